@@ -0,0 +1,140 @@
+package ckit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormats are the supported access log formats.
+var AccessLogFormats = []string{"common", "combined", "json"}
+
+// accessLogTimeFormat is the Apache log timestamp format.
+const accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog wraps a handler and writes a line per request to w, in Apache
+// common or combined log format or as JSON. The combined format has the
+// request duration in microseconds appended (like Apache %D), JSON contains
+// the duration in seconds.
+func AccessLog(w io.Writer, h http.Handler, format string) (http.Handler, error) {
+	if !SliceContains(AccessLogFormats, format) {
+		return nil, fmt.Errorf("invalid access log format: %s %v", format, AccessLogFormats)
+	}
+	var mu sync.Mutex
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var (
+			started = time.Now()
+			lw      = &loggingResponseWriter{ResponseWriter: rw}
+			uri     = r.RequestURI
+		)
+		if uri == "" {
+			uri = r.URL.RequestURI()
+		}
+		h.ServeHTTP(lw, r)
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+		var (
+			entry = accessLogEntry{
+				Host:      remoteHost(r),
+				User:      "-",
+				Time:      started,
+				Method:    r.Method,
+				URI:       uri,
+				Proto:     r.Proto,
+				Status:    lw.status,
+				Size:      lw.size,
+				Referer:   r.Referer(),
+				UserAgent: r.UserAgent(),
+				Took:      time.Since(started).Seconds(),
+			}
+			line []byte
+		)
+		if r.URL.User != nil && r.URL.User.Username() != "" {
+			entry.User = r.URL.User.Username()
+		}
+		switch format {
+		case "json":
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return
+			}
+			line = append(b, '\n')
+		case "combined":
+			line = []byte(fmt.Sprintf("%s %q %q %d\n", entry.common(), entry.Referer, entry.UserAgent,
+				time.Since(started).Microseconds()))
+		default:
+			line = []byte(entry.common() + "\n")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(line)
+	}), nil
+}
+
+// accessLogEntry contains the logged fields of a request.
+type accessLogEntry struct {
+	Host      string    `json:"host"`
+	User      string    `json:"user"`
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Size      int64     `json:"size"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Took      float64   `json:"took"` // seconds
+}
+
+// common returns the entry in common log format.
+func (e accessLogEntry) common() string {
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		e.Host, e.User, e.Time.Format(accessLogTimeFormat), e.Method,
+		strings.ReplaceAll(e.URI, `"`, "%22"), e.Proto, e.Status, strconv.FormatInt(e.Size, 10))
+}
+
+// remoteHost returns the host part of the remote address.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loggingResponseWriter records status code and response size.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *loggingResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *loggingResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, if the wrapped writer does.
+func (w *loggingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,54 @@
+package ckit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hello"))
+	})
+	var cases = []struct {
+		format  string
+		pattern string
+	}{
+		{"common", `^192\.0\.2\.1 - - \[[^\]]+\] "GET /id/1\?a=b HTTP/1\.1" 418 5\n$`},
+		{"combined", `^192\.0\.2\.1 - - \[[^\]]+\] "GET /id/1\?a=b HTTP/1\.1" 418 5 "http://x" "test" [0-9]+\n$`},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		lh, err := AccessLog(&buf, h, c.format)
+		if err != nil {
+			t.Fatalf("access log: %v", err)
+		}
+		req := httptest.NewRequest("GET", "/id/1?a=b", nil)
+		req.Header.Set("Referer", "http://x")
+		req.Header.Set("User-Agent", "test")
+		lh.ServeHTTP(httptest.NewRecorder(), req)
+		if !regexp.MustCompile(c.pattern).MatchString(buf.String()) {
+			t.Fatalf("[%s] got %q", c.format, buf.String())
+		}
+	}
+	var buf bytes.Buffer
+	lh, err := AccessLog(&buf, h, "json")
+	if err != nil {
+		t.Fatalf("access log: %v", err)
+	}
+	lh.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/id/1", nil))
+	var entry accessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if entry.Status != 418 || entry.Size != 5 || entry.URI != "/id/1" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	if _, err := AccessLog(&buf, h, "xml"); err == nil {
+		t.Fatalf("expected error for invalid format")
+	}
+}
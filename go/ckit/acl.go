@@ -0,0 +1,101 @@
+package ckit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NetworkACL restricts access to clients from a list of networks. Behind a
+// reverse proxy, the client address is taken from the X-Forwarded-For
+// header, if the request comes from one of the TrustedProxies.
+type NetworkACL struct {
+	Allow          []*net.IPNet
+	TrustedProxies []*net.IPNet
+}
+
+// ParseNetworks parses a comma separated list of networks in CIDR notation,
+// e.g. "10.0.0.0/8,2001:db8::/32"; single addresses are allowed as well.
+func ParseNetworks(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network: %s", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %s", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Allowed returns true, if the client of a request is in one of the allowed
+// networks; a nil ACL allows all clients.
+func (a *NetworkACL) Allowed(r *http.Request) bool {
+	if a == nil {
+		return true
+	}
+	ip := clientIP(r, a.TrustedProxies)
+	return ip != nil && containsIP(a.Allow, ip)
+}
+
+// withNetworkACL rejects requests from clients not allowed by the ACL with
+// status 403.
+func withNetworkACL(acl *NetworkACL, h http.HandlerFunc) http.HandlerFunc {
+	if acl == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !acl.Allowed(r) {
+			httpErrLog(w, http.StatusForbidden, fmt.Errorf("client not allowed: %s", r.RemoteAddr))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// clientIP returns the address of the client; for requests from trusted
+// proxies, the rightmost untrusted address in X-Forwarded-For is used.
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	ip := net.ParseIP(remoteHost(r))
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if ip == nil || len(forwarded) == 0 || !containsIP(trusted, ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		v := net.ParseIP(strings.TrimSpace(hops[i]))
+		if v == nil {
+			return nil
+		}
+		if ip = v; !containsIP(trusted, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// containsIP returns true, if any of the networks contains the address.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
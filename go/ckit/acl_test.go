@@ -0,0 +1,93 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseNetworks(t *testing.T) {
+	var cases = []struct {
+		s   string
+		n   int
+		err bool
+	}{
+		{"", 0, false},
+		{"10.0.0.0/8", 1, false},
+		{"10.0.0.0/8, 127.0.0.1,::1,2001:db8::/32", 4, false},
+		{"10.0.0.0/33", 0, true},
+		{"localhost", 0, true},
+	}
+	for _, c := range cases {
+		nets, err := ParseNetworks(c.s)
+		if (err != nil) != c.err || len(nets) != c.n {
+			t.Fatalf("[%s] got %v, %v, want %d networks, error %v", c.s, nets, err, c.n, c.err)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseNetworks("127.0.0.1,10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var cases = []struct {
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"127.0.0.1:1234", "", "127.0.0.1"},
+		{"127.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"127.0.0.1:1234", "203.0.113.9, 198.51.100.1, 10.1.2.3", "198.51.100.1"},
+		{"127.0.0.1:1234", "10.1.2.3", "10.1.2.3"},
+		{"127.0.0.1:1234", "junk", "<nil>"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if got := clientIP(r, trusted).String(); got != c.want {
+			t.Fatalf("[%s %s] got %s, want %s", c.remote, c.forwarded, got, c.want)
+		}
+	}
+}
+
+func TestServerNetworkACL(t *testing.T) {
+	allow, err := ParseNetworks("192.0.2.0/24,127.0.0.1")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	admin, err := ParseNetworks("127.0.0.1")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.AllowedNetworks = &NetworkACL{Allow: allow}
+	srv.AdminAllowedNetworks = &NetworkACL{Allow: admin}
+	srv.Router = mux.NewRouter()
+	srv.Routes()
+	var cases = []struct {
+		remote string
+		target string
+		status int
+	}{
+		{"192.0.2.1:1234", "/id/i0029", 200},
+		{"198.51.100.1:1234", "/id/i0029", 403},
+		{"192.0.2.1:1234", "/stats", 403},
+		{"127.0.0.1:1234", "/stats", 200},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.target, nil)
+		r.RemoteAddr = c.remote
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, r)
+		if rr.Code != c.status {
+			t.Fatalf("[%s %s] got %d, want %d", c.remote, c.target, rr.Code, c.status)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ckit
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd, after
+// stdin, stdout and stderr.
+const listenFDsStart = 3
+
+// ActivatedListener is a listening socket passed by the service manager,
+// with the name given in the socket unit (FileDescriptorName=), or "unknown",
+// if it has none.
+type ActivatedListener struct {
+	Name string
+	net.Listener
+}
+
+// ActivationListeners returns the listening sockets passed by systemd socket
+// activation (see sd_listen_fds(3)), in the order of the socket unit, or
+// nil, if the process has not been socket activated. The environment
+// variables are unset, so child processes do not take over the sockets. As
+// systemd keeps the sockets open, the server can be restarted (e.g. after a
+// dataset update) without refusing connections; they are queued meanwhile.
+func ActivationListeners() ([]ActivatedListener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	return activationListeners(os.Getenv, os.Getpid(), listenFDsStart)
+}
+
+// activationListeners turns the file descriptors announced in the
+// environment, starting at start, into listeners.
+func activationListeners(getenv func(string) string, pid, start int) ([]ActivatedListener, error) {
+	if getenv("LISTEN_PID") == "" || getenv("LISTEN_FDS") == "" {
+		return nil, nil
+	}
+	listenPID, err := strconv.Atoi(getenv("LISTEN_PID"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_PID: %w", err)
+	}
+	if listenPID != pid {
+		// Meant for another process, e.g. our parent.
+		return nil, nil
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %s", getenv("LISTEN_FDS"))
+	}
+	var names []string
+	if v := getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+	var result []ActivatedListener
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(start+i), name)
+		// FileListener duplicates the descriptor (close-on-exec), so the
+		// original is not needed any more.
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, al := range result {
+				al.Close()
+			}
+			return nil, fmt.Errorf("socket %d (%s): %w", start+i, name, err)
+		}
+		result = append(result, ActivatedListener{Name: name, Listener: l})
+	}
+	return result, nil
+}
+
+// PickListener returns the activated listener with a given name and removes
+// it from the list; if none has the name, the first unnamed listener is
+// taken, if unnamed is true. Returns nil, if there is no such listener.
+func PickListener(ls *[]ActivatedListener, name string, unnamed bool) net.Listener {
+	for _, match := range []func(ActivatedListener) bool{
+		func(al ActivatedListener) bool { return al.Name == name },
+		func(al ActivatedListener) bool { return unnamed && al.Name == "unknown" },
+	} {
+		for i, al := range *ls {
+			if match(al) {
+				*ls = append((*ls)[:i], (*ls)[i+1:]...)
+				return al.Listener
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+//go:build unix
+
+package ckit
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestActivationListeners(t *testing.T) {
+	// Pass two listening sockets, with consecutive file descriptors, which
+	// are not owned by an *os.File; activationListeners closes them.
+	var fds, other []int
+	for len(fds) < 2 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		f, err := l.(*net.TCPListener).File()
+		l.Close()
+		if err != nil {
+			t.Fatalf("file: %v", err)
+		}
+		fd, err := syscall.Dup(int(f.Fd()))
+		f.Close()
+		if err != nil {
+			t.Fatalf("dup: %v", err)
+		}
+		switch {
+		case len(fds) == 0 || fd == fds[0]+1:
+			fds = append(fds, fd)
+		default:
+			other = append(other, fds[0])
+			fds = []int{fd}
+		}
+	}
+	for _, fd := range other {
+		syscall.Close(fd)
+	}
+	env := map[string]string{
+		"LISTEN_PID":     "100",
+		"LISTEN_FDS":     "2",
+		"LISTEN_FDNAMES": ":admin",
+	}
+	getenv := func(k string) string { return env[k] }
+	if ls, err := activationListeners(getenv, 200, fds[0]); err != nil || ls != nil {
+		t.Fatalf("got %v, %v, want nothing for other process", ls, err)
+	}
+	ls, err := activationListeners(getenv, 100, fds[0])
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(ls) != 2 || ls[0].Name != "unknown" || ls[1].Name != "admin" {
+		t.Fatalf("got %v, want unknown and admin", ls)
+	}
+	if l := PickListener(&ls, "grpc", false); l != nil {
+		t.Fatalf("got %v, want no grpc listener", l)
+	}
+	if l := PickListener(&ls, "admin", false); l == nil || len(ls) != 1 {
+		t.Fatalf("got %v, want admin listener", l)
+	}
+	l := PickListener(&ls, "http", true)
+	if l == nil || len(ls) != 0 {
+		t.Fatalf("got %v, want unnamed listener for http", l)
+	}
+	l.Close()
+	env["LISTEN_FDS"] = "x"
+	if _, err := activationListeners(getenv, 100, fds[0]); err == nil {
+		t.Fatalf("got nil, want error for invalid LISTEN_FDS")
+	}
+}
@@ -0,0 +1,115 @@
+package ckit
+
+import (
+	"hash/maphash"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sketchDepth is the number of rows of the count-min sketch.
+	sketchDepth = 4
+	// sketchWidth is the number of counters per row; a power of two.
+	sketchWidth = 1 << 16
+	// sketchResetFactor times sketchWidth requests halve all counters.
+	sketchResetFactor = 10
+)
+
+// CacheAdmission decides, which responses are worth caching, in addition to
+// the trigger duration (CacheTriggerDuration): a single threshold lets cheap,
+// but huge responses crowd out many expensive small ones. The score of a
+// response is the time it took to compute, times the number of recent
+// requests for the identifier, per megabyte of compressed size, i.e. seconds
+// saved per megabyte of cache; responses below MinScore are not cached.
+//
+// Request frequencies are estimated with a count-min sketch (like in
+// TinyLFU), which takes constant memory; all counts are halved periodically,
+// so past popularity fades. The zero value is not usable, use
+// NewCacheAdmission.
+type CacheAdmission struct {
+	// MinScore is the minimum seconds saved per megabyte, e.g. 1.0 admits a
+	// response of 1MB, which took one second and has been requested once.
+	MinScore float64
+
+	seed      maphash.Seed
+	mu        sync.Mutex
+	rows      [sketchDepth][]uint8
+	additions int
+}
+
+// NewCacheAdmission creates an admission policy with a given minimum score.
+func NewCacheAdmission(minScore float64) *CacheAdmission {
+	a := &CacheAdmission{MinScore: minScore, seed: maphash.MakeSeed()}
+	for i := range a.rows {
+		a.rows[i] = make([]uint8, sketchWidth)
+	}
+	return a
+}
+
+// indexes returns the counter positions of a key, one per row, using double
+// hashing. Cache variants count as their identifier.
+func (a *CacheAdmission) indexes(key string) (result [sketchDepth]int) {
+	key, _, _ = strings.Cut(key, cacheVariantSep)
+	var (
+		sum    = maphash.String(a.seed, key)
+		h1, h2 = uint32(sum), uint32(sum>>32) | 1
+	)
+	for i := range result {
+		result[i] = int((h1 + uint32(i)*h2) & (sketchWidth - 1))
+	}
+	return result
+}
+
+// Record counts a request for a key.
+func (a *CacheAdmission) Record(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, j := range a.indexes(key) {
+		if a.rows[i][j] < 255 {
+			a.rows[i][j]++
+		}
+	}
+	a.additions++
+	if a.additions >= sketchResetFactor*sketchWidth {
+		for i := range a.rows {
+			for j := range a.rows[i] {
+				a.rows[i][j] /= 2
+			}
+		}
+		a.additions /= 2
+	}
+}
+
+// Frequency returns the estimated number of recent requests for a key; the
+// estimate may be too high, but not too low (except for the halving).
+func (a *CacheAdmission) Frequency(key string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	min := 255
+	for i, j := range a.indexes(key) {
+		if v := int(a.rows[i][j]); v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Score returns the seconds saved per megabyte of cache for a response of a
+// given compressed size in bytes, which took a given time to compute.
+func (a *CacheAdmission) Score(key string, size int, took time.Duration) float64 {
+	freq := a.Frequency(key)
+	if freq < 1 {
+		freq = 1 // the current request, if it has not been recorded
+	}
+	mb := float64(size) / (1 << 20)
+	if mb <= 0 {
+		mb = 1.0 / (1 << 20)
+	}
+	return took.Seconds() * float64(freq) / mb
+}
+
+// Admit returns true, if a response should be cached.
+func (a *CacheAdmission) Admit(key string, size int, took time.Duration) bool {
+	return a.Score(key, size, took) >= a.MinScore
+}
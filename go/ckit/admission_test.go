@@ -0,0 +1,90 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestCacheAdmission(t *testing.T) {
+	a := NewCacheAdmission(1.0)
+	for i := 0; i < 3; i++ {
+		a.Record("ai-49-a")
+	}
+	a.Record("ai-49-b")
+	if f := a.Frequency("ai-49-a"); f != 3 {
+		t.Fatalf("got %d, want 3", f)
+	}
+	// Variants count as their identifier.
+	if f := a.Frequency("ai-49-a" + cacheVariantSep + "DE-14"); f != 3 {
+		t.Fatalf("got %d, want 3 for variant", f)
+	}
+	if f := a.Frequency("x"); f != 0 {
+		t.Fatalf("got %d, want 0", f)
+	}
+	var cases = []struct {
+		about string
+		key   string
+		size  int
+		took  time.Duration
+		admit bool
+	}{
+		{"small and expensive", "ai-49-b", 50 << 10, 300 * time.Millisecond, true},
+		{"huge and cheap", "ai-49-b", 20 << 20, 600 * time.Millisecond, false},
+		{"huge, cheap and popular", "ai-49-a", 2 << 20, 700 * time.Millisecond, true},
+		{"not requested before", "x", 2 << 20, time.Second, false},
+		{"empty", "x", 0, time.Millisecond, true},
+	}
+	for _, c := range cases {
+		if got := a.Admit(c.key, c.size, c.took); got != c.admit {
+			t.Fatalf("[%s] got %v (%0.2f), want %v", c.about, got, a.Score(c.key, c.size, c.took), c.admit)
+		}
+	}
+	// Counts are halved periodically.
+	for i := 0; i < sketchResetFactor*sketchWidth; i++ {
+		a.Record("other")
+	}
+	if f := a.Frequency("ai-49-a"); f != 1 {
+		t.Fatalf("got %d, want halved frequency", f)
+	}
+	if f := a.Frequency("other"); f >= 255 {
+		t.Fatalf("got %d, want halved, saturated frequency", f)
+	}
+}
+
+func TestServerCacheAdmission(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	srv.CacheAdmission = NewCacheAdmission(1e12)
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+		if rr.Code != 200 || rr.Header().Get("X-Cache") == "HIT" {
+			t.Fatalf("got %d, %s, want uncached response", rr.Code, rr.Header().Get("X-Cache"))
+		}
+	}
+	if resp := mustRequest(t, srv, "/id/i0029"); resp.Extra.Cached {
+		t.Fatalf("got cached flag, want response not cached")
+	}
+	st, err := srv.CacheStats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if st.AdmissionRejects != 3 || st.Writes != 0 {
+		t.Fatalf("got %+v, want 3 admission rejects", st)
+	}
+	// A low score admits the response.
+	srv.CacheAdmission.MinScore = 0
+	mustRequest(t, srv, "/id/i0029")
+	if resp := mustRequest(t, srv, "/id/i0029"); !resp.Extra.Cached {
+		t.Fatalf("got no cached flag, want cached response")
+	}
+}
@@ -0,0 +1,297 @@
+package ckit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AuditRecord describes a single query, e.g. for usage reporting. Citing,
+// cited and unmatched are the number of documents in the response.
+type AuditRecord struct {
+	Time        time.Time `json:"time" db:"time"`
+	Client      string    `json:"client" db:"client"`
+	Tenant      string    `json:"tenant,omitempty" db:"tenant"`
+	ID          string    `json:"id" db:"id"`
+	DOI         string    `json:"doi,omitempty" db:"doi"`
+	Institution string    `json:"isil,omitempty" db:"isil"`
+	Status      int       `json:"status" db:"status"`
+	Citing      int       `json:"citing" db:"citing"`
+	Cited       int       `json:"cited" db:"cited"`
+	Unmatched   int       `json:"unmatched" db:"unmatched"`
+	Cache       string    `json:"cache" db:"cache"` // hit, miss or off
+	Took        float64   `json:"took" db:"took"`   // seconds
+}
+
+// setCounts sets the document counts from a response.
+func (rec *AuditRecord) setCounts(resp *Response) {
+	if rec == nil {
+		return
+	}
+	rec.DOI = resp.DOI
+	rec.Citing, rec.Cited = resp.Extra.CitingCount, resp.Extra.CitedCount
+	rec.Unmatched = resp.Extra.UnmatchedCitingCount + resp.Extra.UnmatchedCitedCount
+}
+
+// AuditOptions configure the rotation of an audit log. Files are rotated,
+// when they exceed MaxSize bytes; the current file is renamed with a
+// timestamp suffix. Sqlite3 audit logs keep records for MaxAge. Zero values
+// disable rotation.
+type AuditOptions struct {
+	MaxSize int64
+	MaxAge  time.Duration
+}
+
+// AuditLog records queries to an append-only file (one JSON object per
+// line) or to an sqlite3 table. Records are written in the background, in
+// batches; if the writer falls behind, records are dropped (and counted),
+// so the log never slows down requests.
+type AuditLog struct {
+	sink    auditSink
+	ch      chan *AuditRecord
+	done    chan struct{}
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+// auditSink writes batches of audit records.
+type auditSink interface {
+	write(recs []*AuditRecord) error
+	close() error
+}
+
+// OpenAuditLog opens an audit log for appending; a filename ending in .db
+// or .sqlite is used as sqlite3 database, any other as JSON lines file.
+func OpenAuditLog(filename string, opts AuditOptions) (*AuditLog, error) {
+	var (
+		sink auditSink
+		err  error
+	)
+	if strings.HasSuffix(filename, ".db") || strings.HasSuffix(filename, ".sqlite") {
+		sink, err = openAuditDatabase(filename, opts.MaxAge)
+	} else {
+		sink, err = openAuditFile(filename, opts.MaxSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	a := &AuditLog{
+		sink: sink,
+		ch:   make(chan *AuditRecord, 4096),
+		done: make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// Record queues a record for writing; a nil audit log does nothing.
+func (a *AuditLog) Record(rec *AuditRecord) {
+	if a == nil {
+		return
+	}
+	select {
+	case a.ch <- rec:
+	default:
+		if n := a.dropped.Add(1); n%1000 == 1 {
+			log.Printf("audit log: writer too slow, %d records dropped", n)
+		}
+	}
+}
+
+// Dropped returns the number of records dropped so far.
+func (a *AuditLog) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Close writes pending records and closes the log. No records must be
+// recorded after Close.
+func (a *AuditLog) Close() error {
+	a.once.Do(func() { close(a.ch) })
+	<-a.done
+	return a.sink.close()
+}
+
+// run writes records in batches, until the log is closed.
+func (a *AuditLog) run() {
+	defer close(a.done)
+	var batch []*AuditRecord
+	for rec := range a.ch {
+		batch = append(batch[:0], rec)
+	drain:
+		for len(batch) < 1000 {
+			select {
+			case rec, ok := <-a.ch:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, rec)
+			default:
+				break drain
+			}
+		}
+		if err := a.sink.write(batch); err != nil {
+			log.Printf("audit log: %v", err)
+		}
+	}
+}
+
+// auditFile is an audit log file, rotated by size.
+type auditFile struct {
+	filename string
+	maxSize  int64
+	f        *os.File
+	size     int64
+}
+
+func openAuditFile(filename string, maxSize int64) (*auditFile, error) {
+	a := &auditFile{filename: filename, maxSize: maxSize}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *auditFile) open() error {
+	f, err := os.OpenFile(a.filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.f, a.size = f, fi.Size()
+	return nil
+}
+
+// rotate renames the current file, e.g. to audit.log.20220301-120000, and
+// starts a new one.
+func (a *auditFile) rotate() error {
+	if err := a.f.Close(); err != nil {
+		return err
+	}
+	rotated := a.filename + "." + time.Now().Format("20060102-150405")
+	if _, err := os.Stat(rotated); err == nil {
+		rotated = fmt.Sprintf("%s.%d", rotated, time.Now().UnixNano())
+	}
+	if err := os.Rename(a.filename, rotated); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+func (a *auditFile) write(recs []*AuditRecord) error {
+	bw := bufio.NewWriter(a.f)
+	for _, rec := range recs {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if a.maxSize > 0 && a.size > 0 && a.size+int64(len(b))+1 > a.maxSize {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			if err := a.rotate(); err != nil {
+				return err
+			}
+			bw.Reset(a.f)
+		}
+		bw.Write(b)
+		bw.WriteByte('\n')
+		a.size += int64(len(b)) + 1
+	}
+	return bw.Flush()
+}
+
+func (a *auditFile) close() error {
+	return a.f.Close()
+}
+
+// auditDatabase is an sqlite3 audit log table; records older than maxAge
+// are deleted about once an hour.
+type auditDatabase struct {
+	db      *sqlx.DB
+	maxAge  time.Duration
+	expired time.Time // last deletion of old records
+}
+
+func openAuditDatabase(filename string, maxAge time.Duration) (*auditDatabase, error) {
+	db, err := sqlx.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	const s = `
+	CREATE TABLE IF NOT EXISTS audit (
+		time TEXT NOT NULL,
+		client TEXT,
+		tenant TEXT,
+		id TEXT,
+		doi TEXT,
+		isil TEXT,
+		status INTEGER,
+		citing INTEGER,
+		cited INTEGER,
+		unmatched INTEGER,
+		cache TEXT,
+		took REAL
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_time ON audit(time);
+	PRAGMA journal_mode = WAL;
+	`
+	if _, err := db.Exec(s); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &auditDatabase{db: db, maxAge: maxAge}, nil
+}
+
+func (a *auditDatabase) write(recs []*AuditRecord) error {
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	const q = `INSERT INTO audit (time, client, tenant, id, doi, isil, status, citing, cited, unmatched, cache, took)
+		VALUES (:time, :client, :tenant, :id, :doi, :isil, :status, :citing, :cited, :unmatched, :cache, :took)`
+	stmt, err := tx.PrepareNamed(q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, rec := range recs {
+		if _, err := stmt.Exec(auditRow{rec, rec.Time.UTC().Format(auditTimeFormat)}); err != nil {
+			return err
+		}
+	}
+	if a.maxAge > 0 && time.Since(a.expired) > time.Hour {
+		cutoff := time.Now().Add(-a.maxAge).UTC().Format(auditTimeFormat)
+		if _, err := tx.Exec(`DELETE FROM audit WHERE time < ?`, cutoff); err != nil {
+			return err
+		}
+		a.expired = time.Now()
+	}
+	return tx.Commit()
+}
+
+func (a *auditDatabase) close() error {
+	return a.db.Close()
+}
+
+// auditTimeFormat is a fixed width, sortable timestamp format.
+const auditTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// auditRow stores the time as sortable text in UTC.
+type auditRow struct {
+	*AuditRecord
+	Time string `db:"time"`
+}
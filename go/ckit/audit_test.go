@@ -0,0 +1,109 @@
+package ckit
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestServerAuditLog(t *testing.T) {
+	for _, name := range []string{"audit.log", "audit.db"} {
+		var (
+			dir      = t.TempDir()
+			filename = filepath.Join(dir, name)
+		)
+		a, err := OpenAuditLog(filename, AuditOptions{})
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		c, err := cache.New(filepath.Join(dir, "cache.db"))
+		if err != nil {
+			t.Fatalf("cache: %v", err)
+		}
+		defer c.Close()
+		srv := newTestServer(t)
+		srv.AuditLog = a
+		srv.Cache = c
+		for _, target := range []string{"/id/i0029", "/id/i0029", "/id/i0029?i=DE-1", "/id/x"} {
+			srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+		}
+		if err := a.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		var recs []AuditRecord
+		switch name {
+		case "audit.db":
+			db, err := sqlx.Open("sqlite3", filename)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer db.Close()
+			if err := db.Select(&recs, `SELECT client, tenant, id, doi, isil, status, citing, cited,
+				unmatched, cache, took FROM audit ORDER BY time`); err != nil {
+				t.Fatalf("select: %v", err)
+			}
+		default:
+			f, err := os.Open(filename)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var rec AuditRecord
+				if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				recs = append(recs, rec)
+			}
+		}
+		var want = []AuditRecord{
+			{ID: "i0029", DOI: "d0029", Status: 200, Citing: 12, Cited: 4, Cache: "miss"},
+			{ID: "i0029", DOI: "d0029", Status: 200, Citing: 12, Cited: 4, Cache: "hit"},
+			{ID: "i0029", DOI: "d0029", Institution: "DE-1", Status: 200, Citing: 8, Cited: 4, Cache: "hit"},
+			{ID: "x", Status: 404, Cache: "miss"},
+		}
+		if len(recs) != len(want) {
+			t.Fatalf("[%s] got %d records, want %d", name, len(recs), len(want))
+		}
+		for i, rec := range recs {
+			w := want[i]
+			if rec.ID != w.ID || rec.DOI != w.DOI || rec.Institution != w.Institution ||
+				rec.Status != w.Status || rec.Citing != w.Citing || rec.Cited != w.Cited ||
+				rec.Cache != w.Cache || rec.Client != "192.0.2.1" {
+				t.Fatalf("[%s] %d: got %+v, want %+v", name, i, rec, w)
+			}
+		}
+	}
+}
+
+func TestAuditFileRotate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	f, err := openAuditFile(filename, 200)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := f.write([]*AuditRecord{{ID: "i0029", Status: 200}, {ID: "i0030", Status: 200}}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := f.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	matches, err := filepath.Glob(filename + "*")
+	if err != nil || len(matches) < 3 {
+		t.Fatalf("got %v, %v, want rotated files", matches, err)
+	}
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err != nil || fi.Size() > 200 {
+			t.Fatalf("got %v, %v, want at most 200 bytes", fi.Size(), err)
+		}
+	}
+}
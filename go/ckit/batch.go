@@ -0,0 +1,184 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// maxBatchDOIs is the maximum number of DOI in a single batch request for
+// fused responses; counts are limited by maxMapKeys only, as they are cheap.
+const maxBatchDOIs = 1000
+
+// BatchResponse is the result of a batch DOI request, with one result per
+// requested DOI, in request order.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+	Extra   struct {
+		Count          int     `json:"count"`
+		MappedCount    int     `json:"mapped_count"`
+		UnmatchedCount int     `json:"unmatched_count"`
+		Took           float64 `json:"took"`
+	} `json:"extra"`
+}
+
+// BatchResult is the result for a single DOI: its local identifier and
+// either the fused response, as returned by "/id/{id}", or the counts. The
+// status is the HTTP status of the fused response; a DOI without a local
+// identifier has status 404 (but counts, if requested).
+type BatchResult struct {
+	DOI      string          `json:"doi"`
+	ID       string          `json:"id,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Counts   *Counts         `json:"counts,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// handleBatchDOI returns fused responses (or, with counts=1, counts) for a
+// list of DOI, posted like for "/map/doi", so batch jobs working with DOI do
+// not need to resolve each DOI and follow a redirect. Responses are assembled
+// by the same handler as "/id/{id}" with the remaining query parameters,
+// e.g. "i" or "sort", in parallel.
+func (s *Server) handleBatchDOI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			started = time.Now()
+			query   = r.URL.Query()
+			counts  bool
+		)
+		switch query.Get("counts") {
+		case "1", "true":
+			counts = true
+		}
+		query.Del("counts")
+		query.Del("format")
+		query.Del("v")
+		dois, err := readMappingKeys(r)
+		if err != nil {
+			httpErrLogf(w, http.StatusBadRequest, "batch: %w", err)
+			return
+		}
+		if !counts && len(dois) > maxBatchDOIs {
+			httpErrLogf(w, http.StatusBadRequest, "batch: too many values: %d, limit is %d",
+				len(dois), maxBatchDOIs)
+			return
+		}
+		mapping, err := s.mapKeys(r.Context(), "doi", dois)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(r.Context(), "lookup",
+				s.LookupTimeout, fmt.Sprintf("mapping %d values", len(dois))))
+			return
+		case err != nil:
+			httpErrLogf(w, http.StatusInternalServerError, "batch: %w", err)
+			return
+		}
+		resp := &BatchResponse{Results: make([]BatchResult, len(dois))}
+		for i, doi := range dois {
+			resp.Results[i] = BatchResult{DOI: doi, Status: http.StatusNotFound}
+			if ids := mapping.Mapped[doi]; len(ids) > 0 {
+				// A DOI may belong to more than one record; we take the
+				// smallest identifier, so results do not change between
+				// requests.
+				sort.Strings(ids)
+				resp.Results[i].ID = ids[0]
+				resp.Results[i].Status = http.StatusOK
+			}
+		}
+		if counts {
+			err = s.batchCounts(r.Context(), resp.Results)
+		} else {
+			err = s.batchResponses(r, query, resp.Results)
+		}
+		if err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "batch: %w", err)
+			return
+		}
+		resp.Extra.Count = len(dois)
+		resp.Extra.MappedCount = mapping.Extra.MappedCount
+		resp.Extra.UnmatchedCount = mapping.Extra.UnmatchedCount
+		resp.Extra.Took = time.Since(started).Seconds()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+		}
+	}
+}
+
+// batchCounts adds the counts for each DOI, also for DOI without a local
+// identifier.
+func (s *Server) batchCounts(ctx context.Context, results []BatchResult) error {
+	for i := range results {
+		c, err := s.counts(ctx, results[i].DOI)
+		if err != nil {
+			return fmt.Errorf("counts for %s: %w", results[i].DOI, err)
+		}
+		results[i].Counts = c
+	}
+	return nil
+}
+
+// batchResponses runs a request for each local identifier through the
+// router, in parallel. The batch request has been checked (network, tenant)
+// already, so requests go to the router directly; failed requests are
+// reported per result.
+func (s *Server) batchResponses(r *http.Request, query url.Values, results []BatchResult) error {
+	var (
+		ctx      = r.Context()
+		rawQuery = query.Encode()
+		sem      = make(chan struct{}, runtime.NumCPU())
+		done     = make(chan struct{})
+		n        int
+	)
+	for i := range results {
+		if results[i].ID == "" {
+			results[i].Error = "no id found"
+			continue
+		}
+		n++
+		go func(result *BatchResult) {
+			defer func() { done <- struct{}{} }()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			req := r.Clone(ctx)
+			req.Method = "GET"
+			req.Body = http.NoBody
+			req.ContentLength = 0
+			req.URL = localIdentifierURL(result.ID, rawQuery)
+			req.RequestURI = req.URL.RequestURI()
+			req.Header.Set("Accept", "application/json")
+			req.Header.Del("Accept-Encoding")
+			req.Header.Del("Content-Type")
+			rr := httptest.NewRecorder()
+			s.Router.ServeHTTP(rr, req)
+			result.Status = rr.Code
+			if rr.Code == http.StatusOK {
+				result.Response = json.RawMessage(bytes.TrimSpace(rr.Body.Bytes()))
+			} else {
+				result.Error = strings.TrimSpace(rr.Body.String())
+			}
+		}(&results[i])
+	}
+	for i := 0; i < n; i++ {
+		<-done
+	}
+	return ctx.Err()
+}
+
+// localIdentifierURL returns the URL of the fused response for a local
+// identifier, for requests through the router, with the identifier escaped
+// like in a link, e.g. for identifiers with spaces or slashes.
+func localIdentifierURL(id, rawQuery string) *url.URL {
+	return &url.URL{Path: "/id/" + id, RawPath: "/id/" + url.PathEscape(id), RawQuery: rawQuery}
+}
@@ -0,0 +1,79 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestHandleBatchDOI(t *testing.T) {
+	srv := newTestServer(t)
+	batch := func(target, body string) *BatchResponse {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("POST", target, strings.NewReader(body)))
+		if rr.Code != 200 {
+			t.Fatalf("%s: got status %d, want 200: %s", target, rr.Code, rr.Body.String())
+		}
+		var resp BatchResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode: %v", target, err)
+		}
+		return &resp
+	}
+	resp := batch("/dois?sort=year", `["d0029", "x", "d0029"]`)
+	if len(resp.Results) != 2 || resp.Extra.MappedCount != 1 || resp.Extra.UnmatchedCount != 1 {
+		t.Fatalf("got %+v, want two results, one mapped", resp)
+	}
+	if r := resp.Results[1]; r.DOI != "x" || r.ID != "" || r.Status != 404 || r.Response != nil {
+		t.Fatalf("got %+v, want 404 for unknown DOI", r)
+	}
+	r := resp.Results[0]
+	if r.DOI != "d0029" || r.ID != "i0029" || r.Status != 200 {
+		t.Fatalf("got %+v, want response for i0029", r)
+	}
+	var got Response
+	if err := json.Unmarshal(r.Response, &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := mustRequest(t, srv, "/id/i0029?sort=year")
+	if got.ID != "i0029" || !reflect.DeepEqual(got.Citing, want.Citing) || !reflect.DeepEqual(got.Cited, want.Cited) {
+		t.Fatalf("got %v, want same documents as /id/i0029", got)
+	}
+	resp = batch("/dois?counts=1", `["d0029", "x"]`)
+	if r := resp.Results[0]; r.Response != nil || !reflect.DeepEqual(r.Counts, &Counts{DOI: "d0029", Citing: 3, Cited: 2}) {
+		t.Fatalf("got %+v, want counts only", r)
+	}
+	if r := resp.Results[1]; r.Counts == nil || r.Counts.Total() != 0 {
+		t.Fatalf("got %+v, want zero counts for unknown DOI", r)
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("POST", "/dois", strings.NewReader(`{}`)))
+	if rr.Code != 400 {
+		t.Fatalf("got status %d, want 400 for invalid body", rr.Code)
+	}
+}
+
+func TestLocalIdentifierURL(t *testing.T) {
+	var cases = []struct {
+		id       string
+		rawQuery string
+		want     string
+	}{
+		{"i0029", "", "/id/i0029"},
+		{"i0029", "sort=year", "/id/i0029?sort=year"},
+		{"a b", "", "/id/a%20b"},
+		{"a/b?c", "i=DE-14", "/id/a%2Fb%3Fc?i=DE-14"},
+	}
+	for _, c := range cases {
+		u := localIdentifierURL(c.id, c.rawQuery)
+		if got := u.RequestURI(); got != c.want {
+			t.Fatalf("[%s] got %s, want %s", c.id, got, c.want)
+		}
+		if u.Path != "/id/"+c.id {
+			t.Fatalf("[%s] got path %s, want unescaped path", c.id, u.Path)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package bloom implements a simple Bloom filter for strings, which can be
+// serialized to and loaded from a file. We use it to answer "does this DOI
+// have any citation edges at all" without touching the (large) citation
+// database; roughly a third of all lookups have no edges.
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+)
+
+var (
+	magic   = [4]byte{'L', 'B', 'F', '2'}
+	magicV1 = [4]byte{'L', 'B', 'F', '1'} // without tag
+
+	ErrInvalidFormat = errors.New("invalid bloom filter format")
+)
+
+// Filter is a Bloom filter, not thread-safe for writes, but concurrent calls
+// to Test are fine.
+type Filter struct {
+	// Tag is an optional label stored with the filter, e.g. to identify the
+	// data it has been built from.
+	Tag string
+
+	bits []uint64
+	m    uint64 // number of bits
+	k    uint64 // number of hash functions
+}
+
+// New creates a filter for about n elements with a given false positive
+// rate p, e.g. 0.01.
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	var (
+		m = uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+		k = uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	)
+	if k < 1 {
+		k = 1
+	}
+	return &Filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// hashes returns two independent hash values for double hashing.
+func hashes(s string) (uint64, uint64) {
+	a, b := fnv.New64a(), fnv.New64()
+	_, _ = io.WriteString(a, s)
+	_, _ = io.WriteString(b, s)
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// Add adds a string to the filter.
+func (f *Filter) Add(s string) {
+	h1, h2 := hashes(s)
+	for i := uint64(0); i < f.k; i++ {
+		j := (h1 + i*h2) % f.m
+		f.bits[j/64] |= 1 << (j % 64)
+	}
+}
+
+// Test returns false, if the string has definitely not been added, true if it
+// probably has.
+func (f *Filter) Test(s string) bool {
+	h1, h2 := hashes(s)
+	for i := uint64(0); i < f.k; i++ {
+		j := (h1 + i*h2) % f.m
+		if f.bits[j/64]&(1<<(j%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SizeBytes returns the size of the bit array in bytes.
+func (f *Filter) SizeBytes() int {
+	return len(f.bits) * 8
+}
+
+// WriteTo serializes the filter.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(magic[:]); err != nil {
+		return 0, err
+	}
+	for _, v := range []uint64{f.m, f.k, uint64(len(f.Tag))} {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := bw.WriteString(f.Tag); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, f.bits); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(4 + 24 + len(f.Tag) + 8*len(f.bits)), nil
+}
+
+// ReadFrom loads a filter serialized with WriteTo; filters written before tags
+// were added are read with an empty tag.
+func ReadFrom(r io.Reader) (*Filter, error) {
+	var (
+		br  = bufio.NewReader(r)
+		hdr [4]byte
+		f   Filter
+	)
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr != magic && hdr != magicV1 {
+		return nil, ErrInvalidFormat
+	}
+	var n uint64 // tag length
+	fields := []*uint64{&f.m, &f.k}
+	if hdr == magic {
+		fields = append(fields, &n)
+	}
+	for _, v := range fields {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	if f.m == 0 || f.k == 0 || n > 1<<16 {
+		return nil, ErrInvalidFormat
+	}
+	if n > 0 {
+		tag := make([]byte, n)
+		if _, err := io.ReadFull(br, tag); err != nil {
+			return nil, err
+		}
+		f.Tag = string(tag)
+	}
+	f.bits = make([]uint64, (f.m+63)/64)
+	if err := binary.Read(br, binary.LittleEndian, f.bits); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,48 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprintf("10.1234/%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.Test(fmt.Sprintf("10.1234/%d", i)) {
+			t.Fatalf("false negative for %d", i)
+		}
+	}
+	var fp int
+	for i := 0; i < 10000; i++ {
+		if f.Test(fmt.Sprintf("10.5678/%d", i)) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Fatalf("too many false positives: %d", fp)
+	}
+	f.Tag = "abc"
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	g, err := ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if !g.Test(fmt.Sprintf("10.1234/%d", i)) {
+			t.Fatalf("false negative after loading for %d", i)
+		}
+	}
+	if g.Tag != "abc" {
+		t.Fatalf("got tag %q, want abc", g.Tag)
+	}
+	if _, err := ReadFrom(bytes.NewReader([]byte("XXXX"))); err != ErrInvalidFormat {
+		t.Fatalf("got %v, want %v", err, ErrInvalidFormat)
+	}
+}
@@ -0,0 +1,75 @@
+package ckit
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker keeps track of consecutive failures of a backend. After
+// Threshold consecutive failures the breaker opens and the backend should be
+// skipped for the Cooldown period. After the cool-down, a single trial
+// request is let through; if it succeeds, the breaker closes again, otherwise
+// it stays open for another cool-down window. A zero Threshold disables the
+// breaker. Thread-safe.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool // a trial request is in flight
+}
+
+// Allow returns true, if a request to the backend should be attempted.
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil || b.Threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.Threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.Cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// Success records a successful request, closing the breaker.
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+// Failure records a failed request and opens the breaker, once the threshold
+// has been reached.
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.Threshold > 0 && b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// IsOpen returns true, if the breaker currently rejects requests.
+func (b *CircuitBreaker) IsOpen() bool {
+	if b == nil || b.Threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.Threshold && time.Since(b.openedAt) < b.Cooldown
+}
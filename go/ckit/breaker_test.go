@@ -0,0 +1,161 @@
+package ckit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond}
+	if !b.Allow() {
+		t.Fatalf("closed breaker should allow requests")
+	}
+	b.Failure()
+	if !b.Allow() {
+		t.Fatalf("breaker should allow requests below threshold")
+	}
+	b.Failure()
+	if b.Allow() {
+		t.Fatalf("open breaker should reject requests")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatalf("breaker should allow a trial request after cool-down")
+	}
+	if b.Allow() {
+		t.Fatalf("breaker should allow only a single trial request")
+	}
+	b.Success()
+	if !b.Allow() {
+		t.Fatalf("breaker should close after successful trial")
+	}
+}
+
+type failingFetcher struct{ calls int }
+
+func (f *failingFetcher) Fetch(id string) ([]byte, error) {
+	f.calls++
+	return nil, errors.New("backend down")
+}
+
+func TestFetchGroupBreaker(t *testing.T) {
+	var (
+		f = &failingFetcher{}
+		g = &FetchGroup{
+			Backends:         []Fetcher{f},
+			BreakerThreshold: 3,
+			BreakerCooldown:  time.Hour,
+		}
+	)
+	for i := 0; i < 10; i++ {
+		if _, err := g.Fetch("a"); err != ErrBackendsFailed {
+			t.Fatalf("got %v, want %v", err, ErrBackendsFailed)
+		}
+	}
+	if f.calls != 3 {
+		t.Fatalf("got %d calls, want 3", f.calls)
+	}
+}
+
+func TestFetchGroupMiss(t *testing.T) {
+	g := &FetchGroup{}
+	if err := g.FromFiles("testdata/id_metadata.db"); err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	if _, err := g.Fetch("xxxx"); err != ErrBlobNotFound {
+		t.Fatalf("got %v, want %v", err, ErrBlobNotFound)
+	}
+}
+
+func TestFetchGroupSkippedBackend(t *testing.T) {
+	var (
+		f = &failingFetcher{}
+		g = &FetchGroup{BreakerThreshold: 1, BreakerCooldown: time.Hour}
+	)
+	if err := g.FromFiles("testdata/id_metadata.db"); err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	g.Backends = append([]Fetcher{f}, g.Backends...)
+	if _, err := g.Fetch("xxxx"); err != ErrBackendsFailed {
+		t.Fatalf("got %v, want %v, while the failing backend is asked", err, ErrBackendsFailed)
+	}
+	// With the breaker open, the failing backend is skipped and a miss of
+	// the other backend is a miss.
+	if _, err := g.Fetch("xxxx"); err != ErrBlobNotFound {
+		t.Fatalf("got %v, want %v", err, ErrBlobNotFound)
+	}
+	if _, err := g.Fetch("i0029"); err != nil {
+		t.Fatalf("got %v, want document from the other backend", err)
+	}
+	if f.calls != 1 {
+		t.Fatalf("got %d calls, want 1", f.calls)
+	}
+}
+
+func TestServerSkipsDocumentsOfFailedBackends(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	srv.IndexData = &FetchGroup{
+		Backends:         []Fetcher{&failingFetcher{}},
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Hour,
+	}
+	// Documents are left out and reported, while the backend fails and
+	// while its breaker is open; such responses are not cached.
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+		if rr.Code != 200 || rr.Header().Get("X-Cache") != "MISS" {
+			t.Fatalf("[%d] got %d, %s, want 200 and no cached value", i, rr.Code, rr.Header().Get("X-Cache"))
+		}
+		var resp Response
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Citing) != 0 || len(resp.Extra.Errors) == 0 {
+			t.Fatalf("[%d] got %d citing, errors %v, want none and errors", i, len(resp.Citing), resp.Extra.Errors)
+		}
+	}
+}
+
+// missingFetcher reports a single identifier as missing.
+type missingFetcher struct {
+	Fetcher
+	missing string
+}
+
+func (f *missingFetcher) Fetch(id string) ([]byte, error) {
+	if id == f.missing {
+		return nil, ErrBlobNotFound
+	}
+	return f.Fetcher.Fetch(id)
+}
+
+func TestServerSkipsMissingDocument(t *testing.T) {
+	srv := newTestServer(t)
+	g := srv.IndexData.(*FetchGroup)
+	g.Backends[0] = &missingFetcher{Fetcher: g.Backends[0], missing: "i0009"}
+	// d0029 cites d0009, d0039 and d0065; the index document of d0009 is
+	// missing and gets skipped, while the request still succeeds.
+	resp := mustRequest(t, srv, "/id/i0029")
+	if resp.Extra.CitingCount == 0 {
+		t.Fatalf("got no citing documents, want some")
+	}
+	for _, doc := range resp.Citing {
+		if strings.Contains(string(doc), `"a":"9"`) {
+			t.Fatalf("got document of missing identifier: %s", doc)
+		}
+	}
+}
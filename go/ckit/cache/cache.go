@@ -34,6 +34,7 @@ package cache
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"sync"
@@ -72,6 +73,9 @@ func New(path string) (*Cache, error) {
 	if err := c.init(); err != nil {
 		return nil, err
 	}
+	if err := c.migrate(); err != nil {
+		return nil, err
+	}
 	c.startSizeWatcher()
 	return c, nil
 }
@@ -106,12 +110,27 @@ PRAGMA journal_mode = OFF;
 PRAGMA synchronous = 0;
 PRAGMA locking_mode = EXCLUSIVE;
 PRAGMA temp_store = MEMORY;
-CREATE TABLE IF NOT EXISTS map (k TEXT, v TEXT);
+CREATE TABLE IF NOT EXISTS map (k TEXT, v TEXT, t INTEGER);
 CREATE INDEX IF NOT EXISTS idx_k ON map(k);
+CREATE TABLE IF NOT EXISTS dict (version INTEGER PRIMARY KEY AUTOINCREMENT, id INTEGER UNIQUE, dict BLOB, created TEXT);
 	`
 	return tabutils.RunScript(c.Path, s, "initialized database")
 }
 
+// migrate adds the write time column to caches created before it existed;
+// older entries have no write time.
+func (c *Cache) migrate() error {
+	var n int
+	if err := c.db.Get(&n, `SELECT count(*) FROM pragma_table_info('map') WHERE name = 't'`); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := c.db.Exec(`ALTER TABLE map ADD COLUMN t INTEGER`)
+	return err
+}
+
 // Close closes the underlying database.
 func (c *Cache) Close() error {
 	return c.db.Close()
@@ -135,6 +154,37 @@ func (c *Cache) ItemCount() (int, error) {
 	return v, nil
 }
 
+// Snapshot writes a consistent copy of the cache to a new file, e.g. for
+// seeding the cache of another server, while the cache is in use; writes
+// wait until the copy is done.
+func (c *Cache) Snapshot(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("snapshot file exists: %s", path)
+	}
+	c.Lock()
+	defer c.Unlock()
+	_, err := c.db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
+// Size returns the number of entries and the total size of the values in
+// bytes; this scans the whole table.
+func (c *Cache) Size() (entries, size int64, err error) {
+	row := c.db.QueryRow(`SELECT count(k), coalesce(sum(length(v)), 0) FROM map`)
+	if err := row.Scan(&entries, &size); err != nil {
+		return 0, 0, err
+	}
+	return entries, size, nil
+}
+
+// ReadOnly returns true, if the cache does not accept new values, because it
+// exceeded its maximum file size.
+func (c *Cache) ReadOnly() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.readOnly
+}
+
 // Set key value pair.
 func (c *Cache) Set(key string, value []byte) error {
 	c.Lock()
@@ -142,11 +192,53 @@ func (c *Cache) Set(key string, value []byte) error {
 	if c.readOnly {
 		return ErrReadOnly
 	}
-	s := `INSERT into map (k, v) VALUES (?, ?)`
-	_, err := c.db.Exec(s, key, value)
+	s := `INSERT into map (k, v, t) VALUES (?, ?, ?)`
+	_, err := c.db.Exec(s, key, value, time.Now().Unix())
 	return err
 }
 
+// Sample returns up to n randomly chosen values.
+func (c *Cache) Sample(n int) ([][]byte, error) {
+	var vs []string
+	if err := c.db.Select(&vs, `SELECT v FROM map ORDER BY random() LIMIT ?`, n); err != nil {
+		return nil, err
+	}
+	result := make([][]byte, len(vs))
+	for i, v := range vs {
+		result[i] = []byte(v)
+	}
+	return result, nil
+}
+
+// Dictionary is a compression dictionary stored with the cache. Dictionaries
+// are never removed (not even by Flush), so values compressed with an older
+// dictionary can still be decompressed.
+type Dictionary struct {
+	Version int    `db:"version"`
+	ID      uint32 `db:"id"`
+	Dict    []byte `db:"dict"`
+	Created string `db:"created"`
+}
+
+// AddDictionary stores a dictionary as the newest version; id identifies
+// the dictionary, adding a dictionary with a known id does nothing.
+func (c *Cache) AddDictionary(id uint32, dict []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	_, err := c.db.Exec(`INSERT OR IGNORE INTO dict (id, dict, created) VALUES (?, ?, ?)`,
+		id, dict, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// Dictionaries returns all stored dictionaries, oldest version first.
+func (c *Cache) Dictionaries() ([]Dictionary, error) {
+	var dicts []Dictionary
+	if err := c.db.Select(&dicts, `SELECT version, id, dict, created FROM dict ORDER BY version`); err != nil {
+		return nil, err
+	}
+	return dicts, nil
+}
+
 // Get value for a key.
 func (c *Cache) Get(key string) ([]byte, error) {
 	var (
@@ -165,3 +257,49 @@ func (c *Cache) Get(key string) ([]byte, error) {
 	// TODO: can we read into a byte slice directly?
 	return []byte(v), nil
 }
+
+// Entry describes a cached value, without the value itself.
+type Entry struct {
+	Key  string `db:"k"`
+	Size int64  `db:"size"` // in bytes, as stored
+	// Written is the time the value was stored, as unix timestamp; zero,
+	// if the value has been stored by a version without write times.
+	Written int64 `db:"t"`
+}
+
+// Largest returns up to n entries with the largest values, largest first.
+func (c *Cache) Largest(n int) ([]Entry, error) {
+	return c.selectEntries(`ORDER BY length(v) DESC, rowid DESC LIMIT ?`, n)
+}
+
+// Latest returns up to n most recently written entries, latest first.
+func (c *Cache) Latest(n int) ([]Entry, error) {
+	return c.selectEntries(`ORDER BY rowid DESC LIMIT ?`, n)
+}
+
+// selectEntries returns entries, with a given query suffix.
+func (c *Cache) selectEntries(suffix string, args ...interface{}) ([]Entry, error) {
+	var entries []Entry
+	err := c.db.Select(&entries, `SELECT k, length(v) AS size, coalesce(t, 0) AS t FROM map `+suffix, args...)
+	return entries, err
+}
+
+// EachEntry calls f for every entry, in write order; this scans the whole
+// table. An error returned by f stops the iteration and is returned.
+func (c *Cache) EachEntry(f func(Entry) error) error {
+	rows, err := c.db.Queryx(`SELECT k, length(v) AS size, coalesce(t, 0) AS t FROM map ORDER BY rowid`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Entry
+		if err := rows.StructScan(&e); err != nil {
+			return err
+		}
+		if err := f(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
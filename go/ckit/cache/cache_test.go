@@ -2,7 +2,11 @@ package cache
 
 import (
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/jmoiron/sqlx"
 )
 
 func TestCache(t *testing.T) {
@@ -44,3 +48,76 @@ func TestCache(t *testing.T) {
 		t.Fatalf("failed to close db: %v", err)
 	}
 }
+
+func TestCacheDictionaries(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "cache")
+	if err != nil {
+		t.Fatalf("failed to create temporary test file: %v", err)
+	}
+	defer f.Close()
+	cache, err := New(f.Name())
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer cache.Close()
+	for _, id := range []uint32{40000, 32768, 40000} {
+		if err := cache.AddDictionary(id, []byte("dict")); err != nil {
+			t.Fatalf("failed to add dictionary: %v", err)
+		}
+	}
+	dicts, err := cache.Dictionaries()
+	if err != nil {
+		t.Fatalf("failed to get dictionaries: %v", err)
+	}
+	if len(dicts) != 2 || dicts[1].ID != 32768 || dicts[1].Version != 2 || string(dicts[1].Dict) != "dict" {
+		t.Fatalf("got %v", dicts)
+	}
+	if err := cache.Set("a", []byte("abc")); err != nil {
+		t.Fatalf("failed to set value: %v", err)
+	}
+	if vs, err := cache.Sample(10); err != nil || len(vs) != 1 || string(vs[0]) != "abc" {
+		t.Fatalf("got %v, %v", vs, err)
+	}
+}
+
+func TestCacheEntries(t *testing.T) {
+	// A cache created before write times were recorded.
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE map (k TEXT, v TEXT); INSERT INTO map VALUES ('old', x'0102')`); err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	db.Close()
+	cache, err := New(path)
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+	defer cache.Close()
+	for _, kv := range [][]string{{"a", "abcd"}, {"b", "abc"}} {
+		if err := cache.Set(kv[0], []byte(kv[1])); err != nil {
+			t.Fatalf("failed to set value: %v", err)
+		}
+	}
+	largest, err := cache.Largest(2)
+	if err != nil || len(largest) != 2 || largest[0].Key != "a" || largest[0].Size != 4 || largest[1].Key != "b" {
+		t.Fatalf("got %v, %v, want a and b", largest, err)
+	}
+	if largest[0].Written == 0 {
+		t.Fatalf("got %v, want write time", largest[0])
+	}
+	latest, err := cache.Latest(10)
+	if err != nil || len(latest) != 3 || latest[0].Key != "b" || latest[2].Key != "old" || latest[2].Written != 0 {
+		t.Fatalf("got %v, %v, want b, a and old", latest, err)
+	}
+	var keys []string
+	err = cache.EachEntry(func(e Entry) error {
+		keys = append(keys, e.Key)
+		return nil
+	})
+	if err != nil || strings.Join(keys, ",") != "old,a,b" {
+		t.Fatalf("got %v, %v, want entries in write order", keys, err)
+	}
+}
@@ -0,0 +1,115 @@
+package ckit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControlKeys are the valid keys for Server.CacheControl: "default"
+// applies to all API endpoints without a specific value, "cached" to
+// responses served from the server-side cache, the others to the endpoint
+// of the same name ("ns" covers alternate namespaces, "lookup" /lookup/id
+// and /lookup/doi, "view" the HTML pages /view and /viz).
+var CacheControlKeys = []string{"default", "cached", "id", "doi", "counts", "exists", "network", "top", "citations", "references", "lookup", "oci", "ns", "view"}
+
+// ParseCacheControl parses a "key=directives" value, e.g.
+// "id=public, max-age=3600", into a map.
+func ParseCacheControl(m map[string]string, s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("cache control must be given as key=directives, got %s", s)
+	}
+	key := strings.TrimSpace(parts[0])
+	if !SliceContains(CacheControlKeys, key) {
+		return fmt.Errorf("invalid cache control key: %s %v", key, CacheControlKeys)
+	}
+	m[key] = strings.TrimSpace(parts[1])
+	return nil
+}
+
+// maxAge returns the max-age directive value, if any.
+func maxAge(directives string) (time.Duration, bool) {
+	for _, d := range strings.Split(directives, ",") {
+		d = strings.TrimSpace(d)
+		if !strings.HasPrefix(d, "max-age=") {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimPrefix(d, "max-age="))
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		return time.Duration(v) * time.Second, true
+	}
+	return 0, false
+}
+
+// withCacheControl wraps a handler and sets Cache-Control (and Expires, if
+// there is a max-age) on successful responses, according to the endpoint
+// key and whether the response came from the server-side cache.
+func (s *Server) withCacheControl(key string, h http.HandlerFunc) http.HandlerFunc {
+	if len(s.CacheControl) == 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(&cacheControlWriter{ResponseWriter: w, s: s, key: key}, r)
+	}
+}
+
+// cacheControlWriter sets caching headers right before the header is written.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	s           *Server
+	key         string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status < 400 {
+			w.setHeaders()
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, if the wrapped writer does.
+func (w *cacheControlWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// setHeaders picks the most specific directives available.
+func (w *cacheControlWriter) setHeaders() {
+	var (
+		h          = w.Header()
+		directives string
+	)
+	for _, k := range []string{"cached", w.key, "default"} {
+		if k == "cached" && h.Get("X-Cache") != "HIT" {
+			continue
+		}
+		if v, ok := w.s.CacheControl[k]; ok {
+			directives = v
+			break
+		}
+	}
+	if directives == "" {
+		return
+	}
+	h.Set("Cache-Control", directives)
+	if d, ok := maxAge(directives); ok {
+		h.Set("Expires", time.Now().Add(d).UTC().Format(http.TimeFormat))
+	}
+}
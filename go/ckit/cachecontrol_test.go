@@ -0,0 +1,62 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	m := make(map[string]string)
+	if err := ParseCacheControl(m, "id=public, max-age=60"); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if m["id"] != "public, max-age=60" {
+		t.Fatalf("got %v", m)
+	}
+	for _, v := range []string{"id", "id=", "xxx=max-age=1"} {
+		if err := ParseCacheControl(m, v); err == nil {
+			t.Fatalf("expected error for %s", v)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv.Cache = c
+	srv.CacheControl = map[string]string{
+		"default": "public, max-age=60",
+		"cached":  "public, max-age=3600",
+		"counts":  "no-cache",
+	}
+	srv.Router = mux.NewRouter()
+	srv.Routes()
+	var cases = []struct {
+		target  string
+		header  string
+		expires bool
+	}{
+		{"/id/i0029", "public, max-age=60", true},
+		{"/id/i0029", "public, max-age=3600", true}, // served from cache
+		{"/id/i0029/counts", "no-cache", false},
+		{"/id/xxxx", "", false}, // errors are not cacheable
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if got := rr.Header().Get("Cache-Control"); got != c.header {
+			t.Fatalf("%s: got %q, want %q", c.target, got, c.header)
+		}
+		if got := rr.Header().Get("Expires") != ""; got != c.expires {
+			t.Fatalf("%s: got expires %v, want %v", c.target, got, c.expires)
+		}
+	}
+}
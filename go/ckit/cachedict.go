@@ -0,0 +1,159 @@
+package ckit
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+// DictionaryStats reports on a trained dictionary: the total size of the
+// samples compressed without and with the dictionary.
+type DictionaryStats struct {
+	ID      uint32 `json:"id"`
+	Size    int    `json:"size"`
+	Samples int    `json:"samples"`
+	Before  int    `json:"before"`
+	After   int    `json:"after"`
+}
+
+// SampleCache returns up to n decompressed values from a cache, e.g. for
+// training a dictionary.
+func SampleCache(c *cache.Cache, n int) ([][]byte, error) {
+	dicts, err := c.Dictionaries()
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil, cacheDecoderOptions(dicts)...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	values, err := c.Sample(n)
+	if err != nil {
+		return nil, err
+	}
+	var samples [][]byte
+	for _, v := range values {
+		b, err := dec.DecodeAll(v, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cache decompress: %w", err)
+		}
+		samples = append(samples, b)
+	}
+	return samples, nil
+}
+
+// TrainDictionary trains a zstd dictionary of at most maxSize bytes from
+// samples of responses; the dictionary gets a random id.
+func TrainDictionary(samples [][]byte, maxSize int) ([]byte, *DictionaryStats, error) {
+	if len(samples) < 8 {
+		return nil, nil, fmt.Errorf("not enough samples to train a dictionary: %d", len(samples))
+	}
+	b, err := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: maxSize, HashBytes: 6})
+	if err != nil {
+		return nil, nil, fmt.Errorf("train: %w", err)
+	}
+	id, err := dictionaryID(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats := &DictionaryStats{ID: id, Size: len(b), Samples: len(samples)}
+	plain, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer plain.Close()
+	withDict, err := zstd.NewWriter(nil, zstd.WithEncoderDict(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("dictionary: %w", err)
+	}
+	defer withDict.Close()
+	for _, s := range samples {
+		stats.Before += len(plain.EncodeAll(s, nil))
+		stats.After += len(withDict.EncodeAll(s, nil))
+	}
+	return b, stats, nil
+}
+
+// AddCacheDictionary stores a zstd dictionary with the cache as the newest
+// version and returns its id; it is used for all values written by a
+// server started afterwards. Older dictionaries are kept, so values
+// compressed with them still decompress (zstd frames record the dictionary
+// id).
+func AddCacheDictionary(c *cache.Cache, b []byte) (uint32, error) {
+	id, err := dictionaryID(b)
+	if err != nil {
+		return 0, err
+	}
+	return id, c.AddDictionary(id, b)
+}
+
+// dictionaryID returns the id of a zstd dictionary.
+func dictionaryID(b []byte) (uint32, error) {
+	d, err := zstd.InspectDictionary(b)
+	if err != nil {
+		return 0, fmt.Errorf("dictionary: %w", err)
+	}
+	return d.ID(), nil
+}
+
+// cacheDecoderOptions registers all dictionaries with a decoder.
+func cacheDecoderOptions(dicts []cache.Dictionary) []zstd.DOption {
+	if len(dicts) == 0 {
+		return nil
+	}
+	bs := make([][]byte, len(dicts))
+	for i, d := range dicts {
+		bs[i] = d.Dict
+	}
+	return []zstd.DOption{zstd.WithDecoderDicts(bs...)}
+}
+
+// cacheCodec keeps the zstd options for cache values, loaded once from the
+// cache: values are compressed with the newest dictionary, if any.
+type cacheCodec struct {
+	encoder []zstd.EOption
+	decoder []zstd.DOption
+	err     error
+}
+
+// codec returns the cache codec; dictionaries added while the server is
+// running are used after a restart.
+func (s *Server) codec() *cacheCodec {
+	s.codecOnce.Do(func() {
+		if s.Cache == nil {
+			return
+		}
+		dicts, err := s.Cache.Dictionaries()
+		if err != nil {
+			s.cacheCodec.err = fmt.Errorf("cache dictionaries: %w", err)
+			return
+		}
+		s.cacheCodec.decoder = cacheDecoderOptions(dicts)
+		if len(dicts) > 0 {
+			s.cacheCodec.encoder = []zstd.EOption{zstd.WithEncoderDict(dicts[len(dicts)-1].Dict)}
+		}
+	})
+	return &s.cacheCodec
+}
+
+// newCacheWriter returns a writer compressing a cache value.
+func (s *Server) newCacheWriter(w io.Writer) (*zstd.Encoder, error) {
+	c := s.codec()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return zstd.NewWriter(w, c.encoder...)
+}
+
+// newCacheReader returns a reader decompressing a cache value.
+func (s *Server) newCacheReader(r io.Reader) (*zstd.Decoder, error) {
+	c := s.codec()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return zstd.NewReader(r, c.decoder...)
+}
@@ -0,0 +1,74 @@
+package ckit
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestCacheDictionary(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	for i := 0; i < 40; i++ {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", fmt.Sprintf("/id/i%04d", i), nil))
+	}
+	samples, err := SampleCache(c, 100)
+	if err != nil {
+		t.Fatalf("sample: %v", err)
+	}
+	b, stats, err := TrainDictionary(samples, 4096)
+	if err != nil {
+		t.Fatalf("train: %v", err)
+	}
+	if stats.Samples != len(samples) || stats.After >= stats.Before {
+		t.Fatalf("got %+v, want smaller values with dictionary", stats)
+	}
+	id, err := AddCacheDictionary(c, b)
+	if err != nil || id != stats.ID {
+		t.Fatalf("got %d, %v, want %d", id, err, stats.ID)
+	}
+	// A restarted server uses the dictionary for new values and can still
+	// read values compressed without it.
+	srv = newTestServer(t)
+	srv.Cache = c
+	for _, c := range []struct {
+		id    string
+		cache string
+	}{
+		{"i0029", "HIT"},
+		{"i0050", "MISS"},
+		{"i0050", "HIT"},
+	} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/"+c.id, nil))
+		if rr.Code != 200 || rr.Header().Get("X-Cache") != c.cache {
+			t.Fatalf("[%s] got %d, %s, want %s", c.id, rr.Code, rr.Header().Get("X-Cache"), c.cache)
+		}
+	}
+	v, err := c.Get("i0050")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	dec, _ := zstd.NewReader(nil)
+	defer dec.Close()
+	if _, err := dec.DecodeAll(v, nil); err == nil {
+		t.Fatalf("value decompressed without dictionary")
+	}
+	// Values compressed with a dictionary are not sent compressed.
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/id/i0050", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	srv.ServeHTTP(rr, req)
+	if rr.Code != 200 || rr.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("got %d, %q, want uncompressed response", rr.Code, rr.Header().Get("Content-Encoding"))
+	}
+}
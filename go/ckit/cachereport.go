@@ -0,0 +1,163 @@
+package ckit
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+const (
+	// defaultCacheReportSize is the default number of largest and latest
+	// entries in a cache report.
+	defaultCacheReportSize = 20
+	// maxCacheReportSize limits the number of entries in a cache report.
+	maxCacheReportSize = 1000
+)
+
+// CacheReport shows what takes up space in the cache: the largest and most
+// recently written entries and the size aggregated by key prefix, i.e. by
+// source of the local identifier, largest first.
+type CacheReport struct {
+	Entries  int64              `json:"entries"`
+	Bytes    int64              `json:"bytes"`
+	Largest  []CacheReportEntry `json:"largest"`
+	Latest   []CacheReportEntry `json:"latest"`
+	Prefixes []CachePrefixStats `json:"prefixes"`
+	Took     float64            `json:"took"` // seconds
+}
+
+// CacheReportEntry is a single cached response; size is the compressed size
+// in bytes; written and age (in seconds) are only known for entries stored
+// with write times.
+type CacheReportEntry struct {
+	Key     string  `json:"key"`
+	Size    int64   `json:"size"`
+	Written string  `json:"written,omitempty"`
+	Age     float64 `json:"age,omitempty"`
+}
+
+// CachePrefixStats aggregates the entries with the same key prefix.
+type CachePrefixStats struct {
+	Prefix  string `json:"prefix"`
+	Entries int64  `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Largest int64  `json:"largest"`
+}
+
+// CacheReport lists the n largest and latest cache entries and sums up
+// sizes per key prefix, which requires a scan over the whole cache.
+func (s *Server) CacheReport(n int) (*CacheReport, error) {
+	if s.Cache == nil {
+		return nil, fmt.Errorf("cache not enabled")
+	}
+	var (
+		started  = time.Now()
+		report   = &CacheReport{}
+		prefixes = make(map[string]*CachePrefixStats)
+	)
+	largest, err := s.Cache.Largest(n)
+	if err != nil {
+		return nil, fmt.Errorf("largest: %w", err)
+	}
+	latest, err := s.Cache.Latest(n)
+	if err != nil {
+		return nil, fmt.Errorf("latest: %w", err)
+	}
+	report.Largest = newCacheReportEntries(largest, started)
+	report.Latest = newCacheReportEntries(latest, started)
+	err = s.Cache.EachEntry(func(e cache.Entry) error {
+		report.Entries++
+		report.Bytes += e.Size
+		prefix := cacheKeyPrefix(e.Key)
+		ps, ok := prefixes[prefix]
+		if !ok {
+			ps = &CachePrefixStats{Prefix: prefix}
+			prefixes[prefix] = ps
+		}
+		ps.Entries++
+		ps.Bytes += e.Size
+		if e.Size > ps.Largest {
+			ps.Largest = e.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+	report.Prefixes = []CachePrefixStats{}
+	for _, ps := range prefixes {
+		report.Prefixes = append(report.Prefixes, *ps)
+	}
+	sort.Slice(report.Prefixes, func(i, j int) bool {
+		a, b := report.Prefixes[i], report.Prefixes[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Prefix < b.Prefix
+	})
+	report.Took = time.Since(started).Seconds()
+	return report, nil
+}
+
+// newCacheReportEntries converts cache entries, with ages relative to now.
+func newCacheReportEntries(entries []cache.Entry, now time.Time) []CacheReportEntry {
+	result := make([]CacheReportEntry, len(entries))
+	for i, e := range entries {
+		result[i] = CacheReportEntry{Key: e.Key, Size: e.Size}
+		if e.Written > 0 {
+			t := time.Unix(e.Written, 0)
+			result[i].Written = t.Format(time.RFC3339)
+			result[i].Age = now.Sub(t).Seconds()
+		}
+	}
+	return result
+}
+
+// cacheKeyPrefix returns the source part of a cache key, which is the first
+// segment of a local identifier, e.g. "0" for "0-1234", or the first two, if
+// the first is not a number, e.g. "ai-49" for "ai-49-aHR0..."; for cache
+// variants, the institution is appended, e.g. "ai-49@DE-14".
+func cacheKeyPrefix(key string) string {
+	id, isil, variant := strings.Cut(key, cacheVariantSep)
+	parts := strings.SplitN(id, "-", 3)
+	prefix := parts[0]
+	if _, err := strconv.Atoi(prefix); err != nil && len(parts) == 3 {
+		prefix = parts[0] + "-" + parts[1]
+	}
+	if variant {
+		prefix += cacheVariantSep + isil
+	}
+	return prefix
+}
+
+// handleCacheReport reports the largest and latest cache entries and the
+// size of the cache by key prefix; the number of entries can be set with
+// "n".
+func (s *Server) handleCacheReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := defaultCacheReportSize
+		if v := r.URL.Query().Get("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n < 1 || n > maxCacheReportSize {
+				httpErrLogf(w, http.StatusBadRequest, "n must be between 1 and %d: %s", maxCacheReportSize, v)
+				return
+			}
+		}
+		report, err := s.CacheReport(n)
+		if err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
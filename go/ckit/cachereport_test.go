@@ -0,0 +1,85 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestCacheKeyPrefix(t *testing.T) {
+	var cases = []struct {
+		key    string
+		prefix string
+	}{
+		{"", ""},
+		{"i0029", "i0029"},
+		{"0-1234", "0"},
+		{"0-1234-5", "0"},
+		{"ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTA3My9wbmFzLjg1LjguMjQ0NA", "ai-49"},
+		{"ai-49-aHR0c@DE-14", "ai-49@DE-14"},
+		{"68-x", "68"},
+	}
+	for _, c := range cases {
+		if got := cacheKeyPrefix(c.key); got != c.prefix {
+			t.Fatalf("[%s] got %s, want %s", c.key, got, c.prefix)
+		}
+	}
+}
+
+func TestServerCacheReport(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	for _, kv := range [][]string{
+		{"ai-49-a", "aaaa"},
+		{"ai-49-b", "bb"},
+		{"0-1", "ccccccc"},
+		{"ai-49-a@DE-14", "a"},
+	} {
+		if err := c.Set(kv[0], []byte(kv[1])); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	srv := newTestServer(t)
+	srv.Cache = c
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/cache/report?n=2", nil))
+	if rr.Code != 200 {
+		t.Fatalf("got %d, want 200: %s", rr.Code, rr.Body.String())
+	}
+	var report CacheReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Entries != 4 || report.Bytes != 14 {
+		t.Fatalf("got %d entries, %d bytes, want 4, 14", report.Entries, report.Bytes)
+	}
+	if len(report.Largest) != 2 || report.Largest[0].Key != "0-1" || report.Largest[0].Size != 7 ||
+		report.Largest[0].Written == "" {
+		t.Fatalf("got %+v, want 0-1 largest", report.Largest)
+	}
+	if len(report.Latest) != 2 || report.Latest[0].Key != "ai-49-a@DE-14" {
+		t.Fatalf("got %+v, want variant latest", report.Latest)
+	}
+	want := []CachePrefixStats{
+		{Prefix: "0", Entries: 1, Bytes: 7, Largest: 7},
+		{Prefix: "ai-49", Entries: 2, Bytes: 6, Largest: 4},
+		{Prefix: "ai-49@DE-14", Entries: 1, Bytes: 1, Largest: 1},
+	}
+	if !reflect.DeepEqual(report.Prefixes, want) {
+		t.Fatalf("got %+v, want %+v", report.Prefixes, want)
+	}
+	for _, target := range []string{"/cache/report?n=0", "/cache/report?n=x"} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != 400 {
+			t.Fatalf("%s: got %d, want 400", target, rr.Code)
+		}
+	}
+}
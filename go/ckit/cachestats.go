@@ -0,0 +1,159 @@
+package ckit
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+// cacheSizeInterval limits how often the size of the cache is computed, as
+// this requires a table scan.
+const cacheSizeInterval = time.Minute
+
+// CacheStats reports on the effectiveness of the response cache. Counters
+// are kept since server start; the number of entries and stored bytes are
+// updated at most once a minute. The compression ratio is the uncompressed
+// divided by the compressed size of the values written since start.
+type CacheStats struct {
+	Hits             int64   `json:"hits"`
+	VariantHits      int64   `json:"variant_hits"`
+	Misses           int64   `json:"misses"`
+	ReadErrors       int64   `json:"read_errors"`
+	HitRatio         float64 `json:"hit_ratio"`
+	Writes           int64   `json:"writes"`
+	WriteErrors      int64   `json:"write_errors"`
+	ReadOnlyRejects  int64   `json:"read_only_rejects"`
+	AdmissionRejects int64   `json:"admission_rejects"`
+	ReadOnly         bool    `json:"read_only"`
+	Entries          int64   `json:"entries"`
+	Bytes            int64   `json:"bytes"`
+	AvgEntrySize     float64 `json:"avg_entry_size"`
+	FileSize         int64   `json:"file_size"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	SizeUpdated      string  `json:"size_updated,omitempty"`
+}
+
+// cacheMetrics counts cache reads and writes.
+type cacheMetrics struct {
+	hits, misses, readErrors             atomic.Int64
+	variantHits                          atomic.Int64
+	writes, writeErrors, readOnlyRejects atomic.Int64
+	admissionRejects                     atomic.Int64
+	uncompressedBytes, compressedBytes   atomic.Int64
+
+	mu      sync.Mutex
+	sizeAt  time.Time
+	entries int64
+	size    int64
+}
+
+// recordRead counts the outcome of a cache lookup.
+func (m *cacheMetrics) recordRead(err error) {
+	switch {
+	case err == nil:
+		m.hits.Add(1)
+	case errors.Is(err, cache.ErrCacheMiss):
+		m.misses.Add(1)
+	default:
+		m.readErrors.Add(1)
+	}
+}
+
+// setCache stores a compressed value of a given uncompressed size and
+// records the outcome; cache.ErrReadOnly is returned, too.
+func (s *Server) setCache(id string, value []byte, uncompressed int) error {
+	m := &s.cacheMetrics
+	err := s.Cache.Set(id, value)
+	switch {
+	case err == nil:
+		m.writes.Add(1)
+		m.uncompressedBytes.Add(int64(uncompressed))
+		m.compressedBytes.Add(int64(len(value)))
+	case errors.Is(err, cache.ErrReadOnly):
+		m.readOnlyRejects.Add(1)
+	default:
+		m.writeErrors.Add(1)
+	}
+	return err
+}
+
+// admitCache returns true, if a compressed value of a given size, which took
+// a number of seconds to compute, should be cached, according to the
+// admission policy; without a policy, everything is admitted.
+func (s *Server) admitCache(key string, size int, took float64) bool {
+	if s.CacheAdmission == nil {
+		return true
+	}
+	if s.CacheAdmission.Admit(key, size, time.Duration(took*float64(time.Second))) {
+		return true
+	}
+	s.cacheMetrics.admissionRejects.Add(1)
+	return false
+}
+
+// resetSize forces an update of the cache size, e.g. after a purge.
+func (m *cacheMetrics) resetSize() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sizeAt = time.Time{}
+}
+
+// countingWriter counts the bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += n
+	return n, err
+}
+
+// CacheStats returns cache metrics, or nil if there is no cache.
+func (s *Server) CacheStats() (*CacheStats, error) {
+	if s.Cache == nil {
+		return nil, nil
+	}
+	m := &s.cacheMetrics
+	st := &CacheStats{
+		Hits:             m.hits.Load(),
+		VariantHits:      m.variantHits.Load(),
+		Misses:           m.misses.Load(),
+		ReadErrors:       m.readErrors.Load(),
+		Writes:           m.writes.Load(),
+		WriteErrors:      m.writeErrors.Load(),
+		ReadOnlyRejects:  m.readOnlyRejects.Load(),
+		AdmissionRejects: m.admissionRejects.Load(),
+		ReadOnly:         s.Cache.ReadOnly(),
+	}
+	if n := st.Hits + st.Misses; n > 0 {
+		st.HitRatio = float64(st.Hits) / float64(n)
+	}
+	if c := m.compressedBytes.Load(); c > 0 {
+		st.CompressionRatio = float64(m.uncompressedBytes.Load()) / float64(c)
+	}
+	if fi, err := os.Stat(s.Cache.Path); err == nil {
+		st.FileSize = fi.Size()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.sizeAt) > cacheSizeInterval {
+		entries, size, err := s.Cache.Size()
+		if err != nil {
+			return nil, err
+		}
+		m.entries, m.size, m.sizeAt = entries, size, time.Now()
+	}
+	st.Entries, st.Bytes = m.entries, m.size
+	st.SizeUpdated = m.sizeAt.Format(time.RFC3339)
+	if st.Entries > 0 {
+		st.AvgEntrySize = float64(st.Bytes) / float64(st.Entries)
+	}
+	return st, nil
+}
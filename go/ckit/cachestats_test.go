@@ -0,0 +1,44 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestServerCacheStats(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	for _, target := range []string{"/id/i0029", "/id/i0029", "/id/i0029", "/id/i0050"} {
+		mustRequest(t, srv, target)
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/stats", nil))
+	var data struct {
+		Cache *CacheStats `json:"cache"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &data); err != nil || data.Cache == nil {
+		t.Fatalf("got %s, %v, want cache stats", rr.Body.String(), err)
+	}
+	st := data.Cache
+	if st.Hits != 2 || st.Misses != 2 || st.HitRatio != 0.5 || st.Writes != 2 || st.WriteErrors != 0 {
+		t.Fatalf("got %+v, want 2 hits, 2 misses, 2 writes", st)
+	}
+	if st.Entries != 2 || st.Bytes == 0 || st.AvgEntrySize != float64(st.Bytes)/2 ||
+		st.CompressionRatio <= 1 || st.FileSize == 0 {
+		t.Fatalf("got %+v, want size of 2 compressed entries", st)
+	}
+	// Without a cache, there are no cache stats.
+	srv.Cache = nil
+	if st, err := srv.CacheStats(); st != nil || err != nil {
+		t.Fatalf("got %v, %v, want nil", st, err)
+	}
+}
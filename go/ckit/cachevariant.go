@@ -0,0 +1,46 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+)
+
+// cacheVariantSep separates identifier and ISIL in the cache key of a
+// filtered variant, e.g. "i0029@DE-14".
+const cacheVariantSep = "@"
+
+// rawCacheable returns true, if a cached value, which matches the filter and
+// sort options of a request, can be copied to the client as is: plain JSON in
+// the version 1 schema, without field filter, audit record or renamed DOI
+// field.
+func (s *Server) rawCacheable(ctx context.Context, opts *requestOptions, rec *AuditRecord) bool {
+	return !opts.Debug && opts.Format == FormatJSON && opts.Version == SchemaV1 &&
+		s.fieldFilter(ctx) == nil && rec == nil && s.unmatchedDOIField() == DefaultDOIField
+}
+
+// cacheVariantKey returns the cache key of the filtered variant of a response
+// for an institution, or the empty string, if the request is not limited to
+// one of CacheVariantISILs alone.
+func (s *Server) cacheVariantKey(ctx context.Context, id string, opts *requestOptions, rec *AuditRecord) string {
+	if opts == nil || opts.Institution == "" || !SliceContains(s.CacheVariantISILs, opts.Institution) {
+		return ""
+	}
+	o := *opts
+	o.Institution = ""
+	if !o.isZero() || !s.rawCacheable(ctx, opts, rec) {
+		return ""
+	}
+	return id + cacheVariantSep + opts.Institution
+}
+
+// cacheVariant stores the filtered variant of a response under key, if key
+// is not empty.
+func (s *Server) cacheVariant(key string, response *Response) error {
+	if key == "" {
+		return nil
+	}
+	if err := s.cacheResponseKey(key, response, false); err != nil {
+		return fmt.Errorf("cache variant: %w", err)
+	}
+	return nil
+}
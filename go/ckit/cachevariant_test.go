@@ -0,0 +1,65 @@
+package ckit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestCacheVariants(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	srv.CacheVariantISILs = []string{"DE-1"}
+	hasKey := func(key string) bool {
+		_, err := c.Get(key)
+		if err != nil && err != cache.ErrCacheMiss {
+			t.Fatalf("get %s: %v", key, err)
+		}
+		return err == nil
+	}
+	// A fresh response caches the unfiltered response and the variant.
+	want := mustRequest(t, srv, "/id/i0029?i=DE-1")
+	if !hasKey("i0029") || !hasKey("i0029@DE-1") {
+		t.Fatalf("want unfiltered response and variant cached")
+	}
+	got := mustRequest(t, srv, "/id/i0029?i=DE-1")
+	if got.Extra.CitingCount != want.Extra.CitingCount || got.Extra.CitedCount != want.Extra.CitedCount ||
+		got.Extra.Institution != "DE-1" {
+		t.Fatalf("got %+v, want %+v", got.Extra, want.Extra)
+	}
+	if n := srv.cacheMetrics.variantHits.Load(); n != 1 {
+		t.Fatalf("got %d variant hits, want 1", n)
+	}
+	// A variant is derived from the cached unfiltered response.
+	if err := c.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	all := mustRequest(t, srv, "/id/i0029")
+	if all.Extra.CitingCount+all.Extra.CitedCount <= want.Extra.CitingCount+want.Extra.CitedCount {
+		t.Fatalf("got %+v, want more documents than filtered %+v", all.Extra, want.Extra)
+	}
+	if hasKey("i0029@DE-1") {
+		t.Fatalf("want no variant for unfiltered request")
+	}
+	got = mustRequest(t, srv, "/id/i0029?i=DE-1")
+	if got.Extra.CitingCount != want.Extra.CitingCount || !hasKey("i0029@DE-1") {
+		t.Fatalf("got %+v, want %+v and variant cached", got.Extra, want.Extra)
+	}
+	mustRequest(t, srv, "/id/i0029?i=DE-1")
+	if n := srv.cacheMetrics.variantHits.Load(); n != 2 {
+		t.Fatalf("got %d variant hits, want 2", n)
+	}
+	// No variants for other institutions or with other options.
+	for _, target := range []string{"/id/i0029?i=DE-2", "/id/i0029?i=DE-1&sort=title"} {
+		mustRequest(t, srv, target)
+	}
+	if hasKey("i0029@DE-2") || srv.cacheMetrics.variantHits.Load() != 2 {
+		t.Fatalf("want no other variants")
+	}
+}
@@ -0,0 +1,282 @@
+// Package client implements a client for the labed HTTP API, decoding
+// responses into the types of the ckit package.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// ErrNoLocation is returned, if a DOI redirect contains no location.
+var ErrNoLocation = errors.New("redirect without location")
+
+// Error is a non-successful response from the server.
+type Error struct {
+	StatusCode int
+	Body       string
+}
+
+// Error returns the status and the (shortened) response body.
+func (e *Error) Error() string {
+	body := e.Body
+	if len(body) > 256 {
+		body = body[:256] + "..."
+	}
+	return fmt.Sprintf("labed: status %d: %s", e.StatusCode, strings.TrimSpace(body))
+}
+
+// IsNotFound returns true, if the error is a 404 response from the server,
+// e.g. for an unknown identifier or an identifier without citations.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// Options are optional request parameters for filtering and sorting, see the
+// labed documentation for details.
+type Options struct {
+	Institution string   // e.g. DE-14
+	Sort        string   // year, citation_count, rank or title
+	Order       string   // asc or desc
+	From        int      // publication year, inclusive
+	Until       int      // publication year, inclusive
+	Sources     []string // source ids or identifier prefixes
+	ISSN        []string // journals, e.g. 0027-8424
+}
+
+// values returns the options as URL query parameters.
+func (o *Options) values() url.Values {
+	v := url.Values{}
+	if o == nil {
+		return v
+	}
+	if o.Institution != "" {
+		v.Set("i", o.Institution)
+	}
+	if o.Sort != "" {
+		v.Set("sort", o.Sort)
+	}
+	if o.Order != "" {
+		v.Set("order", o.Order)
+	}
+	if o.From > 0 {
+		v.Set("from", strconv.Itoa(o.From))
+	}
+	if o.Until > 0 {
+		v.Set("until", strconv.Itoa(o.Until))
+	}
+	if len(o.Sources) > 0 {
+		v.Set("source", strings.Join(o.Sources, ","))
+	}
+	if len(o.ISSN) > 0 {
+		v.Set("issn", strings.Join(o.ISSN, ","))
+	}
+	return v
+}
+
+// Client talks to a labed server. Failed requests are retried on network
+// errors and server errors (5xx), with exponential backoff.
+type Client struct {
+	Server     string        // base URL, e.g. http://localhost:8000
+	HTTPClient *http.Client  // uses http.DefaultClient, if nil
+	MaxRetries int           // number of retries, 0 disables retries
+	RetryDelay time.Duration // initial delay between retries
+	Workers    int           // number of parallel requests for batch methods
+}
+
+// New returns a client for a server with default settings.
+func New(server string) *Client {
+	return &Client{
+		Server:     strings.TrimRight(server, "/"),
+		MaxRetries: 3,
+		RetryDelay: 100 * time.Millisecond,
+		Workers:    8,
+	}
+}
+
+// Result is the result of a single lookup in a batch.
+type Result struct {
+	Key      string // identifier or DOI, as given
+	Response *ckit.Response
+	Err      error
+}
+
+// LookupID returns the fused response for a local identifier.
+func (c *Client) LookupID(ctx context.Context, id string, opts *Options) (*ckit.Response, error) {
+	var resp ckit.Response
+	link := c.link("/id/"+url.PathEscape(id), opts.values())
+	if err := c.getJSON(ctx, link, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LookupDOI returns the fused response for a DOI, by resolving the DOI to a
+// local identifier first.
+func (c *Client) LookupDOI(ctx context.Context, doi string, opts *Options) (*ckit.Response, error) {
+	id, err := c.ResolveDOI(ctx, doi)
+	if err != nil {
+		return nil, err
+	}
+	return c.LookupID(ctx, id, opts)
+}
+
+// ResolveDOI returns the local identifier for a DOI.
+func (c *Client) ResolveDOI(ctx context.Context, doi string) (string, error) {
+	// Do not follow the redirect, we only need the location.
+	hc := *c.httpClient()
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := c.do(ctx, &hc, c.link("/doi/"+url.PathEscape(doi), nil))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", ErrNoLocation
+	}
+	id := loc[strings.LastIndex(loc, "/")+1:]
+	return url.PathUnescape(id)
+}
+
+// Counts returns the number of citing and cited edges for a local identifier;
+// requires a counts database on the server.
+func (c *Client) Counts(ctx context.Context, id string) (*ckit.Counts, error) {
+	var counts ckit.Counts
+	if err := c.getJSON(ctx, c.link("/id/"+url.PathEscape(id)+"/counts", nil), &counts); err != nil {
+		return nil, err
+	}
+	return &counts, nil
+}
+
+// LookupIDs looks up a number of local identifiers in parallel. Results are
+// returned in the order of the given identifiers, with per identifier errors.
+func (c *Client) LookupIDs(ctx context.Context, ids []string, opts *Options) []Result {
+	return c.batch(ctx, ids, func(ctx context.Context, id string) (*ckit.Response, error) {
+		return c.LookupID(ctx, id, opts)
+	})
+}
+
+// LookupDOIs looks up a number of DOI in parallel, like LookupIDs.
+func (c *Client) LookupDOIs(ctx context.Context, dois []string, opts *Options) []Result {
+	return c.batch(ctx, dois, func(ctx context.Context, doi string) (*ckit.Response, error) {
+		return c.LookupDOI(ctx, doi, opts)
+	})
+}
+
+// batch runs f for all keys with a number of workers.
+func (c *Client) batch(ctx context.Context, keys []string,
+	f func(context.Context, string) (*ckit.Response, error)) []Result {
+	var (
+		results = make([]Result, len(keys))
+		queue   = make(chan int)
+		wg      sync.WaitGroup
+		workers = c.Workers
+	)
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				resp, err := f(ctx, keys[j])
+				results[j] = Result{Key: keys[j], Response: resp, Err: err}
+			}
+		}()
+	}
+	for j := range keys {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
+
+// link returns the URL for a path and optional query.
+func (c *Client) link(path string, v url.Values) string {
+	link := strings.TrimRight(c.Server, "/") + path
+	if len(v) > 0 {
+		link += "?" + v.Encode()
+	}
+	return link
+}
+
+// httpClient returns the configured HTTP client or the default client.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// getJSON requests a link and decodes a successful response into v.
+func (c *Client) getJSON(ctx context.Context, link string, v interface{}) error {
+	resp, err := c.do(ctx, c.httpClient(), link)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	return nil
+}
+
+// do performs a GET request with retries; responses with status codes below
+// 400 are returned, the caller needs to close the body.
+func (c *Client) do(ctx context.Context, hc *http.Client, link string) (*http.Response, error) {
+	var (
+		delay = c.RetryDelay
+		err   error
+	)
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+				delay *= 2
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, "GET", link, nil)
+		if err != nil {
+			return nil, err
+		}
+		var resp *http.Response
+		resp, err = hc.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		err = &Error{StatusCode: resp.StatusCode, Body: string(b)}
+		if resp.StatusCode < 500 {
+			return nil, err
+		}
+	}
+	return nil, err
+}
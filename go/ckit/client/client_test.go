@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/slub/labe/go/ckit"
+	"github.com/thoas/stats"
+)
+
+// newTestServer returns a labed server over the ckit test databases.
+func newTestServer(t *testing.T) *httptest.Server {
+	a, err := ckit.OpenDatabase("../testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	b, err := ckit.OpenDatabase("../testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	g := &ckit.FetchGroup{}
+	if err := g.FromFiles("../testdata/id_metadata.db"); err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	st := stats.New()
+	st.MetricsCounts = make(map[string]int)
+	st.MetricsTimers = make(map[string]time.Time)
+	srv := &ckit.Server{
+		IdentifierDatabase: a,
+		OciDatabase:        b,
+		IndexData:          g,
+		Router:             mux.NewRouter(),
+		Stats:              st,
+	}
+	srv.Routes()
+	return httptest.NewServer(srv)
+}
+
+func TestClient(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	var (
+		c   = New(ts.URL)
+		ctx = context.Background()
+	)
+	resp, err := c.LookupID(ctx, "i0029", nil)
+	if err != nil {
+		t.Fatalf("lookup id: %v", err)
+	}
+	if resp.DOI != "d0029" || resp.Extra.CitingCount == 0 {
+		t.Fatalf("got %v, %d citing", resp.DOI, resp.Extra.CitingCount)
+	}
+	resp, err = c.LookupDOI(ctx, "d0029", &Options{Sort: "title"})
+	if err != nil {
+		t.Fatalf("lookup doi: %v", err)
+	}
+	if resp.ID != "i0029" {
+		t.Fatalf("got %v, want i0029", resp.ID)
+	}
+	if _, err := c.LookupID(ctx, "xxxx", nil); !IsNotFound(err) {
+		t.Fatalf("got %v, want not found", err)
+	}
+	results := c.LookupIDs(ctx, []string{"i0029", "xxxx", "i0029"}, nil)
+	if len(results) != 3 || results[0].Err != nil || !IsNotFound(results[1].Err) || results[2].Key != "i0029" {
+		t.Fatalf("unexpected batch results: %v", results)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id": "a", "doi": "10.1/a"}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL)
+	c.RetryDelay = time.Millisecond
+	resp, err := c.LookupID(context.Background(), "a", nil)
+	if err != nil || resp.DOI != "10.1/a" || calls != 3 {
+		t.Fatalf("got %v, %v after %d calls", resp, err, calls)
+	}
+	c.MaxRetries = 0
+	atomic.StoreInt32(&calls, 0)
+	if _, err := c.LookupID(context.Background(), "a", nil); err == nil {
+		t.Fatalf("expected error without retries")
+	}
+}
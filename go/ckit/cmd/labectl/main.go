@@ -0,0 +1,276 @@
+// labectl queries a labed server from the command line, e.g. to debug
+// citation data for a record without composing curl commands.
+//
+//	$ labectl id ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTA3My9wbmFzLjg1LjguMjQ0NA
+//	$ labectl doi 10.1073/pnas.85.8.2444
+//	$ labectl counts ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTA3My9wbmFzLjg1LjguMjQ0NA
+//	$ labectl graph -depth 2 ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTA3My9wbmFzLjg1LjguMjQ0NA
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/andrew-d/go-termutil"
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/client"
+)
+
+var (
+	Version   string // set by makefile
+	Buildtime string // set by makefile
+
+	server      = flag.String("server", defaultServer(), "labed server base URL (or set LABED_SERVER)")
+	raw         = flag.Bool("raw", false, "do not pretty print JSON, even on a terminal")
+	doiField    = flag.String("doi-field", ckit.DefaultDOIField, "DOI field of unmatched documents, if the server uses another name (labed -unmatched-doi-field)")
+	showVersion = flag.Bool("version", false, "show version and exit")
+
+	subcommands = map[string]func(c *client.Client, args []string) error{
+		"counts": runCounts,
+		"doi":    runDOI,
+		"graph":  runGraph,
+		"id":     runID,
+	}
+
+	Help = `usage: labectl [-server URL] COMMAND [OPTION] ARG [ARG ...]
+
+Commands
+
+  id ID [ID ...]         fused response for local identifiers
+  doi DOI [DOI ...]      fused response for DOI
+  counts ID [ID ...]     citing and cited counts (requires labed -counts)
+  graph [-depth N] ID    citation edges (citing and cited DOI as TSV) around
+                         a record, following matched documents up to depth N
+
+Options for id and doi
+
+  -i ISIL, -sort KEY, -order asc|desc, -from YEAR, -until YEAR, -source S
+
+Flags
+
+`
+)
+
+// defaultServer returns the server from the environment or a default.
+func defaultServer() string {
+	if v := os.Getenv("LABED_SERVER"); v != "" {
+		return v
+	}
+	return "http://localhost:8000"
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, Help)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *showVersion {
+		fmt.Printf("labectl %v %v\n", Version, Buildtime)
+		os.Exit(0)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	cmd, ok := subcommands[flag.Arg(0)]
+	if !ok {
+		log.Fatalf("unknown command: %s", flag.Arg(0))
+	}
+	if err := cmd(client.New(*server), flag.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeJSON writes a value as JSON to stdout, indented on a terminal, one
+// value per line otherwise.
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	if !*raw && termutil.Isatty(os.Stdout.Fd()) {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+// parseOptions parses request options for the id and doi commands.
+func parseOptions(name string, args []string) (*client.Options, []string, error) {
+	var (
+		fs      = flag.NewFlagSet(name, flag.ContinueOnError)
+		opts    client.Options
+		sources string
+		issn    string
+	)
+	fs.StringVar(&opts.Institution, "i", "", "limit to documents held by an institution, e.g. DE-14")
+	fs.StringVar(&opts.Sort, "sort", "", "sort key: year, citation_count, rank, title")
+	fs.StringVar(&opts.Order, "order", "", "sort order: asc, desc")
+	fs.IntVar(&opts.From, "from", 0, "publication year from, inclusive")
+	fs.IntVar(&opts.Until, "until", 0, "publication year until, inclusive")
+	fs.StringVar(&sources, "source", "", "source ids or identifier prefixes, comma separated")
+	fs.StringVar(&issn, "issn", "", "limit to journals by ISSN, comma separated")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if sources != "" {
+		opts.Sources = strings.Split(sources, ",")
+	}
+	if issn != "" {
+		opts.ISSN = strings.Split(issn, ",")
+	}
+	if fs.NArg() == 0 {
+		return nil, nil, fmt.Errorf("%s: missing argument", name)
+	}
+	return &opts, fs.Args(), nil
+}
+
+// writeResults writes responses and reports the number of failed lookups.
+func writeResults(results []client.Result) error {
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			log.Printf("%s: %v", r.Key, r.Err)
+			failed++
+			continue
+		}
+		if err := writeJSON(r.Response); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lookups failed", failed, len(results))
+	}
+	return nil
+}
+
+// runID looks up local identifiers.
+func runID(c *client.Client, args []string) error {
+	opts, ids, err := parseOptions("id", args)
+	if err != nil {
+		return err
+	}
+	return writeResults(c.LookupIDs(context.Background(), ids, opts))
+}
+
+// runDOI looks up DOI.
+func runDOI(c *client.Client, args []string) error {
+	opts, dois, err := parseOptions("doi", args)
+	if err != nil {
+		return err
+	}
+	return writeResults(c.LookupDOIs(context.Background(), dois, opts))
+}
+
+// runCounts looks up edge counts.
+func runCounts(c *client.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("counts: missing argument")
+	}
+	for _, id := range args {
+		counts, err := c.Counts(context.Background(), id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		if err := writeJSON(struct {
+			ID string `json:"id"`
+			*ckit.Counts
+		}{id, counts}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runGraph writes citation edges around a record as TSV (citing DOI, cited
+// DOI), following matched documents breadth first.
+func runGraph(c *client.Client, args []string) error {
+	var (
+		fs       = flag.NewFlagSet("graph", flag.ContinueOnError)
+		depth    = fs.Int("depth", 1, "number of hops to follow")
+		maxNodes = fs.Int("max", 1000, "maximum number of records to request")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("graph: need exactly one identifier")
+	}
+	var (
+		ctx      = context.Background()
+		frontier = []string{fs.Arg(0)}
+		visited  = map[string]bool{fs.Arg(0): true}
+		edges    = make(map[[2]string]bool)
+	)
+	for level := 0; level < *depth && len(frontier) > 0; level++ {
+		var next []string
+		for _, r := range c.LookupIDs(ctx, frontier, nil) {
+			if r.Err != nil {
+				if !client.IsNotFound(r.Err) {
+					log.Printf("%s: %v", r.Key, r.Err)
+				}
+				continue
+			}
+			resp := r.Response
+			for _, doc := range resp.Citing {
+				id, doi := parseDoc(doc)
+				edges[[2]string{resp.DOI, doi}] = true
+				if id != "" && !visited[id] && len(visited) < *maxNodes {
+					visited[id] = true
+					next = append(next, id)
+				}
+			}
+			for _, doc := range resp.Cited {
+				id, doi := parseDoc(doc)
+				edges[[2]string{doi, resp.DOI}] = true
+				if id != "" && !visited[id] && len(visited) < *maxNodes {
+					visited[id] = true
+					next = append(next, id)
+				}
+			}
+		}
+		frontier = next
+	}
+	var sorted [][2]string
+	for e := range edges {
+		if e[0] != "" && e[1] != "" {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+	for _, e := range sorted {
+		fmt.Printf("%s\t%s\n", e[0], e[1])
+	}
+	return nil
+}
+
+// parseDoc returns the local identifier and the first DOI of a document;
+// unmatched documents may use another DOI field than index documents.
+func parseDoc(doc json.RawMessage) (id, doi string) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return "", ""
+	}
+	json.Unmarshal(fields["id"], &id)
+	v, ok := fields[ckit.DefaultDOIField]
+	if !ok {
+		v = fields[*doiField]
+	}
+	var dois []string
+	if err := json.Unmarshal(v, &dois); err != nil {
+		json.Unmarshal(v, &doi)
+		return id, doi
+	}
+	if len(dois) > 0 {
+		doi = dois[0]
+	}
+	return id, doi
+}
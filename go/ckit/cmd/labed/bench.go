@@ -0,0 +1,95 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/xflag"
+	"github.com/thoas/stats"
+)
+
+// runBench samples identifiers from the identifier database and replays them
+// against a running server or, if no server is given, directly against a
+// handler over the given databases and reports throughput, latencies and
+// errors.
+func runBench(args []string) {
+	var (
+		fs                     = flag.NewFlagSet("bench", flag.ExitOnError)
+		identifierDatabasePath = fs.String("i", "", "identifier database path or postgres:// DSN (id-doi mapping)")
+		ociDatabasePath        = fs.String("o", "", "oci as a database path (in-process mode only)")
+		server                 = fs.String("server", "", "labed server base URL, e.g. http://localhost:8000 (in-process, if empty)")
+		numSamples             = fs.Int("n", 1000, "number of identifiers to sample")
+		concurrency            = fs.Int("c", 8, "number of parallel requests")
+		rate                   = fs.Float64("rate", 0, "maximum number of requests per second (0 means no limit)")
+		metadataPaths          xflag.Array
+	)
+	fs.Var(&metadataPaths, "m", "index metadata cache sqlite3 path (in-process mode only, repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed bench -i i.db [-server http://localhost:8000 | -o o.db -m d.db] [-n 1000] [-c 8]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *identifierDatabasePath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	identifierDatabase, err := ckit.OpenDatabase(*identifierDatabasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer identifierDatabase.Close()
+	ids, err := ckit.SampleKeys(identifierDatabase, *numSamples)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[ok] sampled %d identifiers", len(ids))
+	w := &ckit.Warmer{
+		Server:  *server,
+		Workers: *concurrency,
+		Rate:    *rate,
+	}
+	if *server == "" {
+		if *ociDatabasePath == "" || len(metadataPaths) == 0 {
+			log.Fatal("in-process mode requires -o and -m")
+		}
+		ociDatabase, err := ckit.OpenDatabase(*ociDatabasePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer ociDatabase.Close()
+		g := &ckit.FetchGroup{}
+		if err := g.FromFiles(metadataPaths...); err != nil {
+			log.Fatal(err)
+		}
+		srv := &ckit.Server{
+			IdentifierDatabase: identifierDatabase,
+			OciDatabase:        ociDatabase,
+			IndexData:          g,
+			Router:             mux.NewRouter(),
+			Stats:              stats.New(),
+		}
+		srv.Routes()
+		var h http.Handler = srv
+		w.Handler = srv.Stats.Handler(h)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	stats, err := w.Run(ctx, strings.NewReader(strings.Join(ids, "\n")))
+	fmt.Println(stats)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if stats.Errors > 0 {
+		fmt.Printf("error rate: %0.2f%%\n", 100*float64(stats.Errors)/float64(stats.Requests))
+	}
+}
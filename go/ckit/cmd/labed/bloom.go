@@ -0,0 +1,68 @@
+//go:build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/bloom"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+// runBloom builds a Bloom filter over all DOI in one or more citation
+// databases, which can be passed to the server via -bloom.
+func runBloom(args []string) {
+	var (
+		fs     = flag.NewFlagSet("bloom", flag.ExitOnError)
+		output = fs.String("out", "oci.bloom", "output filter path")
+		p      = fs.Float64("p", 0.01, "false positive rate")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed bloom [-out oci.bloom] o.db [o2.db ...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	var dbs []*sqlx.DB
+	for _, path := range fs.Args() {
+		db, err := ckit.OpenDatabase(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+	f, err := ckit.BuildEdgeFilter(dbs, *p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := f.WriteTo(file); err != nil {
+		log.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[ok] wrote %s filter to %s", tabutils.ByteSize(f.SizeBytes()), *output)
+}
+
+// loadBloom loads a filter from a file.
+func loadBloom(path string) (*bloom.Filter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return bloom.ReadFrom(f)
+}
@@ -0,0 +1,137 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/cache"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+// sqliteMagic starts every sqlite3 database file.
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// runCache dispatches cache maintenance commands.
+func runCache(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "usage: labed cache train-dict [-n 2000] [-size 112640] [-out labed.dict] FILE [FILE ...]\n")
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	switch args[0] {
+	case "train-dict":
+		runCacheTrainDict(args[1:])
+	default:
+		usage()
+	}
+}
+
+// runCacheTrainDict trains a zstd dictionary from samples of fused
+// responses, taken from cache databases or NDJSON files (e.g. parts written
+// by labed dump), which can be passed to the server via -cache-dict.
+func runCacheTrainDict(args []string) {
+	var (
+		fs      = flag.NewFlagSet("cache train-dict", flag.ExitOnError)
+		n       = fs.Int("n", 2000, "number of responses to sample")
+		maxSize = fs.Int("size", 112640, "maximum dictionary size in bytes")
+		output  = fs.String("out", "labed.dict", "output dictionary path")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed cache train-dict [-n 2000] [-size 112640] [-out labed.dict] FILE [FILE ...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	var (
+		samples [][]byte
+		seen    int // number of responses seen in NDJSON files
+	)
+	for _, filename := range fs.Args() {
+		isCache, err := hasPrefix(filename, sqliteMagic)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if isCache {
+			c, err := cache.New(filename)
+			if err != nil {
+				log.Fatal(err)
+			}
+			s, err := ckit.SampleCache(c, *n)
+			c.Close()
+			if err != nil {
+				log.Fatalf("%s: %v", filename, err)
+			}
+			samples = append(samples, s...)
+			continue
+		}
+		// Reservoir sampling over all lines of all files.
+		f, err := os.Open(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r, err := tabutils.DecompressReader(f)
+		if err != nil {
+			log.Fatalf("%s: %v", filename, err)
+		}
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 1<<20), 1<<28)
+		for scanner.Scan() {
+			line := append([]byte(nil), bytes.TrimSpace(scanner.Bytes())...)
+			if len(line) == 0 {
+				continue
+			}
+			seen++
+			switch {
+			case len(samples) < *n:
+				samples = append(samples, line)
+			default:
+				if i := rand.Intn(seen); i < *n {
+					samples[i] = line
+				}
+			}
+		}
+		r.Close()
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("%s: %v", filename, err)
+		}
+	}
+	b, stats, err := ckit.TrainDictionary(samples, *maxSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, b, 0644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[ok] wrote dictionary %d (%s) to %s, %d samples compress to %s, %s without dictionary",
+		stats.ID, tabutils.ByteSize(stats.Size), *output, stats.Samples,
+		tabutils.ByteSize(stats.After), tabutils.ByteSize(stats.Before))
+}
+
+// hasPrefix returns true, if a file starts with a given prefix.
+func hasPrefix(filename string, prefix []byte) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	b := make([]byte, len(prefix))
+	if _, err := io.ReadFull(f, b); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(b, prefix), nil
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/xflag"
+)
+
+// runCounts materializes per-DOI citing and cited counts from a citation
+// database into an auxiliary database, which can be passed to the server via
+// -counts. Additional citation databases are merged, like in the server.
+func runCounts(args []string) {
+	var (
+		fs            = flag.NewFlagSet("counts", flag.ExitOnError)
+		ociPath       = fs.String("o", "", "oci as a database path (citations)")
+		output        = fs.String("out", "counts.db", "output database path")
+		extraOciPaths xflag.Array
+	)
+	fs.Var(&extraOciPaths, "O", "additional citation database as name:path, same as for the server (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed counts -o o.db [-O name:extra.db] [-out counts.db]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *ociPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	paths := []string{*ociPath}
+	for _, v := range extraOciPaths {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			log.Fatalf("additional citation database must be given as name:path, got %s", v)
+		}
+		paths = append(paths, parts[1])
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := ckit.BuildCountsDatabase(*output, paths...); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// openDatasets opens the databases and index data given on the command line;
+// it is called on startup and again for each reload.
+func openDatasets(sqliteOptions ckit.SqliteOptions) (d *ckit.Datasets, err error) {
+	d = &ckit.Datasets{}
+	defer func() {
+		if err != nil {
+			d.Close()
+		}
+	}()
+	if d.IdentifierDatabase, err = ckit.OpenDatabaseOptions(*identifierDatabasePath, sqliteOptions); err != nil {
+		return nil, err
+	}
+	if err := openCitations(d, sqliteOptions); err != nil {
+		if !*allowDegraded {
+			return nil, err
+		}
+		log.Printf("[xx] citation database unavailable, responses without citations: %v", err)
+		d.Degraded = append(d.Degraded, ckit.Degradation{Component: ckit.ComponentCitations, Reason: err.Error()})
+		if d.OciDatabase, err = ckit.OpenEmptyMapDatabase(); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range extraOciPaths {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("additional citation database must be given as name:path, got %s", v)
+		}
+		db, err := ckit.OpenDatabaseOptions(parts[1], sqliteOptions)
+		if err != nil {
+			return nil, err
+		}
+		d.AdditionalOciDatabases = append(d.AdditionalOciDatabases, ckit.OciSource{Name: parts[0], DB: db})
+	}
+	for _, v := range namespacePaths {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("namespace must be given as name:path, got %s", v)
+		}
+		if err := ckit.ValidateNamespaceName(parts[0]); err != nil {
+			return nil, err
+		}
+		db, err := ckit.OpenDatabaseOptions(parts[1], sqliteOptions)
+		if err != nil {
+			return nil, err
+		}
+		d.Namespaces = append(d.Namespaces, ckit.Namespace{Name: parts[0], DB: db})
+	}
+	// Setup index data fetcher.
+	if len(sqliteFetcherPaths) == 0 {
+		return nil, fmt.Errorf("need at least one sqlite3 metadata index database (-m)")
+	}
+	if err := openIndexData(d, sqliteOptions); err != nil {
+		if !*allowDegraded {
+			return nil, err
+		}
+		log.Printf("[xx] index data unavailable, responses with document stubs: %v", err)
+		d.Degraded = append(d.Degraded, ckit.Degradation{Component: ckit.ComponentIndexData, Reason: err.Error()})
+		d.IndexData = &ckit.UnavailableFetcher{Err: err}
+	}
+	if len(transforms) > 0 {
+		tf := &ckit.TransformFetcher{Fetcher: d.IndexData}
+		for _, v := range transforms {
+			t, err := ckit.ParseFieldTransform(v)
+			if err != nil {
+				return nil, err
+			}
+			tf.Transforms = append(tf.Transforms, t)
+		}
+		d.IndexData = tf
+		log.Printf("[ok] setup %d index data transform(s)", len(tf.Transforms))
+	}
+	if *lruSize > 0 {
+		d.IndexData = ckit.NewLRUFetcher(d.IndexData, *lruSize<<20)
+		log.Printf("[ok] setup in-memory index data cache with %dMB", *lruSize)
+	}
+	if *counts != "" {
+		if d.CountsDatabase, err = ckit.OpenDatabaseOptions(*counts, sqliteOptions); err != nil {
+			return nil, err
+		}
+	}
+	if *rankPath != "" {
+		if d.RankDatabase, err = ckit.OpenDatabaseOptions(*rankPath, sqliteOptions); err != nil {
+			return nil, err
+		}
+	}
+	if *matchPath != "" {
+		if d.MatchDatabase, err = ckit.OpenDatabaseOptions(*matchPath, sqliteOptions); err != nil {
+			return nil, err
+		}
+	}
+	if *holdingsPath != "" {
+		if d.HoldingsDatabase, err = ckit.OpenDatabaseOptions(*holdingsPath, sqliteOptions); err != nil {
+			return nil, err
+		}
+	}
+	if *bloomFilter != "" {
+		if d.EdgeFilter, err = loadBloom(*bloomFilter); err != nil {
+			return nil, err
+		}
+		if err := d.CheckEdgeFilter(); err != nil {
+			return nil, err
+		}
+		if d.EdgeFilter.Tag == "" {
+			log.Printf("[xx] edge filter %s has no fingerprint, cannot check it matches the citation databases", *bloomFilter)
+		}
+		log.Printf("[ok] loaded edge filter from %s", *bloomFilter)
+	}
+	return d, nil
+}
+
+// openCitations opens the citation database or its shards; with -degraded,
+// databases are checked right away, so a broken file is found before
+// startup completes.
+func openCitations(d *ckit.Datasets, sqliteOptions ckit.SqliteOptions) (err error) {
+	if *ociShards != "" {
+		filenames, err := filepath.Glob(*ociShards)
+		if err != nil {
+			return err
+		}
+		if len(filenames) == 0 {
+			return fmt.Errorf("no citation database shards found: %s", *ociShards)
+		}
+		if d.OciShards, err = ckit.OpenOciShards(filenames, sqliteOptions); err != nil {
+			return err
+		}
+		log.Printf("[ok] opened %d citation database shards", len(d.OciShards))
+	} else if d.OciDatabase, err = ckit.OpenDatabaseOptions(*ociDatabasePath, sqliteOptions); err != nil {
+		return err
+	}
+	if !*allowDegraded {
+		return nil
+	}
+	dbs := d.OciShards
+	if d.OciDatabase != nil {
+		dbs = append(dbs, d.OciDatabase)
+	}
+	for _, db := range dbs {
+		if err = db.Ping(); err == nil {
+			err = ckit.ValidateMapDatabase(db, []string{"idx_k", "idx_v"}, false)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		for _, db := range dbs {
+			db.Close()
+		}
+		d.OciDatabase, d.OciShards = nil, nil
+	}
+	return err
+}
+
+// openIndexData sets up the group fetcher over the index databases; with
+// -degraded, they are checked right away.
+func openIndexData(d *ckit.Datasets, sqliteOptions ckit.SqliteOptions) error {
+	g := &ckit.FetchGroup{
+		BreakerThreshold: *breakerThreshold,
+		BreakerCooldown:  *breakerCooldown,
+		SqliteOptions:    sqliteOptions,
+	}
+	err := g.FromFiles(sqliteFetcherPaths...)
+	if err == nil && *allowDegraded {
+		if err = g.Ping(); err == nil {
+			err = g.Validate(false)
+		}
+	}
+	if err != nil {
+		for _, b := range g.Backends {
+			if f, ok := b.(*ckit.SqliteFetcher); ok {
+				f.DB.Close()
+			}
+		}
+		return err
+	}
+	d.IndexData = g
+	log.Printf("[ok] setup group fetcher over %d database(s): %v",
+		len(g.Backends), sqliteFetcherPaths)
+	return nil
+}
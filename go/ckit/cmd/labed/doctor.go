@@ -0,0 +1,149 @@
+//go:build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/tabutils"
+	"github.com/slub/labe/go/ckit/xflag"
+)
+
+// minOpenFiles is the file descriptor limit below which we warn; each sqlite3
+// connection and each client connection needs one.
+const minOpenFiles = 4096
+
+// runDoctor checks a deployment, i.e. databases, cache directory, disk space
+// and limits and prints a report with hints on how to fix problems. The exit
+// status is non-zero, if any check failed.
+func runDoctor(args []string) {
+	var (
+		fs                     = flag.NewFlagSet("doctor", flag.ExitOnError)
+		identifierDatabasePath = fs.String("i", "", "identifier database path or postgres:// DSN (id-doi mapping)")
+		ociDatabasePath        = fs.String("o", "", "oci as a database path or postgres:// DSN (citations)")
+		countsPath             = fs.String("counts", "", "precomputed citation counts database path")
+		bloomPath              = fs.String("bloom", "", "edge filter path")
+		cacheDir               = fs.String("cache-dir", os.TempDir(), "directory the cache is created in")
+		cacheMaxFileSize       = fs.Int64("cx", 1<<36, "maximum filesize cache in bytes")
+		offline                = fs.Bool("offline", false, "do not check figshare for a newer release of the citation dump")
+		metadataPaths          xflag.Array
+		extraPaths             xflag.Array
+		namespaces             xflag.Array
+		report                 ckit.Report
+	)
+	fs.Var(&metadataPaths, "m", "index metadata cache sqlite3 path (repeatable)")
+	fs.Var(&extraPaths, "O", "additional citation database as name:path or name:DSN (repeatable)")
+	fs.Var(&namespaces, "ns", "alternate identifier namespace as name:path (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed doctor -i i.db -o o.db -m d.db [-m d2.db ...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	kv := []string{"idx_k", "idx_v"}
+	ckit.DiagnoseMapDatabase(&report, "identifier database (-i)", *identifierDatabasePath, kv)
+	ckit.DiagnoseMapDatabase(&report, "oci database (-o)", *ociDatabasePath, kv)
+	if *ociDatabasePath != "" {
+		var checker *ckit.ReleaseChecker
+		if !*offline {
+			checker = &ckit.ReleaseChecker{}
+		}
+		ckit.DiagnoseRelease(&report, "oci release (-o)", *ociDatabasePath, checker)
+	}
+	for _, v := range extraPaths {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			report.Fail("oci database (-O)", "use name:path", "invalid value: %s", v)
+			continue
+		}
+		ckit.DiagnoseMapDatabase(&report, fmt.Sprintf("oci database %s (-O)", parts[0]), parts[1], kv)
+	}
+	if len(metadataPaths) == 0 {
+		report.Fail("index data (-m)", "pass at least one metadata database", "not configured")
+	}
+	for _, path := range metadataPaths {
+		ckit.DiagnoseMapDatabase(&report, fmt.Sprintf("index data %s (-m)", path), path, []string{"idx_k"})
+	}
+	for _, v := range namespaces {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 {
+			report.Fail("namespace (-ns)", "use name:path", "invalid value: %s", v)
+			continue
+		}
+		name := fmt.Sprintf("namespace %s (-ns)", parts[0])
+		if err := ckit.ValidateNamespaceName(parts[0]); err != nil {
+			report.Fail(name, "choose another name", "%v", err)
+			continue
+		}
+		ckit.DiagnoseMapDatabase(&report, name, parts[1], []string{"idx_k"})
+	}
+	if *countsPath != "" {
+		diagnoseFile(&report, "counts database (-counts)", *countsPath, "create it with: labed counts")
+	}
+	if *bloomPath != "" {
+		if _, err := loadBloom(*bloomPath); err != nil {
+			report.Fail("edge filter (-bloom)", "create it with: labed bloom", "%v", err)
+		} else {
+			report.OK("edge filter (-bloom)", "loaded %s", *bloomPath)
+		}
+	}
+	ckit.DiagnoseWritableDir(&report, "cache directory", *cacheDir)
+	diagnoseDiskSpace(&report, "cache directory", *cacheDir, *cacheMaxFileSize)
+	diagnoseOpenFiles(&report)
+	ckit.DiagnoseSqlite(&report)
+	report.WriteTo(os.Stdout)
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
+
+// diagnoseFile checks, whether a file exists and is not empty.
+func diagnoseFile(r *ckit.Report, name, path, hint string) {
+	fi, err := os.Stat(path)
+	switch {
+	case err != nil:
+		r.Fail(name, hint, "%v", err)
+	case fi.Size() == 0:
+		r.Fail(name, hint, "empty file: %s", path)
+	default:
+		r.OK(name, "found %s (%s)", path, tabutils.ByteSize(int(fi.Size())))
+	}
+}
+
+// diagnoseDiskSpace warns, if the free space in dir is less than the
+// required number of bytes.
+func diagnoseDiskSpace(r *ckit.Report, name, dir string, required int64) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		r.Fail(name, "", "statfs: %v", err)
+		return
+	}
+	free := int64(st.Bavail) * int64(st.Bsize)
+	if free < required {
+		r.Warn(name, "free up space, set TMPDIR or lower the maximum cache size with -cx",
+			"%s free, but cache may grow up to %s",
+			tabutils.ByteSize(int(free)), tabutils.ByteSize(int(required)))
+		return
+	}
+	r.OK(name, "%s free", tabutils.ByteSize(int(free)))
+}
+
+// diagnoseOpenFiles checks the limit on open file descriptors.
+func diagnoseOpenFiles(r *ckit.Report) {
+	const name = "open files"
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		r.Fail(name, "", "getrlimit: %v", err)
+		return
+	}
+	if rlimit.Cur < minOpenFiles {
+		r.Warn(name, fmt.Sprintf("raise the limit, e.g. with ulimit -n %d or LimitNOFILE in the systemd unit", minOpenFiles),
+			"limit is %d", rlimit.Cur)
+		return
+	}
+	r.OK(name, "limit is %d", rlimit.Cur)
+}
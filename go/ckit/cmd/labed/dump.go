@@ -0,0 +1,91 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gorilla/mux"
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/xflag"
+	"github.com/thoas/stats"
+)
+
+// runDump writes fused responses for all local identifiers as compressed
+// NDJSON parts into a directory; an interrupted dump is resumed from the last
+// complete part, when run again with the same output directory.
+func runDump(args []string) {
+	var (
+		fs                     = flag.NewFlagSet("dump", flag.ExitOnError)
+		identifierDatabasePath = fs.String("i", "", "identifier database path or postgres:// DSN (id-doi mapping)")
+		ociDatabasePath        = fs.String("o", "", "oci as a database path or postgres:// DSN (citations)")
+		outputDir              = fs.String("out", "dump", "output directory")
+		numWorkers             = fs.Int("w", 8, "number of workers")
+		partSize               = fs.Int("part", 100000, "number of identifiers per output part")
+		verbose                = fs.Bool("verbose", false, "log per request messages")
+		metadataPaths          xflag.Array
+	)
+	fs.Var(&metadataPaths, "m", "index metadata cache sqlite3 path (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed dump -i i.db -o o.db -m d.db [-out dump] [-w 8]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *identifierDatabasePath == "" || *ociDatabasePath == "" || len(metadataPaths) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	identifierDatabase, err := ckit.OpenDatabase(*identifierDatabasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer identifierDatabase.Close()
+	ociDatabase, err := ckit.OpenDatabase(*ociDatabasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ociDatabase.Close()
+	g := &ckit.FetchGroup{}
+	if err := g.FromFiles(metadataPaths...); err != nil {
+		log.Fatal(err)
+	}
+	srv := &ckit.Server{
+		IdentifierDatabase: identifierDatabase,
+		OciDatabase:        ociDatabase,
+		IndexData:          g,
+		Router:             mux.NewRouter(),
+		Stats:              stats.New(),
+	}
+	srv.Routes()
+	// The server logs every identifier without citations, which is most of
+	// them; keep only our own progress messages.
+	progress := log.New(os.Stderr, "", log.LstdFlags)
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	d := &ckit.Dumper{
+		Handler:  srv.Stats.Handler(srv),
+		Dir:      *outputDir,
+		Workers:  *numWorkers,
+		PartSize: *partSize,
+		Logger:   progress,
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	cp, err := d.Run(ctx, identifierDatabase, *identifierDatabasePath)
+	switch {
+	case err != nil && cp != nil:
+		progress.Fatalf("[xx] dump stopped after %d parts, run again to resume: %v", cp.Parts, err)
+	case err != nil:
+		progress.Fatal(err)
+	}
+	progress.Printf("[ok] dump: %d records in %d parts, %d without citations, %d errors",
+		cp.Records, cp.Parts, cp.Skipped, cp.Errors)
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/tabutils"
+	"github.com/slub/labe/go/ckit/xflag"
+	"github.com/thoas/stats"
+)
+
+// runEnrich adds citation data (citation_count, reference_count,
+// cited_by_ids, cites_ids) to index documents, without HTTP, e.g. to feed
+// them back into SOLR. Input lines are either local identifiers or JSON
+// documents with an "id" field, read from stdin.
+func runEnrich(args []string) {
+	var (
+		fs                     = flag.NewFlagSet("enrich", flag.ExitOnError)
+		identifierDatabasePath = fs.String("i", "", "identifier database path or postgres:// DSN (id-doi mapping)")
+		ociDatabasePath        = fs.String("o", "", "oci as a database path or postgres:// DSN (citations)")
+		numWorkers             = fs.Int("w", runtime.NumCPU(), "number of workers")
+		metadataPaths          xflag.Array
+	)
+	fs.Var(&metadataPaths, "m", "index metadata cache sqlite3 path, to fetch documents for identifiers (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed enrich -i i.db -o o.db [-m d.db] < input > output.ndj\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *identifierDatabasePath == "" || *ociDatabasePath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	identifierDatabase, err := ckit.OpenDatabase(*identifierDatabasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer identifierDatabase.Close()
+	ociDatabase, err := ckit.OpenDatabase(*ociDatabasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ociDatabase.Close()
+	g := &ckit.FetchGroup{}
+	if err := g.FromFiles(metadataPaths...); err != nil {
+		log.Fatal(err)
+	}
+	// Measurements are recorded, but never served.
+	st := stats.New()
+	st.MetricsCounts = make(map[string]int)
+	st.MetricsTimers = make(map[string]time.Time)
+	srv := &ckit.Server{
+		IdentifierDatabase: identifierDatabase,
+		OciDatabase:        ociDatabase,
+		IndexData:          g,
+		Stats:              st,
+	}
+	r, err := tabutils.DecompressReader(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	bw := bufio.NewWriter(os.Stdout)
+	defer bw.Flush()
+	log.SetOutput(ioutil.Discard) // no per identifier messages
+	if err := srv.EnrichLines(context.Background(), r, bw, *numWorkers); err != nil {
+		bw.Flush()
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
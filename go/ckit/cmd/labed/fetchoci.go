@@ -0,0 +1,69 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runFetchOCI builds a citation database from the latest OpenCitations COCI
+// dump, read directly from figshare, without intermediate files.
+func runFetchOCI(args []string) {
+	var (
+		fs         = flag.NewFlagSet("fetch-oci", flag.ExitOnError)
+		outFile    = fs.String("out", "oci.db", "output citation database")
+		attributes = fs.Bool("attrs", false, "include edge attributes (oci, creation, timespan, journal_sc, author_sc), for edges=1 and provenance")
+		article    = fs.Int64("article", ckit.DefaultCociArticle, "figshare article of the COCI dump")
+		endpoint   = fs.String("figshare", ckit.DefaultFigshareEndpoint, "figshare API endpoint")
+		link       = fs.String("url", "", "read a zipped dump from this URL, instead of the latest figshare release")
+		file       = fs.String("file", "", "read a local dump (zip or CSV, optionally compressed), instead of the latest figshare release")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed fetch-oci [-out oci.db] [-attrs] [-url URL | -file FILE]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	w, err := ckit.NewCociWriter(*outFile, *attributes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var (
+		started = time.Now()
+		client  = &http.Client{} // dumps take hours to read, no timeout
+	)
+	switch {
+	case *file != "":
+		err = ckit.ImportCociFile(*file, w)
+	case *link != "":
+		err = ckit.ImportCociURL(ctx, client, *link, w)
+	default:
+		var a *ckit.FigshareArticle
+		if a, err = ckit.FetchFigshareArticle(ctx, nil, *endpoint, *article); err != nil {
+			break
+		}
+		log.Printf("coci: %s (version %d, %s)", a.Title, a.Version, a.Published)
+		err = ckit.ImportCociRelease(ctx, client, a, w)
+	}
+	if err != nil {
+		w.Abort()
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		w.Abort()
+		log.Fatal(err)
+	}
+	log.Printf("[ok] coci: %d edges (%d skipped) written to %s in %s",
+		w.Rows, w.Skipped, *outFile, time.Since(started).Round(time.Second))
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runHoldings loads holdings of an institution from KBART files or simple
+// identifier lists into an auxiliary database, which can be passed to the
+// server via -holdings.
+func runHoldings(args []string) {
+	var (
+		fs     = flag.NewFlagSet("holdings", flag.ExitOnError)
+		isil   = fs.String("isil", "", "ISIL of the institution, e.g. DE-14")
+		output = fs.String("out", "holdings.db", "output database path")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed holdings -isil DE-14 [-out holdings.db] [FILE ...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *isil == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	var holdings []ckit.Holding
+	if fs.NArg() == 0 {
+		h, err := ckit.ReadHoldings(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		holdings = h
+	}
+	for _, filename := range fs.Args() {
+		f, err := os.Open(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		h, err := ckit.ReadHoldings(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", filename, err)
+		}
+		holdings = append(holdings, h...)
+	}
+	if err := ckit.BuildHoldingsDatabase(*output, *isil, holdings); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// latencyBounds are the buckets of the latency histogram.
+var latencyBounds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// runLoadgen samples identifiers from the identifier database, generates a
+// skewed request sequence with a fraction of unknown identifiers and replays
+// it against a server, for capacity planning.
+func runLoadgen(args []string) {
+	var (
+		fs                     = flag.NewFlagSet("loadgen", flag.ExitOnError)
+		identifierDatabasePath = fs.String("i", "", "identifier database path or postgres:// DSN (id-doi mapping)")
+		server                 = fs.String("server", "", "labed server base URL, e.g. http://localhost:8000")
+		sampleSize             = fs.Int("sample", 10000, "number of distinct identifiers to sample")
+		numRequests            = fs.Int("n", 100000, "number of requests")
+		skew                   = fs.Float64("zipf", 1.1, "Zipf exponent of the request distribution, greater than 1 (0 means uniform)")
+		missing                = fs.Float64("missing", 0.05, "fraction of requests for unknown identifiers (404)")
+		seed                   = fs.Int64("seed", 1, "random seed, the same seed and sample give the same sequence")
+		concurrency            = fs.Int("c", 8, "number of parallel requests")
+		rate                   = fs.Float64("rate", 0, "maximum number of requests per second (0 means no limit)")
+		save                   = fs.String("save", "", "write the request sequence to a file, to replay it later with labed warm or bench")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed loadgen -i i.db -server http://localhost:8000 [-n 100000] [-zipf 1.1] [-missing 0.05]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *identifierDatabasePath == "" || (*server == "" && *save == "") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	identifierDatabase, err := ckit.OpenDatabase(*identifierDatabasePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer identifierDatabase.Close()
+	sample, err := ckit.SampleKeysSeed(identifierDatabase, *sampleSize, *seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[ok] sampled %d identifiers", len(sample))
+	profile := ckit.LoadProfile{Skew: *skew, Missing: *missing, Seed: *seed}
+	ids, err := profile.Generate(sample, *numRequests)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *save != "" {
+		if err := os.WriteFile(*save, []byte(strings.Join(ids, "\n")+"\n"), 0644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("[ok] wrote %d requests to %s", len(ids), *save)
+	}
+	if *server == "" {
+		return
+	}
+	w := &ckit.Warmer{
+		Server:  *server,
+		Workers: *concurrency,
+		Rate:    *rate,
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	stats, err := w.Run(ctx, strings.NewReader(strings.Join(ids, "\n")))
+	fmt.Println(stats)
+	fmt.Print(stats.HistogramTable(latencyBounds))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
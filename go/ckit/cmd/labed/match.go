@@ -0,0 +1,38 @@
+//go:build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runMatch writes normalized titles of index documents without a DOI into an
+// auxiliary database, which can be passed to the server via -match.
+func runMatch(args []string) {
+	var (
+		fs     = flag.NewFlagSet("match", flag.ExitOnError)
+		output = fs.String("out", "match.db", "output database path")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed match [-out match.db] d.db [d2.db ...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	for _, path := range fs.Args() {
+		if _, err := os.Stat(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := ckit.BuildMatchDatabase(*output, fs.Args()...); err != nil {
+		log.Fatal(err)
+	}
+}
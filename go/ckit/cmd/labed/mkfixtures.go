@@ -0,0 +1,58 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/xflag"
+)
+
+// runMkfixtures extracts small databases around a few seed identifiers, for
+// integration tests and local development.
+func runMkfixtures(args []string) {
+	var (
+		fs             = flag.NewFlagSet("mkfixtures", flag.ExitOnError)
+		identifierPath = fs.String("i", "", "identifier database path (id-doi mapping)")
+		ociPath        = fs.String("o", "", "oci as a database path (citations)")
+		seedFile       = fs.String("file", "", "file with seed identifiers, one per line, in addition to arguments")
+		output         = fs.String("out", "fixtures", "output directory")
+		metadataPaths  xflag.Array
+	)
+	fs.Var(&metadataPaths, "m", "index metadata cache sqlite3 path (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed mkfixtures -i i.db -o o.db -m d.db [-out fixtures] ID [ID ...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	seeds := fs.Args()
+	if *seedFile != "" {
+		f, err := os.Open(*seedFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		br := bufio.NewScanner(f)
+		for br.Scan() {
+			if v := strings.TrimSpace(br.Text()); v != "" {
+				seeds = append(seeds, v)
+			}
+		}
+		if err := br.Err(); err != nil {
+			log.Fatal(err)
+		}
+		f.Close()
+	}
+	if *identifierPath == "" || *ociPath == "" || len(metadataPaths) == 0 || len(seeds) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := ckit.ExtractFixtures(*output, seeds, *identifierPath, *ociPath, metadataPaths); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runPromote switches a running server to a new snapshot of its datasets,
+// after validating it, and warms the cache; the previous snapshot is kept
+// for a rollback.
+func runPromote(args []string) {
+	var (
+		fs       = flag.NewFlagSet("promote", flag.ExitOnError)
+		current  = fs.String("current", "/data/current", "symlink to the active snapshot, which the server opens its databases through")
+		admin    = fs.String("admin", "http://localhost:8001", "labed admin base URL (see: -admin-addr)")
+		server   = fs.String("server", "http://localhost:8000", "labed server base URL, for warming the cache")
+		noFlush  = fs.Bool("no-flush", false, "keep cached responses, which may be stale after the switch")
+		warmFile = fs.String("warm", "", "file with identifiers to request after the switch, one per line (optional)")
+		sample   = fs.Int("sample", 100, "number of identifiers to sample from the identifier database -i of the new snapshot for warming, if no -warm file is given")
+		idName   = fs.String("i", "", "filename of the identifier database in the snapshot, e.g. i.db, for -sample")
+		workers  = fs.Int("workers", 4, "number of parallel warming requests")
+		rollback = fs.Bool("rollback", false, "switch back to the previous snapshot")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed promote [-current /data/current] [-i i.db] /path/to/new-snapshot\n")
+		fmt.Fprintf(os.Stderr, "       labed promote -rollback [-current /data/current]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *rollback != (fs.NArg() == 0) || fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	p := &ckit.Promotion{
+		Current: *current,
+		Admin:   *admin,
+		Server:  *server,
+		Flush:   !*noFlush,
+		Workers: *workers,
+	}
+	var (
+		report *ckit.PromotionReport
+		err    error
+	)
+	if *rollback {
+		report, err = p.Rollback(ctx)
+	} else {
+		dir := fs.Arg(0)
+		switch {
+		case *warmFile != "":
+			p.WarmIDs, err = readLines(*warmFile)
+		case *idName != "" && *sample > 0:
+			p.WarmIDs, err = sampleIdentifiers(filepath.Join(dir, *idName), *sample)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		report, err = p.Promote(ctx, dir)
+	}
+	if report != nil && report.Validation != nil {
+		report.Validation.WriteTo(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[ok] switched from %s to %s, changed: %v", report.Previous, report.Current, report.Reload.Changed)
+	if report.Warm != nil {
+		log.Printf("[ok] warm: %s", report.Warm)
+	}
+}
+
+// readLines returns the non-empty lines of a file.
+func readLines(filename string) (lines []string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// sampleIdentifiers returns up to n random local identifiers from an
+// identifier database.
+func sampleIdentifiers(filename string, n int) ([]string, error) {
+	db, err := ckit.OpenDatabase(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return ckit.SampleKeys(db, n)
+}
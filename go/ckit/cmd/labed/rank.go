@@ -0,0 +1,44 @@
+//go:build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runRank computes PageRank scores over a citation database into an
+// auxiliary database, which can be passed to the server via -rank.
+func runRank(args []string) {
+	var (
+		fs         = flag.NewFlagSet("rank", flag.ExitOnError)
+		ociPath    = fs.String("o", "", "oci as a database path (citations)")
+		output     = fs.String("out", "rank.db", "output database path")
+		damping    = fs.Float64("d", ckit.DefaultPageRank.Damping, "damping factor")
+		iterations = fs.Int("n", ckit.DefaultPageRank.Iterations, "maximum number of iterations")
+		tolerance  = fs.Float64("tol", ckit.DefaultPageRank.Tolerance, "stop, if scores change less than this (L1)")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed rank -o o.db [-out rank.db]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *ociPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if _, err := os.Stat(*ociPath); err != nil {
+		log.Fatal(err)
+	}
+	if *damping <= 0 || *damping >= 1 {
+		log.Fatalf("damping factor must be between 0 and 1, got %v", *damping)
+	}
+	p := ckit.PageRank{Damping: *damping, Iterations: *iterations, Tolerance: *tolerance}
+	if err := ckit.BuildRankDatabase(*ociPath, *output, p); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runReferences builds an additional citation database from the reference
+// lists of Crossref works or the related identifiers of DataCite records,
+// read from public data files or harvested from the REST APIs.
+func runReferences(args []string) {
+	var (
+		fs      = flag.NewFlagSet("references", flag.ExitOnError)
+		outFile = fs.String("out", "references.db", "output citation database, pass it to the server with -O name:path")
+		source  = fs.String("source", "crossref", "source of references: crossref, datacite")
+		api     = fs.Bool("api", false, "harvest the REST API, instead of reading files")
+		filter  = fs.String("filter", "", "restrict harvested records, Crossref filter (e.g. from-index-date:2023-01-01) or DataCite query")
+		mailto  = fs.String("mailto", "", "contact email for the Crossref polite pool (also sent to DataCite)")
+		rows    = fs.Int("rows", ckit.DefaultHarvestRows, "records per page, when harvesting")
+		timeout = fs.Duration("timeout", time.Minute, "timeout per page, when harvesting")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed references [-source crossref] -out references.db [-api | FILE ...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	var (
+		read    func(io.Reader, *ckit.CociWriter) error
+		harvest func(context.Context, ckit.HarvestOptions, *ckit.CociWriter) error
+	)
+	switch *source {
+	case "crossref":
+		read, harvest = ckit.ReadCrossrefWorks, ckit.HarvestCrossref
+	case "datacite":
+		read, harvest = ckit.ReadDataCiteRecords, ckit.HarvestDataCite
+	default:
+		log.Fatalf("unknown source: %s", *source)
+	}
+	if !*api && fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	w, err := ckit.NewCociWriter(*outFile, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	started := time.Now()
+	if *api {
+		err = harvest(ctx, ckit.HarvestOptions{
+			Mailto: *mailto,
+			Client: &http.Client{Timeout: *timeout},
+			Rows:   *rows,
+			Filter: *filter,
+		}, w)
+	}
+	for _, filename := range fs.Args() {
+		if err != nil {
+			break
+		}
+		err = readReferenceFile(filename, w, read)
+	}
+	if err != nil {
+		w.Abort()
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		w.Abort()
+		log.Fatal(err)
+	}
+	log.Printf("[ok] references: %d edges (%d skipped) written to %s in %s",
+		w.Rows, w.Skipped, *outFile, time.Since(started).Round(time.Second))
+}
+
+// readReferenceFile reads a single file.
+func readReferenceFile(filename string, w *ckit.CociWriter, read func(io.Reader, *ckit.CociWriter) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ckit.ReadReferenceFile(f, w, read); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
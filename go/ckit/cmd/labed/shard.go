@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runShard splits a citation database into shards, which can be passed to
+// the server via -oci-shards.
+func runShard(args []string) {
+	var (
+		fs      = flag.NewFlagSet("shard", flag.ExitOnError)
+		ociPath = fs.String("o", "", "oci as a database path (citations)")
+		n       = fs.Int("n", 16, "number of shards")
+		prefix  = fs.String("out", "o-shard", "output filename prefix, shards are named prefix-00.db, prefix-01.db, ...")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed shard -o o.db [-n 16] [-out o-shard]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *ociPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if _, err := os.Stat(*ociPath); err != nil {
+		log.Fatal(err)
+	}
+	filenames, err := ckit.BuildOciShards(*ociPath, *prefix, *n)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, filename := range filenames {
+		fmt.Println(filename)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runWarm requests identifiers from a file (or stdin) from a running server,
+// so expensive responses are cached ahead of time, e.g. after a dataset swap.
+func runWarm(args []string) {
+	var (
+		fs       = flag.NewFlagSet("warm", flag.ExitOnError)
+		filename = fs.String("file", "", "file with one identifier per line (stdin, if empty)")
+		server   = fs.String("server", "http://localhost:8000", "labed server base URL")
+		workers  = fs.Int("workers", 8, "number of parallel requests")
+		rate     = fs.Float64("rate", 0, "maximum number of requests per second (0 means no limit)")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: labed warm [-file ids.txt] [-workers 8] [-server http://localhost:8000]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	var r io.Reader = os.Stdin
+	if *filename != "" {
+		f, err := os.Open(*filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	w := &ckit.Warmer{
+		Server:  *server,
+		Workers: *workers,
+		Rate:    *rate,
+	}
+	stats, err := w.Run(ctx, r)
+	log.Printf("[ok] warm: %s", stats)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/slub/labe/go/ckit"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+// runDelta applies additions and deletions to an existing database.
+func runDelta(args []string) {
+	var (
+		fs        = flag.NewFlagSet("delta", flag.ExitOnError)
+		additions = fs.String("a", "", "additions, TSV with one field per column (may be compressed)")
+		deletions = fs.String("d", "", "deletions, one key or tab separated key and value per line (may be compressed)")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: makta delta [-a additions.tsv] [-d deletions.tsv] data.db\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*additions == "" && *deletions == "") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if _, err := os.Stat(fs.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+	db, err := sqlx.Open("sqlite3", fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	var a, d io.Reader
+	if *additions != "" {
+		r, err := openCompressed(*additions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer r.Close()
+		a = r
+	}
+	if *deletions != "" {
+		r, err := openCompressed(*deletions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer r.Close()
+		d = r
+	}
+	if _, err := ckit.ApplyDelta(db, a, d); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// compressedFile closes both the decompressor and the file.
+type compressedFile struct {
+	io.ReadCloser
+	f *os.File
+}
+
+// Close closes the decompressor and the file.
+func (c *compressedFile) Close() error {
+	c.ReadCloser.Close()
+	return c.f.Close()
+}
+
+// openCompressed opens a file, that may be gzip or zstd compressed.
+func openCompressed(filename string) (io.ReadCloser, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	r, err := tabutils.DecompressReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &compressedFile{ReadCloser: r, f: f}, nil
+}
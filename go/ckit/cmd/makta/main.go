@@ -1,4 +1,7 @@
 // makta takes a two column TSV file and turns it into an indexed sqlite3 database.
+// It can also read newline delimited JSON and select key and value fields.
+// Input is read from files given as arguments or stdin and may be gzip or zstd
+// compressed.
 package main
 
 import (
@@ -7,8 +10,10 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"runtime"
 	"strings"
 	"time"
 
@@ -30,23 +35,71 @@ var (
 	initDatabase = flag.Bool("init", false, "on start, initialize database, even when the file already exists")
 	valueType    = flag.String("T", "TEXT", "sqlite3 type for value column")
 	verbose      = flag.Bool("verbose", false, "be verbose")
+	inputFormat  = flag.String("f", "tsv", "input format: tsv, ndjson")
+	keyField     = flag.String("k", "id", "key field for ndjson input, e.g. id or a.b")
+	valueField   = flag.String("v", ".", "value field for ndjson input, . for the whole document")
+	quiet        = flag.Bool("quiet", false, "do not display progress")
+	resume       = flag.Bool("resume", false, "resume an interrupted import from its checkpoint")
+	extraColumns = flag.String("c", "", "additional columns after k and v, comma separated, with optional type, e.g. oci,creation,timespan:TEXT")
+	extraIndexes = flag.String("X", "", "additional columns to index, comma separated")
+	numWorkers   = flag.Int("w", runtime.NumCPU(), "number of workers for parsing input")
+	sortedInput  = flag.Bool("sorted", false, "input is sorted by key, build a clustered table without separate key index")
+
+	// subcommands are dispatched on the first argument.
+	subcommands = map[string]func(args []string){
+		"delta": runDelta,
+		"merge": runMerge,
+	}
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
 	if !ckit.SliceContains(validTypes, *valueType) {
 		log.Fatalf("invalid type for value column: %v %v", *valueType, validTypes)
 	}
+	if *inputFormat != "tsv" && *inputFormat != "ndjson" {
+		log.Fatalf("invalid input format: %v", *inputFormat)
+	}
+	columns, err := tabutils.ParseColumns(*extraColumns)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range columns {
+		if !ckit.SliceContains(validTypes, c.Type) {
+			log.Fatalf("invalid type for column %s: %v %v", c.Name, c.Type, validTypes)
+		}
+	}
+	if len(columns) > 0 && *inputFormat != "tsv" {
+		log.Fatal("additional columns require tsv input")
+	}
+	var indexColumns []string
+	for _, name := range strings.Split(*extraIndexes, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		var found bool
+		for _, c := range columns {
+			found = found || c.Name == name
+		}
+		if !found {
+			log.Fatalf("cannot index unknown column: %v", name)
+		}
+		indexColumns = append(indexColumns, name)
+	}
 	var (
-		err      error
 		initFile string
 		pragma   = fmt.Sprintf(`
 PRAGMA journal_mode = OFF;
 PRAGMA synchronous = 0;
 PRAGMA cache_size = %d;
 PRAGMA locking_mode = EXCLUSIVE;`, *cacheSize)
-		initSQL = `
-CREATE TABLE IF NOT EXISTS map (k TEXT, v %s);`
+		initSQL     = tabutils.CreateTableSQL(*valueType, columns, *sortedInput)
 		keyIndexSQL = fmt.Sprintf(`
 %s
 CREATE INDEX IF NOT EXISTS idx_k ON map(k);`, pragma)
@@ -64,14 +117,35 @@ PRAGMA temp_store = MEMORY;
 		fmt.Printf("makta %s %s\n", Version, Buildtime)
 		os.Exit(0)
 	}
-	if termutil.Isatty(os.Stdin.Fd()) {
-		log.Println("stdin: no data")
-		os.Exit(1)
+	filenames := flag.Args()
+	if len(filenames) == 0 {
+		if termutil.Isatty(os.Stdin.Fd()) {
+			log.Println("stdin: no data")
+			os.Exit(1)
+		}
+		filenames = []string{"-"}
+	}
+	var (
+		checkpointFile = tabutils.CheckpointPath(*outputFile)
+		checkpoint     = &tabutils.Checkpoint{Filenames: filenames}
+	)
+	if *resume {
+		if *initDatabase {
+			log.Fatal("cannot resume and initialize database at the same time")
+		}
+		if checkpoint, err = tabutils.ReadCheckpoint(checkpointFile); err != nil {
+			log.Fatalf("resume: %v", err)
+		}
+		if err := checkpoint.Matches(filenames); err != nil {
+			log.Fatalf("resume: %v", err)
+		}
+		log.Printf("[ok] resuming import at file %d, offset %d, %d rows imported",
+			checkpoint.FileIndex, checkpoint.Offset, checkpoint.Rows)
 	}
 	_, err = os.Stat(*outputFile)
-	if err != nil || *initDatabase {
+	if (err != nil || *initDatabase) && !*resume {
 		if os.IsNotExist(err) || *initDatabase {
-			if err := tabutils.RunScript(*outputFile, fmt.Sprintf(initSQL, *valueType), "initialized database"); err != nil {
+			if err := tabutils.RunScript(*outputFile, initSQL, "initialized database"); err != nil {
 				log.Fatal(err)
 			}
 		} else {
@@ -81,18 +155,35 @@ PRAGMA temp_store = MEMORY;
 	if initFile, err = tabutils.TempFileReader(strings.NewReader(importSQL)); err != nil {
 		log.Fatal(err)
 	}
+	if !*resume {
+		// An initial checkpoint, so we can resume, even if the first batch
+		// fails.
+		if err := checkpoint.WriteFile(checkpointFile); err != nil {
+			log.Fatalf("checkpoint: %v", err)
+		}
+	}
 	var (
-		br          = bufio.NewReader(os.Stdin)
-		buf         bytes.Buffer
-		written     int64
-		started     = time.Now()
-		elapsed     float64
-		numBatches  int
+		buf        bytes.Buffer
+		written    int64
+		started    = time.Now()
+		elapsed    float64
+		numBatches int
+		// Position of the data in buf: the index of the current file, the
+		// offset in the current file and the number of rows so far.
+		fileIndex   = checkpoint.FileIndex
+		offset      = checkpoint.Offset
+		rows        = checkpoint.Rows
 		importBatch = func() error {
 			n, err := tabutils.RunImport(&buf, initFile, *outputFile)
 			if err != nil {
 				return fmt.Errorf("import: %w", err)
 			}
+			checkpoint.FileIndex = fileIndex
+			checkpoint.Offset = offset
+			checkpoint.Rows = rows
+			if err := checkpoint.WriteFile(checkpointFile); err != nil {
+				return fmt.Errorf("checkpoint: %w", err)
+			}
 			written += n
 			numBatches++
 			elapsed = time.Since(started).Seconds()
@@ -101,36 +192,102 @@ PRAGMA temp_store = MEMORY;
 					numBatches,
 					tabutils.ByteSize(int(written)),
 					tabutils.HumanSpeed(written, elapsed))
-			} else {
-				tabutils.Flushf("written %s · %s",
-					tabutils.ByteSize(int(written)),
-					tabutils.HumanSpeed(written, elapsed))
 			}
 			return nil
 		}
-		indexScripts []string
+		indexScripts  []string
+		keySelector   = tabutils.ParseSelector(*keyField)
+		valueSelector = tabutils.ParseSelector(*valueField)
+		sortedFilter  tabutils.SortedFilter
+		// convert turns an input line into TSV rows; parsing runs in
+		// parallel, while imports are sequential.
+		convert = func(b []byte) ([]byte, error) {
+			if *inputFormat == "ndjson" {
+				return tabutils.NDJSONRows(b, keySelector, valueSelector)
+			}
+			return b, nil
+		}
+		progress = tabutils.NewProgress(inputSize(filenames))
+		done     = make(chan struct{})
+		stopped  = make(chan struct{})
 	)
-	for {
-		b, err := br.ReadBytes('\n')
-		if err == io.EOF {
-			break
+	if !*quiet && !*verbose {
+		go func() {
+			progress.Report(time.Second, done)
+			close(stopped)
+		}()
+	} else {
+		close(stopped)
+	}
+	// readInput reads a file (or stdin, if filename is "-"), which may be
+	// gzip or zstd compressed and imports all lines in batches, starting at
+	// a given offset.
+	readInput := func(filename string, skip int64) error {
+		var r io.Reader = os.Stdin
+		if filename != "-" {
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
 		}
+		dr, err := tabutils.DecompressReader(progress.Reader(r))
 		if err != nil {
-			log.Fatalf("read: %v", err)
+			return err
 		}
-		if _, err := buf.Write(b); err != nil {
-			log.Fatalf("write: %v", err)
+		defer dr.Close()
+		br := bufio.NewReader(dr)
+		if _, err := io.CopyN(ioutil.Discard, br, skip); err != nil {
+			return fmt.Errorf("skip to offset %d: %w", skip, err)
 		}
-		if buf.Len() >= *bufferSize {
-			if err := importBatch(); err != nil {
-				log.Fatalf("batch: %v", err)
+		offset = skip
+		return tabutils.ConvertLines(br, *numWorkers, convert, func(b []byte, numRows, size int64) error {
+			if *sortedInput {
+				var err error
+				if b, numRows, err = sortedFilter.Filter(b); err != nil {
+					return err
+				}
+			}
+			if _, err := buf.Write(b); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+			offset += size
+			rows += numRows
+			progress.AddRows(numRows)
+			if buf.Len() >= *bufferSize {
+				if err := importBatch(); err != nil {
+					return fmt.Errorf("batch: %w", err)
+				}
 			}
+			return nil
+		})
+	}
+	progress.AddRows(rows)
+	for i, filename := range filenames {
+		if checkpoint.Done || i < checkpoint.FileIndex {
+			continue
+		}
+		var skip int64
+		if i == checkpoint.FileIndex {
+			skip = checkpoint.Offset
+		}
+		fileIndex = i
+		if err := readInput(filename, skip); err != nil {
+			log.Fatalf("%s: %v", filename, err)
+		}
+	}
+	if !checkpoint.Done {
+		checkpoint.Done = true
+		if err := importBatch(); err != nil {
+			log.Fatalf("batch: %v", err)
 		}
 	}
-	if err := importBatch(); err != nil {
-		log.Fatalf("batch: %v", err)
+	close(done)
+	<-stopped
+	if !*quiet && !*verbose {
+		fmt.Println()
 	}
-	fmt.Println()
 	switch *indexMode {
 	case 1:
 		indexScripts = []string{
@@ -148,6 +305,13 @@ PRAGMA temp_store = MEMORY;
 	default:
 		log.Printf("no index requested")
 	}
+	if *sortedInput && (*indexMode == 1 || *indexMode == 3) {
+		// The primary key of the clustered table already is an index on k.
+		indexScripts = indexScripts[1:]
+	}
+	for _, name := range indexColumns {
+		indexScripts = append(indexScripts, pragma+"\n"+tabutils.CreateIndexSQL(name))
+	}
 	log.Printf("[io] building %d indices ...", len(indexScripts))
 	for i, script := range indexScripts {
 		msg := fmt.Sprintf("%d/%d created index", i+1, len(indexScripts))
@@ -155,4 +319,29 @@ PRAGMA temp_store = MEMORY;
 			log.Fatalf("run script: %v", err)
 		}
 	}
+	if err := os.Remove(checkpointFile); err != nil && !os.IsNotExist(err) {
+		log.Printf("could not remove checkpoint: %v", err)
+	}
+}
+
+// inputSize returns the total size of the input files in bytes or 0, if the
+// size is unknown, e.g. when reading from a pipe.
+func inputSize(filenames []string) int64 {
+	var total int64
+	for _, filename := range filenames {
+		var (
+			fi  os.FileInfo
+			err error
+		)
+		if filename == "-" {
+			fi, err = os.Stdin.Stat()
+		} else {
+			fi, err = os.Stat(filename)
+		}
+		if err != nil || !fi.Mode().IsRegular() {
+			return 0
+		}
+		total += fi.Size()
+	}
+	return total
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/slub/labe/go/ckit"
+)
+
+// runMerge unions several databases into a new one, removing duplicates.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: makta merge out.db a.db b.db ...\n")
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := ckit.MergeDatabases(fs.Arg(0), fs.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,521 @@
+package ckit
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+const (
+	// cociBatchSize is the number of rows inserted per transaction.
+	cociBatchSize = 1000000
+	// rangeBlockSize is the size of a single range request; rangeBlocks
+	// blocks are kept, as zip archives are read mostly sequentially.
+	rangeBlockSize = 8 << 20
+	rangeBlocks    = 4
+	// rangeRetries is the number of attempts per range request.
+	rangeRetries = 3
+)
+
+// cociColumns are the columns of the COCI CSV dumps, if there is no header.
+var cociColumns = []string{"oci", "citing", "cited", "creation", "timespan", "journal_sc", "author_sc"}
+
+// CociDOI returns the normalized (lowercase) DOI of a citing or cited field
+// of a COCI dump, which may be a plain DOI, a DOI with "doi:" or resolver
+// prefix or a space separated list of prefixed identifiers (as in later OpenCitations
+// dumps); the empty string, if there is no DOI.
+func CociDOI(s string) string {
+	for _, v := range strings.Fields(s) {
+		v = strings.ToLower(v)
+		v = strings.TrimPrefix(v, "doi:")
+		if i := strings.Index(v, "doi.org/"); i >= 0 {
+			v = v[i+len("doi.org/"):]
+		}
+		if strings.HasPrefix(v, "10.") && strings.Contains(v, "/") {
+			return v
+		}
+	}
+	return ""
+}
+
+// CociWriter writes edges from COCI CSV dumps into a new citation database,
+// with a map table as created by makta (k is the citing, v the cited DOI)
+// and indexes on k and v. With attributes, the edge attribute columns (oci,
+// creation, ...) are included and the oci column is indexed as well. The
+// database is written to a temporary file, which is renamed on Close.
+type CociWriter struct {
+	Rows    int64 // edges written
+	Skipped int64 // rows without citing or cited DOI, or malformed
+	// Snapshot, if set, is recorded as the release the database was built
+	// from, see ReadSnapshot.
+	Snapshot *Snapshot
+
+	filename   string
+	attributes bool
+	db         *sqlx.DB
+	tx         *sqlx.Tx
+	stmt       *sqlx.Stmt
+	pending    int
+}
+
+// NewCociWriter creates a citation database; the file must not exist.
+func NewCociWriter(filename string, attributes bool) (*CociWriter, error) {
+	if _, err := os.Stat(filename); err == nil {
+		return nil, fmt.Errorf("file exists: %s", filename)
+	}
+	tmp := filename + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	db, err := sqlx.Open("sqlite3", tmp)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	var columns []tabutils.Column
+	if attributes {
+		for _, name := range edgeMetaColumns {
+			columns = append(columns, tabutils.Column{Name: name, Type: "TEXT"})
+		}
+	}
+	w := &CociWriter{filename: filename, attributes: attributes, db: db}
+	for _, q := range []string{
+		"PRAGMA journal_mode = OFF",
+		"PRAGMA synchronous = 0",
+		tabutils.CreateTableSQL("TEXT", columns, false),
+	} {
+		if _, err := db.Exec(q); err != nil {
+			w.Abort()
+			return nil, err
+		}
+	}
+	if err := w.begin(); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// begin starts a transaction.
+func (w *CociWriter) begin() (err error) {
+	if w.tx, err = w.db.Beginx(); err != nil {
+		return err
+	}
+	n := 2
+	if w.attributes {
+		n += len(edgeMetaColumns)
+	}
+	w.stmt, err = w.tx.Preparex(fmt.Sprintf("INSERT INTO map VALUES (%s)",
+		strings.TrimSuffix(strings.Repeat("?, ", n), ", ")))
+	return err
+}
+
+// commit ends the current transaction.
+func (w *CociWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	w.stmt.Close()
+	err := w.tx.Commit()
+	w.tx, w.stmt, w.pending = nil, nil, 0
+	return err
+}
+
+// ReadCSV writes all edges from a COCI CSV file. A header line, if any,
+// determines the column order.
+func (w *CociWriter) ReadCSV(r io.Reader) error {
+	var (
+		cr      = csv.NewReader(r)
+		index   = make(map[string]int)
+		args    = make([]interface{}, 2, 2+len(edgeMetaColumns))
+		started = true
+	)
+	cr.ReuseRecord = true
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	for i, name := range cociColumns {
+		index[name] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := index[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			w.Skipped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if started && len(record) > 0 && record[0] == "oci" {
+			for i, name := range record {
+				index[name] = i
+			}
+			started = false
+			continue
+		}
+		started = false
+		citing, cited := CociDOI(field(record, "citing")), CociDOI(field(record, "cited"))
+		if citing == "" || cited == "" {
+			w.Skipped++
+			continue
+		}
+		args = append(args[:0], citing, cited)
+		if w.attributes {
+			for _, name := range edgeMetaColumns {
+				args = append(args, field(record, name))
+			}
+		}
+		if err := w.insert(args); err != nil {
+			return err
+		}
+	}
+}
+
+// WriteEdge writes a single edge, e.g. from other sources of references;
+// DOI are normalized like in COCI dumps and edge attributes are left empty.
+func (w *CociWriter) WriteEdge(citing, cited string) error {
+	citing, cited = CociDOI(citing), CociDOI(cited)
+	if citing == "" || cited == "" {
+		w.Skipped++
+		return nil
+	}
+	args := []interface{}{citing, cited}
+	if w.attributes {
+		for range edgeMetaColumns {
+			args = append(args, "")
+		}
+	}
+	return w.insert(args)
+}
+
+// insert writes a row, committing every cociBatchSize rows.
+func (w *CociWriter) insert(args []interface{}) error {
+	if _, err := w.stmt.Exec(args...); err != nil {
+		return err
+	}
+	w.Rows++
+	if w.pending++; w.pending >= cociBatchSize {
+		if err := w.commit(); err != nil {
+			return err
+		}
+		return w.begin()
+	}
+	return nil
+}
+
+// Close commits the remaining edges, creates the indexes and moves the
+// database into place.
+func (w *CociWriter) Close() error {
+	if err := w.commit(); err != nil {
+		return err
+	}
+	if w.Snapshot != nil {
+		if err := WriteSnapshot(w.db, w.Snapshot); err != nil {
+			return err
+		}
+	}
+	indexes := []string{"k", "v"}
+	if w.attributes {
+		indexes = append(indexes, "oci")
+	}
+	for _, column := range indexes {
+		t := time.Now()
+		if _, err := w.db.Exec(tabutils.CreateIndexSQL(column)); err != nil {
+			return fmt.Errorf("index %s: %w", column, err)
+		}
+		log.Printf("[ok] coci: created index on %s (%s)", column, time.Since(t))
+	}
+	if err := w.db.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.filename+".tmp", w.filename)
+}
+
+// Abort discards the database.
+func (w *CociWriter) Abort() {
+	if w.tx != nil {
+		w.tx.Rollback()
+	}
+	w.db.Close()
+	os.Remove(w.filename + ".tmp")
+}
+
+// ReadCociArchive writes the edges of all CSV files in a zip archive, also
+// in nested zip archives (as in the COCI dumps). Nested archives, which are
+// stored without compression, are read in place, others are extracted into
+// a temporary file first.
+func ReadCociArchive(r io.ReaderAt, size int64, w *CociWriter) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".csv":
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			rows := w.Rows
+			err = w.ReadCSV(rc)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			log.Printf("[ok] coci: %s: %d edges", f.Name, w.Rows-rows)
+		case ".zip":
+			if err := readNestedArchive(r, f, w); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readNestedArchive reads a zip archive within a zip archive.
+func readNestedArchive(r io.ReaderAt, f *zip.File, w *CociWriter) error {
+	if f.Method == zip.Store {
+		offset, err := f.DataOffset()
+		if err != nil {
+			return err
+		}
+		size := int64(f.UncompressedSize64)
+		return ReadCociArchive(io.NewSectionReader(r, offset, size), size, w)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tmp, err := os.CreateTemp("", "labe-coci-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, rc)
+	if err != nil {
+		return err
+	}
+	return ReadCociArchive(tmp, size, w)
+}
+
+// ImportCociFile writes the edges of a local COCI dump, a zip archive or a
+// (possibly gzip or zstd compressed) CSV file.
+func ImportCociFile(filename string, w *CociWriter) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.EqualFold(path.Ext(filename), ".zip") {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return ReadCociArchive(f, fi.Size(), w)
+	}
+	dr, err := tabutils.DecompressReader(f)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	return w.ReadCSV(dr)
+}
+
+// ImportCociURL writes the edges of a zipped COCI dump at a URL. If the
+// server supports range requests, the archive is read in place, without
+// downloading it first; otherwise it is downloaded into a temporary file.
+func ImportCociURL(ctx context.Context, c *http.Client, link string, w *CociWriter) error {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	req.Header.Set("User-Agent", resolverUserAgent(""))
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		size, err := contentRangeSize(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		r := &rangeReaderAt{ctx: ctx, client: c, link: link, size: size}
+		return ReadCociArchive(r, size, w)
+	case http.StatusOK:
+		log.Printf("coci: no range requests supported, downloading %s", link)
+		tmp, err := os.CreateTemp("", "labe-coci-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		size, err := io.Copy(tmp, resp.Body)
+		if err != nil {
+			return err
+		}
+		return ReadCociArchive(tmp, size, w)
+	default:
+		return fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	}
+}
+
+// ImportCociRelease writes the edges of all zip archives of a release of the
+// COCI dump on figshare and records the release as the snapshot.
+func ImportCociRelease(ctx context.Context, c *http.Client, a *FigshareArticle, w *CociWriter) error {
+	var n int
+	for _, f := range a.Files {
+		if !strings.EqualFold(path.Ext(f.Name), ".zip") {
+			continue
+		}
+		n++
+		log.Printf("coci: reading %s (%d bytes)", f.Name, f.Size)
+		if err := ImportCociURL(ctx, c, f.DownloadURL, w); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("coci: no zip files in figshare article %d", a.ID)
+	}
+	w.Snapshot = SnapshotOf(a)
+	return nil
+}
+
+// contentRangeSize returns the complete length from a Content-Range header,
+// e.g. "bytes 0-0/1234".
+func contentRangeSize(s string) (int64, error) {
+	i := strings.LastIndex(s, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid content range: %q", s)
+	}
+	size, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unknown content length: %q", s)
+	}
+	return size, nil
+}
+
+// rangeReaderAt reads a remote file with HTTP range requests, in blocks, of
+// which the most recently used are kept.
+type rangeReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	link   string
+	size   int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64 // block numbers, most recently used last
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		b, err := r.block(pos / rangeBlockSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], b[pos%rangeBlockSize:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns a block, fetching it, if required.
+func (r *rangeReaderAt) block(i int64) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.blocks[i]; ok {
+		for j, v := range r.order {
+			if v == i {
+				r.order = append(append(r.order[:j:j], r.order[j+1:]...), i)
+				break
+			}
+		}
+		return b, nil
+	}
+	var (
+		b   []byte
+		err error
+	)
+	for attempt := 1; attempt <= rangeRetries; attempt++ {
+		if b, err = r.fetch(i); err == nil || r.ctx.Err() != nil {
+			break
+		}
+		log.Printf("coci: range request failed (attempt %d/%d): %v", attempt, rangeRetries, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.blocks == nil {
+		r.blocks = make(map[int64][]byte)
+	}
+	if len(r.order) >= rangeBlocks {
+		delete(r.blocks, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.blocks[i] = b
+	r.order = append(r.order, i)
+	return b, nil
+}
+
+// fetch requests a single block.
+func (r *rangeReaderAt) fetch(i int64) ([]byte, error) {
+	start := i * rangeBlockSize
+	end := start + rangeBlockSize
+	if end > r.size {
+		end = r.size
+	}
+	req, err := http.NewRequestWithContext(r.ctx, "GET", r.link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	req.Header.Set("User-Agent", resolverUserAgent(""))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range %d-%d: %s", start, end-1, resp.Status)
+	}
+	b := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, b); err != nil {
+		return nil, fmt.Errorf("range %d-%d: %w", start, end-1, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,159 @@
+package ckit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+func TestCociDOI(t *testing.T) {
+	var cases = []struct {
+		s      string
+		result string
+	}{
+		{"", ""},
+		{"10.1/x", "10.1/x"},
+		{" 10.1/ABC ", "10.1/abc"},
+		{"doi:10.1/x", "10.1/x"},
+		{"https://doi.org/10.1/x", "10.1/x"},
+		{"omid:br/0601 doi:10.1/x pmid:123", "10.1/x"},
+		{"pmid:123", ""},
+		{"10.1", ""},
+	}
+	for _, c := range cases {
+		if got := CociDOI(c.s); got != c.result {
+			t.Fatalf("[%s] got %q, want %q", c.s, got, c.result)
+		}
+	}
+}
+
+// mustZip returns a zip archive of the given files, stored or deflated.
+func mustZip(t *testing.T, method uint16, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, b := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatalf("zip: %v", err)
+		}
+		w.Write(b)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// cociTestDump returns a dump like the COCI dumps on figshare: a zip archive
+// of zip archives of CSV files, with 4 edges and 2 invalid rows.
+func cociTestDump(t *testing.T) []byte {
+	const header = "oci,citing,cited,creation,timespan,journal_sc,author_sc\n"
+	return mustZip(t, zip.Store, map[string][]byte{
+		"2022-01-01T00_00_00_1-2.zip": mustZip(t, zip.Store, map[string][]byte{
+			"a.csv": []byte(header + "01-02,10.1/A,10.1/b,2020,P1Y,no,no\n03-04,10.1/a,10.1/c,2020,P1Y,no,yes\n"),
+		}),
+		"2022-01-01T00_00_00_3-4.zip": mustZip(t, zip.Deflate, map[string][]byte{
+			"b.csv": []byte(header + "05-06,doi:10.1/d,doi:10.1/a,2021,P2Y,yes,no\n07-08,,10.1/a,2021,P2Y,no,no\n\"broken,10.1/e\n"),
+			"c.csv": []byte("09-10,10.1/e,10.1/a,2019,P3Y,no,no\n"),
+		}),
+		"README.txt": []byte("not a dump"),
+	})
+}
+
+func TestImportCociURL(t *testing.T) {
+	dump := cociTestDump(t)
+	var cases = []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"range", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "coci.zip", time.Time{}, bytes.NewReader(dump))
+		}},
+		{"norange", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(dump)
+		}},
+	}
+	for _, c := range cases {
+		ts := httptest.NewServer(c.handler)
+		filename := filepath.Join(t.TempDir(), "oci.db")
+		w, err := NewCociWriter(filename, true)
+		if err != nil {
+			t.Fatalf("writer: %v", err)
+		}
+		if err := ImportCociURL(context.Background(), ts.Client(), ts.URL, w); err != nil {
+			w.Abort()
+			t.Fatalf("[%s] import: %v", c.name, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("[%s] close: %v", c.name, err)
+		}
+		ts.Close()
+		if w.Rows != 4 || w.Skipped != 2 {
+			t.Fatalf("[%s] got %d rows, %d skipped, want 4, 2", c.name, w.Rows, w.Skipped)
+		}
+		db := sqlx.MustOpen("sqlite3", filename)
+		var edges []string
+		if err := db.Select(&edges, "SELECT k || ' ' || v || ' ' || oci || ' ' || author_sc FROM map ORDER BY oci"); err != nil {
+			t.Fatalf("[%s] select: %v", c.name, err)
+		}
+		db.Close()
+		want := "10.1/a 10.1/b 01-02 no,10.1/a 10.1/c 03-04 yes,10.1/d 10.1/a 05-06 no,10.1/e 10.1/a 09-10 no"
+		if got := strings.Join(edges, ","); got != want {
+			t.Fatalf("[%s] got %s, want %s", c.name, got, want)
+		}
+	}
+}
+
+func TestNewCociWriterExists(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "oci.db")
+	w, err := NewCociWriter(filename, false)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	if err := w.ReadCSV(strings.NewReader("01-02,10.1/a,10.1/b\n")); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := NewCociWriter(filename, false); err == nil {
+		t.Fatalf("got nil, want error for existing file")
+	}
+}
+
+func TestFetchFigshareArticle(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/articles/%d", DefaultCociArticle) {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(FigshareArticle{
+			ID:      DefaultCociArticle,
+			Title:   "COCI CSV dataset",
+			Version: 19,
+			Files:   []FigshareFile{{ID: 1, Name: "2022.zip", DownloadURL: "http://example.com/1"}},
+		})
+	}))
+	defer ts.Close()
+	a, err := FetchFigshareArticle(context.Background(), ts.Client(), ts.URL, DefaultCociArticle)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if a.Version != 19 || len(a.Files) != 1 || a.Files[0].DownloadURL != "http://example.com/1" {
+		t.Fatalf("got %+v", a)
+	}
+	if _, err := FetchFigshareArticle(context.Background(), ts.Client(), ts.URL, 1); err == nil ||
+		!strings.Contains(err.Error(), "not found") {
+		t.Fatalf("got %v, want not found", err)
+	}
+}
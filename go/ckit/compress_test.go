@@ -0,0 +1,137 @@
+package ckit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	var cases = []struct {
+		header string
+		result bool
+	}{
+		{"", false},
+		{"gzip", false},
+		{"zstd", true},
+		{"gzip, deflate, br, zstd", true},
+		{"ZSTD", true},
+		{"zstd;q=0.5", true},
+		{"zstd; q=0", false},
+		{"zstd;q=0.0, gzip", false},
+		{"xzstd", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", c.header)
+		if got := acceptsEncoding(r, "zstd"); got != c.result {
+			t.Fatalf("[%s] got %v, want %v", c.header, got, c.result)
+		}
+	}
+}
+
+func TestServeCompressed(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	want := mustRequest(t, srv, "/id/i0029")
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		srv.ServeHTTP(rr, req)
+		if rr.Code != 200 || rr.Header().Get("X-Cache") != "HIT" {
+			t.Fatalf("%s: got %d, %s, want cached response", target, rr.Code, rr.Header().Get("X-Cache"))
+		}
+		return rr
+	}
+	// Compressed value, sent as is.
+	rr := get("/id/i0029", "gzip, zstd")
+	if rr.Header().Get("Content-Encoding") != "zstd" {
+		t.Fatalf("got %q, want zstd content encoding", rr.Header().Get("Content-Encoding"))
+	}
+	b, err := c.Get("i0029")
+	if err != nil || !bytes.Equal(rr.Body.Bytes(), b) {
+		t.Fatalf("got %d bytes, want cached value", rr.Body.Len())
+	}
+	dec, _ := zstd.NewReader(nil)
+	defer dec.Close()
+	raw, err := dec.DecodeAll(rr.Body.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	var got Response
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.ID != want.ID || len(got.Citing) != len(want.Citing) || len(got.Cited) != len(want.Cited) {
+		t.Fatalf("got %s, want %s", mustMarshal(got.Extra), mustMarshal(want.Extra))
+	}
+	// Uncompressed, if the client does not accept zstd or the response
+	// needs to be filtered.
+	for _, target := range []string{"/id/i0029", "/id/i0029?i=DE-1", "/id/i0029?format=xml"} {
+		accept := "zstd"
+		if target == "/id/i0029" {
+			accept = "gzip"
+		}
+		if rr := get(target, accept); rr.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("%s: got %q, want no content encoding", target, rr.Header().Get("Content-Encoding"))
+		}
+	}
+}
+
+func TestCompressHandler(t *testing.T) {
+	const body = `{"id":"x"}`
+	h := CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/zstd" {
+			w.Header().Set("Content-Encoding", "zstd")
+		}
+		io.WriteString(w, body)
+	}))
+	var cases = []struct {
+		path     string
+		accept   string
+		encoding string
+	}{
+		{"/", "", ""},
+		{"/", "gzip", "gzip"},
+		{"/", "gzip;q=0", ""},
+		{"/zstd", "gzip, zstd", "zstd"},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept-Encoding", c.accept)
+		h.ServeHTTP(rr, req)
+		if got := rr.Header().Get("Content-Encoding"); got != c.encoding {
+			t.Fatalf("[%s %s] got %q, want %q", c.path, c.accept, got, c.encoding)
+		}
+		if rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("[%s %s] got Vary %q", c.path, c.accept, rr.Header().Get("Vary"))
+		}
+		got := rr.Body.String()
+		if c.encoding == "gzip" {
+			zr, err := gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Fatalf("gzip: %v", err)
+			}
+			b, _ := io.ReadAll(zr)
+			got = string(b)
+		}
+		if got != body {
+			t.Fatalf("[%s %s] got %q, want %q", c.path, c.accept, got, body)
+		}
+	}
+}
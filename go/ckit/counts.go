@@ -0,0 +1,191 @@
+package ckit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// countsSchema is the schema of the auxiliary counts table; citing is the
+// number of outbound edges (documents cited by the DOI), cited is the number
+// of inbound edges, same as in the Response.
+const countsSchema = `
+CREATE TABLE IF NOT EXISTS counts (
+	doi TEXT PRIMARY KEY,
+	citing INTEGER NOT NULL DEFAULT 0,
+	cited INTEGER NOT NULL DEFAULT 0
+) WITHOUT ROWID;`
+
+// Counts contains the number of citing (outbound) and cited (inbound) edges
+// for a DOI; these are counts of distinct edges, including edges to
+// documents, which are not in the index.
+type Counts struct {
+	DOI    string `json:"doi" db:"doi"`
+	Citing int    `json:"citing" db:"citing"`
+	Cited  int    `json:"cited" db:"cited"`
+}
+
+// Total returns the total number of edges.
+func (c Counts) Total() int {
+	return c.Citing + c.Cited
+}
+
+// countsSourcesSchema records the citation databases a counts database has
+// been built from, so a server can refuse counts, which do not match the
+// merged edges it serves.
+const countsSourcesSchema = `
+CREATE TABLE IF NOT EXISTS sources (
+	name TEXT NOT NULL
+);`
+
+// BuildCountsDatabase materializes per-DOI citing and cited counts from one
+// or more citation databases (as generated by makta) into a "counts" table in
+// an sqlite3 database at output. Counting by scanning edges for highly cited
+// DOI is expensive, so we do it once, ahead of time. With more than one
+// citation database, edges are merged first, so the counts match the edges
+// served with additional citation databases; all of them need to be passed,
+// the primary database first. With a single database and both indexes in
+// place, this is two index scans over the citation database.
+func BuildCountsDatabase(output string, ociPaths ...string) error {
+	if len(ociPaths) == 0 {
+		return fmt.Errorf("counts: no citation database given")
+	}
+	db, err := sqlx.Open("sqlite3", output)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // attached database is per connection
+	type step struct {
+		msg   string
+		query string
+		args  []interface{}
+	}
+	var (
+		started = time.Now()
+		steps   = []step{
+			{"pragma", "PRAGMA journal_mode = OFF; PRAGMA synchronous = 0", nil},
+		}
+		selects []string
+	)
+	for i, p := range ociPaths {
+		steps = append(steps, step{fmt.Sprintf("attach %s", p),
+			fmt.Sprintf("ATTACH DATABASE ? AS oci%d", i),
+			[]interface{}{"file:" + p + "?mode=ro"}})
+		selects = append(selects, fmt.Sprintf("SELECT k, v FROM oci%d.map", i))
+	}
+	// With a single database, we can use its indexes directly; UNION
+	// removes edges found in more than one database.
+	edges := "oci0.map"
+	if len(selects) > 1 {
+		edges = "(" + strings.Join(selects, " UNION ") + ")"
+	}
+	steps = append(steps,
+		step{"schema", countsSchema + countsSourcesSchema, nil},
+		step{"clear", "DELETE FROM counts; DELETE FROM sources", nil},
+		step{"citing", fmt.Sprintf(`
+INSERT INTO counts (doi, citing)
+SELECT k, count(DISTINCT v) FROM %s GROUP BY k`, edges), nil},
+		step{"cited", fmt.Sprintf(`
+INSERT INTO counts (doi, cited)
+SELECT v, count(DISTINCT k) FROM %s WHERE true GROUP BY v
+ON CONFLICT(doi) DO UPDATE SET cited = excluded.cited`, edges), nil},
+		step{"index", "CREATE INDEX IF NOT EXISTS counts_cited ON counts (cited)", nil},
+	)
+	for _, p := range ociPaths {
+		steps = append(steps, step{"sources", "INSERT INTO sources (name) VALUES (?)",
+			[]interface{}{filepath.Base(p)}})
+	}
+	for _, step := range steps {
+		t := time.Now()
+		if _, err := db.Exec(step.query, step.args...); err != nil {
+			return fmt.Errorf("%s: %w", step.msg, err)
+		}
+		log.Printf("[ok] counts: %s (%s)", step.msg, time.Since(t))
+	}
+	log.Printf("[ok] counts: done in %s", time.Since(started))
+	return nil
+}
+
+// ValidateCountsDatabase checks, whether a counts database has been built
+// from n citation databases. Counts databases without a sources table stem
+// from a single citation database.
+func ValidateCountsDatabase(db *sqlx.DB, n int) error {
+	var (
+		m   int
+		err = db.Get(&m, "SELECT count(*) FROM sources")
+	)
+	switch {
+	case err != nil && strings.Contains(err.Error(), "no such table"):
+		m = 1
+	case err != nil:
+		return err
+	}
+	if m != n {
+		return fmt.Errorf("counts built from %d citation databases, but %d configured, "+
+			"rebuild with labed counts and all citation databases", m, n)
+	}
+	return nil
+}
+
+// counts returns the number of edges for a DOI. If a counts database is
+// configured, counts are looked up there, otherwise edges are counted in the
+// citation database.
+func (s *Server) counts(ctx context.Context, doi string) (*Counts, error) {
+	var (
+		c = &Counts{DOI: doi}
+		d = s.data(ctx)
+	)
+	if d.hasNoEdges(doi) {
+		return c, nil
+	}
+	if d.CountsDatabase != nil {
+		stmt, err := s.stmts.get(d.CountsDatabase, "SELECT doi, citing, cited FROM counts WHERE doi = ?")
+		if err != nil {
+			return nil, err
+		}
+		err = stmt.GetContext(ctx, c, doi)
+		if err == sql.ErrNoRows {
+			return c, nil
+		}
+		return c, err
+	}
+	if len(d.AdditionalOciDatabases) > 0 {
+		// Edges found in more than one citation database count once, as
+		// in the merged response.
+		citing, cited, _, err := s.edges(ctx, doi)
+		if err != nil {
+			return nil, err
+		}
+		c.Citing, c.Cited = len(citing), len(cited)
+		return c, nil
+	}
+	var (
+		src   = d.ociSources()[0]
+		db    = src.shardFor(doi)
+		dbs   = src.databases()
+		cited = make([]int, len(dbs))
+	)
+	if err := db.GetContext(ctx, &c.Citing,
+		db.Rebind("SELECT count(DISTINCT v) FROM map WHERE k = ?"), doi); err != nil {
+		return nil, err
+	}
+	// A citing DOI is only found in a single shard, so counts add up.
+	err := eachShard(dbs, func(i int, db *sqlx.DB) error {
+		return db.GetContext(ctx, &cited[i],
+			db.Rebind("SELECT count(DISTINCT k) FROM map WHERE v = ?"), doi)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range cited {
+		c.Cited += v
+	}
+	return c, nil
+}
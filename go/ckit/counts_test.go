@@ -0,0 +1,97 @@
+package ckit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestCounts(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "counts.db")
+	if err := BuildCountsDatabase(output, "testdata/doi_doi.db"); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	oci, err := OpenDatabase("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	countsDB, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var (
+		direct = &Server{OciDatabase: oci}
+		table  = &Server{OciDatabase: oci, CountsDatabase: countsDB}
+	)
+	for _, doi := range []string{"d0098", "d0194", "d0010", "xxx"} {
+		want, err := direct.counts(context.Background(), doi)
+		if err != nil {
+			t.Fatalf("counts: %v", err)
+		}
+		got, err := table.counts(context.Background(), doi)
+		if err != nil {
+			t.Fatalf("counts: %v", err)
+		}
+		if *got != *want {
+			t.Fatalf("[%s] got %v, want %v", doi, got, want)
+		}
+	}
+	// Edges of d0029 appear four times each in the fixture; d0029 cites
+	// d0009, d0039, d0065 and is cited by d0069 and d0156.
+	c, err := table.counts(context.Background(), "d0029")
+	if err != nil || c.Citing != 3 || c.Cited != 2 {
+		t.Fatalf("got %v, %v, want 3/2", c, err)
+	}
+}
+
+func TestCountsAdditionalSources(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		extra  = filepath.Join(dir, "extra.db")
+		output = filepath.Join(dir, "counts.db")
+	)
+	db, err := sqlx.Open("sqlite3", extra)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, q := range []string{
+		`CREATE TABLE map (k TEXT, v TEXT)`,
+		`INSERT INTO map VALUES ('d0029', 'd0009')`, // also in the primary database
+		`INSERT INTO map VALUES ('d0029', 'd0066')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	if err := BuildCountsDatabase(output, "testdata/doi_doi.db", extra); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	oci, err := OpenDatabase("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	countsDB, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var (
+		sources = []OciSource{{Name: "extra", DB: db}}
+		direct  = &Server{OciDatabase: oci, AdditionalOciDatabases: sources, Stats: newTestStats()}
+		table   = &Server{OciDatabase: oci, AdditionalOciDatabases: sources, CountsDatabase: countsDB}
+	)
+	for _, srv := range []*Server{direct, table} {
+		c, err := srv.counts(context.Background(), "d0029")
+		if err != nil || c.Citing != 4 || c.Cited != 2 {
+			t.Fatalf("got %v, %v, want 4/2", c, err)
+		}
+	}
+	if err := ValidateCountsDatabase(countsDB, 2); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := ValidateCountsDatabase(countsDB, 1); err == nil {
+		t.Fatalf("expected error for counts built from other citation databases")
+	}
+}
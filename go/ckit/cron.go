@@ -0,0 +1,174 @@
+package ckit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronFields are the names and ranges of the fields of a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// cronDescriptors are shorthands for common cron expressions.
+var cronDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// Schedule determines when a job runs, parsed from a cron expression.
+type Schedule struct {
+	spec  string
+	every time.Duration // fixed interval, for @every
+	// bits of allowed minutes, hours, days of month, months and days of
+	// week; dom and dow are or'ed, if both are restricted, like in cron.
+	fields  [5]uint64
+	domStar bool
+	dowStar bool
+}
+
+// ParseSchedule parses a cron expression with five fields (minute, hour,
+// day of month, month, day of week; with lists, ranges and steps, like
+// "0 3 * * 1-5" or "*/15 * * * *"), a descriptor like "@daily" or a fixed
+// interval like "@every 6h". Times are local.
+func ParseSchedule(spec string) (Schedule, error) {
+	s := Schedule{spec: spec}
+	spec = strings.TrimSpace(spec)
+	if v, ok := cronDescriptors[spec]; ok {
+		spec = v
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return s, fmt.Errorf("schedule: %w", err)
+		}
+		if d < time.Minute {
+			return s, fmt.Errorf("schedule: interval too short: %s", d)
+		}
+		s.every = d
+		return s, nil
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return s, fmt.Errorf("schedule: want %d fields, got %d: %q", len(cronFields), len(parts), s.spec)
+	}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return s, fmt.Errorf("schedule: %s: %w", cronFields[i].name, err)
+		}
+		s.fields[i] = bits
+	}
+	s.domStar, s.dowStar = parts[2] == "*", parts[4] == "*"
+	return s, nil
+}
+
+// parseCronField returns the allowed values of a comma separated list of
+// values, ranges and steps as bits.
+func parseCronField(s string, min, max int) (bits uint64, err error) {
+	for _, item := range strings.Split(s, ",") {
+		var (
+			rng  = item
+			step = 1
+		)
+		if i := strings.Index(item, "/"); i >= 0 {
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step: %q", item)
+			}
+			rng = item[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			if lo, err = strconv.Atoi(rng[:i]); err != nil {
+				return 0, fmt.Errorf("invalid range: %q", item)
+			}
+			if hi, err = strconv.Atoi(rng[i+1:]); err != nil {
+				return 0, fmt.Errorf("invalid range: %q", item)
+			}
+		default:
+			if lo, err = strconv.Atoi(rng); err != nil {
+				return 0, fmt.Errorf("invalid value: %q", item)
+			}
+			if step == 1 {
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("out of range [%d-%d]: %q", min, max, item)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// String returns the expression, the schedule was parsed from.
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// IsZero returns true, if the schedule was not parsed from an expression.
+func (s Schedule) IsZero() bool {
+	return s.every == 0 && s.fields[0] == 0
+}
+
+// has returns true, if a value is allowed in a field.
+func (s Schedule) has(field, v int) bool {
+	return s.fields[field]&(1<<uint(v)) != 0
+}
+
+// dayMatches returns true, if a job runs on the day of t.
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.has(2, t.Day()), s.has(4, int(t.Weekday()))
+	switch {
+	case s.domStar || s.dowStar:
+		return dom && dow
+	default:
+		return dom || dow
+	}
+}
+
+// Next returns the next time after t, the job runs; the zero time, if it
+// never does (e.g. on February 30).
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every).Truncate(time.Second)
+	}
+	if s.IsZero() {
+		return time.Time{}
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every schedule with a valid date matches within a leap cycle.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.has(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.has(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,62 @@
+package ckit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// 2023-01-18 is a Wednesday.
+	now := time.Date(2023, 1, 18, 10, 30, 15, 0, time.UTC)
+	var cases = []struct {
+		spec   string
+		result string
+	}{
+		{"* * * * *", "2023-01-18T10:31:00Z"},
+		{"*/15 * * * *", "2023-01-18T10:45:00Z"},
+		{"0 3 * * *", "2023-01-19T03:00:00Z"},
+		{"@daily", "2023-01-19T00:00:00Z"},
+		{"@hourly", "2023-01-18T11:00:00Z"},
+		{"@weekly", "2023-01-22T00:00:00Z"},
+		{"@monthly", "2023-02-01T00:00:00Z"},
+		{"0 3 * * 0", "2023-01-22T03:00:00Z"},
+		{"0 3 * * 1-5", "2023-01-19T03:00:00Z"},
+		{"30 10,12 * * *", "2023-01-18T12:30:00Z"},
+		{"0 0 29 2 *", "2024-02-29T00:00:00Z"},
+		{"0 0 13 * 5", "2023-01-20T00:00:00Z"}, // day of month or day of week
+		{"0 0 31 4 *", ""},
+		{"@every 6h", "2023-01-18T16:30:15Z"},
+	}
+	for _, c := range cases {
+		s, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatalf("[%s] parse: %v", c.spec, err)
+		}
+		var got string
+		if next := s.Next(now); !next.IsZero() {
+			got = next.Format(time.RFC3339)
+		}
+		if got != c.result {
+			t.Fatalf("[%s] got %q, want %q", c.spec, got, c.result)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 1s",
+		"@every x",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("[%s] got nil, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// DefaultCrossrefEndpoint is the Crossref REST API.
+const DefaultCrossrefEndpoint = "https://api.crossref.org"
+
+// CrossrefResolver resolves DOI via the Crossref REST API. With a contact
+// email (Mailto), requests go to the "polite" pool, which is more reliable;
+// see https://api.crossref.org/swagger-ui/index.html. Requests are spaced
+// out by the rate limit given to NewCrossrefResolver.
+type CrossrefResolver struct {
+	Endpoint string       // defaults to DefaultCrossrefEndpoint
+	Mailto   string       // contact email, for the polite pool
+	Client   *http.Client // uses a client with a 5s timeout, if nil
+
+	limiter rateLimiter
+}
+
+// NewCrossrefResolver creates a resolver with a contact email and a rate
+// limit in requests per second, zero means no limit.
+func NewCrossrefResolver(mailto string, rate float64) *CrossrefResolver {
+	r := &CrossrefResolver{Endpoint: DefaultCrossrefEndpoint, Mailto: mailto}
+	if rate > 0 {
+		r.limiter.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return r
+}
+
+// crossrefWork contains the fields we use from a Crossref work.
+type crossrefWork struct {
+	DOI            string   `json:"DOI"`
+	Title          []string `json:"title"`
+	ContainerTitle []string `json:"container-title"`
+	Publisher      string   `json:"publisher"`
+	ISSN           []string `json:"ISSN"`
+	Type           string   `json:"type"`
+	Author         []struct {
+		Given  string `json:"given"`
+		Family string `json:"family"`
+		Name   string `json:"name"`
+	} `json:"author"`
+	Issued struct {
+		DateParts [][]int `json:"date-parts"`
+	} `json:"issued"`
+}
+
+// Resolve fetches metadata for a DOI from Crossref.
+func (r *CrossrefResolver) Resolve(ctx context.Context, doi string) (json.RawMessage, error) {
+	if err := r.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultCrossrefEndpoint
+	}
+	link := strings.TrimRight(endpoint, "/") + "/works/" + url.PathEscape(doi)
+	if r.Mailto != "" {
+		link += "?mailto=" + url.QueryEscape(r.Mailto)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", resolverUserAgent(r.Mailto))
+	var payload struct {
+		Message crossrefWork `json:"message"`
+	}
+	if err := getJSON(r.Client, req, &payload); err != nil {
+		return nil, fmt.Errorf("crossref: %w", err)
+	}
+	w := payload.Message
+	doc := resolvedDocument{
+		DOI:        doi,
+		Title:      firstString(w.Title),
+		Container:  firstString(w.ContainerTitle),
+		Publisher:  w.Publisher,
+		ISSN:       w.ISSN,
+		Format:     w.Type,
+		ResolvedBy: "crossref",
+	}
+	for _, a := range w.Author {
+		switch {
+		case a.Family != "" && a.Given != "":
+			doc.Author = append(doc.Author, a.Family+", "+a.Given)
+		case a.Family != "":
+			doc.Author = append(doc.Author, a.Family)
+		case a.Name != "":
+			doc.Author = append(doc.Author, a.Name)
+		}
+	}
+	if len(w.Issued.DateParts) > 0 && len(w.Issued.DateParts[0]) > 0 && w.Issued.DateParts[0][0] > 0 {
+		doc.PublishDate = strconv.Itoa(w.Issued.DateParts[0][0])
+	}
+	return json.Marshal(doc)
+}
+
+// resolvedDocument is a document resolved from an external service, with the
+// field names of the index data, so sorting and filtering by year work.
+type resolvedDocument struct {
+	DOI         string   `json:"doi_str_mv"`
+	Title       string   `json:"title,omitempty"`
+	Author      []string `json:"author,omitempty"`
+	PublishDate string   `json:"publishDate,omitempty"`
+	Container   string   `json:"container_title,omitempty"`
+	Publisher   string   `json:"publisher,omitempty"`
+	ISSN        []string `json:"issn,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	ResolvedBy  string   `json:"resolved_by"`
+}
+
+// getJSON performs a request and decodes a JSON response; a 404 is reported
+// as ErrDOINotFound.
+func getJSON(c *http.Client, req *http.Request, v interface{}) error {
+	if c == nil {
+		c = &client
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrDOINotFound
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// resolverUserAgent returns a user agent with a contact address, as
+// recommended by API providers.
+func resolverUserAgent(mailto string) string {
+	if mailto == "" {
+		return "labe (https://github.com/slub/labe)"
+	}
+	return fmt.Sprintf("labe (https://github.com/slub/labe; mailto:%s)", mailto)
+}
+
+// firstString returns the first element of a slice or the empty string.
+func firstString(ss []string) string {
+	if len(ss) == 0 {
+		return ""
+	}
+	return ss[0]
+}
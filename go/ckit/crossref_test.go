@@ -0,0 +1,50 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestCrossrefResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("mailto"); got != "x@example.com" {
+			t.Errorf("got mailto %q", got)
+		}
+		if !strings.Contains(r.UserAgent(), "mailto:x@example.com") {
+			t.Errorf("got user agent %q", r.UserAgent())
+		}
+		switch r.URL.Path {
+		case "/works/10.1/a":
+			w.Write([]byte(`{"status": "ok", "message": {"DOI": "10.1/a", "title": ["A title"],
+				"author": [{"given": "Ada", "family": "Lovelace"}, {"name": "Consortium"}],
+				"issued": {"date-parts": [[1843, 10]]}, "container-title": ["Memoirs"],
+				"ISSN": ["1234-5678"], "type": "journal-article"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	r := NewCrossrefResolver("x@example.com", 0)
+	r.Endpoint = ts.URL
+	b, err := r.Resolve(context.Background(), "10.1/a")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	var doc resolvedDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if doc.DOI != "10.1/a" || doc.Title != "A title" || doc.PublishDate != "1843" ||
+		strings.Join(doc.Author, "; ") != "Lovelace, Ada; Consortium" || doc.ResolvedBy != "crossref" {
+		t.Fatalf("got %+v", doc)
+	}
+	if _, err := r.Resolve(context.Background(), "10.1/b"); !errors.Is(err, ErrDOINotFound) {
+		t.Fatalf("got %v, want ErrDOINotFound", err)
+	}
+}
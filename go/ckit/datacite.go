@@ -0,0 +1,206 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+const (
+	// DefaultDataCiteEndpoint is the DataCite REST API.
+	DefaultDataCiteEndpoint = "https://api.datacite.org"
+	// DefaultRAEndpoint returns the registration agency of a DOI prefix.
+	DefaultRAEndpoint = "https://doi.org/ra"
+)
+
+// Registration agencies, as reported by the doi.org RA service.
+const (
+	AgencyCrossref = "Crossref"
+	AgencyDataCite = "DataCite"
+)
+
+// DataCiteResolver resolves DOI via the DataCite REST API, mostly datasets
+// and software. Requests are spaced out by the rate limit given to
+// NewDataCiteResolver.
+type DataCiteResolver struct {
+	Endpoint string       // defaults to DefaultDataCiteEndpoint
+	Mailto   string       // contact email, sent in the user agent
+	Client   *http.Client // uses a client with a 5s timeout, if nil
+
+	limiter rateLimiter
+}
+
+// NewDataCiteResolver creates a resolver with a contact email and a rate
+// limit in requests per second, zero means no limit.
+func NewDataCiteResolver(mailto string, rate float64) *DataCiteResolver {
+	r := &DataCiteResolver{Endpoint: DefaultDataCiteEndpoint, Mailto: mailto}
+	if rate > 0 {
+		r.limiter.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return r
+}
+
+// dataciteAttributes contains the fields we use from a DataCite DOI record.
+type dataciteAttributes struct {
+	Titles []struct {
+		Title string `json:"title"`
+	} `json:"titles"`
+	Creators []struct {
+		Name       string `json:"name"`
+		GivenName  string `json:"givenName"`
+		FamilyName string `json:"familyName"`
+	} `json:"creators"`
+	Publisher       json.RawMessage `json:"publisher"` // string or object
+	PublicationYear flexInt         `json:"publicationYear"`
+	Types           struct {
+		ResourceTypeGeneral string `json:"resourceTypeGeneral"`
+	} `json:"types"`
+}
+
+// flexInt decodes a number or a string containing a number.
+type flexInt int
+
+func (v *flexInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*v = 0
+		return nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = flexInt(i)
+	return nil
+}
+
+// Resolve fetches metadata for a DOI from DataCite.
+func (r *DataCiteResolver) Resolve(ctx context.Context, doi string) (json.RawMessage, error) {
+	if err := r.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultDataCiteEndpoint
+	}
+	link := strings.TrimRight(endpoint, "/") + "/dois/" + url.PathEscape(doi)
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+	req.Header.Set("User-Agent", resolverUserAgent(r.Mailto))
+	var payload struct {
+		Data struct {
+			Attributes dataciteAttributes `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := getJSON(r.Client, req, &payload); err != nil {
+		return nil, fmt.Errorf("datacite: %w", err)
+	}
+	a := payload.Data.Attributes
+	doc := resolvedDocument{
+		DOI:        doi,
+		Format:     a.Types.ResourceTypeGeneral,
+		ResolvedBy: "datacite",
+	}
+	if len(a.Titles) > 0 {
+		doc.Title = a.Titles[0].Title
+	}
+	for _, c := range a.Creators {
+		switch {
+		case c.FamilyName != "" && c.GivenName != "":
+			doc.Author = append(doc.Author, c.FamilyName+", "+c.GivenName)
+		case c.Name != "":
+			doc.Author = append(doc.Author, c.Name)
+		}
+	}
+	if a.PublicationYear > 0 {
+		doc.PublishDate = strconv.Itoa(int(a.PublicationYear))
+	}
+	var publisher struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(a.Publisher, &doc.Publisher); err != nil {
+		if err := json.Unmarshal(a.Publisher, &publisher); err == nil {
+			doc.Publisher = publisher.Name
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// AgencyResolver dispatches DOI to a resolver by registration agency (e.g.
+// Crossref or DataCite) of the DOI prefix, which is looked up once per prefix
+// via the doi.org RA service. DOI of other agencies are not resolved.
+type AgencyResolver struct {
+	Resolvers  map[string]DOIResolver // keyed by agency, e.g. AgencyCrossref
+	RAEndpoint string                 // defaults to DefaultRAEndpoint
+	Client     *http.Client           // uses a client with a 5s timeout, if nil
+
+	mu       sync.Mutex
+	agencies map[string]string // prefix to agency
+}
+
+// Resolve looks up the registration agency of a DOI and passes the DOI on to
+// the matching resolver.
+func (r *AgencyResolver) Resolve(ctx context.Context, doi string) (json.RawMessage, error) {
+	agency, err := r.agency(ctx, doiPrefix(doi))
+	if err != nil {
+		return nil, err
+	}
+	resolver, ok := r.Resolvers[agency]
+	if !ok {
+		return nil, ErrDOINotFound
+	}
+	return resolver.Resolve(ctx, doi)
+}
+
+// agency returns the registration agency for a DOI prefix, e.g. "10.5281".
+func (r *AgencyResolver) agency(ctx context.Context, prefix string) (string, error) {
+	r.mu.Lock()
+	agency, ok := r.agencies[prefix]
+	r.mu.Unlock()
+	if ok {
+		return agency, nil
+	}
+	endpoint := r.RAEndpoint
+	if endpoint == "" {
+		endpoint = DefaultRAEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(endpoint, "/")+"/"+url.PathEscape(prefix), nil)
+	if err != nil {
+		return "", err
+	}
+	var payload []struct {
+		RA string `json:"RA"`
+	}
+	if err := getJSON(r.Client, req, &payload); err != nil {
+		return "", fmt.Errorf("ra: %w", err)
+	}
+	if len(payload) > 0 {
+		agency = payload[0].RA // empty, if the prefix is unknown
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.agencies == nil {
+		r.agencies = make(map[string]string)
+	}
+	r.agencies[prefix] = agency
+	return agency, nil
+}
+
+// doiPrefix returns the prefix of a DOI, e.g. "10.5281" for
+// "10.5281/zenodo.1234".
+func doiPrefix(doi string) string {
+	if i := strings.Index(doi, "/"); i > 0 {
+		return doi[:i]
+	}
+	return doi
+}
@@ -0,0 +1,101 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestDataCiteResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dois/10.5281/zenodo.1":
+			w.Write([]byte(`{"data": {"attributes": {"titles": [{"title": "A dataset"}],
+				"creators": [{"name": "Lovelace, Ada", "givenName": "Ada", "familyName": "Lovelace"}, {"name": "Lab"}],
+				"publisher": {"name": "Zenodo"}, "publicationYear": "2020",
+				"types": {"resourceTypeGeneral": "Dataset"}}}}`))
+		case "/dois/10.5281/zenodo.2":
+			w.Write([]byte(`{"data": {"attributes": {"titles": [{"title": "Software"}],
+				"publisher": "Zenodo", "publicationYear": 2021}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	r := NewDataCiteResolver("", 0)
+	r.Endpoint = ts.URL
+	var cases = []struct {
+		doi  string
+		want resolvedDocument
+		err  error
+	}{
+		{"10.5281/zenodo.1", resolvedDocument{DOI: "10.5281/zenodo.1", Title: "A dataset",
+			Author: []string{"Lovelace, Ada", "Lab"}, PublishDate: "2020", Publisher: "Zenodo",
+			Format: "Dataset", ResolvedBy: "datacite"}, nil},
+		{"10.5281/zenodo.2", resolvedDocument{DOI: "10.5281/zenodo.2", Title: "Software",
+			PublishDate: "2021", Publisher: "Zenodo", ResolvedBy: "datacite"}, nil},
+		{"10.5281/zenodo.3", resolvedDocument{}, ErrDOINotFound},
+	}
+	for _, c := range cases {
+		b, err := r.Resolve(context.Background(), c.doi)
+		if !errors.Is(err, c.err) {
+			t.Fatalf("[%s] got %v, want %v", c.doi, err, c.err)
+		}
+		if err != nil {
+			continue
+		}
+		var doc resolvedDocument
+		if err := json.Unmarshal(b, &doc); err != nil {
+			t.Fatalf("[%s] unmarshal: %v", c.doi, err)
+		}
+		if string(mustMarshal(doc)) != string(mustMarshal(c.want)) {
+			t.Fatalf("[%s] got %+v, want %+v", c.doi, doc, c.want)
+		}
+	}
+}
+
+func TestAgencyResolver(t *testing.T) {
+	var lookups int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "10.5281":
+			w.Write([]byte(`[{"DOI": "10.5281", "RA": "DataCite"}]`))
+		case "10.1000":
+			w.Write([]byte(`[{"DOI": "10.1000", "RA": "mEDRA"}]`))
+		default:
+			w.Write([]byte(`[{"DOI": "10.9999", "status": "Prefix does not exist"}]`))
+		}
+	}))
+	defer ts.Close()
+	r := &AgencyResolver{
+		Resolvers:  map[string]DOIResolver{AgencyDataCite: staticResolver(`{"title": "T"}`)},
+		RAEndpoint: ts.URL,
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Resolve(context.Background(), "10.5281/zenodo.1"); err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Fatalf("got %d agency lookups, want 1", n)
+	}
+	for _, doi := range []string{"10.1000/1", "10.9999/1"} {
+		if _, err := r.Resolve(context.Background(), doi); !errors.Is(err, ErrDOINotFound) {
+			t.Fatalf("[%s] got %v, want ErrDOINotFound", doi, err)
+		}
+	}
+}
+
+// staticResolver resolves every DOI to the same document.
+type staticResolver string
+
+func (r staticResolver) Resolve(ctx context.Context, doi string) (json.RawMessage, error) {
+	return json.RawMessage(r), nil
+}
@@ -0,0 +1,134 @@
+package ckit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+// Components, a server can run without, with reduced functionality.
+const (
+	// ComponentCitations is the citation database; responses then contain
+	// no citations.
+	ComponentCitations = "citations"
+	// ComponentIndexData is the index data; documents are then stubs with
+	// identifier and DOI only.
+	ComponentIndexData = "index_data"
+)
+
+// Degradation records an unavailable component and the reason.
+type Degradation struct {
+	Component string `json:"component"`
+	Reason    string `json:"reason"`
+}
+
+// Readiness is the status reported by /readyz: "ok", "degraded" or
+// "unavailable".
+type Readiness struct {
+	Status   string        `json:"status"`
+	Degraded []Degradation `json:"degraded,omitempty"`
+	Err      string        `json:"err,omitempty"`
+}
+
+// OpenEmptyMapDatabase returns an in-memory database with an empty map
+// table, which stands in for a citation database, that cannot be opened.
+func OpenEmptyMapDatabase() (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Each connection would get its own in-memory database.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	for _, q := range []string{
+		"CREATE TABLE map (k TEXT, v TEXT)",
+		"CREATE INDEX idx_k ON map (k)",
+		"CREATE INDEX idx_v ON map (v)",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// UnavailableFetcher stands in for index data, that cannot be opened; all
+// fetches fail with the original error.
+type UnavailableFetcher struct {
+	Err error
+}
+
+// Fetch fails.
+func (f *UnavailableFetcher) Fetch(id string) ([]byte, error) {
+	return nil, fmt.Errorf("index data unavailable: %w", f.Err)
+}
+
+// Ping succeeds, as the unavailable index data is reported as degradation
+// instead.
+func (f *UnavailableFetcher) Ping() error {
+	return nil
+}
+
+// isDegraded returns true, if a component is unavailable.
+func (d *Datasets) isDegraded(component string) bool {
+	for _, v := range d.Degraded {
+		if v.Component == component {
+			return true
+		}
+	}
+	return false
+}
+
+// degradedComponents returns the names of the unavailable components, if
+// any.
+func (d *Datasets) degradedComponents() (result []string) {
+	for _, v := range d.Degraded {
+		result = append(result, v.Component)
+	}
+	return result
+}
+
+// documentStub returns a minimal document, in place of the index data
+// document of a matched identifier, if index data is unavailable.
+func documentStub(id, doi string) []byte {
+	b, _ := json.Marshal(map[string]string{"id": id, DefaultDOIField: doi})
+	return b
+}
+
+// checkReadiness returns the readiness of the datasets and the status code for
+// /readyz, without strict checking.
+func checkReadiness(d *Datasets) (Readiness, int) {
+	readiness := Readiness{Status: "ok", Degraded: d.Degraded}
+	switch err := d.Ping(); {
+	case err != nil:
+		readiness.Status, readiness.Err = "unavailable", err.Error()
+		return readiness, http.StatusServiceUnavailable
+	case len(d.Degraded) > 0:
+		readiness.Status = "degraded"
+	}
+	return readiness, http.StatusOK
+}
+
+// handleReadyz reports, whether the server can serve requests, e.g. for a
+// load balancer: 200 if all datastores are reachable, also if the server
+// runs degraded, unless strict=1 is given; 503 otherwise.
+func (s *Server) handleReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness, status := checkReadiness(s.data(r.Context()))
+		if readiness.Status == "degraded" {
+			switch r.URL.Query().Get("strict") {
+			case "1", "true":
+				status = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(readiness); err != nil {
+			log.Printf("readyz: %v", err)
+		}
+	}
+}
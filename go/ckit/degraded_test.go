@@ -0,0 +1,98 @@
+package ckit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestDegradedCitations(t *testing.T) {
+	db, err := OpenEmptyMapDatabase()
+	if err != nil {
+		t.Fatalf("empty database: %v", err)
+	}
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.OciDatabase = db
+	srv.Cache = c
+	srv.Degraded = []Degradation{{Component: ComponentCitations, Reason: "file not found"}}
+	if err := srv.Validate(false); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	resp := mustRequest(t, srv, "/id/i0029")
+	if resp.DOI != "d0029" || len(resp.Citing) != 0 || len(resp.Cited) != 0 ||
+		len(resp.Extra.Degraded) != 1 || resp.Extra.Degraded[0] != ComponentCitations {
+		t.Fatalf("got %s, want response without citations", mustMarshal(resp))
+	}
+	if _, err := c.Get("i0029"); err != cache.ErrCacheMiss {
+		t.Fatalf("got %v, want degraded response not cached", err)
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("HEAD", "/id/i0029", nil))
+	if rr.Code != 200 {
+		t.Fatalf("HEAD: got %d, want 200", rr.Code)
+	}
+}
+
+func TestDegradedIndexData(t *testing.T) {
+	srv := newTestServer(t)
+	srv.IndexData = &UnavailableFetcher{Err: errors.New("file not found")}
+	srv.Degraded = []Degradation{{Component: ComponentIndexData, Reason: "file not found"}}
+	resp := mustRequest(t, srv, "/id/i0029")
+	if len(resp.Citing) == 0 || len(resp.Extra.Degraded) != 1 {
+		t.Fatalf("got %s, want document stubs", mustMarshal(resp))
+	}
+	for _, b := range append(resp.Citing, resp.Cited...) {
+		var doc map[string]string
+		if err := json.Unmarshal(b, &doc); err != nil || doc["id"] == "" || doc[DefaultDOIField] == "" || len(doc) != 2 {
+			t.Fatalf("got %s, %v, want stub with id and doi", b, err)
+		}
+	}
+	// Streamed responses contain stubs as well.
+	srv.StreamThreshold = 1
+	streamed := mustRequest(t, srv, "/id/i0029")
+	if len(streamed.Citing) != len(resp.Citing) || string(streamed.Citing[0]) != string(resp.Citing[0]) {
+		t.Fatalf("got %s, want %s", mustMarshal(streamed), mustMarshal(resp))
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	srv := newTestServer(t)
+	var cases = []struct {
+		degraded []Degradation
+		target   string
+		status   int
+		want     string
+	}{
+		{nil, "/readyz", 200, "ok"},
+		{nil, "/readyz?strict=1", 200, "ok"},
+		{[]Degradation{{ComponentCitations, "x"}}, "/readyz", 200, "degraded"},
+		{[]Degradation{{ComponentCitations, "x"}}, "/readyz?strict=1", 503, "degraded"},
+	}
+	for _, c := range cases {
+		srv.Degraded = c.degraded
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		var readiness Readiness
+		if err := json.Unmarshal(rr.Body.Bytes(), &readiness); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if rr.Code != c.status || readiness.Status != c.want || len(readiness.Degraded) != len(c.degraded) {
+			t.Fatalf("[%s] got %d, %+v, want %d, %s", c.target, rr.Code, readiness, c.status, c.want)
+		}
+	}
+	srv.IdentifierDatabase.Close()
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != 503 {
+		t.Fatalf("got %d, want 503 for closed database", rr.Code)
+	}
+}
@@ -0,0 +1,138 @@
+package ckit
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// deltaBatchSize is the number of changes per transaction.
+const deltaBatchSize = 100000
+
+// DeltaStats reports the number of rows changed by ApplyDelta.
+type DeltaStats struct {
+	Added   int64
+	Deleted int64
+	Skipped int64 // additions already present
+}
+
+// ApplyDelta applies incremental changes to a database (as generated by
+// makta), instead of rebuilding it. Deletions are applied first: each line
+// contains a key, which deletes all rows with that key, or a tab separated
+// key and value, which deletes only that pair. Then additions, given as TSV
+// with one field per column of the map table, are inserted, unless the same
+// key and value pair already exists. Either reader may be nil. Changes are
+// committed in batches, so a failed delta may have been applied partially.
+func ApplyDelta(db *sqlx.DB, additions, deletions io.Reader) (*DeltaStats, error) {
+	var (
+		stats   DeltaStats
+		started = time.Now()
+	)
+	columns, err := mapColumns(db)
+	if err != nil {
+		return nil, err
+	}
+	if deletions != nil {
+		err := applyDeltaBatches(db, deletions, func(tx *sqlx.Tx, fields []string) error {
+			var (
+				res sql.Result
+				err error
+			)
+			switch len(fields) {
+			case 1:
+				res, err = tx.Exec("DELETE FROM map WHERE k = ?", fields[0])
+			default:
+				res, err = tx.Exec("DELETE FROM map WHERE k = ? AND v = ?", fields[0], fields[1])
+			}
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			stats.Deleted += n
+			return err
+		})
+		if err != nil {
+			return &stats, fmt.Errorf("deletions: %w", err)
+		}
+		log.Printf("[ok] delta: deleted %d rows", stats.Deleted)
+	}
+	if additions != nil {
+		var (
+			placeholders = strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+			insert       = fmt.Sprintf(`INSERT INTO map (%s) SELECT %s
+				WHERE NOT EXISTS (SELECT 1 FROM map WHERE k = ? AND v = ?)`,
+				strings.Join(columns, ", "), placeholders)
+		)
+		err := applyDeltaBatches(db, additions, func(tx *sqlx.Tx, fields []string) error {
+			if len(fields) != len(columns) {
+				return fmt.Errorf("got %d fields, want %d", len(fields), len(columns))
+			}
+			args := make([]interface{}, 0, len(fields)+2)
+			for _, f := range fields {
+				args = append(args, f)
+			}
+			args = append(args, fields[0], fields[1])
+			res, err := tx.Exec(insert, args...)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			stats.Added += n
+			stats.Skipped += 1 - n
+			return err
+		})
+		if err != nil {
+			return &stats, fmt.Errorf("additions: %w", err)
+		}
+		log.Printf("[ok] delta: added %d rows, skipped %d", stats.Added, stats.Skipped)
+	}
+	log.Printf("[ok] delta: done in %s", time.Since(started))
+	return &stats, nil
+}
+
+// applyDeltaBatches calls f for each non-empty line of tab separated fields,
+// committing every deltaBatchSize lines.
+func applyDeltaBatches(db *sqlx.DB, r io.Reader, f func(tx *sqlx.Tx, fields []string) error) error {
+	var (
+		br = bufio.NewReader(r)
+		tx *sqlx.Tx
+		i  int
+	)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			if tx == nil {
+				if tx, err = db.Beginx(); err != nil {
+					return err
+				}
+			}
+			i++
+			if ferr := f(tx, strings.Split(line, "\t")); ferr != nil {
+				tx.Rollback()
+				return fmt.Errorf("line %d: %w", i, ferr)
+			}
+			if i%deltaBatchSize == 0 {
+				if cerr := tx.Commit(); cerr != nil {
+					return cerr
+				}
+				tx = nil
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package ckit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestApplyDelta(t *testing.T) {
+	b, err := os.ReadFile("testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "id_doi.db")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	db, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var (
+		additions = strings.NewReader("i9999\td9999\ni0001\td0001\n")
+		deletions = strings.NewReader("i0002\ni0003\td0003\ni0004\txxx\n")
+	)
+	stats, err := ApplyDelta(db, additions, deletions)
+	if err != nil {
+		t.Fatalf("delta: %v", err)
+	}
+	// Test data contains each row four times.
+	want := DeltaStats{Added: 1, Deleted: 8, Skipped: 1}
+	if *stats != want {
+		t.Fatalf("got %+v, want %+v", stats, want)
+	}
+	var cases = []struct {
+		k     string
+		count int
+	}{
+		{"i9999", 1},
+		{"i0001", 4},
+		{"i0002", 0},
+		{"i0003", 0},
+		{"i0004", 4},
+	}
+	for _, c := range cases {
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM map WHERE k = ?", c.k); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		if n != c.count {
+			t.Fatalf("[%s] got %d, want %d", c.k, n, c.count)
+		}
+	}
+	if _, err := ApplyDelta(db, strings.NewReader("a\tb\tc\n"), nil); err == nil {
+		t.Fatalf("expected error for invalid number of fields")
+	}
+}
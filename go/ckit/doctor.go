@@ -0,0 +1,257 @@
+package ckit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+// SlowLookupThreshold is the duration after which a single key lookup during
+// a diagnosis is considered slow.
+var SlowLookupThreshold = 100 * time.Millisecond
+
+// Status of a single diagnostic check.
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarn
+	StatusFail
+)
+
+// String returns the marker used in reports, similar to the log prefixes.
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "[ok]"
+	case StatusWarn:
+		return "[ww]"
+	default:
+		return "[xx]"
+	}
+}
+
+// Check is the result of a single diagnostic check, with an optional hint on
+// how to fix a problem.
+type Check struct {
+	Name    string
+	Status  Status
+	Message string
+	Hint    string
+}
+
+// Report collects the results of diagnostic checks, e.g. for "labed doctor".
+type Report struct {
+	Checks []Check
+}
+
+// OK records a passed check.
+func (r *Report) OK(name, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: StatusOK, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warn records a problem, which does not prevent the server from starting.
+func (r *Report) Warn(name, hint, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: StatusWarn, Message: fmt.Sprintf(format, args...), Hint: hint})
+}
+
+// Fail records a problem, which needs to be fixed.
+func (r *Report) Fail(name, hint, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: StatusFail, Message: fmt.Sprintf(format, args...), Hint: hint})
+}
+
+// Failed returns true, if any check failed.
+func (r *Report) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTo writes a human readable report, one line per check, followed by
+// hints and a summary.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var (
+		sb      strings.Builder
+		counter = make(map[Status]int)
+	)
+	for _, c := range r.Checks {
+		counter[c.Status]++
+		fmt.Fprintf(&sb, "%s %s: %s\n", c.Status, c.Name, c.Message)
+		if c.Hint != "" {
+			fmt.Fprintf(&sb, "     hint: %s\n", c.Hint)
+		}
+	}
+	fmt.Fprintf(&sb, "\n%d ok, %d warnings, %d failed\n",
+		counter[StatusOK], counter[StatusWarn], counter[StatusFail])
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// DiagnoseMapDatabase checks a database as generated by makta, given as a
+// path or postgres DSN: whether it exists and opens, has the expected schema
+// and indexes and whether a sample key lookup is reasonably fast. The name is
+// used to label the checks, e.g. "identifier database (-i)".
+func DiagnoseMapDatabase(r *Report, name, path string, indexes []string) {
+	if path == "" {
+		r.Fail(name, "pass a database path", "not configured")
+		return
+	}
+	if !IsPostgresDSN(path) {
+		fi, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			r.Fail(name, "check the path or create the database with makta", "file not found: %s", path)
+			return
+		case err != nil:
+			r.Fail(name, "check file permissions", "%v", err)
+			return
+		case fi.IsDir():
+			r.Fail(name, "pass the path to an sqlite3 file", "%s is a directory", path)
+			return
+		case fi.Size() == 0:
+			r.Fail(name, "the file is empty, copy or regenerate it", "empty file: %s", path)
+			return
+		}
+		r.OK(name, "found %s (%s)", path, tabutils.ByteSize(int(fi.Size())))
+	}
+	db, err := OpenDatabase(path)
+	if err != nil {
+		r.Fail(name, "check the path or DSN", "%v", err)
+		return
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		r.Fail(name, "check the path or DSN and access rights", "ping: %v", err)
+		return
+	}
+	if err := ValidateMapDatabase(db, indexes, false); err != nil {
+		r.Fail(name, validationHint(path, err), "%v", err)
+		return
+	}
+	r.OK(name, "schema and indexes %v", indexes)
+	diagnoseLookup(r, name, db)
+}
+
+// validationHint returns a suggestion for a failed validation.
+func validationHint(path string, err error) string {
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, "missing index: "):
+		index := strings.TrimPrefix(msg, "missing index: ")
+		return fmt.Sprintf(`create the index with: sqlite3 %s "CREATE INDEX %s ON map(%s)"`,
+			path, index, strings.TrimPrefix(index, "idx_"))
+	case strings.HasPrefix(msg, "schema: "):
+		return `the database needs a table "map" with columns "k" and "v", e.g. created with makta`
+	case strings.Contains(msg, "empty"):
+		return "the table has no rows, the import may have failed; regenerate the database"
+	default:
+		return "regenerate the database with makta"
+	}
+}
+
+// diagnoseLookup runs a sample query by key and records its duration.
+func diagnoseLookup(r *Report, name string, db *sqlx.DB) {
+	var k string
+	if err := db.Get(&k, "SELECT k FROM map LIMIT 1"); err != nil {
+		r.Fail(name, "the database may be corrupt, try labed -integrity", "sample: %v", err)
+		return
+	}
+	var (
+		started = time.Now()
+		v       []string
+	)
+	if err := db.Select(&v, db.Rebind("SELECT v FROM map WHERE k = ?"), k); err != nil {
+		r.Fail(name, "the database may be corrupt, try labed -integrity", "lookup: %v", err)
+		return
+	}
+	elapsed := time.Since(started)
+	if elapsed > SlowLookupThreshold {
+		r.Warn(name, "a cold disk cache or a missing index can cause slow lookups",
+			"sample lookup for %s took %s", k, elapsed)
+		return
+	}
+	r.OK(name, "sample lookup for %s returned %d row(s) in %s", k, len(v), elapsed)
+}
+
+// DiagnoseWritableDir checks, whether a file can be created in a directory,
+// e.g. the directory the cache is created in.
+func DiagnoseWritableDir(r *Report, name, dir string) {
+	f, err := os.CreateTemp(dir, "labed-doctor-")
+	if err != nil {
+		r.Fail(name, "set TMPDIR to a writable directory or fix permissions", "not writable: %v", err)
+		return
+	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		r.Warn(name, "remove the file manually", "cleanup: %v", err)
+		return
+	}
+	r.OK(name, "%s is writable", dir)
+}
+
+// DiagnoseSqlite reports the sqlite3 library version and a few limits, which
+// matter for large databases.
+func DiagnoseSqlite(r *Report) {
+	const name = "sqlite3"
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		r.Fail(name, "", "%v", err)
+		return
+	}
+	defer db.Close()
+	var version string
+	if err := db.Get(&version, "SELECT sqlite_version()"); err != nil {
+		r.Fail(name, "", "version: %v", err)
+		return
+	}
+	// Upserts (ON CONFLICT ... DO UPDATE) are used by "labed counts".
+	if compareVersion(version, "3.24.0") < 0 {
+		r.Warn(name, "labed counts requires sqlite 3.24.0 or later", "version %s", version)
+	} else {
+		r.OK(name, "version %s", version)
+	}
+	var maxPageCount int64
+	if err := db.Get(&maxPageCount, "PRAGMA max_page_count"); err != nil {
+		r.Fail(name, "", "max_page_count: %v", err)
+		return
+	}
+	var pageSize int64
+	if err := db.Get(&pageSize, "PRAGMA page_size"); err != nil {
+		r.Fail(name, "", "page_size: %v", err)
+		return
+	}
+	r.OK(name, "maximum database size with default page size %s",
+		tabutils.ByteSize(int(maxPageCount*pageSize)))
+}
+
+// compareVersion compares two dotted version strings numerically.
+func compareVersion(a, b string) int {
+	var (
+		u = strings.Split(a, ".")
+		v = strings.Split(b, ".")
+	)
+	for i := 0; i < len(u) || i < len(v); i++ {
+		var x, y int
+		if i < len(u) {
+			fmt.Sscanf(u[i], "%d", &x)
+		}
+		if i < len(v) {
+			fmt.Sscanf(v[i], "%d", &y)
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
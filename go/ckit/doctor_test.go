@@ -0,0 +1,66 @@
+package ckit
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseMapDatabase(t *testing.T) {
+	var cases = []struct {
+		path    string
+		indexes []string
+		failed  bool
+		hint    string
+	}{
+		{"testdata/id_doi.db", []string{"idx_k", "idx_v"}, false, ""},
+		{"testdata/id_doi.db", []string{"idx_x"}, true, "CREATE INDEX idx_x ON map(x)"},
+		{"testdata/missing.db", []string{"idx_k"}, true, "makta"},
+		{"", nil, true, ""},
+	}
+	for _, c := range cases {
+		var r Report
+		DiagnoseMapDatabase(&r, "db", c.path, c.indexes)
+		if r.Failed() != c.failed {
+			t.Fatalf("[%s] got failed %v, want %v: %v", c.path, r.Failed(), c.failed, r.Checks)
+		}
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if !strings.Contains(buf.String(), c.hint) {
+			t.Fatalf("[%s] expected hint %q in report: %s", c.path, c.hint, buf.String())
+		}
+	}
+}
+
+func TestDiagnoseWritableDir(t *testing.T) {
+	var r Report
+	DiagnoseWritableDir(&r, "cache", t.TempDir())
+	DiagnoseSqlite(&r)
+	if r.Failed() {
+		t.Fatalf("unexpected failure: %v", r.Checks)
+	}
+	DiagnoseWritableDir(&r, "cache", filepath.Join(t.TempDir(), "missing"))
+	if !r.Failed() {
+		t.Fatalf("expected failure for missing directory")
+	}
+}
+
+func TestCompareVersion(t *testing.T) {
+	var cases = []struct {
+		a, b   string
+		result int
+	}{
+		{"3.24.0", "3.24.0", 0},
+		{"3.9.2", "3.24.0", -1},
+		{"3.39.4", "3.24.0", 1},
+		{"3.24", "3.24.0", 0},
+	}
+	for _, c := range cases {
+		if got := compareVersion(c.a, c.b); got != c.result {
+			t.Fatalf("compareVersion(%s, %s) got %d, want %d", c.a, c.b, got, c.result)
+		}
+	}
+}
@@ -124,7 +124,7 @@ type MapSniffer struct {
 }
 
 func (s *MapSniffer) SearchMap(doc map[string]interface{}) []string {
-	ss := set.New()
+	ss := set.New[string]()
 	for k, v := range doc {
 		if anyMatchString(s.IgnoreKeys, k) {
 			continue
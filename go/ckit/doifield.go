@@ -0,0 +1,51 @@
+package ckit
+
+import "github.com/segmentio/encoding/json"
+
+// DefaultDOIField is the field containing the DOI of unmatched documents,
+// following the VuFind SOLR schema; resolver metadata uses it as well.
+const DefaultDOIField = "doi_str_mv"
+
+// SpindelDOIField is the field containing the DOI of unmatched documents in
+// responses of spindel, the prototype of the server. All other response
+// fields have the same names as in spindel.
+const SpindelDOIField = "doi"
+
+// renameField renames a top level field of documents, e.g. the DOI field of
+// unmatched documents; documents, which are not JSON objects or do not have
+// the field, are kept unchanged. Field order is not preserved.
+func renameField(docs []json.RawMessage, from, to string) []json.RawMessage {
+	if from == to || to == "" {
+		return docs
+	}
+	result := make([]json.RawMessage, len(docs))
+	for i, doc := range docs {
+		result[i] = doc
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(doc, &fields); err != nil {
+			continue
+		}
+		v, ok := fields[from]
+		if !ok {
+			continue
+		}
+		delete(fields, from)
+		fields[to] = v
+		if b, err := json.Marshal(fields); err == nil {
+			result[i] = b
+		}
+	}
+	return result
+}
+
+// unmatchedDOIField returns the configured name of the DOI field for
+// unmatched documents in responses.
+func (s *Server) unmatchedDOIField() string {
+	switch {
+	case s.UnmatchedDOIField != "":
+		return s.UnmatchedDOIField
+	case s.Spindel:
+		return SpindelDOIField
+	}
+	return DefaultDOIField
+}
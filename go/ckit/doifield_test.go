@@ -0,0 +1,61 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestRenameField(t *testing.T) {
+	var cases = []struct {
+		doc    string
+		from   string
+		to     string
+		result string
+	}{
+		{`{"doi_str_mv": "10.1/x"}`, "doi_str_mv", "doi", `{"doi":"10.1/x"}`},
+		{`{"doi_str_mv": "10.1/x"}`, "doi_str_mv", "doi_str_mv", `{"doi_str_mv": "10.1/x"}`},
+		{`{"doi_str_mv": "10.1/x"}`, "doi_str_mv", "", `{"doi_str_mv": "10.1/x"}`},
+		{`{"title": "x"}`, "doi_str_mv", "doi", `{"title": "x"}`},
+		{`[1, 2]`, "doi_str_mv", "doi", `[1, 2]`},
+	}
+	for _, c := range cases {
+		result := renameField([]json.RawMessage{json.RawMessage(c.doc)}, c.from, c.to)
+		if string(result[0]) != c.result {
+			t.Fatalf("got %s, want %s", result[0], c.result)
+		}
+	}
+}
+
+func TestUnmatchedDOIField(t *testing.T) {
+	srv := newTestServer(t)
+	srv.UnmatchedDOIField = "doi"
+	resp := mustRequest(t, srv, "/id/i0029")
+	if len(resp.Unmatched.Cited) == 0 {
+		t.Fatalf("got no unmatched documents")
+	}
+	for _, doc := range append(resp.Unmatched.Citing, resp.Unmatched.Cited...) {
+		var v map[string]string
+		if err := json.Unmarshal(doc, &v); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if _, ok := v["doi_str_mv"]; ok || v["doi"] == "" {
+			t.Fatalf("got %s, want doi field", doc)
+		}
+	}
+	for _, target := range []string{"/id/i0029?v=2", "/id/i0029?format=xml"} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if body := rr.Body.String(); rr.Code != 200 || strings.Contains(body, "doi_str_mv") {
+			t.Fatalf("%s: got %d, %s", target, rr.Code, body)
+		}
+	}
+	// The HTML view still finds the DOI of unmatched documents.
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/view/i0029", nil))
+	if !strings.Contains(rr.Body.String(), "https://doi.org/d0156") {
+		t.Fatalf("view: unmatched doi missing")
+	}
+}
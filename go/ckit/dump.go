@@ -0,0 +1,237 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DumpCheckpointName is the name of the checkpoint file in the dump directory.
+const DumpCheckpointName = "dump.checkpoint"
+
+// Dumper exports fused responses for all local identifiers as zstd
+// compressed NDJSON. The output is split into parts of PartSize identifiers,
+// which are written atomically, followed by a checkpoint, so an interrupted
+// dump can be resumed after the last complete part. Identifiers without
+// citations are skipped.
+type Dumper struct {
+	Handler  http.Handler // fuses responses, usually a Server
+	Dir      string       // output directory
+	Workers  int          // number of parallel requests
+	PartSize int          // number of identifiers per part
+	Logger   *log.Logger  // progress messages, standard logger, if nil
+}
+
+// DumpCheckpoint records the progress of a dump.
+type DumpCheckpoint struct {
+	Identity string    `json:"identity,omitempty"` // optional, e.g. database path
+	LastKey  string    `json:"last_key"`
+	Parts    int       `json:"parts"`
+	Records  int64     `json:"records"`
+	Skipped  int64     `json:"skipped"` // identifiers without citations
+	Errors   int64     `json:"errors"`
+	Done     bool      `json:"done"`
+	Updated  time.Time `json:"updated"`
+}
+
+// dumpCounts are the record counts of a single part.
+type dumpCounts struct {
+	records, skipped, errors int64
+}
+
+// dumpPartName returns the filename of a part.
+func dumpPartName(i int) string {
+	return fmt.Sprintf("part-%06d.ndjson.zst", i)
+}
+
+// readDumpCheckpoint reads a checkpoint, a missing file is not an error.
+func readDumpCheckpoint(path string) (*DumpCheckpoint, error) {
+	var c DumpCheckpoint
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// writeFileAtomic writes data to a temporary file first and renames it.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Run dumps all distinct keys of the identifier database, resuming from a
+// checkpoint in the output directory, if there is one. If identity is not
+// empty and differs from the one in the checkpoint, Run refuses to resume.
+func (d *Dumper) Run(ctx context.Context, db *sqlx.DB, identity string) (*DumpCheckpoint, error) {
+	if d.PartSize < 1 {
+		d.PartSize = 100000
+	}
+	if d.Workers < 1 {
+		d.Workers = 1
+	}
+	if err := os.MkdirAll(d.Dir, 0755); err != nil {
+		return nil, err
+	}
+	cpath := filepath.Join(d.Dir, DumpCheckpointName)
+	cp, err := readDumpCheckpoint(cpath)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Identity != "" && identity != "" && cp.Identity != identity {
+		return nil, fmt.Errorf("checkpoint is for %s, got %s", cp.Identity, identity)
+	}
+	cp.Identity = identity
+	if cp.Done {
+		return cp, nil
+	}
+	query := db.Rebind("SELECT DISTINCT k FROM map WHERE k > ? ORDER BY k LIMIT ?")
+	for {
+		if err := ctx.Err(); err != nil {
+			return cp, err
+		}
+		var keys []string
+		if err := db.SelectContext(ctx, &keys, query, cp.LastKey, d.PartSize); err != nil {
+			return cp, fmt.Errorf("keys: %w", err)
+		}
+		if len(keys) == 0 {
+			break
+		}
+		t := time.Now()
+		b, stats, err := d.part(ctx, keys)
+		if err != nil {
+			return cp, err
+		}
+		if err := writeFileAtomic(filepath.Join(d.Dir, dumpPartName(cp.Parts)), b); err != nil {
+			return cp, err
+		}
+		cp.Parts++
+		cp.LastKey = keys[len(keys)-1]
+		cp.Records += stats.records
+		cp.Skipped += stats.skipped
+		cp.Errors += stats.errors
+		cp.Updated = time.Now()
+		if err := cp.writeFile(cpath); err != nil {
+			return cp, err
+		}
+		d.logf("[ok] dump: part %d with %d records (%s), last key %s",
+			cp.Parts, stats.records, time.Since(t), cp.LastKey)
+	}
+	cp.Done = true
+	cp.Updated = time.Now()
+	return cp, cp.writeFile(cpath)
+}
+
+// logf logs a progress message.
+func (d *Dumper) logf(format string, args ...interface{}) {
+	if d.Logger != nil {
+		d.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// writeFile writes the checkpoint atomically.
+func (c *DumpCheckpoint) writeFile(path string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// part fuses responses for keys and returns a compressed NDJSON part, with
+// records in key order.
+func (d *Dumper) part(ctx context.Context, keys []string) ([]byte, dumpCounts, error) {
+	var (
+		stats   dumpCounts
+		results = make([][]byte, len(keys))
+		codes   = make([]int, len(keys))
+		queue   = make(chan int)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < d.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				req, err := http.NewRequestWithContext(ctx, "GET", "/id/"+url.PathEscape(keys[j]), nil)
+				if err != nil {
+					codes[j] = http.StatusInternalServerError
+					continue
+				}
+				rr := httptest.NewRecorder()
+				d.Handler.ServeHTTP(rr, req)
+				codes[j], results[j] = rr.Code, bytes.TrimSpace(rr.Body.Bytes())
+			}
+		}()
+	}
+	for j := range keys {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+	// An interrupted part is not written, it will be redone on resume.
+	if err := ctx.Err(); err != nil {
+		return nil, stats, err
+	}
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		return nil, stats, err
+	}
+	for j, code := range codes {
+		switch code {
+		case http.StatusOK:
+			stats.records++
+		case http.StatusNotFound:
+			stats.skipped++
+			continue
+		default:
+			stats.errors++
+			d.logf("dump: %s: status %d: %s", keys[j], code, results[j])
+			continue
+		}
+		if _, err := zw.Write(results[j]); err != nil {
+			return nil, stats, err
+		}
+		if _, err := zw.Write([]byte{'\n'}); err != nil {
+			return nil, stats, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, stats, err
+	}
+	return buf.Bytes(), stats, nil
+}
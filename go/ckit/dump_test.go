@@ -0,0 +1,60 @@
+package ckit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDumper(t *testing.T) {
+	srv := newTestServer(t)
+	var (
+		dir = t.TempDir()
+		d   = &Dumper{Handler: srv, Dir: dir, Workers: 4, PartSize: 40}
+	)
+	cp, err := d.Run(context.Background(), srv.IdentifierDatabase, "id_doi.db")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !cp.Done || cp.Parts == 0 || cp.Records == 0 || cp.Errors != 0 {
+		t.Fatalf("unexpected checkpoint: %+v", cp)
+	}
+	// Count records in all parts.
+	var n int64
+	for i := 0; i < cp.Parts; i++ {
+		f, err := os.Open(filepath.Join(dir, dumpPartName(i)))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			t.Fatalf("zstd: %v", err)
+		}
+		br := bufio.NewScanner(zr)
+		br.Buffer(make([]byte, 1<<20), 1<<24)
+		for br.Scan() {
+			var resp Response
+			if err := json.Unmarshal(br.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			n++
+		}
+		zr.Close()
+		f.Close()
+	}
+	if n != cp.Records {
+		t.Fatalf("got %d records, want %d", n, cp.Records)
+	}
+	// A finished dump is not repeated, a dump for different input is refused.
+	if again, err := d.Run(context.Background(), srv.IdentifierDatabase, "id_doi.db"); err != nil || again.Parts != cp.Parts {
+		t.Fatalf("got %+v, %v", again, err)
+	}
+	if _, err := d.Run(context.Background(), srv.IdentifierDatabase, "other.db"); err == nil {
+		t.Fatalf("expected error for different identity")
+	}
+}
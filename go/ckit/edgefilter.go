@@ -0,0 +1,137 @@
+package ckit
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/slub/labe/go/ckit/bloom"
+)
+
+// BuildEdgeFilter creates a Bloom filter over all keys and values of one or
+// more citation databases, so the server can skip edge queries for DOI
+// without any citation data. The filter is sized by the number of distinct
+// keys and values, which requires one additional pass over the indexes. The
+// filter is tagged with the fingerprint of the databases.
+func BuildEdgeFilter(dbs []*sqlx.DB, p float64) (*bloom.Filter, error) {
+	tag, err := EdgeFilterFingerprint(dbs)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	for _, db := range dbs {
+		var k, v int
+		if err := db.Get(&k, "SELECT count(DISTINCT k) FROM map"); err != nil {
+			return nil, fmt.Errorf("count keys: %w", err)
+		}
+		if err := db.Get(&v, "SELECT count(DISTINCT v) FROM map"); err != nil {
+			return nil, fmt.Errorf("count values: %w", err)
+		}
+		n += k + v
+	}
+	log.Printf("[..] creating filter for at most %d elements", n)
+	f := bloom.New(n, p)
+	f.Tag = tag
+	for _, db := range dbs {
+		for _, query := range []string{
+			"SELECT DISTINCT k FROM map",
+			"SELECT DISTINCT v FROM map",
+		} {
+			rows, err := db.Query(query)
+			if err != nil {
+				return nil, err
+			}
+			var s string
+			for rows.Next() {
+				if err := rows.Scan(&s); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				f.Add(s)
+			}
+			if err := rows.Close(); err != nil {
+				return nil, err
+			}
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+// EdgeFilterFingerprint identifies the contents of sqlite3 citation databases
+// by the file change counter and the number of pages from their headers; both
+// change with every write transaction, but not when files are copied or
+// moved. The fingerprint is empty, if any database is not an sqlite3 file.
+func EdgeFilterFingerprint(dbs []*sqlx.DB) (string, error) {
+	var parts []string
+	for _, db := range dbs {
+		if !strings.HasPrefix(db.DriverName(), "sqlite3") {
+			return "", nil
+		}
+		var rows []struct {
+			Seq  int    `db:"seq"`
+			Name string `db:"name"`
+			File string `db:"file"`
+		}
+		if err := db.Select(&rows, "PRAGMA database_list"); err != nil {
+			return "", err
+		}
+		if len(rows) == 0 || rows[0].File == "" {
+			return "", nil // in-memory
+		}
+		f, err := os.Open(rows[0].File)
+		if err != nil {
+			return "", err
+		}
+		var hdr [32]byte
+		_, err = io.ReadFull(f, hdr[:])
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("sqlite3 header: %w", err)
+		}
+		// File change counter at offset 24, database size in pages at 28.
+		parts = append(parts, fmt.Sprintf("%x", hdr[24:32]))
+	}
+	// Databases may be given in any order.
+	sort.Strings(parts)
+	h := sha1.Sum([]byte(strings.Join(parts, ",")))
+	return fmt.Sprintf("%x", h[:8]), nil
+}
+
+// CheckEdgeFilter returns an error, if the edge filter has been built from
+// other citation databases than the configured ones, which could hide edges.
+// Filters without a fingerprint, or databases without one, are accepted.
+func (d *Datasets) CheckEdgeFilter() error {
+	if d.EdgeFilter == nil || d.EdgeFilter.Tag == "" {
+		return nil
+	}
+	dbs := d.OciShards
+	if len(dbs) == 0 {
+		dbs = []*sqlx.DB{d.OciDatabase}
+	}
+	for _, src := range d.AdditionalOciDatabases {
+		dbs = append(dbs, src.DB)
+	}
+	fp, err := EdgeFilterFingerprint(dbs)
+	if err != nil {
+		return fmt.Errorf("edge filter: %w", err)
+	}
+	if fp != "" && fp != d.EdgeFilter.Tag {
+		return fmt.Errorf("edge filter built from other citation databases (%s, want %s), "+
+			"rebuild with labed bloom", d.EdgeFilter.Tag, fp)
+	}
+	return nil
+}
+
+// hasNoEdges returns true, if the edge filter is configured and the DOI
+// definitely does not appear in any citation database.
+func (d *Datasets) hasNoEdges(doi string) bool {
+	return d.EdgeFilter != nil && !d.EdgeFilter.Test(doi)
+}
@@ -0,0 +1,68 @@
+package ckit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestBuildEdgeFilter(t *testing.T) {
+	db, err := OpenDatabase("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f, err := BuildEdgeFilter([]*sqlx.DB{db}, 0.01)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	srv := &Server{EdgeFilter: f}
+	for _, doi := range []string{"d0098", "d0194"} {
+		if srv.data(context.Background()).hasNoEdges(doi) {
+			t.Fatalf("false negative for %s", doi)
+		}
+	}
+	// The filter is deterministic, these keys are not in the test data and
+	// happen not to be false positives.
+	for _, doi := range []string{"10.9999/not-there", "10.1234/x", "d9999", "xxx"} {
+		if !srv.data(context.Background()).hasNoEdges(doi) {
+			t.Fatalf("got edges for %s, want none", doi)
+		}
+	}
+}
+
+func TestCheckEdgeFilter(t *testing.T) {
+	b, err := os.ReadFile("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "doi_doi.db")
+	if err := os.WriteFile(filename, b, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	db, err := sqlx.Open("sqlite3", filename)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	f, err := BuildEdgeFilter([]*sqlx.DB{db}, 0.01)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if f.Tag == "" {
+		t.Fatalf("filter without fingerprint")
+	}
+	d := &Datasets{OciDatabase: db, EdgeFilter: f}
+	if err := d.CheckEdgeFilter(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	// A delta import adds edges, the filter would hide them.
+	if _, err := db.Exec("INSERT INTO map (k, v) VALUES ('d9999', 'd0001')"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := d.CheckEdgeFilter(); err == nil {
+		t.Fatalf("expected error for stale filter")
+	}
+}
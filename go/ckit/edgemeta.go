@@ -0,0 +1,102 @@
+package ckit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// edgeMetaColumns are the optional columns of the map table of a citation
+// database, containing edge attributes from the COCI dumps.
+var edgeMetaColumns = []string{"oci", "creation", "timespan", "journal_sc", "author_sc"}
+
+// EdgeMeta contains optional edge attributes, as found in the COCI dumps: the
+// OCI identifier, the creation date of the citing document, the timespan
+// between the publication of cited and citing document and whether the
+// citation is a journal or author self-citation ("yes" or "no").
+type EdgeMeta struct {
+	OCI       string `db:"oci" json:"oci,omitempty"`
+	Creation  string `db:"creation" json:"creation,omitempty"`
+	Timespan  string `db:"timespan" json:"timespan,omitempty"`
+	JournalSC string `db:"journal_sc" json:"journal_sc,omitempty"`
+	AuthorSC  string `db:"author_sc" json:"author_sc,omitempty"`
+}
+
+// IsZero returns true, if no attribute is set.
+func (m EdgeMeta) IsZero() bool {
+	return m == EdgeMeta{}
+}
+
+// edgeQueries are the queries for outbound and inbound edges of a citation
+// database; byOCI is only set, if the database has an indexed oci column.
+type edgeQueries struct {
+	byKey   string
+	byValue string
+	byOCI   string
+}
+
+// edgeQueriesFor returns the edge queries for a citation database, including
+// any edge attribute columns the map table has. The result is cached per
+// database.
+func (s *Server) edgeQueriesFor(db *sqlx.DB) (edgeQueries, error) {
+	if v, ok := s.edgeMeta.Load(db); ok {
+		return v.(edgeQueries), nil
+	}
+	rows, err := db.Queryx("SELECT * FROM map LIMIT 0")
+	if err != nil {
+		return edgeQueries{}, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return edgeQueries{}, err
+	}
+	var available []string
+	for _, c := range edgeMetaColumns {
+		if SliceContains(columns, c) {
+			available = append(available, c)
+		}
+	}
+	q := edgeQueries{byKey: queryRowsByKey, byValue: queryRowsByValue}
+	if len(available) > 0 {
+		q = edgeQueries{
+			byKey:   edgeMetaQuery("k", available),
+			byValue: edgeMetaQuery("v", available),
+		}
+		if SliceContains(available, "oci") && hasIndexOn(db, "oci") {
+			q.byOCI = edgeMetaQuery("oci", available)
+		}
+	}
+	s.edgeMeta.Store(db, q)
+	return q, nil
+}
+
+// hasIndexOn returns true, if the map table has an index with the given
+// column first, so lookups by that column do not scan the table. Databases
+// other than sqlite3 are assumed to be indexed.
+func hasIndexOn(db *sqlx.DB, column string) bool {
+	if !strings.HasPrefix(db.DriverName(), "sqlite3") {
+		return true
+	}
+	var n int
+	err := db.Get(&n, `SELECT COUNT(*) FROM pragma_index_list('map') AS l,
+		pragma_index_info(l.name) AS i WHERE i.seqno = 0 AND i.name = ?`, column)
+	return err == nil && n > 0
+}
+
+// edgeMetaQuery returns a query for edges including the available edge
+// attributes, with the given column (k or v) as condition; missing attributes
+// are returned as empty strings.
+func edgeMetaQuery(column string, available []string) string {
+	fields := make([]string, len(edgeMetaColumns))
+	for i, c := range edgeMetaColumns {
+		if SliceContains(available, c) {
+			fields[i] = fmt.Sprintf("COALESCE(%s, '') AS %s", c, c)
+		} else {
+			fields[i] = fmt.Sprintf("'' AS %s", c)
+		}
+	}
+	return fmt.Sprintf("SELECT k, v, %s FROM map WHERE %s = ?",
+		strings.Join(fields, ", "), column)
+}
@@ -0,0 +1,58 @@
+package ckit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestEdgeMeta(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "oci.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, q := range []string{
+		`CREATE TABLE map (k TEXT, v TEXT, oci TEXT, creation TEXT,
+			timespan TEXT, author_sc TEXT)`,
+		`INSERT INTO map VALUES ('a', 'b', '0201-0202', '2019-01', 'P2Y', 'yes')`,
+		`INSERT INTO map (k, v) VALUES ('c', 'a')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	srv := &Server{OciDatabase: db, Stats: newTestStats()}
+	citing, cited, _, err := srv.edges(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("edges: %v", err)
+	}
+	if len(citing) != 1 || len(cited) != 1 {
+		t.Fatalf("got %d citing, %d cited, want 1, 1", len(citing), len(cited))
+	}
+	// Not all attributes need to be present.
+	want := EdgeMeta{OCI: "0201-0202", Creation: "2019-01", Timespan: "P2Y", AuthorSC: "yes"}
+	if citing[0].EdgeMeta != want {
+		t.Fatalf("got %v, want %v", citing[0].EdgeMeta, want)
+	}
+	var resp Response
+	resp.setEdgeMeta(citing, cited)
+	if len(resp.Extra.CitingEdges) != 1 || resp.Extra.CitedEdges != nil {
+		t.Fatalf("got %v, %v, want one citing edge", resp.Extra.CitingEdges, resp.Extra.CitedEdges)
+	}
+	// Plain k/v databases do not have edge attributes.
+	plain, err := OpenDatabase("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	defer plain.Close()
+	q, err := srv.edgeQueriesFor(plain)
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if q.byKey != queryRowsByKey || q.byValue != queryRowsByValue {
+		t.Fatalf("got %v, want plain queries", q)
+	}
+}
@@ -0,0 +1,144 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/slub/labe/go/ckit/set"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+// Enrichment contains citation data to be added to an index document, e.g. to
+// make citation data searchable in the index itself. Counts are edge counts
+// and include documents not in the index, the identifier lists only contain
+// matched documents.
+type Enrichment struct {
+	CitationCount  int      `json:"citation_count"`
+	ReferenceCount int      `json:"reference_count"`
+	CitedByIDs     []string `json:"cited_by_ids,omitempty"`
+	CitesIDs       []string `json:"cites_ids,omitempty"`
+}
+
+// Enrich runs the fusion pipeline for a local identifier without fetching
+// related documents and returns the citation data for the record; a record
+// without DOI or edges yields a zero value.
+func (s *Server) Enrich(ctx context.Context, id string) (*Enrichment, error) {
+	var e Enrichment
+	doi, err := s.lookupDOI(ctx, id)
+	if err == sql.ErrNoRows {
+		return &e, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	citing, cited, _, err := s.edges(ctx, doi)
+	if err != nil {
+		return nil, err
+	}
+	e.ReferenceCount, e.CitationCount = len(citing), len(cited)
+	if len(citing)+len(cited) == 0 {
+		return &e, nil
+	}
+	var outbound, inbound = set.New[string](), set.New[string]()
+	for _, v := range citing {
+		outbound.Add(v.Value)
+	}
+	for _, v := range cited {
+		inbound.Add(v.Key)
+	}
+	ids, err := s.mapToLocal(ctx, outbound.Union(inbound).Slice())
+	if err != nil {
+		return nil, err
+	}
+	var cites, citedBy = set.New[string](), set.New[string]()
+	for _, v := range ids {
+		if outbound.Contains(v.Value) {
+			cites.Add(v.Key)
+		}
+		if inbound.Contains(v.Value) {
+			citedBy.Add(v.Key)
+		}
+	}
+	e.CitesIDs, e.CitedByIDs = set.Sorted(cites), set.Sorted(citedBy)
+	return &e, nil
+}
+
+// EnrichDocument adds citation data to a JSON document (object) for a local
+// identifier; if id is empty, it is taken from the "id" field of the document.
+func (s *Server) EnrichDocument(ctx context.Context, id string, doc []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+	if id == "" {
+		if err := json.Unmarshal(fields["id"], &id); err != nil || id == "" {
+			return nil, fmt.Errorf("document without id")
+		}
+	}
+	e, err := s.Enrich(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	for k, v := range map[string]interface{}{
+		"citation_count":  e.CitationCount,
+		"reference_count": e.ReferenceCount,
+		"cited_by_ids":    nonNil(e.CitedByIDs),
+		"cites_ids":       nonNil(e.CitesIDs),
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		fields[k] = b
+	}
+	return json.Marshal(fields)
+}
+
+// nonNil returns an empty slice for nil, so lists are serialized as [] and
+// replace stale values on reindexing.
+func nonNil(ss []string) []string {
+	if ss == nil {
+		return []string{}
+	}
+	return ss
+}
+
+// EnrichLines reads lines from r, which are either JSON documents (e.g. from
+// a SOLR export) or local identifiers, whose documents are fetched from the
+// index data. Enriched documents are written to w as NDJSON, in input order;
+// identifiers without index data are skipped.
+func (s *Server) EnrichLines(ctx context.Context, r io.Reader, w io.Writer, workers int) error {
+	data := s.data(ctx)
+	f := func(line []byte) ([]byte, error) {
+		var id string
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			return nil, nil
+		}
+		if line[0] != '{' {
+			id = string(line)
+			b, err := data.IndexData.Fetch(id)
+			if errors.Is(err, ErrBlobNotFound) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			line = b
+		}
+		b, err := s.EnrichDocument(ctx, id, line)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	return tabutils.ConvertLines(r, workers, f, func(b []byte, _, _ int64) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
@@ -0,0 +1,57 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEnrich(t *testing.T) {
+	srv := newTestServer(t)
+	// d0029 cites d0009, d0039, d0065 and d0029 is cited by d0069 (matched)
+	// and d0156 (unmatched); every row appears four times in the fixtures.
+	e, err := srv.Enrich(context.Background(), "i0029")
+	if err != nil {
+		t.Fatalf("enrich: %v", err)
+	}
+	if len(e.CitedByIDs) == 0 || e.CitedByIDs[0] != "i0069" {
+		t.Fatalf("got cited by %v, want i0069", e.CitedByIDs)
+	}
+	if e.CitationCount == 0 || e.ReferenceCount == 0 || len(e.CitesIDs) == 0 {
+		t.Fatalf("unexpected enrichment: %+v", e)
+	}
+	if e, err = srv.Enrich(context.Background(), "xxxx"); err != nil || e.CitationCount != 0 {
+		t.Fatalf("got %+v, %v, want zero value", e, err)
+	}
+}
+
+func TestEnrichLines(t *testing.T) {
+	srv := newTestServer(t)
+	var (
+		input = "i0029\nxxxx\n{\"id\": \"i0029\", \"title\": \"a\"}\n"
+		buf   bytes.Buffer
+	)
+	if err := srv.EnrichLines(context.Background(), strings.NewReader(input), &buf, 2); err != nil {
+		t.Fatalf("enrich: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %s", len(lines), buf.String())
+	}
+	var doc struct {
+		Title         string   `json:"title"`
+		CitationCount int      `json:"citation_count"`
+		CitedByIDs    []string `json:"cited_by_ids"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.Title != "a" || doc.CitationCount == 0 || len(doc.CitedByIDs) == 0 {
+		t.Fatalf("unexpected document: %s", lines[1])
+	}
+	if err := srv.EnrichLines(context.Background(), strings.NewReader("{}\n"), &buf, 1); err == nil {
+		t.Fatalf("expected error for document without id")
+	}
+}
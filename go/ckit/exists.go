@@ -0,0 +1,123 @@
+package ckit
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+// Existence tells, whether a local identifier has a DOI and any citation
+// data, without fetching documents.
+type Existence struct {
+	ID        string `json:"id"`
+	DOI       string `json:"doi,omitempty"`
+	HasDOI    bool   `json:"has_doi"`
+	HasCiting bool   `json:"has_citing"` // outbound edges
+	HasCited  bool   `json:"has_cited"`  // inbound edges
+}
+
+// HasEdges returns true, if the /id/{id} endpoint has a response.
+func (e *Existence) HasEdges() bool {
+	return e.HasCiting || e.HasCited
+}
+
+// exists checks a local identifier with at most two small queries per
+// citation database; a configured counts database or edge filter is used
+// first.
+func (s *Server) exists(ctx context.Context, id string) (*Existence, error) {
+	e := &Existence{ID: id}
+	doi, err := s.lookupDOI(ctx, id)
+	if err == sql.ErrNoRows {
+		return e, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.DOI, e.HasDOI = doi, true
+	d := s.data(ctx)
+	if d.hasNoEdges(doi) {
+		return e, nil
+	}
+	if d.CountsDatabase != nil {
+		c, err := s.counts(ctx, doi)
+		if err != nil {
+			return nil, err
+		}
+		e.HasCiting, e.HasCited = c.Citing > 0, c.Cited > 0
+		return e, nil
+	}
+	ectx, cancel := withTimeout(ctx, s.EdgesTimeout)
+	defer cancel()
+	for _, src := range d.ociSources() {
+		if !e.HasCiting {
+			stmt, err := s.stmts.get(src.shardFor(doi), "SELECT EXISTS (SELECT 1 FROM map WHERE k = ?)")
+			if err != nil {
+				return nil, err
+			}
+			if err := stmt.GetContext(ectx, &e.HasCiting, doi); err != nil {
+				return nil, err
+			}
+		}
+		if e.HasCited {
+			continue
+		}
+		var (
+			dbs   = src.databases()
+			found = make([]bool, len(dbs))
+		)
+		err := eachShard(dbs, func(i int, db *sqlx.DB) error {
+			stmt, err := s.stmts.get(db, "SELECT EXISTS (SELECT 1 FROM map WHERE v = ?)")
+			if err != nil {
+				return err
+			}
+			return stmt.GetContext(ectx, &found[i], doi)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range found {
+			e.HasCited = e.HasCited || v
+		}
+	}
+	return e, nil
+}
+
+// handleExists reports, whether a local identifier has a DOI and citation
+// data; always 200, except for errors.
+func (s *Server) handleExists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		e, err := s.exists(r.Context(), id)
+		if err != nil {
+			s.writeLookupError(w, r, id, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(e); err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+		}
+	}
+}
+
+// handleHead answers HEAD requests for /id/{id} with the status a GET
+// request would have (200 or 404), without doing the work.
+func (s *Server) handleHead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		e, err := s.exists(r.Context(), id)
+		if err != nil {
+			s.writeLookupError(w, r, id, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !e.HasEdges() && !s.data(r.Context()).isDegraded(ComponentCitations) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,61 @@
+package ckit
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestServerExists(t *testing.T) {
+	srv := newTestServer(t)
+	var cases = []struct {
+		id   string
+		want Existence
+		head int
+	}{
+		{"i0029", Existence{ID: "i0029", DOI: "d0029", HasDOI: true, HasCiting: true, HasCited: true}, 200},
+		{"i0098", Existence{ID: "i0098", DOI: "d0098", HasDOI: true, HasCiting: true}, 200},
+		{"i0001", Existence{ID: "i0001", DOI: "d0001", HasDOI: true}, 404},
+		{"xxx", Existence{ID: "xxx"}, 404},
+	}
+	output := filepath.Join(t.TempDir(), "counts.db")
+	if err := BuildCountsDatabase(output, "testdata/doi_doi.db"); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	countsDB, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer countsDB.Close()
+	// Same results with and without counts database.
+	for _, withCounts := range []bool{false, true} {
+		if withCounts {
+			srv.CountsDatabase = countsDB
+		}
+		for _, c := range cases {
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/"+c.id+"/exists", nil))
+			if rr.Code != 200 {
+				t.Fatalf("%s: got %d, want 200", c.id, rr.Code)
+			}
+			var got Existence
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got != c.want {
+				t.Fatalf("%s: got %+v, want %+v", c.id, got, c.want)
+			}
+			rr = httptest.NewRecorder()
+			srv.ServeHTTP(rr, httptest.NewRequest("HEAD", "/id/"+c.id, nil))
+			if rr.Code != c.head || rr.Body.Len() != 0 {
+				t.Fatalf("HEAD %s: got %d, want %d without body", c.id, rr.Code, c.head)
+			}
+		}
+	}
+	if e, err := srv.exists(context.Background(), "i0029"); err != nil || !e.HasEdges() {
+		t.Fatalf("got %v, %v, want edges", e, err)
+	}
+}
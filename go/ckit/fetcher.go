@@ -1,14 +1,16 @@
 package ckit
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/slub/labe/go/ckit/tabutils"
 )
 
 var (
@@ -33,32 +35,85 @@ type Fetcher interface {
 	Fetch(id string) ([]byte, error)
 }
 
+// SourceFetcher is a Fetcher, which also tells which backend served a blob,
+// e.g. for provenance information.
+type SourceFetcher interface {
+	FetchSource(id string) (p []byte, source string, err error)
+}
+
+// fetchSource fetches a blob and names the backend it came from: the source
+// reported by a SourceFetcher, the name of a fmt.Stringer or the type.
+func fetchSource(f Fetcher, id string) ([]byte, string, error) {
+	switch v := f.(type) {
+	case SourceFetcher:
+		return v.FetchSource(id)
+	case fmt.Stringer:
+		p, err := f.Fetch(id)
+		return p, v.String(), err
+	default:
+		p, err := f.Fetch(id)
+		return p, fmt.Sprintf("%T", f), err
+	}
+}
+
 // SqliteFetcher serves index documents from sqlite database with a fixed schema,
 // as generated by the makta tool.
 type SqliteFetcher struct {
-	DB *sqlx.DB
+	DB   *sqlx.DB
+	Name string // usually the filename, for provenance information
+
+	stmts stmtCache
 }
 
 // Fetch document.
 func (b *SqliteFetcher) Fetch(id string) (p []byte, err error) {
+	stmt, err := b.stmts.get(b.DB, queryValueByKey)
+	if err != nil {
+		return nil, err
+	}
 	var s string // TODO: could we just get into a []byte?
-	if err := b.DB.Get(&s, "SELECT v FROM map WHERE k = ?", id); err != nil {
+	if err := stmt.Get(&s, id); err != nil {
 		return nil, err
 	}
 	return []byte(s), nil
 }
 
+// String names the database, e.g. "sqlite:index.db".
+func (b *SqliteFetcher) String() string {
+	if b.Name == "" {
+		return "sqlite"
+	}
+	return "sqlite:" + filepath.Base(b.Name)
+}
+
 // Ping pings the database.
 func (b *SqliteFetcher) Ping() error {
 	return b.DB.Ping()
 }
 
+// Validate checks the database schema, optionally the integrity as well.
+func (b *SqliteFetcher) Validate(integrity bool) error {
+	return ValidateMapDatabase(b.DB, []string{"idx_k"}, integrity)
+}
+
 // FetchGroup allows to run a index data fetch operation in a cascade over a
 // couple of backends. The result from the first database that contains a value
 // for a given id is returned. Currently sequential, but could be made
 // parallel, maybe.
+//
+// If BreakerThreshold is greater than zero, each backend is guarded by a
+// circuit breaker: after that many consecutive failures (not misses) a
+// backend is skipped for BreakerCooldown, so a single hanging backend does
+// not stall every document fetch.
 type FetchGroup struct {
-	Backends []Fetcher
+	Backends         []Fetcher
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// SqliteOptions are applied to databases opened with FromFiles.
+	SqliteOptions SqliteOptions
+
+	mu       sync.Mutex
+	breakers []*CircuitBreaker
 }
 
 // FromFiles sets up a fetch group from a list of sqlite3 database filenames.
@@ -68,11 +123,11 @@ func (g *FetchGroup) FromFiles(files ...string) error {
 		if _, err := os.Stat(f); os.IsNotExist(err) {
 			return fmt.Errorf("file not found: %s", f)
 		}
-		db, err := sqlx.Open("sqlite3", tabutils.WithReadOnly(f))
+		db, err := openSqlite(f, g.SqliteOptions)
 		if err != nil {
 			return fmt.Errorf("database: %w", err)
 		}
-		fetcher := &SqliteFetcher{DB: db}
+		fetcher := &SqliteFetcher{DB: db, Name: f}
 		g.Backends = append(g.Backends, fetcher)
 	}
 	return nil
@@ -92,15 +147,77 @@ func (g *FetchGroup) Ping() error {
 	return nil
 }
 
-// Fetch constructs a URL from a template and retrieves the blob.
+// Validate validates all backends, which support validation.
+func (g *FetchGroup) Validate(integrity bool) error {
+	for i, v := range g.Backends {
+		w, ok := v.(Validator)
+		if !ok {
+			continue
+		}
+		if err := w.Validate(integrity); err != nil {
+			return fmt.Errorf("backend #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Fetch constructs a URL from a template and retrieves the blob. If all
+// backends report a missing value, ErrBlobNotFound is returned; backends
+// skipped by their circuit breaker do not count, as long as one backend
+// answered. If no backend answered, ErrBackendsFailed is returned.
 func (g *FetchGroup) Fetch(id string) ([]byte, error) {
-	for _, v := range g.Backends {
-		if p, err := v.Fetch(id); err != nil {
-			// OK to miss.
+	p, _, err := g.FetchSource(id)
+	return p, err
+}
+
+// FetchSource is like Fetch, but also returns the name of the backend, which
+// served the blob.
+func (g *FetchGroup) FetchSource(id string) ([]byte, string, error) {
+	var missed, skipped int
+	for i, v := range g.Backends {
+		breaker := g.breaker(i)
+		if !breaker.Allow() {
+			skipped++
 			continue
-		} else {
-			return p, nil
 		}
+		p, source, err := fetchSource(v, id)
+		switch {
+		case err == nil:
+			breaker.Success()
+			return p, source, nil
+		case isMiss(err):
+			// OK to miss.
+			breaker.Success()
+			missed++
+		default:
+			breaker.Failure()
+		}
+	}
+	if missed > 0 && missed+skipped == len(g.Backends) {
+		return nil, "", ErrBlobNotFound
+	}
+	return nil, "", ErrBackendsFailed
+}
+
+// breaker returns the circuit breaker for the i-th backend, or nil if
+// breakers are disabled.
+func (g *FetchGroup) breaker(i int) *CircuitBreaker {
+	if g.BreakerThreshold <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for len(g.breakers) <= i {
+		g.breakers = append(g.breakers, &CircuitBreaker{
+			Threshold: g.BreakerThreshold,
+			Cooldown:  g.BreakerCooldown,
+		})
 	}
-	return nil, ErrBackendsFailed
+	return g.breakers[i]
+}
+
+// isMiss returns true, if an error only signals a missing value, as opposed
+// to a failing backend.
+func isMiss(err error) bool {
+	return errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrBlobNotFound)
 }
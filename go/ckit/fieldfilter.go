@@ -0,0 +1,97 @@
+package ckit
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// FieldFilter removes top level fields from documents in responses, so
+// internal fields of the index data (e.g. holdings codes, raw MARC leftovers)
+// do not leak to API consumers. If Allow is not empty, only these fields are
+// kept; fields in Deny are always removed. The filter is applied after all
+// request options (e.g. the institution filter), which may use any field.
+type FieldFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+// ParseFieldList parses a comma separated list of field names.
+func ParseFieldList(s string) []string {
+	var fields []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			fields = append(fields, v)
+		}
+	}
+	return fields
+}
+
+// Transform removes fields from a JSON object; the document is returned
+// unchanged, if no field needs to be removed.
+func (f *FieldFilter) Transform(b []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	n := len(fields)
+	if len(f.Allow) > 0 {
+		for k := range fields {
+			if !SliceContains(f.Allow, k) {
+				delete(fields, k)
+			}
+		}
+	}
+	for _, k := range f.Deny {
+		delete(fields, k)
+	}
+	if len(fields) == n {
+		return b, nil
+	}
+	return json.Marshal(fields)
+}
+
+// filterDocuments applies the filter to documents in place; documents,
+// which are not valid JSON objects, cannot be filtered and are removed.
+// Returns messages about removed documents.
+func (f *FieldFilter) filterDocuments(docs []json.RawMessage, name string) ([]json.RawMessage, []string) {
+	var (
+		result = docs[:0]
+		errs   []string
+	)
+	for i, b := range docs {
+		v, err := f.Transform(b)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %d: removed, cannot filter fields: %v", name, i, err))
+			continue
+		}
+		result = append(result, v)
+	}
+	return result, errs
+}
+
+// applyFieldFilter removes fields from all documents of the response.
+func (r *Response) applyFieldFilter(f *FieldFilter) {
+	if f == nil {
+		return
+	}
+	for _, list := range []struct {
+		docs *[]json.RawMessage
+		name string
+	}{
+		{&r.Citing, "citing"},
+		{&r.Cited, "cited"},
+		{&r.Unmatched.Citing, "unmatched citing"},
+		{&r.Unmatched.Cited, "unmatched cited"},
+	} {
+		var errs []string
+		*list.docs, errs = f.filterDocuments(*list.docs, list.name)
+		for _, msg := range errs {
+			log.Printf("%s: %s", r.ID, msg)
+		}
+		r.Extra.Errors = append(r.Extra.Errors, errs...)
+	}
+	r.updateCounts()
+}
@@ -0,0 +1,80 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestFieldFilterTransform(t *testing.T) {
+	var cases = []struct {
+		filter FieldFilter
+		doc    string
+		want   string
+		err    bool
+	}{
+		{FieldFilter{}, `{"b":2, "a":1}`, `{"b":2, "a":1}`, false},
+		{FieldFilter{Deny: []string{"a"}}, `{"a":1,"b":2}`, `{"b":2}`, false},
+		{FieldFilter{Deny: []string{"x"}}, `{"b":2, "a":1}`, `{"b":2, "a":1}`, false},
+		{FieldFilter{Allow: []string{"a", "c"}}, `{"a":1,"b":2,"c":3}`, `{"a":1,"c":3}`, false},
+		{FieldFilter{Allow: []string{"a", "b"}, Deny: []string{"b"}}, `{"a":1,"b":2}`, `{"a":1}`, false},
+		{FieldFilter{Deny: []string{"a"}}, `[1]`, "", true},
+	}
+	for i, c := range cases {
+		b, err := c.filter.Transform([]byte(c.doc))
+		if (err != nil) != c.err {
+			t.Fatalf("[%d] got %v, want error %v", i, err, c.err)
+		}
+		if string(b) != c.want {
+			t.Fatalf("[%d] got %s, want %s", i, b, c.want)
+		}
+	}
+	if got := ParseFieldList(" a,,b "); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("got %v, want [a b]", got)
+	}
+}
+
+func TestServerFieldFilter(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	srv.CacheTriggerDuration = 0
+	srv.FieldFilter = &FieldFilter{Deny: []string{"institution"}}
+	for _, threshold := range []int{0, 1} {
+		srv.StreamThreshold = threshold
+		for _, tc := range []struct {
+			target string
+			citing int
+		}{
+			{"/id/i0029", 12},
+			{"/id/i0029", 12},
+			{"/id/i0029?i=DE-1", 8},
+			{"/id/i0029?i=DE-X", 0},
+		} {
+			target := tc.target
+			resp := mustRequest(t, srv, target)
+			if len(resp.Citing) != tc.citing {
+				t.Fatalf("[%d %s] got %d citing, want %d", threshold, target, len(resp.Citing), tc.citing)
+			}
+			for _, b := range append(resp.Citing, resp.Cited...) {
+				if strings.Contains(string(b), "institution") {
+					t.Fatalf("[%d %s] got %s, want institution removed", threshold, target, b)
+				}
+			}
+		}
+	}
+	// The cache keeps the unfiltered documents.
+	srv.FieldFilter = nil
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+	if rr.Header().Get("X-Cache") != "HIT" || !strings.Contains(rr.Body.String(), "institution") {
+		t.Fatalf("got %s, want cached response with institution", rr.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,61 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultFigshareEndpoint is the figshare API, which hosts the
+	// OpenCitations dumps.
+	DefaultFigshareEndpoint = "https://api.figshare.com/v2"
+	// DefaultCociArticle is the figshare article of the COCI CSV dump, see
+	// https://doi.org/10.6084/m9.figshare.6741422.
+	DefaultCociArticle = 6741422
+)
+
+// FigshareFile is a file of a figshare article.
+type FigshareFile struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	DownloadURL string `json:"download_url"`
+	MD5         string `json:"computed_md5"`
+}
+
+// FigshareArticle is the metadata of the latest version of a figshare
+// article, e.g. a release of a citation dump.
+type FigshareArticle struct {
+	ID        int64          `json:"id"`
+	Title     string         `json:"title"`
+	DOI       string         `json:"doi"`
+	Version   int            `json:"version"`
+	Published string         `json:"published_date"`
+	Files     []FigshareFile `json:"files"`
+}
+
+// FetchFigshareArticle fetches the metadata of the latest version of a
+// figshare article; endpoint defaults to DefaultFigshareEndpoint, client to
+// a client with a 5s timeout.
+func FetchFigshareArticle(ctx context.Context, c *http.Client, endpoint string, id int64) (*FigshareArticle, error) {
+	if endpoint == "" {
+		endpoint = DefaultFigshareEndpoint
+	}
+	link := fmt.Sprintf("%s/articles/%d", strings.TrimRight(endpoint, "/"), id)
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", resolverUserAgent(""))
+	var article FigshareArticle
+	if err := getJSON(c, req, &article); err != nil {
+		if errors.Is(err, ErrDOINotFound) {
+			return nil, fmt.Errorf("figshare: article not found: %d", id)
+		}
+		return nil, fmt.Errorf("figshare: %w", err)
+	}
+	return &article, nil
+}
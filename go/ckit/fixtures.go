@@ -0,0 +1,260 @@
+package ckit
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/slub/labe/go/ckit/set"
+)
+
+// Fixture filenames, as used in testdata.
+const (
+	FixtureIdentifierFile = "id_doi.db"
+	FixtureOciFile        = "doi_doi.db"
+	FixtureIndexFile      = "id_metadata.db"
+)
+
+// mapRows are rows of a map table, with all columns. Rows are kept as they
+// are, including duplicates, so callers need to avoid selecting a row twice.
+type mapRows struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+// add appends rows; if skip is not nil, rows with a value in skip in the
+// given column are left out.
+func (m *mapRows) add(columns []string, rows [][]interface{}, column string, skip set.Set[string]) {
+	m.columns = columns
+	for _, row := range rows {
+		if skip != nil {
+			if v, ok := row[columnIndex(columns, column)].(string); ok && skip.Contains(v) {
+				continue
+			}
+		}
+		m.rows = append(m.rows, row)
+	}
+}
+
+// columnIndex returns the index of a column or -1.
+func columnIndex(columns []string, column string) int {
+	for i, c := range columns {
+		if c == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// values returns the set of values of a column (k or v).
+func (m *mapRows) values(column string) set.Set[string] {
+	result := set.New[string]()
+	if i := columnIndex(m.columns, column); i >= 0 {
+		for _, row := range m.rows {
+			if v, ok := row[i].(string); ok {
+				result.Add(v)
+			}
+		}
+	}
+	return result
+}
+
+// selectMapRows returns all columns of the rows of the map table, where
+// column (k or v) is one of values, queried in batches.
+func selectMapRows(db *sqlx.DB, column string, values []string) (columns []string, result [][]interface{}, err error) {
+	const size = 500 // sqlite variable limit, see mapIn
+	if len(values) == 0 {
+		return nil, nil, nil
+	}
+	for _, batch := range batchedStrings(values, size) {
+		query, args, err := sqlx.In("SELECT * FROM map WHERE "+column+" IN (?)", batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows, err := db.Queryx(db.Rebind(query), args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		if columns, err = rows.Columns(); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		for rows.Next() {
+			row, err := rows.SliceScan()
+			if err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			for i, v := range row {
+				if b, ok := v.([]byte); ok {
+					row[i] = string(b)
+				}
+			}
+			result = append(result, row)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, nil, err
+		}
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return columns, result, nil
+}
+
+// writeMapRows creates an sqlite3 database with the given schema (as
+// returned by mapSchema) and rows; indexes are created after the rows are
+// inserted.
+func writeMapRows(filename string, schema []string, m *mapRows) error {
+	db, err := sqlx.Open("sqlite3", filename)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema[0]); err != nil {
+		return err
+	}
+	if len(m.rows) > 0 {
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.Preparex(fmt.Sprintf("INSERT INTO map (%s) VALUES (%s)",
+			strings.Join(m.columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(m.columns)), ", ")))
+		if err != nil {
+			return err
+		}
+		for _, row := range m.rows {
+			if _, err := stmt.Exec(row...); err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	for _, q := range schema[1:] {
+		if _, err := db.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractFixtures writes small, self-consistent identifier, citation and
+// index databases (sqlite3, named like in testdata) into dir, containing the
+// seed identifiers, all their citing and cited edges, the identifiers of the
+// related DOI and the index documents of all these identifiers. A server
+// over these databases returns the same responses for the seeds as over the
+// full databases. The schema (including edge attributes and indexes) is
+// copied from the source databases.
+func ExtractFixtures(dir string, seeds []string, identifierPath, ociPath string, indexPaths []string) error {
+	if len(seeds) == 0 {
+		return fmt.Errorf("no seed identifiers")
+	}
+	if len(indexPaths) == 0 {
+		return fmt.Errorf("no index data")
+	}
+	for _, name := range []string{FixtureIdentifierFile, FixtureOciFile, FixtureIndexFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return fmt.Errorf("fixture exists: %s", filepath.Join(dir, name))
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	identifierDB, err := OpenDatabase(identifierPath)
+	if err != nil {
+		return err
+	}
+	defer identifierDB.Close()
+	ociDB, err := OpenDatabase(ociPath)
+	if err != nil {
+		return err
+	}
+	defer ociDB.Close()
+	// (1) Seed identifiers to DOI.
+	var identifiers, edges, docs mapRows
+	columns, rows, err := selectMapRows(identifierDB, "k", seeds)
+	if err != nil {
+		return fmt.Errorf("identifiers: %w", err)
+	}
+	identifiers.add(columns, rows, "", nil)
+	dois := set.Sorted(identifiers.values("v"))
+	if len(dois) == 0 {
+		return fmt.Errorf("no DOI found for seed identifiers")
+	}
+	// (2) Outbound and inbound edges of the seeds; edges among seeds are
+	// found twice, but kept once.
+	if columns, rows, err = selectMapRows(ociDB, "k", dois); err != nil {
+		return fmt.Errorf("edges: %w", err)
+	}
+	edges.add(columns, rows, "", nil)
+	if columns, rows, err = selectMapRows(ociDB, "v", dois); err != nil {
+		return fmt.Errorf("edges: %w", err)
+	}
+	edges.add(columns, rows, "k", set.FromSlice(dois))
+	// (3) Identifiers of all related DOI, other than the seeds.
+	related := edges.values("k").Union(edges.values("v")).Difference(set.FromSlice(dois))
+	if columns, rows, err = selectMapRows(identifierDB, "v", set.Sorted(related)); err != nil {
+		return fmt.Errorf("identifiers: %w", err)
+	}
+	identifiers.add(columns, rows, "", nil)
+	// (4) Index documents of all identifiers, the first database wins.
+	var (
+		missing     = identifiers.values("k")
+		indexSchema []string
+	)
+	for _, path := range indexPaths {
+		db, err := OpenDatabase(path)
+		if err != nil {
+			return err
+		}
+		if indexSchema == nil {
+			if indexSchema, err = mapSchema(db); err != nil {
+				db.Close()
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		columns, rows, err := selectMapRows(db, "k", set.Sorted(missing))
+		db.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		docs.add(columns, rows, "", nil)
+		missing = missing.Difference(docs.values("k"))
+	}
+	// (5) Write databases with the schema of the sources.
+	for _, f := range []struct {
+		name string
+		src  *sqlx.DB
+		rows *mapRows
+	}{
+		{FixtureIdentifierFile, identifierDB, &identifiers},
+		{FixtureOciFile, ociDB, &edges},
+		{FixtureIndexFile, nil, &docs},
+	} {
+		schema := indexSchema
+		if f.src != nil {
+			if schema, err = mapSchema(f.src); err != nil {
+				return fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+		if f.rows.columns == nil {
+			f.rows.columns = []string{"k", "v"}
+		}
+		if err := writeMapRows(filepath.Join(dir, f.name), schema, f.rows); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		log.Printf("[ok] fixtures: %d rows in %s", len(f.rows.rows), f.name)
+	}
+	if missing.Len() > 0 {
+		log.Printf("fixtures: %d identifiers without index document", missing.Len())
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package ckit
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+func TestExtractFixtures(t *testing.T) {
+	dir := t.TempDir()
+	seeds := []string{"i0029", "i0066"}
+	err := ExtractFixtures(dir, seeds, "testdata/id_doi.db", "testdata/doi_doi.db",
+		[]string{"testdata/id_metadata.db"})
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	identifierDB, err := OpenDatabase(filepath.Join(dir, FixtureIdentifierFile))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer identifierDB.Close()
+	ociDB, err := OpenDatabase(filepath.Join(dir, FixtureOciFile))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer ociDB.Close()
+	g := &FetchGroup{}
+	if err := g.FromFiles(filepath.Join(dir, FixtureIndexFile)); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	fixtures := &Server{
+		IdentifierDatabase: identifierDB,
+		OciDatabase:        ociDB,
+		IndexData:          g,
+		Router:             mux.NewRouter(),
+		Stats:              newTestStats(),
+	}
+	fixtures.Routes()
+	srv := newTestServer(t)
+	// Responses for the seeds are the same as with the full databases.
+	for _, id := range seeds {
+		for _, target := range []string{"/id/" + id, "/id/" + id + "?i=DE-1"} {
+			got, want := mustRequest(t, fixtures, target), mustRequest(t, srv, target)
+			got.Extra.Took, want.Extra.Took = 0, 0
+			// Unmatched documents come in no particular order.
+			for _, r := range []*Response{got, want} {
+				for _, docs := range [][]json.RawMessage{r.Unmatched.Citing, r.Unmatched.Cited} {
+					sort.Slice(docs, func(i, j int) bool { return string(docs[i]) < string(docs[j]) })
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: got %v, want %v", target, got, want)
+			}
+		}
+	}
+	var n int
+	if err := ociDB.Get(&n, "SELECT COUNT(*) FROM map"); err != nil || n == 0 {
+		t.Fatalf("got %d edges (%v), want some", n, err)
+	}
+	// Existing fixtures are not overwritten.
+	err = ExtractFixtures(dir, seeds, "testdata/id_doi.db", "testdata/doi_doi.db",
+		[]string{"testdata/id_metadata.db"})
+	if err == nil {
+		t.Fatalf("got nil, want error")
+	}
+}
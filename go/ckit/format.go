@@ -0,0 +1,156 @@
+package ckit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Response formats, selected with the "format" query parameter or via
+// content negotiation.
+const (
+	FormatJSON    = "json"
+	FormatXML     = "xml"
+	FormatJSONAPI = "jsonapi"
+)
+
+// responseFormats are the supported values for the "format" query parameter.
+var responseFormats = []string{FormatJSON, FormatXML, FormatJSONAPI}
+
+// negotiateFormat returns the response format for a request: an explicit
+// format parameter wins, otherwise JSON:API or XML are chosen, if the Accept
+// header asks for them (XML only, if JSON is not acceptable as well).
+func negotiateFormat(r *http.Request) (string, error) {
+	if v := r.URL.Query().Get("format"); v != "" {
+		if !SliceContains(responseFormats, v) {
+			return "", fmt.Errorf("invalid format: %s %v", v, responseFormats)
+		}
+		return v, nil
+	}
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "application/vnd.api+json") {
+		return FormatJSONAPI, nil
+	}
+	if (strings.Contains(accept, "application/xml") || strings.Contains(accept, "text/xml")) &&
+		!strings.Contains(accept, "application/json") {
+		return FormatXML, nil
+	}
+	return FormatJSON, nil
+}
+
+// contentType returns the media type for the response format.
+func (o *requestOptions) contentType() string {
+	if o == nil {
+		return "application/json"
+	}
+	switch o.Format {
+	case FormatXML:
+		return "application/xml; charset=utf-8"
+	case FormatJSONAPI:
+		return "application/vnd.api+json"
+	default:
+		return "application/json"
+	}
+}
+
+// encodeResponse writes a response in the requested format and schema
+// version; JSON:API has a schema of its own. The DOI field of unmatched
+// documents is renamed to doiField (JSON:API uses the DOI as resource id).
+func encodeResponse(w io.Writer, resp *Response, opts *requestOptions, doiField string) error {
+	if opts == nil {
+		return json.NewEncoder(w).Encode(resp)
+	}
+	var v interface{} = resp
+	if opts.Version == SchemaV2 {
+		v2 := NewResponseV2(resp, opts.Sort != "")
+		v2.Citing.Unmatched = renameField(v2.Citing.Unmatched, DefaultDOIField, doiField)
+		v2.Cited.Unmatched = renameField(v2.Cited.Unmatched, DefaultDOIField, doiField)
+		v = v2
+	} else if opts.Format != FormatJSONAPI {
+		resp.Unmatched.Citing = renameField(resp.Unmatched.Citing, DefaultDOIField, doiField)
+		resp.Unmatched.Cited = renameField(resp.Unmatched.Cited, DefaultDOIField, doiField)
+	}
+	switch opts.Format {
+	case FormatXML:
+		return WriteXML(w, "response", v)
+	case FormatJSONAPI:
+		return WriteJSONAPI(w, resp)
+	default:
+		return json.NewEncoder(w).Encode(v)
+	}
+}
+
+// WriteXML renders a value as XML, by mapping its JSON representation
+// generically: the value is wrapped in an element named root, object members
+// become <field name="..."> elements (in document order), array elements
+// become <item> elements and scalars are text; null values become empty
+// elements. This way, arbitrary index data documents can be represented.
+//
+//	{"id": "1", "institution": ["DE-14"]}
+//
+//	<response><field name="id">1</field><field name="institution"><item>DE-14</item></field></response>
+func WriteXML(w io.Writer, root string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var (
+		bw  = bufio.NewWriter(w)
+		dec = json.NewDecoder(bytes.NewReader(b))
+	)
+	dec.UseNumber()
+	bw.WriteString(xml.Header)
+	bw.WriteString("<" + root + ">")
+	if err := writeXMLValue(bw, dec); err != nil {
+		return err
+	}
+	bw.WriteString("</" + root + ">\n")
+	return bw.Flush()
+}
+
+// writeXMLValue writes the next value from the decoder.
+func writeXMLValue(w *bufio.Writer, dec *json.Decoder) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := t.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				w.WriteString(`<field name="`)
+				xml.EscapeText(w, []byte(fmt.Sprint(k)))
+				w.WriteString(`">`)
+				if err := writeXMLValue(w, dec); err != nil {
+					return err
+				}
+				w.WriteString("</field>")
+			}
+		case '[':
+			for dec.More() {
+				w.WriteString("<item>")
+				if err := writeXMLValue(w, dec); err != nil {
+					return err
+				}
+				w.WriteString("</item>")
+			}
+		}
+		// Consume the closing delimiter.
+		_, err := dec.Token()
+		return err
+	case nil:
+		return nil
+	default:
+		return xml.EscapeText(w, []byte(fmt.Sprint(v)))
+	}
+}
@@ -0,0 +1,106 @@
+package ckit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestWriteXML(t *testing.T) {
+	var cases = []struct {
+		about string
+		v     interface{}
+		want  string
+	}{
+		{"empty object", map[string]interface{}{}, `<r></r>`},
+		{"scalar", "a<b", `<r>a&lt;b</r>`},
+		{"null", nil, `<r></r>`},
+		{
+			"object with list",
+			struct {
+				ID   string   `json:"id"`
+				Inst []string `json:"institution"`
+				N    int      `json:"n"`
+			}{"1", []string{"DE-14", "DE-15"}, 2},
+			`<r><field name="id">1</field><field name="institution"><item>DE-14</item>` +
+				`<item>DE-15</item></field><field name="n">2</field></r>`,
+		},
+		{
+			"escaped key",
+			map[string]string{`a"&`: "x"},
+			`<r><field name="a&#34;&amp;">x</field></r>`,
+		},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := WriteXML(&buf, "r", c.v); err != nil {
+			t.Fatalf("[%s] got %v, want nil", c.about, err)
+		}
+		got := strings.TrimSpace(strings.TrimPrefix(buf.String(), xml.Header))
+		if got != c.want {
+			t.Fatalf("[%s] got %s, want %s", c.about, got, c.want)
+		}
+	}
+}
+
+func TestServerXML(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv.Cache = c
+	var cases = []struct {
+		target      string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"/id/i0029", "", 200, "application/json"},
+		{"/id/i0029", "application/xml", 200, "application/xml; charset=utf-8"},
+		{"/id/i0029", "text/xml, application/json", 200, "application/json"},
+		{"/id/i0029?format=xml", "", 200, "application/xml; charset=utf-8"},
+		{"/id/i0029?format=json", "application/xml", 200, "application/json"},
+		{"/id/i0029?format=yaml", "", 400, ""},
+	}
+	for _, c := range cases {
+		var (
+			rr  = httptest.NewRecorder()
+			req = httptest.NewRequest("GET", c.target, nil)
+		)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		srv.ServeHTTP(rr, req)
+		if rr.Code != c.status {
+			t.Fatalf("%s [%s]: got %d, want %d", c.target, c.accept, rr.Code, c.status)
+		}
+		if c.status != 200 {
+			continue
+		}
+		if got := rr.Header().Get("Content-Type"); got != c.contentType {
+			t.Fatalf("%s [%s]: got %s, want %s", c.target, c.accept, got, c.contentType)
+		}
+		if !strings.HasPrefix(c.contentType, "application/xml") {
+			continue
+		}
+		var v struct {
+			XMLName xml.Name `xml:"response"`
+			Fields  []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"field"`
+		}
+		if err := xml.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+			t.Fatalf("%s: invalid XML: %v", c.target, err)
+		}
+		if len(v.Fields) == 0 || v.Fields[0].Name != "id" {
+			t.Fatalf("%s: got %v, want id field first", c.target, v.Fields)
+		}
+	}
+}
@@ -1,27 +1,29 @@
 module github.com/slub/labe/go/ckit
 
-go 1.17
+go 1.22
 
 require (
 	github.com/andrew-d/go-termutil v0.0.0-20150726205930-009166a695a2
 	github.com/araddon/dateparse v0.0.0-20210429162001-6b43995a97de
-	github.com/google/go-cmp v0.5.7
-	github.com/gorilla/handlers v1.5.1
+	github.com/google/go-cmp v0.6.0
 	github.com/gorilla/mux v1.8.0
 	github.com/icholy/replace v0.5.0
 	github.com/jmoiron/sqlx v1.3.4
-	github.com/klauspost/compress v1.14.3
+	github.com/klauspost/compress v1.18.0
+	github.com/lib/pq v1.9.0
 	github.com/matryer/is v1.4.0
 	github.com/mattn/go-sqlite3 v1.14.11
 	github.com/miku/parallel v0.0.0-20210205192328-1a799ab70294
 	github.com/segmentio/encoding v0.3.4
 	github.com/thoas/stats v0.0.0-20190407194641-965cb2de1678
-	golang.org/x/text v0.3.7
+	golang.org/x/text v0.14.0
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.34.2
 )
 
 require (
-	github.com/felixge/httpsnoop v1.0.2 // indirect
 	github.com/segmentio/asm v1.1.3 // indirect
-	golang.org/x/net v0.0.0-20220121210141-e204ce36a2ba // indirect
-	golang.org/x/sys v0.0.0-20220209214540-3681064d5158 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
 )
@@ -0,0 +1,246 @@
+package ckit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+// holdingsSchema is the schema of the auxiliary holdings table; id is an ISSN
+// (normalized to 1234-567X) or a local identifier, first and last restrict
+// the coverage to a range of publication years, zero means open.
+const holdingsSchema = `
+CREATE TABLE IF NOT EXISTS holdings (
+	isil TEXT NOT NULL,
+	id TEXT NOT NULL,
+	first INTEGER NOT NULL DEFAULT 0,
+	last INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS holdings_isil_id ON holdings (isil, id);`
+
+var issnPattern = regexp.MustCompile(`^[0-9]{4}-?[0-9]{3}[0-9xX]$`)
+
+// Holding is a title (or document) held by an institution, with an optional
+// coverage in publication years.
+type Holding struct {
+	ID    string `db:"id"`
+	First int    `db:"first"`
+	Last  int    `db:"last"`
+}
+
+// covers returns true, if a publication year is within the coverage; an
+// unknown year (zero) is always covered.
+func (h Holding) covers(year int) bool {
+	if year == 0 {
+		return true
+	}
+	return (h.First == 0 || year >= h.First) && (h.Last == 0 || year <= h.Last)
+}
+
+// normalizeHoldingID returns ISSN in the form 1234-567X and other identifiers
+// unchanged, without surrounding whitespace.
+func normalizeHoldingID(s string) string {
+	s = strings.TrimSpace(s)
+	if !issnPattern.MatchString(s) {
+		return s
+	}
+	s = strings.ToUpper(strings.Replace(s, "-", "", 1))
+	return s[:4] + "-" + s[4:]
+}
+
+// ReadHoldings reads holdings from a KBART file (tab separated, with a header
+// row containing print_identifier and online_identifier; date_first_issue_online
+// and date_last_issue_online are used for coverage) or from a simple list,
+// with one ISSN or local identifier per line; empty lines and lines starting
+// with "#" are skipped.
+func ReadHoldings(r io.Reader) (result []Holding, err error) {
+	var (
+		br     = bufio.NewReader(r)
+		header map[string]int
+		lineno int
+	)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		lineno++
+		line = strings.TrimRight(line, "\r\n")
+		if lineno == 1 && strings.Contains(line, "print_identifier") {
+			header = make(map[string]int)
+			for i, name := range strings.Split(line, "\t") {
+				header[strings.TrimSpace(name)] = i
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if header == nil {
+			result = append(result, Holding{ID: normalizeHoldingID(line)})
+			continue
+		}
+		var (
+			fields = strings.Split(line, "\t")
+			field  = func(name string) string {
+				if i, ok := header[name]; ok && i < len(fields) {
+					return strings.TrimSpace(fields[i])
+				}
+				return ""
+			}
+			first, last int
+		)
+		if first, err = kbartYear(field("date_first_issue_online")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		if last, err = kbartYear(field("date_last_issue_online")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		for _, name := range []string{"print_identifier", "online_identifier"} {
+			if v := field(name); v != "" {
+				result = append(result, Holding{ID: normalizeHoldingID(v), First: first, Last: last})
+			}
+		}
+	}
+	return result, nil
+}
+
+// kbartYear returns the year of a KBART date (YYYY, YYYY-MM or YYYY-MM-DD),
+// or zero for an empty value.
+func kbartYear(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if len(s) < 4 {
+		return 0, fmt.Errorf("invalid date: %s", s)
+	}
+	year, err := strconv.Atoi(s[:4])
+	if err != nil {
+		return 0, fmt.Errorf("invalid date: %s", s)
+	}
+	return year, nil
+}
+
+// BuildHoldingsDatabase writes holdings of an institution, identified by its
+// ISIL, into a "holdings" table in an sqlite3 database at output, replacing
+// any previous holdings of that institution. Holdings of several
+// institutions can live in the same database.
+func BuildHoldingsDatabase(output, isil string, holdings []Holding) error {
+	if isil == "" {
+		return fmt.Errorf("isil required")
+	}
+	db, err := sqlx.Open("sqlite3", output)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	t := time.Now()
+	if _, err := db.Exec(holdingsSchema); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM holdings WHERE isil = ?", isil); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO holdings (isil, id, first, last) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, h := range holdings {
+		if _, err := stmt.Exec(isil, h.ID, h.First, h.Last); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("[ok] holdings: wrote %d entries for %s (%s)", len(holdings), isil, time.Since(t))
+	return nil
+}
+
+// holdingSet contains the holdings of an institution relevant for a response,
+// keyed by identifier; a nil holdingSet contains nothing.
+type holdingSet map[string][]Holding
+
+// contains returns true, if a document is held, by local identifier or by
+// ISSN, within the coverage.
+func (hs holdingSet) contains(b json.RawMessage) bool {
+	if len(hs) == 0 {
+		return false
+	}
+	var v docSnippet
+	if err := json.Unmarshal(b, &v); err != nil {
+		return false
+	}
+	year := v.year()
+	for _, id := range append([]string{v.ID}, v.ISSN...) {
+		for _, h := range hs[normalizeHoldingID(id)] {
+			if h.covers(year) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// holdings returns the holdings of an institution matching any of the
+// documents (by local identifier or ISSN), or nil, if there is no holdings
+// database.
+func (s *Server) holdings(ctx context.Context, isil string, docs ...[]json.RawMessage) (holdingSet, error) {
+	db := s.data(ctx).HoldingsDatabase
+	if db == nil {
+		return nil, nil
+	}
+	var ids []string
+	for _, d := range docs {
+		for _, b := range d {
+			var v docSnippet
+			if err := json.Unmarshal(b, &v); err != nil {
+				continue
+			}
+			if v.ID != "" {
+				ids = append(ids, v.ID)
+			}
+			for _, issn := range v.ISSN {
+				ids = append(ids, normalizeHoldingID(issn))
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	hs := make(holdingSet)
+	for _, batch := range batchedStrings(ids, 500) {
+		query, args, err := sqlx.In("SELECT id, first, last FROM holdings WHERE isil = ? AND id IN (?)", isil, batch)
+		if err != nil {
+			return nil, err
+		}
+		var result []Holding
+		if err := db.SelectContext(ctx, &result, db.Rebind(query), args...); err != nil {
+			return nil, err
+		}
+		for _, h := range result {
+			hs[h.ID] = append(hs[h.ID], h)
+		}
+	}
+	return hs, nil
+}
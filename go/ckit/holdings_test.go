@@ -0,0 +1,101 @@
+package ckit
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestReadHoldings(t *testing.T) {
+	var cases = []struct {
+		about  string
+		input  string
+		result []Holding
+		err    bool
+	}{
+		{"empty", "", nil, false},
+		{"list", "# comment\n12345678\n\n0-1234\n1234-567x\n", []Holding{
+			{ID: "1234-5678"}, {ID: "0-1234"}, {ID: "1234-567X"},
+		}, false},
+		{"kbart", "publication_title\tprint_identifier\tonline_identifier\tdate_first_issue_online\tdate_last_issue_online\n" +
+			"A\t1234-5678\t\t2001-01-01\t\n" +
+			"B\t\t8765-4321\t1990\t2000-12\n", []Holding{
+			{ID: "1234-5678", First: 2001}, {ID: "8765-4321", First: 1990, Last: 2000},
+		}, false},
+		{"kbart, invalid date", "print_identifier\tdate_first_issue_online\n1234-5678\tX\n", nil, true},
+	}
+	for _, c := range cases {
+		result, err := ReadHoldings(strings.NewReader(c.input))
+		if (err != nil) != c.err {
+			t.Fatalf("[%s] got %v, want err %v", c.about, err, c.err)
+		}
+		if !reflect.DeepEqual(result, c.result) {
+			t.Fatalf("[%s] got %v, want %v", c.about, result, c.result)
+		}
+	}
+}
+
+func TestHoldingsFilter(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "holdings.db")
+	holdings := []Holding{{ID: "0-1"}, {ID: "1234-5678", First: 2000, Last: 2010}}
+	if err := BuildHoldingsDatabase(output, "DE-X", holdings); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	db, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	srv := newTestServer(t)
+	srv.HoldingsDatabase = db
+	resp := &Response{
+		Citing: []json.RawMessage{
+			json.RawMessage(`{"id": "0-1"}`),
+			json.RawMessage(`{"id": "0-2", "issn": "12345678", "publishDate": "2005"}`),
+			json.RawMessage(`{"id": "0-3", "issn": ["1234-5678"], "publishDate": "2015"}`),
+			json.RawMessage(`{"id": "0-4", "institution": ["DE-X"]}`),
+			json.RawMessage(`{"id": "0-5"}`),
+		},
+	}
+	hs, err := srv.holdings(context.Background(), "DE-X", resp.Citing, resp.Cited)
+	if err != nil {
+		t.Fatalf("holdings: %v", err)
+	}
+	resp.applyInstitutionFilter("DE-X", hs)
+	var ids []string
+	for _, b := range resp.Citing {
+		var v docSnippet
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		ids = append(ids, v.ID)
+	}
+	if want := []string{"0-1", "0-2", "0-4"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	if len(resp.Unmatched.Citing) != 2 {
+		t.Fatalf("got %d unmatched, want 2", len(resp.Unmatched.Citing))
+	}
+	// Other institutions are not affected.
+	if hs, err = srv.holdings(context.Background(), "DE-Y", resp.Unmatched.Citing); err != nil || len(hs) != 0 {
+		t.Fatalf("got %v, %v, want no holdings", hs, err)
+	}
+	// Rebuilding replaces the holdings of an institution.
+	if err := BuildHoldingsDatabase(output, "DE-X", nil); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	db, err = OpenDatabase(output) // opened as immutable
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var count int
+	if err := db.Get(&count, "SELECT count(*) FROM holdings"); err != nil || count != 0 {
+		t.Fatalf("got %d, %v, want no rows", count, err)
+	}
+	mustRequest(t, srv, "/id/i0029?i=DE-X")
+}
@@ -0,0 +1,88 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// IDMapping pairs the local identifier of a matched document with its DOI.
+// The DOI is empty, if it is neither in the identifier database nor in the
+// index data.
+type IDMapping struct {
+	ID  string `json:"id"`
+	DOI string `json:"doi"`
+}
+
+// IDMap lists local identifier and DOI of each citing and cited document, in
+// the order of the documents in the response, so clients do not need to
+// know the index data schema to get stable identifiers.
+type IDMap struct {
+	Citing []IDMapping `json:"citing"`
+	Cited  []IDMapping `json:"cited"`
+}
+
+// addIDMap sets the id map of a response (requested with map=1); it needs
+// to run after post-processing, which may filter or reorder documents, and
+// before the field filter, which may remove the "id" field.
+func (s *Server) addIDMap(ctx context.Context, resp *Response) error {
+	var (
+		citing = documentSnippets(resp.Citing)
+		cited  = documentSnippets(resp.Cited)
+		ids    []string
+		seen   = make(map[string]bool)
+	)
+	for _, v := range append(append([]docSnippet{}, citing...), cited...) {
+		if v.ID != "" && !seen[v.ID] {
+			seen[v.ID] = true
+			ids = append(ids, v.ID)
+		}
+	}
+	// A local identifier may be mapped to more than one DOI; we take the
+	// smallest, so the mapping does not change between requests.
+	doi := make(map[string]string, len(ids))
+	if len(ids) > 0 {
+		ms, err := s.mapIn(ctx, "k", ids)
+		if err != nil {
+			return fmt.Errorf("id map: %w", err)
+		}
+		sortMaps(ms)
+		for _, m := range ms {
+			if _, ok := doi[m.Key]; !ok {
+				doi[m.Key] = m.Value
+			}
+		}
+	}
+	mappings := func(snippets []docSnippet) []IDMapping {
+		result := make([]IDMapping, len(snippets))
+		for i, v := range snippets {
+			result[i] = IDMapping{ID: v.ID, DOI: doi[v.ID]}
+			if result[i].DOI == "" {
+				result[i].DOI = v.DOI.first()
+			}
+		}
+		return result
+	}
+	resp.Map = &IDMap{Citing: mappings(citing), Cited: mappings(cited)}
+	return nil
+}
+
+// documentSnippets parses documents; invalid documents yield an empty
+// snippet, so the result is parallel to docs.
+func documentSnippets(docs []json.RawMessage) []docSnippet {
+	result := make([]docSnippet, len(docs))
+	for i, doc := range docs {
+		_ = json.Unmarshal(doc, &result[i])
+	}
+	return result
+}
+
+// sortedMappings returns a copy of ms sorted by local identifier, matching
+// the order of the matched documents in the version 2 schema.
+func sortedMappings(ms []IDMapping) []IDMapping {
+	result := append([]IDMapping{}, ms...)
+	sort.SliceStable(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
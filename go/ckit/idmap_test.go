@@ -0,0 +1,46 @@
+package ckit
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestAddIDMap(t *testing.T) {
+	srv := newTestServer(t)
+	resp := &Response{
+		Citing: []json.RawMessage{
+			json.RawMessage(`{"id": "i0002"}`),
+			json.RawMessage(`{"id": "i0001"}`),
+			json.RawMessage(`{"id": "x-1", "doi_str_mv": ["10.1/x"]}`),
+		},
+		Cited: []json.RawMessage{
+			json.RawMessage(`{"id": "i0001"}`),
+			json.RawMessage(`{"title": "no id"}`),
+		},
+	}
+	if err := srv.addIDMap(context.Background(), resp); err != nil {
+		t.Fatalf("id map: %v", err)
+	}
+	want := &IDMap{
+		Citing: []IDMapping{{"i0002", "d0002"}, {"i0001", "d0001"}, {"x-1", "10.1/x"}},
+		Cited:  []IDMapping{{"i0001", "d0001"}, {"", ""}},
+	}
+	if !reflect.DeepEqual(resp.Map, want) {
+		t.Fatalf("got %+v, want %+v", resp.Map, want)
+	}
+	v2 := NewResponseV2(resp, false)
+	if want := []IDMapping{{"i0001", "d0001"}, {"i0002", "d0002"}, {"x-1", "10.1/x"}}; !reflect.DeepEqual(v2.Citing.Map, want) {
+		t.Fatalf("got %v, want %v", v2.Citing.Map, want)
+	}
+	// The map is only included on request.
+	if resp := mustRequest(t, srv, "/id/i0029"); resp.Map != nil {
+		t.Fatalf("got %v, want no map", resp.Map)
+	}
+	resp = mustRequest(t, srv, "/id/i0029?map=1")
+	if resp.Map == nil || len(resp.Map.Citing) != len(resp.Citing) || len(resp.Map.Cited) != len(resp.Cited) {
+		t.Fatalf("got %+v, want map parallel to documents", resp.Map)
+	}
+}
@@ -0,0 +1,222 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// SchedulerConfig configures scheduled jobs, e.g.
+//
+//	{"jobs": [{"name": "oci", "schedule": "0 3 * * 0", "steps": [
+//	    {"action": "fetch-oci", "out": "/data/o.db.new", "if_newer_than": "/data/o.db"},
+//	    {"action": "verify", "path": "/data/o.db.new"},
+//	    {"action": "swap", "from": "/data/o.db.new", "to": "/data/o.db", "keep": true},
+//	    {"action": "reload", "flush": true}]}]}
+type SchedulerConfig struct {
+	Jobs []JobConfig `json:"jobs"`
+}
+
+// JobConfig configures a job; the timeout is a duration like "12h".
+type JobConfig struct {
+	Name     string       `json:"name"`
+	Schedule string       `json:"schedule"`
+	Timeout  string       `json:"timeout,omitempty"`
+	Steps    []StepConfig `json:"steps"`
+}
+
+// StepConfig configures a step, by action:
+//
+//   - fetch-oci builds a citation database from the latest COCI release (out,
+//     attrs, article); with if_newer_than, the job ends, unless the release
+//     is newer than the one recorded in that database
+//   - exec runs a command, e.g. a shell script building other datasets
+//   - verify checks a database for the map table and indexes (path, indexes)
+//   - swap moves a file into place (from, to); with keep, the replaced file
+//     is kept with an .old suffix
+//   - reload reopens all datasets of the server, optionally flushing the
+//     cache (flush)
+type StepConfig struct {
+	Action      string   `json:"action"`
+	Out         string   `json:"out,omitempty"`
+	Attrs       bool     `json:"attrs,omitempty"`
+	Article     int64    `json:"article,omitempty"`
+	IfNewerThan string   `json:"if_newer_than,omitempty"`
+	Command     []string `json:"command,omitempty"`
+	Path        string   `json:"path,omitempty"`
+	Indexes     []string `json:"indexes,omitempty"`
+	From        string   `json:"from,omitempty"`
+	To          string   `json:"to,omitempty"`
+	Keep        bool     `json:"keep,omitempty"`
+	Flush       bool     `json:"flush,omitempty"`
+}
+
+// LoadScheduler reads a scheduler configuration from a JSON file; reload
+// steps act on the given server.
+func LoadScheduler(filename string, srv *Server) (*Scheduler, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config SchedulerConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("scheduler: %w", err)
+	}
+	var jobs []*Job
+	for _, jc := range config.Jobs {
+		job := &Job{Name: jc.Name}
+		if job.Schedule, err = ParseSchedule(jc.Schedule); err != nil {
+			return nil, fmt.Errorf("job %s: %w", jc.Name, err)
+		}
+		if jc.Timeout != "" {
+			if job.Timeout, err = time.ParseDuration(jc.Timeout); err != nil {
+				return nil, fmt.Errorf("job %s: timeout: %w", jc.Name, err)
+			}
+		}
+		for i, sc := range jc.Steps {
+			step, err := sc.step(srv)
+			if err != nil {
+				return nil, fmt.Errorf("job %s: step %d: %w", jc.Name, i+1, err)
+			}
+			job.Steps = append(job.Steps, step)
+		}
+		jobs = append(jobs, job)
+	}
+	return NewScheduler(jobs...)
+}
+
+// step returns the step for a configuration.
+func (c StepConfig) step(srv *Server) (Step, error) {
+	step := Step{Name: c.Action}
+	switch c.Action {
+	case "fetch-oci":
+		if c.Out == "" {
+			return step, fmt.Errorf("fetch-oci: out required")
+		}
+		step.Run = c.fetchOCI
+	case "exec":
+		if len(c.Command) == 0 {
+			return step, fmt.Errorf("exec: command required")
+		}
+		step.Name = "exec " + c.Command[0]
+		step.Run = c.exec
+	case "verify":
+		if c.Path == "" {
+			return step, fmt.Errorf("verify: path required")
+		}
+		step.Run = c.verify
+	case "swap":
+		if c.From == "" || c.To == "" {
+			return step, fmt.Errorf("swap: from and to required")
+		}
+		step.Run = c.swap
+	case "reload":
+		if srv == nil || srv.Reload == nil {
+			return step, fmt.Errorf("reload: server cannot reload datasets")
+		}
+		step.Run = func(ctx context.Context) error {
+			report, err := srv.ReloadDatasets(c.Flush)
+			if err != nil {
+				return err
+			}
+			log.Printf("reload: changed %v, flushed %v", report.Changed, report.Flushed)
+			return nil
+		}
+	default:
+		return step, fmt.Errorf("unknown action: %q", c.Action)
+	}
+	return step, nil
+}
+
+// fetchOCI builds a citation database from the latest COCI release.
+func (c StepConfig) fetchOCI(ctx context.Context) error {
+	article := c.Article
+	if article == 0 {
+		article = DefaultCociArticle
+	}
+	a, err := FetchFigshareArticle(ctx, nil, "", article)
+	if err != nil {
+		return err
+	}
+	if c.IfNewerThan != "" {
+		if installed := readSnapshotFile(c.IfNewerThan); installed != nil && !SnapshotOf(a).NewerThan(installed) {
+			return fmt.Errorf("%w: version %d installed", ErrSkipJob, installed.Version)
+		}
+	}
+	// The output is a staging file, which may be left from a failed run.
+	if err := os.Remove(c.Out); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w, err := NewCociWriter(c.Out, c.Attrs)
+	if err != nil {
+		return err
+	}
+	if err := ImportCociRelease(ctx, &http.Client{}, a, w); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		w.Abort()
+		return err
+	}
+	log.Printf("fetch-oci: %d edges (%d skipped) written to %s", w.Rows, w.Skipped, c.Out)
+	return nil
+}
+
+// readSnapshotFile returns the release recorded in a database, if any.
+func readSnapshotFile(filename string) *Snapshot {
+	db, err := OpenDatabase(filename)
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+	s, err := ReadSnapshot(db)
+	if err != nil {
+		log.Printf("snapshot: %s: %v", filename, err)
+	}
+	return s
+}
+
+// exec runs a command, with its output going to the log.
+func (c StepConfig) exec(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	cmd.Stdout = log.Writer()
+	cmd.Stderr = log.Writer()
+	return cmd.Run()
+}
+
+// verify checks a database, before it is moved into place.
+func (c StepConfig) verify(ctx context.Context) error {
+	indexes := c.Indexes
+	if len(indexes) == 0 {
+		indexes = []string{"idx_k", "idx_v"}
+	}
+	db, err := OpenDatabase(c.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+	return ValidateMapDatabase(db, indexes, false)
+}
+
+// swap moves a file into place, optionally keeping the replaced file.
+func (c StepConfig) swap(ctx context.Context) error {
+	if _, err := os.Stat(c.From); err != nil {
+		return err
+	}
+	if c.Keep {
+		if err := os.Rename(c.To, c.To+".old"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(c.From, c.To)
+}
@@ -0,0 +1,138 @@
+package ckit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSON:API resource types used in responses.
+const (
+	jsonapiDocumentType = "documents" // documents in the index
+	jsonapiDOIType      = "dois"      // unmatched DOI
+)
+
+// jsonapiDocument is a JSON:API top-level document, see
+// https://jsonapi.org/format/.
+type jsonapiDocument struct {
+	JSONAPI  map[string]string `json:"jsonapi"`
+	Data     jsonapiResource   `json:"data"`
+	Included []jsonapiResource `json:"included"`
+	Meta     interface{}       `json:"meta,omitempty"`
+}
+
+// jsonapiResource is a resource object; documents without an identifier
+// use a local identifier (lid) instead.
+type jsonapiResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id,omitempty"`
+	LID           string                         `json:"lid,omitempty"`
+	Attributes    map[string]json.RawMessage     `json:"attributes,omitempty"`
+	Relationships map[string]jsonapiRelationship `json:"relationships,omitempty"`
+}
+
+// jsonapiIdentifier is a resource identifier object.
+type jsonapiIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	LID  string `json:"lid,omitempty"`
+}
+
+// jsonapiRelationship is a to-many relationship with resource linkage.
+type jsonapiRelationship struct {
+	Data []jsonapiIdentifier `json:"data"`
+}
+
+// identifier returns the resource identifier object for a resource.
+func (r jsonapiResource) identifier() jsonapiIdentifier {
+	return jsonapiIdentifier{Type: r.Type, ID: r.ID, LID: r.LID}
+}
+
+// newJSONAPIResource turns a document into a resource object. The "id" field
+// becomes the resource id, all other fields are attributes; unmatched
+// documents carry a DOI, which is used as id, and resolved metadata, if any.
+// The lid is used for documents without an identifier.
+func newJSONAPIResource(doc json.RawMessage, typ, lid string) (jsonapiResource, error) {
+	var (
+		r      = jsonapiResource{Type: typ}
+		fields map[string]json.RawMessage
+	)
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return r, err
+	}
+	switch typ {
+	case jsonapiDOIType:
+		if err := json.Unmarshal(fields["doi_str_mv"], &r.ID); err != nil {
+			return r, fmt.Errorf("unmatched document without doi: %w", err)
+		}
+		delete(fields, "doi_str_mv")
+	default:
+		if v, ok := fields["id"]; ok {
+			if err := json.Unmarshal(v, &r.ID); err != nil {
+				return r, fmt.Errorf("invalid id: %w", err)
+			}
+			delete(fields, "id")
+		}
+	}
+	if r.ID == "" {
+		r.LID = lid
+	}
+	if len(fields) > 0 {
+		r.Attributes = fields
+	}
+	return r, nil
+}
+
+// WriteJSONAPI renders a response as a JSON:API document: the primary data is
+// the requested document, with relationships to citing and cited documents
+// (and unmatched DOI), which are contained in "included" (once, even if a
+// document both cites and is cited by the requested document); the extra
+// information about the response becomes "meta".
+func WriteJSONAPI(w io.Writer, resp *Response) error {
+	var (
+		doc = jsonapiDocument{
+			JSONAPI: map[string]string{"version": "1.1"},
+			Data: jsonapiResource{
+				Type:          jsonapiDocumentType,
+				ID:            resp.ID,
+				Relationships: make(map[string]jsonapiRelationship),
+			},
+			Included: []jsonapiResource{},
+			Meta:     resp.Extra,
+		}
+		seen = make(map[jsonapiIdentifier]bool)
+	)
+	if resp.DOI != "" {
+		b, err := json.Marshal(resp.DOI)
+		if err != nil {
+			return err
+		}
+		doc.Data.Attributes = map[string]json.RawMessage{"doi": b}
+	}
+	for _, rel := range []struct {
+		name string
+		typ  string
+		docs []json.RawMessage
+	}{
+		{"citing", jsonapiDocumentType, resp.Citing},
+		{"cited", jsonapiDocumentType, resp.Cited},
+		{"unmatched_citing", jsonapiDOIType, resp.Unmatched.Citing},
+		{"unmatched_cited", jsonapiDOIType, resp.Unmatched.Cited},
+	} {
+		linkage := jsonapiRelationship{Data: []jsonapiIdentifier{}}
+		for i, v := range rel.docs {
+			r, err := newJSONAPIResource(v, rel.typ, fmt.Sprintf("%s-%d", rel.name, i))
+			if err != nil {
+				return fmt.Errorf("%s: %w", rel.name, err)
+			}
+			id := r.identifier()
+			linkage.Data = append(linkage.Data, id)
+			if !seen[id] {
+				seen[id] = true
+				doc.Included = append(doc.Included, r)
+			}
+		}
+		doc.Data.Relationships[rel.name] = linkage
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
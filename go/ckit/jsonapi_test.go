@@ -0,0 +1,90 @@
+package ckit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJSONAPI(t *testing.T) {
+	var resp Response
+	resp.ID, resp.DOI = "1", "10.1/1"
+	resp.Citing = []json.RawMessage{
+		json.RawMessage(`{"id": "2", "title": "A"}`),
+		json.RawMessage(`{"title": "B"}`),
+	}
+	resp.Cited = []json.RawMessage{json.RawMessage(`{"id": "2", "title": "A"}`)}
+	resp.Unmatched.Cited = []json.RawMessage{json.RawMessage(`{"doi_str_mv": "10.1/3"}`)}
+	resp.Extra.CitingCount = 2
+	var buf bytes.Buffer
+	if err := WriteJSONAPI(&buf, &resp); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	var doc jsonapiDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.Data.Type != "documents" || doc.Data.ID != "1" || string(doc.Data.Attributes["doi"]) != `"10.1/1"` {
+		t.Fatalf("unexpected primary data: %+v", doc.Data)
+	}
+	var cases = []struct {
+		rel  string
+		want []jsonapiIdentifier
+	}{
+		{"citing", []jsonapiIdentifier{{Type: "documents", ID: "2"}, {Type: "documents", LID: "citing-1"}}},
+		{"cited", []jsonapiIdentifier{{Type: "documents", ID: "2"}}},
+		{"unmatched_citing", []jsonapiIdentifier{}},
+		{"unmatched_cited", []jsonapiIdentifier{{Type: "dois", ID: "10.1/3"}}},
+	}
+	for _, c := range cases {
+		got := doc.Data.Relationships[c.rel].Data
+		if len(got) != len(c.want) {
+			t.Fatalf("[%s] got %v, want %v", c.rel, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("[%s] got %v, want %v", c.rel, got, c.want)
+			}
+		}
+	}
+	// Document "2" is both citing and cited, but included only once.
+	if len(doc.Included) != 3 {
+		t.Fatalf("got %d included resources, want 3", len(doc.Included))
+	}
+	if _, ok := doc.Included[0].Attributes["id"]; ok {
+		t.Fatalf("id must not be an attribute")
+	}
+	if doc.Meta == nil {
+		t.Fatalf("missing meta")
+	}
+}
+
+func TestServerJSONAPI(t *testing.T) {
+	srv := newTestServer(t)
+	for _, accept := range []string{"", "application/vnd.api+json"} {
+		var (
+			rr     = httptest.NewRecorder()
+			target = "/id/i0029?format=jsonapi"
+		)
+		if accept != "" {
+			target = "/id/i0029"
+		}
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", accept)
+		srv.ServeHTTP(rr, req)
+		if rr.Code != 200 {
+			t.Fatalf("got %d, want 200: %s", rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/vnd.api+json" {
+			t.Fatalf("got %s, want application/vnd.api+json", got)
+		}
+		var doc jsonapiDocument
+		if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if doc.Data.ID != "i0029" || len(doc.Data.Relationships["citing"].Data) == 0 {
+			t.Fatalf("unexpected data: %+v", doc.Data)
+		}
+	}
+}
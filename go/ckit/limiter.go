@@ -0,0 +1,124 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimiter caps the number of concurrently executing fusion
+// requests. Up to MaxConcurrent requests run at the same time, up to MaxQueue
+// further requests wait for a slot, for at most QueueTimeout (zero means as
+// long as the client waits); all other requests are rejected right away, so
+// latency degrades predictably under load. A zero MaxConcurrent disables the
+// limiter. Thread-safe.
+type ConcurrencyLimiter struct {
+	MaxConcurrent int
+	MaxQueue      int
+	QueueTimeout  time.Duration
+
+	once     sync.Once
+	slots    chan struct{}
+	mu       sync.Mutex
+	queued   int
+	rejected int64
+	timedOut int64
+}
+
+// LimiterStats is a snapshot of the limiter state, for metrics.
+type LimiterStats struct {
+	MaxConcurrent int   `json:"max_concurrent"`
+	MaxQueue      int   `json:"max_queue"`
+	InFlight      int   `json:"in_flight"`
+	Queued        int   `json:"queued"`
+	Rejected      int64 `json:"rejected"`
+	TimedOut      int64 `json:"timed_out"`
+}
+
+// OverloadError is returned with status 503, if a request could not get a
+// slot, because the queue was full or the wait exceeded the queue timeout.
+type OverloadError struct {
+	MaxConcurrent int  `json:"max_concurrent"`
+	MaxQueue      int  `json:"max_queue"`
+	TimedOut      bool `json:"timed_out,omitempty"`
+}
+
+// Error returns the error message.
+func (e *OverloadError) Error() string {
+	if e.TimedOut {
+		return fmt.Sprintf("server busy: timed out waiting for one of %d slots", e.MaxConcurrent)
+	}
+	return fmt.Sprintf("server busy: %d requests running, %d queued", e.MaxConcurrent, e.MaxQueue)
+}
+
+// Acquire waits for a slot and returns a function to release it. It fails
+// with an OverloadError, if the queue is full or the queue timeout passed,
+// or with the context error, if the context is done first.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil || l.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	l.init()
+	release = func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	l.mu.Lock()
+	if l.queued >= l.MaxQueue {
+		l.rejected++
+		l.mu.Unlock()
+		return nil, &OverloadError{MaxConcurrent: l.MaxConcurrent, MaxQueue: l.MaxQueue}
+	}
+	l.queued++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+	}()
+	var timeout <-chan time.Time
+	if l.QueueTimeout > 0 {
+		t := time.NewTimer(l.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		l.mu.Lock()
+		l.timedOut++
+		l.mu.Unlock()
+		return nil, &OverloadError{MaxConcurrent: l.MaxConcurrent, MaxQueue: l.MaxQueue, TimedOut: true}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// init creates the slots, once.
+func (l *ConcurrencyLimiter) init() {
+	l.once.Do(func() {
+		l.slots = make(chan struct{}, l.MaxConcurrent)
+	})
+}
+
+// Stats returns the current state of the limiter.
+func (l *ConcurrencyLimiter) Stats() LimiterStats {
+	if l == nil || l.MaxConcurrent <= 0 {
+		return LimiterStats{}
+	}
+	l.init()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStats{
+		MaxConcurrent: l.MaxConcurrent,
+		MaxQueue:      l.MaxQueue,
+		InFlight:      len(l.slots),
+		Queued:        l.queued,
+		Rejected:      l.rejected,
+		TimedOut:      l.timedOut,
+	}
+}
@@ -0,0 +1,78 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := &ConcurrencyLimiter{MaxConcurrent: 1, MaxQueue: 1}
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	queued := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	for l.Stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	var oe *OverloadError
+	if _, err := l.Acquire(context.Background()); !errors.As(err, &oe) || oe.TimedOut {
+		t.Fatalf("got %v, want overload error", err)
+	}
+	release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queued request: %v", err)
+	}
+	st := l.Stats()
+	if st.InFlight != 0 || st.Queued != 0 || st.Rejected != 1 {
+		t.Fatalf("got %+v", st)
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	l := &ConcurrencyLimiter{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 10 * time.Millisecond}
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+	var oe *OverloadError
+	if _, err := l.Acquire(context.Background()); !errors.As(err, &oe) || !oe.TimedOut {
+		t.Fatalf("got %v, want timeout", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context canceled", err)
+	}
+	if st := l.Stats(); st.TimedOut != 1 || st.InFlight != 1 {
+		t.Fatalf("got %+v", st)
+	}
+}
+
+func TestServerLimiter(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Limiter = &ConcurrencyLimiter{MaxConcurrent: 1}
+	mustRequest(t, srv, "/id/i0029")
+	release, err := srv.Limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+	if rr.Code != 503 || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("got %d, %v, want 503 with Retry-After", rr.Code, rr.Header())
+	}
+	release()
+	mustRequest(t, srv, "/id/i0029")
+}
@@ -0,0 +1,96 @@
+package ckit
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MissingKeyPrefix is the prefix of synthetic identifiers, which are not in
+// the identifier database, for requests expected to fail with 404.
+const MissingKeyPrefix = "labe-loadgen-missing-"
+
+// LoadProfile describes a synthetic request sequence over a sample of
+// identifiers: a few identifiers are requested much more often than others
+// (following a Zipf distribution, as for highly cited documents) and a
+// fraction of requests is for unknown identifiers. With the same seed and
+// sample, the same sequence is generated.
+type LoadProfile struct {
+	// Skew is the Zipf exponent, must be greater than 1 (e.g. 1.1); larger
+	// values concentrate requests on fewer identifiers, zero means uniform.
+	Skew float64
+	// Missing is the fraction of requests for unknown identifiers (0-1).
+	Missing float64
+	// Seed for the random number generator.
+	Seed int64
+}
+
+// Generate returns a sequence of n identifiers drawn from ids.
+func (p LoadProfile) Generate(ids []string, n int) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no identifiers to sample from")
+	}
+	if p.Skew != 0 && p.Skew <= 1 {
+		return nil, fmt.Errorf("skew must be greater than 1, got %v", p.Skew)
+	}
+	if p.Missing < 0 || p.Missing > 1 {
+		return nil, fmt.Errorf("missing fraction must be between 0 and 1, got %v", p.Missing)
+	}
+	var (
+		rng    = rand.New(rand.NewSource(p.Seed))
+		result = make([]string, n)
+		zipf   *rand.Zipf
+	)
+	if p.Skew > 0 {
+		zipf = rand.NewZipf(rng, p.Skew, 1, uint64(len(ids)-1))
+	}
+	for i := range result {
+		switch {
+		case p.Missing > 0 && rng.Float64() < p.Missing:
+			result[i] = fmt.Sprintf("%s%d", MissingKeyPrefix, rng.Int63())
+		case zipf != nil:
+			result[i] = ids[zipf.Uint64()]
+		default:
+			result[i] = ids[rng.Intn(len(ids))]
+		}
+	}
+	return result, nil
+}
+
+// Histogram returns the number of requests with a latency up to each bound,
+// and above the last bound, as the last element; bounds must be sorted.
+func (ws *WarmStats) Histogram(bounds []time.Duration) []int {
+	counts := make([]int, len(bounds)+1)
+	for _, v := range ws.latencies {
+		i := sort.Search(len(bounds), func(i int) bool { return v <= bounds[i] })
+		counts[i]++
+	}
+	return counts
+}
+
+// HistogramTable formats the latency histogram for the given bounds, one
+// line per bucket, with count and share of requests.
+func (ws *WarmStats) HistogramTable(bounds []time.Duration) string {
+	if len(bounds) == 0 {
+		return ""
+	}
+	var (
+		sb     strings.Builder
+		counts = ws.Histogram(bounds)
+		total  = len(ws.latencies)
+	)
+	for i, c := range counts {
+		label := "> " + bounds[len(bounds)-1].String()
+		if i < len(bounds) {
+			label = "<= " + bounds[i].String()
+		}
+		var share float64
+		if total > 0 {
+			share = 100 * float64(c) / float64(total)
+		}
+		fmt.Fprintf(&sb, "%10s %8d %6.2f%%\n", label, c, share)
+	}
+	return sb.String()
+}
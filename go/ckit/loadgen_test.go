@@ -0,0 +1,57 @@
+package ckit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadProfileGenerate(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	p := LoadProfile{Skew: 2, Missing: 0.1, Seed: 42}
+	seq, err := p.Generate(ids, 10000)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	again, _ := p.Generate(ids, 10000)
+	if !reflect.DeepEqual(seq, again) {
+		t.Fatalf("same seed, got different sequences")
+	}
+	counts := make(map[string]int)
+	var missing int
+	for _, id := range seq {
+		if strings.HasPrefix(id, MissingKeyPrefix) {
+			missing++
+			continue
+		}
+		counts[id]++
+	}
+	if missing < 800 || missing > 1200 {
+		t.Fatalf("got %d missing, want about 1000", missing)
+	}
+	// The first identifier is the most frequent one.
+	for _, id := range ids[1:] {
+		if counts[id] >= counts["a"] {
+			t.Fatalf("got %d for %s, %d for a, want a most frequent", counts[id], id, counts["a"])
+		}
+	}
+	for _, p := range []LoadProfile{{Skew: 0.5}, {Missing: 2}} {
+		if _, err := p.Generate(ids, 1); err == nil {
+			t.Fatalf("%+v: got nil, want error", p)
+		}
+	}
+	if _, err := (LoadProfile{}).Generate(nil, 1); err == nil {
+		t.Fatalf("got nil, want error")
+	}
+}
+
+func TestWarmStatsHistogram(t *testing.T) {
+	ws := &WarmStats{latencies: []time.Duration{
+		time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, time.Second,
+	}}
+	got := ws.Histogram([]time.Duration{10 * time.Millisecond, 100 * time.Millisecond})
+	if want := []int{2, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,52 @@
+package ckit
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+// Mapping is a pair of local identifier and DOI from the identifier
+// database.
+type Mapping struct {
+	ID  string `json:"id"`
+	DOI string `json:"doi"`
+}
+
+// handleLookupID returns the DOI for a local identifier, without any
+// citation data; 404, if the identifier has no DOI.
+func (s *Server) handleLookupID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		doi, err := s.lookupDOI(r.Context(), id)
+		if err != nil {
+			s.writeLookupError(w, r, id, err)
+			return
+		}
+		writeMapping(w, Mapping{ID: id, DOI: doi})
+	}
+}
+
+// handleLookupDOI returns the local identifier for a DOI, the same as
+// "/doi/{doi}" would redirect to, without any citation data; 404, if the DOI
+// is not in the index.
+func (s *Server) handleLookupDOI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		doi := mux.Vars(r)["doi"]
+		id, err := s.lookupID(r.Context(), doi)
+		if err != nil {
+			s.writeLookupError(w, r, doi, err)
+			return
+		}
+		writeMapping(w, Mapping{ID: id, DOI: doi})
+	}
+}
+
+// writeMapping writes a mapping pair as JSON.
+func writeMapping(w http.ResponseWriter, m Mapping) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+	}
+}
@@ -0,0 +1,39 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestHandleLookup(t *testing.T) {
+	srv := newTestServer(t)
+	var cases = []struct {
+		target string
+		status int
+		result Mapping
+	}{
+		{"/lookup/id/i0029", 200, Mapping{ID: "i0029", DOI: "d0029"}},
+		{"/lookup/doi/d0066", 200, Mapping{ID: "i0066", DOI: "d0066"}},
+		{"/lookup/id/x", 404, Mapping{}},
+		{"/lookup/doi/10.9999/x", 404, Mapping{}},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != c.status {
+			t.Fatalf("%s: got %d, want %d", c.target, rr.Code, c.status)
+		}
+		if c.status != 200 {
+			continue
+		}
+		var m Mapping
+		if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+			t.Fatalf("%s: decode: %v", c.target, err)
+		}
+		if m != c.result {
+			t.Fatalf("%s: got %v, want %v", c.target, m, c.result)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package ckit
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUFetcher keeps the most recently fetched blobs in memory, in front of
+// another Fetcher. Access patterns are heavily skewed, a few thousand highly
+// cited documents appear in a large fraction of responses, so keeping them in
+// RAM saves a lot of disk reads. The cache is bounded by the total size of
+// the cached blobs in bytes. Thread-safe.
+type LRUFetcher struct {
+	Fetcher  Fetcher
+	MaxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+	hits  int64
+	miss  int64
+}
+
+type lruEntry struct {
+	id string
+	b  []byte
+}
+
+// NewLRUFetcher wraps a fetcher with an in-memory cache of at most maxBytes.
+func NewLRUFetcher(f Fetcher, maxBytes int64) *LRUFetcher {
+	return &LRUFetcher{
+		Fetcher:  f,
+		MaxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Fetch returns a blob from memory or from the wrapped fetcher. Callers must
+// not modify the returned slice.
+func (f *LRUFetcher) Fetch(id string) ([]byte, error) {
+	b, _, err := f.FetchSource(id)
+	return b, err
+}
+
+// FetchSource is like Fetch, but also names the backend of the blob; blobs
+// served from memory have source "lru".
+func (f *LRUFetcher) FetchSource(id string) ([]byte, string, error) {
+	f.mu.Lock()
+	if e, ok := f.items[id]; ok {
+		f.ll.MoveToFront(e)
+		f.hits++
+		b := e.Value.(*lruEntry).b
+		f.mu.Unlock()
+		return b, "lru", nil
+	}
+	f.miss++
+	f.mu.Unlock()
+	b, source, err := fetchSource(f.Fetcher, id)
+	if err != nil {
+		return nil, "", err
+	}
+	f.add(id, b)
+	return b, source, nil
+}
+
+// add puts a blob into the cache, evicting least recently used entries as
+// needed. Blobs larger than the whole budget are not cached.
+func (f *LRUFetcher) add(id string, b []byte) {
+	size := int64(len(b) + len(id))
+	if size > f.MaxBytes {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.items[id]; ok {
+		return
+	}
+	f.items[id] = f.ll.PushFront(&lruEntry{id: id, b: b})
+	f.size += size
+	for f.size > f.MaxBytes {
+		e := f.ll.Back()
+		if e == nil {
+			break
+		}
+		entry := f.ll.Remove(e).(*lruEntry)
+		delete(f.items, entry.id)
+		f.size -= int64(len(entry.b) + len(entry.id))
+	}
+}
+
+// Len returns the number of cached blobs.
+func (f *LRUFetcher) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ll.Len()
+}
+
+// Size returns the total size of cached blobs in bytes.
+func (f *LRUFetcher) Size() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
+
+// HitsMisses returns the number of cache hits and misses so far.
+func (f *LRUFetcher) HitsMisses() (hits, misses int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hits, f.miss
+}
+
+// Ping pings the wrapped fetcher, if it supports it.
+func (f *LRUFetcher) Ping() error {
+	if p, ok := f.Fetcher.(Pinger); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// Validate validates the wrapped fetcher, if it supports it.
+func (f *LRUFetcher) Validate(integrity bool) error {
+	if v, ok := f.Fetcher.(Validator); ok {
+		return v.Validate(integrity)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package ckit
+
+import (
+	"fmt"
+	"testing"
+)
+
+type countingFetcher struct{ calls int }
+
+func (f *countingFetcher) Fetch(id string) ([]byte, error) {
+	f.calls++
+	return []byte(fmt.Sprintf("blob-%s", id)), nil
+}
+
+func TestLRUFetcher(t *testing.T) {
+	var (
+		f   = &countingFetcher{}
+		lru = NewLRUFetcher(f, 26) // room for two entries of size 13
+	)
+	for _, id := range []string{"aaaa", "bbbb", "aaaa", "cccc", "aaaa", "bbbb"} {
+		b, err := lru.Fetch(id)
+		if err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+		if string(b) != "blob-"+id {
+			t.Fatalf("got %s, want blob-%s", b, id)
+		}
+	}
+	// aaaa (miss), bbbb (miss), aaaa (hit), cccc (miss, evicts bbbb), aaaa
+	// (hit), bbbb (miss, evicts cccc)
+	if f.calls != 4 {
+		t.Fatalf("got %d calls, want 4", f.calls)
+	}
+	if lru.Len() != 2 {
+		t.Fatalf("got %d entries, want 2", lru.Len())
+	}
+	if lru.Size() > lru.MaxBytes {
+		t.Fatalf("size %d exceeds budget %d", lru.Size(), lru.MaxBytes)
+	}
+}
@@ -0,0 +1,155 @@
+package ckit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+const (
+	// maxMapKeys is the maximum number of DOI or identifiers in a single
+	// mapping request.
+	maxMapKeys = 100000
+	// maxMapBodySize limits the size of a mapping request body.
+	maxMapBodySize = 16 << 20
+)
+
+// MappingResponse is the result of a bulk mapping request. For DOI, Mapped
+// contains the list of local identifiers per DOI, for local identifiers, it
+// contains the DOI (as single element list). Input, which cannot be mapped,
+// is listed in Unmatched, in request order.
+type MappingResponse struct {
+	Mapped    map[string][]string `json:"mapped"`
+	Unmatched []string            `json:"unmatched"`
+	Extra     struct {
+		Count          int     `json:"count"`
+		MappedCount    int     `json:"mapped_count"`
+		UnmatchedCount int     `json:"unmatched_count"`
+		Took           float64 `json:"took"`
+	} `json:"extra"`
+}
+
+// readMappingKeys reads a list of DOI or identifiers from a request body,
+// either as JSON array of strings or, with content type text/plain, one per
+// line. Empty values and duplicates are dropped; the order is kept.
+func readMappingKeys(r *http.Request) ([]string, error) {
+	var (
+		keys []string
+		body = io.LimitReader(r.Body, maxMapBodySize+1)
+	)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/plain" {
+		br := bufio.NewScanner(body)
+		br.Buffer(make([]byte, 0, 4096), maxMapBodySize)
+		for br.Scan() {
+			keys = append(keys, br.Text())
+		}
+		if err := br.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > maxMapBodySize {
+			return nil, fmt.Errorf("request body exceeds %d bytes", maxMapBodySize)
+		}
+		if err := json.Unmarshal(b, &keys); err != nil {
+			return nil, fmt.Errorf("expected JSON array of strings: %w", err)
+		}
+	}
+	var (
+		seen   = make(map[string]bool, len(keys))
+		result = keys[:0]
+	)
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		result = append(result, k)
+	}
+	if len(result) > maxMapKeys {
+		return nil, fmt.Errorf("too many values: %d, limit is %d", len(result), maxMapKeys)
+	}
+	return result, nil
+}
+
+// mapKeys maps DOI to local identifiers (kind "doi") or local identifiers to
+// DOI (kind "id") with batched queries against the identifier database.
+func (s *Server) mapKeys(ctx context.Context, kind string, keys []string) (*MappingResponse, error) {
+	resp := &MappingResponse{Mapped: make(map[string][]string), Unmatched: []string{}}
+	if len(keys) > 0 {
+		ctx, cancel := withTimeout(ctx, s.LookupTimeout)
+		defer cancel()
+		column := "v"
+		if kind == "id" {
+			column = "k"
+		}
+		rows, err := s.mapIn(ctx, column, keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range rows {
+			k, v := m.Value, m.Key
+			if kind == "id" {
+				k, v = m.Key, m.Value
+			}
+			if !SliceContains(resp.Mapped[k], v) {
+				resp.Mapped[k] = append(resp.Mapped[k], v)
+			}
+		}
+	}
+	for _, k := range keys {
+		if _, ok := resp.Mapped[k]; !ok {
+			resp.Unmatched = append(resp.Unmatched, k)
+		}
+	}
+	resp.Extra.Count = len(keys)
+	resp.Extra.MappedCount = len(resp.Mapped)
+	resp.Extra.UnmatchedCount = len(resp.Unmatched)
+	return resp, nil
+}
+
+// handleMap maps a list of DOI to local identifiers ("/map/doi") or a list
+// of local identifiers to DOI ("/map/id"), e.g. for bulk reconciliation
+// jobs, which would otherwise need one request per value.
+func (s *Server) handleMap() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			started = time.Now()
+			kind    = mux.Vars(r)["kind"]
+		)
+		keys, err := readMappingKeys(r)
+		if err != nil {
+			httpErrLogf(w, http.StatusBadRequest, "map: %w", err)
+			return
+		}
+		resp, err := s.mapKeys(r.Context(), kind, keys)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(r.Context(), "lookup",
+				s.LookupTimeout, fmt.Sprintf("mapping %d values", len(keys))))
+			return
+		case err != nil:
+			httpErrLogf(w, http.StatusInternalServerError, "map: %w", err)
+			return
+		}
+		resp.Extra.Took = time.Since(started).Seconds()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+		}
+	}
+}
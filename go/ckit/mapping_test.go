@@ -0,0 +1,85 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestHandleMap(t *testing.T) {
+	srv := newTestServer(t)
+	var cases = []struct {
+		about       string
+		target      string
+		contentType string
+		body        string
+		status      int
+		mapped      map[string][]string
+		unmatched   []string
+	}{
+		{
+			about:     "doi to id",
+			target:    "/map/doi",
+			body:      `["d0029", "d0000", "x", "d0029"]`,
+			status:    200,
+			mapped:    map[string][]string{"d0029": {"i0029"}, "d0000": {"i0000"}},
+			unmatched: []string{"x"},
+		},
+		{
+			about:       "id to doi, plain text",
+			target:      "/map/id",
+			contentType: "text/plain",
+			body:        "i0029\n\ni0066\nx\n",
+			status:      200,
+			mapped:      map[string][]string{"i0029": {"d0029"}, "i0066": {"d0066"}},
+			unmatched:   []string{"x"},
+		},
+		{
+			about:     "empty list",
+			target:    "/map/doi",
+			body:      `[]`,
+			status:    200,
+			mapped:    map[string][]string{},
+			unmatched: []string{},
+		},
+		{
+			about:  "invalid json",
+			target: "/map/doi",
+			body:   `{"doi": "d0029"}`,
+			status: 400,
+		},
+		{
+			about:  "unknown kind",
+			target: "/map/isbn",
+			body:   `[]`,
+			status: 404,
+		},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", c.target, strings.NewReader(c.body))
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		srv.ServeHTTP(rr, req)
+		if rr.Code != c.status {
+			t.Fatalf("[%s] got %d, want %d: %s", c.about, rr.Code, c.status, rr.Body.String())
+		}
+		if c.status != 200 {
+			continue
+		}
+		var resp MappingResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("[%s] decode: %v", c.about, err)
+		}
+		if !reflect.DeepEqual(resp.Mapped, c.mapped) {
+			t.Fatalf("[%s] got %v, want %v", c.about, resp.Mapped, c.mapped)
+		}
+		if !reflect.DeepEqual(resp.Unmatched, c.unmatched) {
+			t.Fatalf("[%s] got %v, want %v", c.about, resp.Unmatched, c.unmatched)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+	"golang.org/x/text/unicode/norm"
+)
+
+// matchSchema is the schema of the auxiliary match table, which maps a
+// normalized title to local identifiers, with year and author surnames for
+// verification.
+const matchSchema = `
+CREATE TABLE IF NOT EXISTS titles (
+	key TEXT NOT NULL,
+	id TEXT NOT NULL,
+	year INTEGER NOT NULL DEFAULT 0,
+	authors TEXT NOT NULL DEFAULT ''
+);`
+
+// minMatchTitleLength is the minimum length of a normalized title, which is
+// specific enough to match on title alone; for shorter titles (e.g.
+// "Introduction"), year or authors need to agree as well.
+const minMatchTitleLength = 40
+
+// matchSnippet contains the fields used for metadata matching.
+type matchSnippet struct {
+	docSnippet
+	Author flexStrings `json:"author"`
+}
+
+// matchCandidate is a local document with the same normalized title.
+type matchCandidate struct {
+	ID      string `db:"id"`
+	Year    int    `db:"year"`
+	Authors string `db:"authors"`
+}
+
+// NormalizeTitle reduces a title to lowercase letters and digits, separated
+// by single spaces, without diacritics, e.g. "Über  Graphen: Eine
+// Einführung" becomes "uber graphen eine einfuhrung".
+func NormalizeTitle(s string) string {
+	var (
+		sb    strings.Builder
+		space bool
+	)
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+			space = false
+		default:
+			space = true
+		}
+	}
+	return sb.String()
+}
+
+// authorSurnames returns the normalized surnames of authors, given as
+// "Family, Given" or "Given Family".
+func authorSurnames(authors []string) []string {
+	var result []string
+	for _, a := range authors {
+		if i := strings.Index(a, ","); i > 0 {
+			a = a[:i]
+		} else if fields := strings.Fields(a); len(fields) > 0 {
+			a = fields[len(fields)-1]
+		}
+		// Multi-word surnames are kept as one word, e.g. "vandenberg".
+		if v := strings.ReplaceAll(NormalizeTitle(a), " ", ""); v != "" && !SliceContains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// accept returns true, if a candidate agrees with a document with the given
+// title key, year and surnames: years may differ by one (e.g. online first),
+// at least one author surname must be shared, if both have authors. Short
+// titles need year or author to agree.
+func (c matchCandidate) accept(key string, year int, surnames []string) bool {
+	var verified bool
+	if year > 0 && c.Year > 0 {
+		if year-c.Year > 1 || c.Year-year > 1 {
+			return false
+		}
+		verified = true
+	}
+	if authors := strings.Fields(c.Authors); len(authors) > 0 && len(surnames) > 0 {
+		var shared bool
+		for _, v := range surnames {
+			shared = shared || SliceContains(authors, v)
+		}
+		if !shared {
+			return false
+		}
+		verified = true
+	}
+	return verified || len(key) >= minMatchTitleLength
+}
+
+// matchDocument returns the local identifiers of documents in the index,
+// which match the title, year and authors of a document.
+func (s *Server) matchDocument(ctx context.Context, doc json.RawMessage) ([]string, error) {
+	var snippet matchSnippet
+	if err := json.Unmarshal(doc, &snippet); err != nil {
+		return nil, nil
+	}
+	key := NormalizeTitle(snippet.Title.first())
+	if key == "" {
+		return nil, nil
+	}
+	stmt, err := s.stmts.get(s.data(ctx).MatchDatabase, "SELECT id, year, authors FROM titles WHERE key = ?")
+	if err != nil {
+		return nil, err
+	}
+	var candidates []matchCandidate
+	if err := stmt.SelectContext(ctx, &candidates, key); err != nil {
+		return nil, err
+	}
+	var (
+		ids      []string
+		year     = snippet.year()
+		surnames = authorSurnames(snippet.Author)
+	)
+	for _, c := range candidates {
+		if c.accept(key, year, surnames) && !SliceContains(ids, c.ID) {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids, nil
+}
+
+// matchUnmatched looks up unmatched documents with metadata (e.g. from the
+// resolver) in the match database and removes the documents, which match
+// local records, from the unmatched lists. Returns the identifiers and DOI of
+// the matched records, except for identifiers in exclude, which are already
+// part of the response. On error, the response is left unchanged.
+func (s *Server) matchUnmatched(ctx context.Context, response *Response, exclude []Map) ([]Map, error) {
+	ctx, cancel := withTimeout(ctx, s.LookupTimeout)
+	defer cancel()
+	var (
+		known   = make(map[string]bool, len(exclude))
+		matches = make(map[string][]string) // DOI to matched ids, nil for no match
+		result  []Map
+	)
+	for _, v := range exclude {
+		known[v.Key] = true
+	}
+	match := func(docs []json.RawMessage) ([]json.RawMessage, error) {
+		kept := make([]json.RawMessage, 0, len(docs))
+		for _, doc := range docs {
+			var snippet docSnippet
+			if err := json.Unmarshal(doc, &snippet); err != nil || len(snippet.DOI) == 0 {
+				kept = append(kept, doc)
+				continue
+			}
+			doi := snippet.DOI[0]
+			ids, ok := matches[doi]
+			if !ok {
+				found, err := s.matchDocument(ctx, doc)
+				if err != nil {
+					return nil, err
+				}
+				for _, id := range found {
+					if !known[id] {
+						known[id] = true
+						ids = append(ids, id)
+						result = append(result, Map{Key: id, Value: doi})
+					}
+				}
+				matches[doi] = ids
+			}
+			if len(ids) == 0 {
+				kept = append(kept, doc)
+			}
+		}
+		return kept, nil
+	}
+	citing, err := match(response.Unmatched.Citing)
+	if err != nil {
+		return nil, err
+	}
+	cited, err := match(response.Unmatched.Cited)
+	if err != nil {
+		return nil, err
+	}
+	response.Unmatched.Citing, response.Unmatched.Cited = citing, cited
+	return result, nil
+}
+
+// BuildMatchDatabase writes normalized titles, years and author surnames of
+// all documents in the index data (sqlite3 databases, as generated by makta)
+// into a "titles" table in an sqlite3 database at output, for matching
+// unmatched DOI to local records without a DOI. Documents with a DOI are
+// skipped, as they are matched via the identifier database already.
+func BuildMatchDatabase(output string, indexPaths ...string) error {
+	db, err := sqlx.Open("sqlite3", output)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{"PRAGMA journal_mode = OFF", "PRAGMA synchronous = 0", matchSchema, "DELETE FROM titles"} {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("%s: %w", q, err)
+		}
+	}
+	started := time.Now()
+	for _, path := range indexPaths {
+		n, err := insertTitles(db, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		log.Printf("[ok] match: %d titles from %s (%s)", n, path, time.Since(started))
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_titles_key ON titles (key)"); err != nil {
+		return err
+	}
+	log.Printf("[ok] match: done in %s", time.Since(started))
+	return nil
+}
+
+// insertTitles adds the titles of an index database to the match database
+// and returns the number of titles added.
+func insertTitles(db *sqlx.DB, path string) (int, error) {
+	index, err := OpenDatabase(path)
+	if err != nil {
+		return 0, err
+	}
+	defer index.Close()
+	rows, err := index.Queryx("SELECT k, v FROM map")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Preparex("INSERT INTO titles (key, id, year, authors) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for rows.Next() {
+		var m Map
+		if err := rows.StructScan(&m); err != nil {
+			return n, err
+		}
+		var snippet matchSnippet
+		if err := json.Unmarshal([]byte(m.Value), &snippet); err != nil || len(snippet.DOI) > 0 {
+			continue
+		}
+		key := NormalizeTitle(snippet.Title.first())
+		if key == "" {
+			continue
+		}
+		authors := strings.Join(authorSurnames(snippet.Author), " ")
+		if _, err := stmt.Exec(key, m.Key, snippet.year(), authors); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, tx.Commit()
+}
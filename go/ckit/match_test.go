@@ -0,0 +1,171 @@
+package ckit
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	var cases = []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"Über  Graphen: Eine Einführung", "uber graphen eine einfuhrung"},
+		{"On the Matching of Records -- A Study (2nd ed.)", "on the matching of records a study 2nd ed"},
+		{"α-Helices", "α helices"},
+	}
+	for _, c := range cases {
+		if got := NormalizeTitle(c.s); got != c.want {
+			t.Fatalf("[%s] got %q, want %q", c.s, got, c.want)
+		}
+	}
+}
+
+func TestMatchCandidateAccept(t *testing.T) {
+	var (
+		long  = "on the matching of records a study of library catalogs"
+		short = "introduction"
+	)
+	var cases = []struct {
+		c        matchCandidate
+		key      string
+		year     int
+		surnames []string
+		want     bool
+	}{
+		{matchCandidate{Year: 2001, Authors: "doe smith"}, short, 2001, []string{"doe"}, true},
+		{matchCandidate{Year: 2001, Authors: "doe smith"}, short, 2002, nil, true},
+		{matchCandidate{Year: 2001, Authors: "doe smith"}, long, 2003, []string{"doe"}, false},
+		{matchCandidate{Year: 2001, Authors: "doe smith"}, long, 2001, []string{"miller"}, false},
+		{matchCandidate{}, short, 2001, []string{"doe"}, false},
+		{matchCandidate{}, long, 2001, []string{"doe"}, true},
+	}
+	for i, c := range cases {
+		if got := c.c.accept(c.key, c.year, c.surnames); got != c.want {
+			t.Fatalf("[%d] got %v, want %v", i, got, c.want)
+		}
+	}
+}
+
+// matchResolver resolves d0156 with some metadata.
+type matchResolver struct{}
+
+func (matchResolver) Resolve(ctx context.Context, doi string) (json.RawMessage, error) {
+	if doi != "d0156" {
+		return nil, ErrDOINotFound
+	}
+	return json.RawMessage(`{"doi_str_mv": "d0156", "title": "On the Matching of Records: A Study",
+		"author": ["Doe, Jane"], "publishDate": "2001", "resolved_by": "test"}`), nil
+}
+
+func TestServerMetadataMatch(t *testing.T) {
+	dir := t.TempDir()
+	index, err := sqlx.Open("sqlite3", filepath.Join(dir, "index.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer index.Close()
+	for _, q := range []string{
+		"CREATE TABLE map (k TEXT, v TEXT)",
+		`INSERT INTO map VALUES
+			('local-1', '{"id": "local-1", "title": "On the matching of records - a study", "author": ["Jane Doe"], "publishDate": "2002"}'),
+			('local-2', '{"id": "local-2", "title": "On the matching of records: a study", "publishDate": "1990"}'),
+			('local-3', '{"id": "local-3", "title": "On the matching of records: a study", "doi_str_mv": ["10.1/x"]}')`,
+	} {
+		if _, err := index.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	matchPath := filepath.Join(dir, "match.db")
+	if err := BuildMatchDatabase(matchPath, filepath.Join(dir, "index.db")); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	db, err := OpenDatabase(matchPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.Get(&n, "SELECT count(*) FROM titles"); err != nil || n != 2 {
+		t.Fatalf("got %d, %v, want 2 titles", n, err)
+	}
+	g := &FetchGroup{}
+	if err := g.FromFiles("testdata/id_metadata.db", filepath.Join(dir, "index.db")); err != nil {
+		t.Fatalf("fetch group: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.IndexData = g
+	srv.Resolver = matchResolver{}
+	resp := mustRequest(t, srv, "/id/i0029")
+	if resp.Extra.MetadataMatchedCount != 0 || len(resp.Unmatched.Cited) != 1 {
+		t.Fatalf("got %d matched, %d unmatched, want 0, 1", resp.Extra.MetadataMatchedCount, len(resp.Unmatched.Cited))
+	}
+	srv.MatchDatabase = db
+	resp = mustRequest(t, srv, "/id/i0029")
+	if resp.Extra.MetadataMatchedCount != 1 || len(resp.Unmatched.Cited) != 0 || len(resp.Cited) != 5 {
+		t.Fatalf("got %d matched, %d unmatched, %d cited, want 1, 0, 5",
+			resp.Extra.MetadataMatchedCount, len(resp.Unmatched.Cited), len(resp.Cited))
+	}
+	var found bool
+	for _, doc := range resp.Cited {
+		found = found || strings.Contains(string(doc), `"local-1"`)
+	}
+	if !found {
+		t.Fatalf("want local-1 in cited documents")
+	}
+}
+
+func TestMatchUnmatchedError(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "match.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	// A year, which cannot be read, lets the lookup of the "broken" title fail.
+	for _, q := range []string{
+		"CREATE TABLE titles (key TEXT, id TEXT, year INTEGER, authors TEXT)",
+		`INSERT INTO titles VALUES
+			('on the matching of records a study of library catalogs', 'local-1', 2001, 'doe'),
+			('broken', 'local-2', 'x', '')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	var (
+		matched = json.RawMessage(`{"doi_str_mv": "10.1/a", "title": "On the Matching of Records: A Study of Library Catalogs"}`)
+		noDOI   = json.RawMessage(`{"title": "Without DOI"}`)
+		broken  = json.RawMessage(`{"doi_str_mv": "10.1/c", "title": "Broken"}`)
+	)
+	var cases = []struct {
+		about  string
+		citing []json.RawMessage
+		cited  []json.RawMessage
+	}{
+		{"error within a list", []json.RawMessage{matched, noDOI, broken}, []json.RawMessage{}},
+		{"error in the second list", []json.RawMessage{matched, noDOI}, []json.RawMessage{broken}},
+	}
+	srv := newTestServer(t)
+	srv.MatchDatabase = db
+	for _, c := range cases {
+		response := &Response{}
+		response.Unmatched.Citing = append([]json.RawMessage{}, c.citing...)
+		response.Unmatched.Cited = append([]json.RawMessage{}, c.cited...)
+		if _, err := srv.matchUnmatched(context.Background(), response, nil); err == nil {
+			t.Fatalf("[%s] got no error, want error", c.about)
+		}
+		if got, want := string(mustMarshal(response.Unmatched.Citing)), string(mustMarshal(c.citing)); got != want {
+			t.Fatalf("[%s] got citing %s, want unchanged %s", c.about, got, want)
+		}
+		if got, want := string(mustMarshal(response.Unmatched.Cited)), string(mustMarshal(c.cited)); got != want {
+			t.Fatalf("[%s] got cited %s, want unchanged %s", c.about, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ckit
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxAttached is the number of databases we attach at once; sqlite3 allows
+// ten by default.
+const maxAttached = 8
+
+// MergeDatabases unions the map tables of several databases (as generated by
+// makta) into a new database at output, removing duplicate rows. All inputs
+// must have the same columns; the table and index definitions are taken
+// from the first input. Indexes are created after all data has been copied.
+func MergeDatabases(output string, inputs []string) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("no input databases")
+	}
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("output database already exists: %s", output)
+	}
+	var (
+		started = time.Now()
+		schema  string
+		indexes []string
+		columns []string
+	)
+	for i, input := range inputs {
+		db, err := OpenDatabase(input)
+		if err != nil {
+			return err
+		}
+		cols, err := mapColumns(db)
+		if err == nil && i == 0 {
+			columns = cols
+			err = db.Get(&schema, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'map'")
+			if err == nil {
+				err = db.Select(&indexes, `SELECT sql FROM sqlite_master
+					WHERE type = 'index' AND tbl_name = 'map' AND sql IS NOT NULL`)
+			}
+		}
+		db.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		if !reflect.DeepEqual(cols, columns) {
+			return fmt.Errorf("%s: columns %v differ from %v", input, cols, columns)
+		}
+	}
+	db, err := sqlx.Open("sqlite3", output)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // attached databases are per connection
+	for _, q := range []string{"PRAGMA journal_mode = OFF", "PRAGMA synchronous = 0", schema} {
+		if _, err := db.Exec(q); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(inputs); i += maxAttached {
+		var (
+			t       = time.Now()
+			j       = i + maxAttached
+			names   []string
+			selects []string
+		)
+		if j > len(inputs) {
+			j = len(inputs)
+		}
+		for k, input := range inputs[i:j] {
+			name := fmt.Sprintf("src%d", k)
+			if _, err := db.Exec("ATTACH DATABASE ? AS "+name, "file:"+input+"?mode=ro"); err != nil {
+				return fmt.Errorf("attach %s: %w", input, err)
+			}
+			names = append(names, name)
+			selects = append(selects, fmt.Sprintf("SELECT * FROM %s.map", name))
+		}
+		// A compound SELECT with UNION removes duplicates.
+		union := strings.Join(selects, " UNION ")
+		if len(selects) == 1 {
+			union = fmt.Sprintf("SELECT DISTINCT * FROM %s.map", names[0])
+		}
+		query := "INSERT INTO map " + union
+		if i > 0 {
+			query = fmt.Sprintf("INSERT INTO map SELECT * FROM (%s) EXCEPT SELECT * FROM map", union)
+		}
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("merge: %w", err)
+		}
+		for _, name := range names {
+			if _, err := db.Exec("DETACH DATABASE " + name); err != nil {
+				return err
+			}
+		}
+		log.Printf("[ok] merged %d/%d databases (%s)", j, len(inputs), time.Since(t))
+	}
+	for _, q := range indexes {
+		t := time.Now()
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("index: %w", err)
+		}
+		log.Printf("[ok] %s (%s)", q, time.Since(t))
+	}
+	log.Printf("[ok] merge: done in %s", time.Since(started))
+	return nil
+}
+
+// mapColumns returns the column names of the map table.
+func mapColumns(db *sqlx.DB) ([]string, error) {
+	rows, err := db.Queryx("SELECT * FROM map LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
@@ -0,0 +1,51 @@
+package ckit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeDatabases(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		output = filepath.Join(dir, "merged.db")
+		inputs []string
+	)
+	// More inputs than can be attached at once; the test data contains
+	// duplicates as well.
+	for i := 0; i < 10; i++ {
+		inputs = append(inputs, "testdata/id_doi.db")
+	}
+	if err := MergeDatabases(output, inputs); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	db, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var n, m int
+	if err := db.Get(&n, "SELECT count(*) FROM map"); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	src, err := OpenDatabase("testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer src.Close()
+	if err := src.Get(&m, "SELECT count(*) FROM (SELECT DISTINCT k, v FROM map)"); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != m {
+		t.Fatalf("got %d rows, want %d", n, m)
+	}
+	if err := ValidateMapDatabase(db, []string{"idx_k", "idx_v"}, false); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := MergeDatabases(output, inputs); err == nil {
+		t.Fatalf("expected error for existing output")
+	}
+	if err := MergeDatabases(filepath.Join(dir, "x.db"), []string{"testdata/id_doi.db", "testdata/counts.db"}); err == nil {
+		t.Fatalf("expected error for missing input")
+	}
+}
@@ -0,0 +1,79 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+)
+
+// Namespace is an alternate identifier namespace, e.g. PubMed ids or arXiv
+// ids. The database maps identifiers of the namespace (k) to DOI (v) and can
+// be built with makta from a two-column TSV.
+type Namespace struct {
+	Name string
+	DB   *sqlx.DB
+}
+
+var (
+	namespacePattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+	// reservedNamespaces would clash with existing routes, including admin
+	// routes, which may be served on the same router; keep in sync with
+	// Routes and adminRoutes.
+	reservedNamespaces = []string{
+		"admin", "cache", "debug", "doi", "dois", "id", "index", "lookup",
+		"map", "oci", "q", "readyz", "stats", "top", "version", "view", "viz",
+	}
+)
+
+// ValidateNamespaceName returns an error, if a name cannot be used as a
+// namespace, e.g. because it clashes with an existing route.
+func ValidateNamespaceName(name string) error {
+	if !namespacePattern.MatchString(name) {
+		return fmt.Errorf("invalid namespace name: %q", name)
+	}
+	if SliceContains(reservedNamespaces, name) {
+		return fmt.Errorf("reserved namespace name: %q", name)
+	}
+	return nil
+}
+
+// lookupNamespaceDOI returns the DOI for an identifier in a namespace.
+func (s *Server) lookupNamespaceDOI(ctx context.Context, ns Namespace, id string) (doi string, err error) {
+	stmt, err := s.stmts.get(ns.DB, queryValueByKey)
+	if err != nil {
+		return "", fmt.Errorf("prepare: %w", err)
+	}
+	ctx, cancel := withTimeout(ctx, s.LookupTimeout)
+	defer cancel()
+	err = stmt.GetContext(ctx, &doi, id)
+	return doi, err
+}
+
+// handleNamespace resolves an identifier of an alternate namespace to a DOI
+// and then to a local identifier and redirects to the local identifier, just
+// like "/doi/{doi}".
+func (s *Server) handleNamespace(ns Namespace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			ctx     = r.Context()
+			id      = mux.Vars(r)["id"]
+			current = ns
+		)
+		// The namespace database may have been reloaded.
+		for _, v := range s.data(ctx).Namespaces {
+			if v.Name == ns.Name {
+				current = v
+			}
+		}
+		doi, err := s.lookupNamespaceDOI(ctx, current, id)
+		if err != nil {
+			s.writeLookupError(w, r, ns.Name+":"+id, err)
+			return
+		}
+		s.redirectDOI(w, r, doi)
+	}
+}
@@ -0,0 +1,89 @@
+package ckit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidateNamespaceName(t *testing.T) {
+	var cases = []struct {
+		name string
+		ok   bool
+	}{
+		{"pmid", true},
+		{"arxiv", true},
+		{"pmc2", true},
+		{"", false},
+		{"PMID", false},
+		{"doi", false},
+		{"id", false},
+		{"a/b", false},
+	}
+	for _, c := range cases {
+		if err := ValidateNamespaceName(c.name); (err == nil) != c.ok {
+			t.Fatalf("[%s] got %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestReservedNamespacesCoverRoutes(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Router = mux.NewRouter()
+	srv.AdminRouter = mux.NewRouter()
+	srv.Reload = func() (*Datasets, error) { return nil, nil }
+	srv.Spindel = true
+	srv.Routes()
+	for _, r := range []*mux.Router{srv.Router, srv.AdminRouter} {
+		err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			tmpl, err := route.GetPathTemplate()
+			if err != nil {
+				return err
+			}
+			name := strings.SplitN(strings.TrimPrefix(tmpl, "/"), "/", 2)[0]
+			if name == "" {
+				return nil
+			}
+			if err := ValidateNamespaceName(name); err == nil {
+				t.Errorf("route %s not reserved as namespace name", tmpl)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("walk: %v", err)
+		}
+	}
+}
+
+func TestServerNamespace(t *testing.T) {
+	srv := newTestServer(t)
+	// Any key-value database will do; use the identifier database, so the
+	// namespace identifier resolves to the DOI of the same local id.
+	db, err := OpenDatabase("testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	srv.Namespaces = []Namespace{{Name: "pmid", DB: db}}
+	srv.Routes()
+	var cases = []struct {
+		target   string
+		status   int
+		location string
+	}{
+		{"/pmid/i0029", http.StatusTemporaryRedirect, "/id/i0029"},
+		{"/pmid/x", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != c.status {
+			t.Fatalf("[%s] got status %d, want %d", c.target, rr.Code, c.status)
+		}
+		if loc := rr.Header().Get("Location"); loc != c.location {
+			t.Fatalf("[%s] got location %q, want %q", c.target, loc, c.location)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/set"
+)
+
+// Edge types in a citation network.
+const (
+	EdgeCiting   = "citing"   // the target cites a neighbor
+	EdgeCited    = "cited"    // a neighbor cites the target
+	EdgeNeighbor = "neighbor" // a neighbor cites another neighbor
+)
+
+// Network is the citation neighborhood (ego network) of a document: the
+// target, all documents it cites or is cited by, and the citations among
+// all of them. Nodes and edges are identified by DOI, as not every neighbor
+// is in the index.
+type Network struct {
+	ID    string        `json:"id"`
+	DOI   string        `json:"doi"`
+	Nodes []NetworkNode `json:"nodes"`
+	Edges []NetworkEdge `json:"edges"`
+	Extra struct {
+		NodeCount int     `json:"node_count"`
+		EdgeCount int     `json:"edge_count"`
+		Took      float64 `json:"took"` // seconds
+	} `json:"extra"`
+}
+
+// NetworkNode is a document in a network, with minimal metadata for matched
+// documents; a DOI may map to more than one local identifier.
+type NetworkNode struct {
+	DOI   string   `json:"doi"`
+	IDs   []string `json:"ids,omitempty"`
+	Title string   `json:"title,omitempty"`
+	Year  int      `json:"year,omitempty"`
+}
+
+// NetworkEdge is a citation, source cites target.
+type NetworkEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// handleNetwork returns the citation network around a local identifier.
+func (s *Server) handleNetwork() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			ctx = r.Context()
+			id  = mux.Vars(r)["id"]
+		)
+		doi, err := s.lookupDOI(ctx, id)
+		if err != nil {
+			s.writeLookupError(w, r, id, err)
+			return
+		}
+		network, err := s.network(ctx, id, doi)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(ctx, "network",
+				s.EdgesTimeout, fmt.Sprintf("network for %s", doi)))
+			return
+		case err != nil:
+			httpErrLogf(w, http.StatusInternalServerError, "network: %w", err)
+			return
+		case len(network.Edges) == 0:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(network); err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+		}
+	}
+}
+
+// network assembles the citation network for a DOI; besides the edges of
+// the target, this requires one more query per batch of neighbors, for the
+// citations among them.
+func (s *Server) network(ctx context.Context, id, doi string) (*Network, error) {
+	var (
+		started = time.Now()
+		network = &Network{ID: id, DOI: doi, Nodes: []NetworkNode{}, Edges: []NetworkEdge{}}
+		seen    = make(map[[2]string]bool)
+		add     = func(source, target, typ string) {
+			key := [2]string{source, target}
+			if source == target || seen[key] {
+				return
+			}
+			seen[key] = true
+			network.Edges = append(network.Edges, NetworkEdge{Source: source, Target: target, Type: typ})
+		}
+	)
+	ectx, cancel := withTimeout(ctx, s.EdgesTimeout)
+	defer cancel()
+	citing, cited, _, err := s.edges(ectx, doi)
+	if err != nil {
+		return nil, err
+	}
+	neighbors := set.New[string]()
+	for _, v := range citing {
+		neighbors.Add(v.Value)
+		add(doi, v.Value, EdgeCiting)
+	}
+	for _, v := range cited {
+		neighbors.Add(v.Key)
+		add(v.Key, doi, EdgeCited)
+	}
+	delete(neighbors, doi)
+	for _, src := range s.data(ctx).ociSources() {
+		edges, err := s.edgesAmong(ectx, src, neighbors)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src.Name, err)
+		}
+		for _, v := range edges {
+			add(v.Key, v.Value, EdgeNeighbor)
+		}
+	}
+	nodes, err := s.networkNodes(ctx, append([]string{doi}, set.Sorted(neighbors)...))
+	if err != nil {
+		return nil, err
+	}
+	network.Nodes = nodes
+	network.Extra.NodeCount = len(network.Nodes)
+	network.Extra.EdgeCount = len(network.Edges)
+	network.Extra.Took = time.Since(started).Seconds()
+	return network, nil
+}
+
+// edgesAmong returns the edges of a citation database between the DOI of a
+// set, in batches; shards are queried in parallel, each for the DOI whose
+// outbound edges it contains.
+func (s *Server) edgesAmong(ctx context.Context, src OciSource, dois set.Set[string]) (edges []Map, err error) {
+	if dois.IsEmpty() {
+		return nil, nil
+	}
+	var (
+		groups  = src.groupByShard(dois)
+		results = make([][]Map, len(groups))
+	)
+	err = eachShard(src.databases(), func(i int, db *sqlx.DB) error {
+		if len(groups[i]) == 0 {
+			return nil
+		}
+		for _, batch := range batchedStrings(groups[i], 500) {
+			query, args, err := sqlx.In("SELECT k, v FROM map WHERE k IN (?)", batch)
+			if err != nil {
+				return err
+			}
+			var result []Map
+			if err := db.SelectContext(ctx, &result, db.Rebind(query), args...); err != nil {
+				return err
+			}
+			for _, v := range result {
+				if dois.Contains(v.Value) {
+					results[i] = append(results[i], v)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range results {
+		edges = append(edges, v...)
+	}
+	return edges, nil
+}
+
+// networkNodes returns nodes for a list of DOI, in the given order, with
+// metadata from the index data for matched documents.
+func (s *Server) networkNodes(ctx context.Context, dois []string) ([]NetworkNode, error) {
+	mctx, cancel := withTimeout(ctx, s.LookupTimeout)
+	defer cancel()
+	ids, err := s.mapToLocal(mctx, dois)
+	if err != nil {
+		return nil, err
+	}
+	byDOI := make(map[string][]string)
+	for _, v := range ids {
+		if !SliceContains(byDOI[v.Value], v.Key) {
+			byDOI[v.Value] = append(byDOI[v.Value], v.Key)
+		}
+	}
+	fctx, cancel := withTimeout(ctx, s.FetchTimeout)
+	defer cancel()
+	var (
+		nodes = make([]NetworkNode, len(dois))
+		data  = s.data(ctx)
+	)
+	for i, doi := range dois {
+		nodes[i] = NetworkNode{DOI: doi, IDs: byDOI[doi]}
+		if len(nodes[i].IDs) == 0 {
+			continue
+		}
+		if err := fctx.Err(); err != nil {
+			return nil, err
+		}
+		sort.Strings(nodes[i].IDs)
+		b, err := data.IndexData.Fetch(nodes[i].IDs[0])
+		if errors.Is(err, ErrBlobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("index data fetch: %w", err)
+		}
+		var snippet docSnippet
+		if err := json.Unmarshal(b, &snippet); err != nil {
+			continue
+		}
+		nodes[i].Title, nodes[i].Year = snippet.Title.first(), snippet.year()
+	}
+	return nodes, nil
+}
@@ -0,0 +1,79 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+func TestServerNetwork(t *testing.T) {
+	srv := newTestServer(t)
+	// An additional citation database with an edge between two neighbors of
+	// d0029 and a duplicate of an existing edge.
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "local.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, q := range []string{
+		"CREATE TABLE map (k TEXT, v TEXT, PRIMARY KEY (k, v)) WITHOUT ROWID",
+		"INSERT INTO map VALUES ('d0069', 'd0009'), ('d0069', 'd0029'), ('d0009', 'd1000')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	srv.AdditionalOciDatabases = []OciSource{{Name: "local", DB: db}}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029/network", nil))
+	if rr.Code != 200 {
+		t.Fatalf("got %d, want 200: %s", rr.Code, rr.Body.String())
+	}
+	var network Network
+	if err := json.Unmarshal(rr.Body.Bytes(), &network); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if network.DOI != "d0029" || len(network.Nodes) == 0 || network.Nodes[0].DOI != "d0029" {
+		t.Fatalf("unexpected network: %+v", network)
+	}
+	types := make(map[NetworkEdge]bool)
+	for _, e := range network.Edges {
+		if types[e] {
+			t.Fatalf("duplicate edge: %v", e)
+		}
+		types[e] = true
+	}
+	for _, e := range []NetworkEdge{
+		{"d0029", "d0009", EdgeCiting},
+		{"d0069", "d0029", EdgeCited},
+		{"d0156", "d0029", EdgeCited},
+		{"d0069", "d0009", EdgeNeighbor},
+	} {
+		if !types[e] {
+			t.Fatalf("missing edge %v in %v", e, network.Edges)
+		}
+	}
+	if network.Extra.EdgeCount != 6 || network.Extra.NodeCount != 6 {
+		t.Fatalf("got %d edges and %d nodes, want 6 and 6", network.Extra.EdgeCount, network.Extra.NodeCount)
+	}
+	for _, node := range network.Nodes {
+		switch node.DOI {
+		case "d0069":
+			if len(node.IDs) != 1 || node.IDs[0] != "i0069" {
+				t.Fatalf("got %v, want i0069", node.IDs)
+			}
+		case "d0156":
+			if len(node.IDs) != 0 {
+				t.Fatalf("unmatched node with ids: %v", node)
+			}
+		}
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/xxx/network", nil))
+	if rr.Code != 404 {
+		t.Fatalf("got %d, want 404", rr.Code)
+	}
+}
@@ -0,0 +1,129 @@
+package ckit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+// errNoOCIColumn is returned, if no citation database supports lookups by
+// OCI identifier.
+var errNoOCIColumn = errors.New("no citation database with an indexed oci column")
+
+// OCIResponse describes a single citation, identified by an OpenCitations
+// Identifier (OCI): the citing and cited DOI, the local identifiers of both,
+// if they are in the index, the citation database it was found in and any
+// other edge attributes.
+type OCIResponse struct {
+	Citing    string   `json:"citing"`
+	Cited     string   `json:"cited"`
+	CitingIDs []string `json:"citing_ids,omitempty"`
+	CitedIDs  []string `json:"cited_ids,omitempty"`
+	Source    string   `json:"source"`
+	EdgeMeta
+}
+
+// lookupOCI finds the edge with the given OCI in the citation databases,
+// which have an indexed oci column, in source order; shards are queried in
+// parallel, as the shard cannot be derived from the OCI. Returns
+// sql.ErrNoRows, if there is no such edge and errNoOCIColumn, if no database
+// can be queried by OCI.
+func (s *Server) lookupOCI(ctx context.Context, oci string) (edge Map, source string, err error) {
+	var supported bool
+	for _, src := range s.data(ctx).ociSources() {
+		var (
+			dbs     = src.databases()
+			found   = make([][]Map, len(dbs))
+			indexed = make([]bool, len(dbs))
+		)
+		err := eachShard(dbs, func(i int, db *sqlx.DB) error {
+			q, err := s.edgeQueriesFor(db)
+			if err != nil || q.byOCI == "" {
+				return err
+			}
+			indexed[i] = true
+			stmt, err := s.stmts.get(db, q.byOCI)
+			if err != nil {
+				return err
+			}
+			return stmt.SelectContext(ctx, &found[i], oci)
+		})
+		if err != nil {
+			return edge, "", err
+		}
+		for i, v := range found {
+			supported = supported || indexed[i]
+			if len(v) > 0 {
+				return v[0], src.Name, nil
+			}
+		}
+	}
+	if !supported {
+		return edge, "", errNoOCIColumn
+	}
+	return edge, "", sql.ErrNoRows
+}
+
+// handleOCI resolves an OpenCitations Identifier (with or without "oci:"
+// prefix) to the citing and cited DOI and their local identifiers. This
+// requires a citation database with an indexed oci column (see edge
+// attributes).
+func (s *Server) handleOCI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			oci    = mux.Vars(r)["oci"]
+			prefix = "oci:"
+		)
+		if len(oci) > len(prefix) && strings.EqualFold(oci[:len(prefix)], prefix) {
+			oci = oci[len(prefix):]
+		}
+		ctx, cancel := withTimeout(r.Context(), s.EdgesTimeout)
+		defer cancel()
+		edge, source, err := s.lookupOCI(ctx, oci)
+		switch {
+		case err == sql.ErrNoRows:
+			httpErrLogf(w, http.StatusNotFound, "oci not found: %s", oci)
+			return
+		case err == errNoOCIColumn:
+			httpErrLog(w, http.StatusNotImplemented, err)
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(r.Context(), "edges",
+				s.EdgesTimeout, fmt.Sprintf("oci lookup for %s", oci)))
+			return
+		case err != nil:
+			httpErrLogf(w, http.StatusInternalServerError, "oci: %w", err)
+			return
+		}
+		resp := &OCIResponse{
+			Citing:   edge.Key,
+			Cited:    edge.Value,
+			Source:   source,
+			EdgeMeta: edge.EdgeMeta,
+		}
+		ids, err := s.mapToLocal(r.Context(), []string{edge.Key, edge.Value})
+		if err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "oci: %w", err)
+			return
+		}
+		for _, m := range ids {
+			if m.Value == resp.Citing && !SliceContains(resp.CitingIDs, m.Key) {
+				resp.CitingIDs = append(resp.CitingIDs, m.Key)
+			}
+			if m.Value == resp.Cited && !SliceContains(resp.CitedIDs, m.Key) {
+				resp.CitedIDs = append(resp.CitedIDs, m.Key)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+		}
+	}
+}
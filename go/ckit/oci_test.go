@@ -0,0 +1,85 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+func TestHandleOCI(t *testing.T) {
+	srv := newTestServer(t)
+	// The test citation database has no oci column.
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/oci/0201-0202", nil))
+	if rr.Code != 501 {
+		t.Fatalf("got %d, want 501", rr.Code)
+	}
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "oci.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, q := range []string{
+		`CREATE TABLE map (k TEXT, v TEXT, oci TEXT, creation TEXT)`,
+		`INSERT INTO map VALUES ('d0029', 'd0066', '0201-0202', '2019-01')`,
+		`INSERT INTO map VALUES ('d0029', '10.9999/x', '0201-0203', '2019-01')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	// Without an index, lookups by OCI would scan the table.
+	srv.AdditionalOciDatabases = []OciSource{{Name: "coci", DB: db}}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/oci/0201-0202", nil))
+	if rr.Code != 501 {
+		t.Fatalf("got %d, want 501", rr.Code)
+	}
+	if _, err := db.Exec(`CREATE INDEX idx_oci ON map (oci)`); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	srv.edgeMeta.Delete(db)
+	var cases = []struct {
+		target string
+		status int
+		result OCIResponse
+	}{
+		{"/oci/oci:0201-0202", 200, OCIResponse{
+			Citing:    "d0029",
+			Cited:     "d0066",
+			CitingIDs: []string{"i0029"},
+			CitedIDs:  []string{"i0066"},
+			Source:    "coci",
+			EdgeMeta:  EdgeMeta{OCI: "0201-0202", Creation: "2019-01"},
+		}},
+		{"/oci/0201-0203", 200, OCIResponse{
+			Citing:    "d0029",
+			Cited:     "10.9999/x",
+			CitingIDs: []string{"i0029"},
+			Source:    "coci",
+			EdgeMeta:  EdgeMeta{OCI: "0201-0203", Creation: "2019-01"},
+		}},
+		{"/oci/0201-0299", 404, OCIResponse{}},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != c.status {
+			t.Fatalf("%s: got %d, want %d", c.target, rr.Code, c.status)
+		}
+		if c.status != 200 {
+			continue
+		}
+		var resp OCIResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode: %v", c.target, err)
+		}
+		if !reflect.DeepEqual(resp, c.result) {
+			t.Fatalf("%s: got %+v, want %+v", c.target, resp, c.result)
+		}
+	}
+}
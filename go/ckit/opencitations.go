@@ -0,0 +1,61 @@
+package ckit
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+// OpenCitationsEdge is a citation in the format of the OpenCitations COCI
+// REST API (https://opencitations.net/index/coci/api/v1), so tools written
+// against the public API can use a local mirror instead. Fields other than
+// citing and cited are only filled in, if the citation database contains
+// edge attributes (see EdgeMeta).
+type OpenCitationsEdge struct {
+	OCI       string `json:"oci"`
+	Citing    string `json:"citing"`
+	Cited     string `json:"cited"`
+	Creation  string `json:"creation"`
+	Timespan  string `json:"timespan"`
+	JournalSC string `json:"journal_sc"`
+	AuthorSC  string `json:"author_sc"`
+}
+
+// handleOpenCitations returns the outbound edges (references) or inbound
+// edges (citations) of a DOI, in OpenCitations COCI API format. Like the
+// public API, an unknown DOI results in an empty list.
+func (s *Server) handleOpenCitations(references bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			doi    = mux.Vars(r)["doi"]
+			result = make([]OpenCitationsEdge, 0)
+		)
+		ctx, cancel := withTimeout(r.Context(), s.EdgesTimeout)
+		defer cancel()
+		citing, cited, _, err := s.edges(ctx, doi)
+		if err != nil {
+			s.writeEdgesError(w, r, doi, len(citing), err)
+			return
+		}
+		edges := cited
+		if references {
+			edges = citing
+		}
+		for _, e := range edges {
+			result = append(result, OpenCitationsEdge{
+				OCI:       e.OCI,
+				Citing:    e.Key,
+				Cited:     e.Value,
+				Creation:  e.Creation,
+				Timespan:  e.Timespan,
+				JournalSC: e.JournalSC,
+				AuthorSC:  e.AuthorSC,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package ckit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestOpenCitations(t *testing.T) {
+	srv := newTestServer(t)
+	var cases = []struct {
+		target string
+		result []string // unique DOI on the other end of the edge
+	}{
+		{"/index/v1/references/d0029", []string{"d0009", "d0039", "d0065"}},
+		{"/index/v1/citations/d0029", []string{"d0069", "d0156"}},
+		{"/index/v1/citations/10.123/unknown", nil},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("[%s] got status %d, want 200", c.target, rr.Code)
+		}
+		var edges []OpenCitationsEdge
+		if err := json.Unmarshal(rr.Body.Bytes(), &edges); err != nil {
+			t.Fatalf("[%s] decode: %v", c.target, err)
+		}
+		if edges == nil {
+			t.Fatalf("[%s] got null, want list", c.target)
+		}
+		var (
+			seen   = make(map[string]bool)
+			result []string
+		)
+		for _, e := range edges {
+			v := e.Cited
+			if v == "d0029" {
+				v = e.Citing
+			}
+			if !seen[v] {
+				result = append(result, v)
+				seen[v] = true
+			}
+		}
+		sort.Strings(result)
+		if !reflect.DeepEqual(result, c.result) {
+			t.Fatalf("[%s] got %v, want %v", c.target, result, c.result)
+		}
+	}
+}
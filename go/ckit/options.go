@@ -0,0 +1,180 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// requestOptions are per-request options for post-processing a response,
+// parsed from the URL query. Post-processing happens after caching, so the
+// cache always contains the unmodified response.
+type requestOptions struct {
+	// Institution, e.g. "DE-14", to limit results to documents held by an
+	// institution (query parameter "i").
+	Institution string
+	// Sort key for citing and cited documents, one of sortKeys (query
+	// parameter "sort"), and order, "asc" or "desc" (query parameter
+	// "order"); each key has a default order.
+	Sort  string
+	Order string
+	// From and Until limit documents to a range of publication years,
+	// inclusive (query parameters "from" and "until").
+	From  int
+	Until int
+	// Sources limits documents to a set of catalogs, given as source id or
+	// local identifier prefix, comma separated (query parameter "source").
+	Sources []string
+	// ISSN limits documents to journals, comma separated (query parameter
+	// "issn"), normalized to 1234-567X.
+	ISSN []string
+	// Debug includes the stopwatch timings in the response (query parameter
+	// "debug"); this does not change the documents.
+	Debug bool
+	// Provenance includes the backend and citation databases of each
+	// document in the response (query parameter "provenance"); responses
+	// are then neither read from nor written to the cache.
+	Provenance bool
+	// Edges includes the citing and cited DOI of all edges found in the
+	// citation databases (query parameter "edges"); like Provenance, this
+	// bypasses the cache.
+	Edges bool
+	// Map includes the local identifier and DOI of each citing and cited
+	// document (query parameter "map"); this does not change the
+	// documents.
+	Map bool
+	// Format of the response, "json", "xml" or "jsonapi" (query parameter
+	// "format" or Accept header).
+	Format string
+	// Version of the response schema, SchemaV1 (default) or SchemaV2 (query
+	// parameter "v" or Accept header).
+	Version int
+}
+
+// bypassCache returns true, if a response contains information only
+// available for fresh responses, which must neither be read from nor
+// written to the cache.
+func (o *requestOptions) bypassCache() bool {
+	return o.Provenance || o.Edges
+}
+
+// parseRequestOptions parses and validates options from the URL query.
+func parseRequestOptions(r *http.Request) (*requestOptions, error) {
+	q := r.URL.Query()
+	opts := &requestOptions{
+		Institution: q.Get("i"),
+		Sort:        q.Get("sort"),
+		Order:       q.Get("order"),
+	}
+	switch q.Get("debug") {
+	case "1", "true":
+		opts.Debug = true
+	}
+	switch q.Get("provenance") {
+	case "1", "true":
+		opts.Provenance = true
+	}
+	switch q.Get("edges") {
+	case "1", "true":
+		opts.Edges = true
+	}
+	switch q.Get("map") {
+	case "1", "true":
+		opts.Map = true
+	}
+	format, err := negotiateFormat(r)
+	if err != nil {
+		return nil, err
+	}
+	opts.Format = format
+	if opts.Version, err = negotiateVersion(r); err != nil {
+		return nil, err
+	}
+	for _, v := range strings.Split(q.Get("source"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			opts.Sources = append(opts.Sources, v)
+		}
+	}
+	for _, v := range strings.Split(q.Get("issn"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if !issnPattern.MatchString(v) {
+			return nil, fmt.Errorf("invalid issn: %s", v)
+		}
+		opts.ISSN = append(opts.ISSN, normalizeHoldingID(v))
+	}
+	if opts.Sort != "" {
+		if _, ok := sortKeys[opts.Sort]; !ok {
+			return nil, fmt.Errorf("invalid sort key: %s", opts.Sort)
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"from", &opts.From},
+		{"until", &opts.Until},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		year, err := strconv.Atoi(v)
+		if err != nil || year < 1 {
+			return nil, fmt.Errorf("invalid year for %s: %s", p.name, v)
+		}
+		*p.dst = year
+	}
+	if opts.From > 0 && opts.Until > 0 && opts.From > opts.Until {
+		return nil, fmt.Errorf("invalid year range: %d-%d", opts.From, opts.Until)
+	}
+	switch opts.Order {
+	case "", "asc", "desc":
+	default:
+		return nil, fmt.Errorf("invalid order: %s", opts.Order)
+	}
+	return opts, nil
+}
+
+// isZero returns true, if the response does not need any post-processing;
+// Debug, Map, Format and Version are not considered here, as they do not change the
+// documents.
+func (o *requestOptions) isZero() bool {
+	return o == nil || (o.Institution == "" && o.Sort == "" && o.Order == "" &&
+		o.From == 0 && o.Until == 0 && len(o.Sources) == 0 && len(o.ISSN) == 0)
+}
+
+// postprocess applies request options to a response.
+func (s *Server) postprocess(ctx context.Context, resp *Response, opts *requestOptions) error {
+	if opts.isZero() {
+		return nil
+	}
+	if opts.Institution != "" {
+		hs, err := s.holdings(ctx, opts.Institution, resp.Citing, resp.Cited)
+		if err != nil {
+			return fmt.Errorf("holdings: %w", err)
+		}
+		resp.applyInstitutionFilter(opts.Institution, hs)
+	}
+	if opts.From > 0 || opts.Until > 0 {
+		resp.applyYearFilter(opts.From, opts.Until)
+	}
+	if len(opts.Sources) > 0 {
+		resp.applySourceFilter(opts.Sources)
+	}
+	if len(opts.ISSN) > 0 {
+		resp.applyISSNFilter(opts.ISSN)
+	}
+	if opts.Sort != "" {
+		scores, err := s.sortScores(ctx, opts.Sort, resp.Citing, resp.Cited)
+		if err != nil {
+			return err
+		}
+		sortDocuments(resp.Citing, opts.Sort, opts.Order, scores)
+		sortDocuments(resp.Cited, opts.Sort, opts.Order, scores)
+	}
+	return nil
+}
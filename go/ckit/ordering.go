@@ -0,0 +1,233 @@
+package ckit
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/set"
+)
+
+// sortKeys are the supported sort keys, with their default order.
+var sortKeys = map[string]string{
+	"year":           "desc", // most recent first
+	"citation_count": "desc", // most cited first
+	"rank":           "desc", // highest PageRank first
+	"title":          "asc",
+}
+
+var yearPattern = regexp.MustCompile(`[12][0-9]{3}`)
+
+// flexStrings decodes a JSON string or an array of strings, as index data
+// fields may be single or multi-valued.
+type flexStrings []string
+
+// UnmarshalJSON decodes a string or an array of strings.
+func (f *flexStrings) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '[' {
+		var ss []string
+		if err := json.Unmarshal(b, &ss); err != nil {
+			return err
+		}
+		*f = ss
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*f = flexStrings{s}
+	return nil
+}
+
+// first returns the first value or the empty string.
+func (f flexStrings) first() string {
+	if len(f) == 0 {
+		return ""
+	}
+	return f[0]
+}
+
+// docSnippet contains the fields of the index metadata relevant for sorting
+// and filtering (following the VuFind SOLR schema).
+type docSnippet struct {
+	ID              string      `json:"id"`
+	SourceID        flexStrings `json:"source_id"`
+	Title           flexStrings `json:"title"`
+	PublishDateSort flexStrings `json:"publishDateSort"`
+	PublishDate     flexStrings `json:"publishDate"`
+	DOI             flexStrings `json:"doi_str_mv"`
+	Institution     flexStrings `json:"institution"`
+	ISSN            flexStrings `json:"issn"`
+}
+
+// year returns the publication year or zero, if none could be found.
+func (s *docSnippet) year() int {
+	for _, v := range append(s.PublishDateSort, s.PublishDate...) {
+		if m := yearPattern.FindString(v); m != "" {
+			year, _ := strconv.Atoi(m)
+			return year
+		}
+	}
+	return 0
+}
+
+// hasSource returns true, if the document belongs to any of the given sources,
+// given as source id (e.g. "49") or local identifier prefix (e.g. "ai-49").
+func (s *docSnippet) hasSource(sources []string) bool {
+	for _, source := range sources {
+		if SliceContains(s.SourceID, source) || strings.HasPrefix(s.ID, source+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// sortDocuments sorts documents in-place by a given key and order; if order
+// is empty, the default order for the key is used. Documents without a value
+// for the key are placed last. Citation counts and ranks are taken from
+// scores by DOI, see sortScores.
+func sortDocuments(docs []json.RawMessage, key, order string, scores map[string]float64) {
+	if order == "" {
+		order = sortKeys[key]
+	}
+	type entry struct {
+		doc     json.RawMessage
+		num     int
+		score   float64
+		str     string
+		missing bool
+	}
+	entries := make([]entry, len(docs))
+	for i, doc := range docs {
+		var snippet docSnippet
+		entries[i].doc = doc
+		if err := json.Unmarshal(doc, &snippet); err != nil {
+			entries[i].missing = true
+			continue
+		}
+		switch key {
+		case "year":
+			entries[i].num = snippet.year()
+			entries[i].missing = entries[i].num == 0
+		case "title":
+			entries[i].str = strings.ToLower(snippet.Title.first())
+			entries[i].missing = entries[i].str == ""
+		case "citation_count":
+			doi := snippet.DOI.first()
+			if doi == "" {
+				entries[i].missing = true
+				continue
+			}
+			entries[i].num = int(scores[doi])
+		case "rank":
+			doi := snippet.DOI.first()
+			if doi == "" {
+				entries[i].missing = true
+				continue
+			}
+			entries[i].score = scores[doi]
+			entries[i].missing = entries[i].score == 0
+		}
+	}
+	less := func(a, b entry) bool {
+		switch key {
+		case "title":
+			return a.str < b.str
+		case "rank":
+			return a.score < b.score
+		}
+		return a.num < b.num
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.missing != b.missing {
+			return !a.missing
+		}
+		if order == "desc" {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	for i := range entries {
+		docs[i] = entries[i].doc
+	}
+}
+
+// sortScores looks up the citation count (number of citing documents) or
+// rank of each distinct DOI in the given documents once, before sorting.
+// Counts and ranks are queried in batches from the counts and rank
+// databases; without a counts database, edges are counted for each DOI,
+// which is slow for large responses. Other sort keys need no scores.
+func (s *Server) sortScores(ctx context.Context, key string, lists ...[]json.RawMessage) (map[string]float64, error) {
+	var query string
+	switch key {
+	case "citation_count":
+		query = "SELECT doi, cited AS score FROM counts WHERE doi IN (?)"
+	case "rank":
+		query = "SELECT doi, score FROM rank WHERE doi IN (?)"
+	default:
+		return nil, nil
+	}
+	var (
+		seen = set.New[string]()
+		dois []string
+	)
+	for _, docs := range lists {
+		for _, doc := range docs {
+			var snippet docSnippet
+			if err := json.Unmarshal(doc, &snippet); err != nil {
+				continue
+			}
+			if doi := snippet.DOI.first(); doi != "" && !seen.Contains(doi) {
+				seen.Add(doi)
+				dois = append(dois, doi)
+			}
+		}
+	}
+	scores := make(map[string]float64, len(dois))
+	if len(dois) == 0 {
+		return scores, nil
+	}
+	var (
+		data = s.data(ctx)
+		db   = data.RankDatabase
+	)
+	if key == "citation_count" {
+		if data.CountsDatabase == nil {
+			for _, doi := range dois {
+				c, err := s.counts(ctx, doi)
+				if err != nil {
+					return nil, err
+				}
+				scores[doi] = float64(c.Cited)
+			}
+			return scores, nil
+		}
+		db = data.CountsDatabase
+	}
+	if db == nil {
+		return scores, nil
+	}
+	for _, batch := range batchedStrings(dois, 500) {
+		q, args, err := sqlx.In(query, batch)
+		if err != nil {
+			return nil, err
+		}
+		var rows []struct {
+			DOI   string  `db:"doi"`
+			Score float64 `db:"score"`
+		}
+		if err := db.SelectContext(ctx, &rows, db.Rebind(q), args...); err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			scores[r.DOI] = r.Score
+		}
+	}
+	return scores, nil
+}
@@ -0,0 +1,90 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestSortDocuments(t *testing.T) {
+	docs := []json.RawMessage{
+		json.RawMessage(`{"id": "a", "title": "Zebra", "publishDate": ["2001"]}`),
+		json.RawMessage(`{"id": "b", "title": "apple", "publishDateSort": "2019"}`),
+		json.RawMessage(`{"id": "c"}`),
+		json.RawMessage(`{"id": "d", "title": "Mango", "publishDate": "ca. 1998"}`),
+	}
+	var cases = []struct {
+		key, order string
+		result     []string
+	}{
+		{"year", "", []string{"b", "a", "d", "c"}},
+		{"year", "asc", []string{"d", "a", "b", "c"}},
+		{"title", "", []string{"b", "d", "a", "c"}},
+		{"title", "desc", []string{"a", "d", "b", "c"}},
+	}
+	for _, c := range cases {
+		sorted := make([]json.RawMessage, len(docs))
+		copy(sorted, docs)
+		sortDocuments(sorted, c.key, c.order, nil)
+		var result []string
+		for _, doc := range sorted {
+			var v struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(doc, &v); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			result = append(result, v.ID)
+		}
+		if !reflect.DeepEqual(result, c.result) {
+			t.Fatalf("[%s %s] got %v, want %v", c.key, c.order, result, c.result)
+		}
+	}
+}
+
+func TestSortScores(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "counts.db")
+	if err := BuildCountsDatabase(output, "testdata/doi_doi.db"); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	oci, err := OpenDatabase("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	countsDB, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var (
+		citing = []json.RawMessage{
+			json.RawMessage(`{"id": "a", "doi_str_mv": ["d0009"]}`),
+			json.RawMessage(`{"id": "b", "doi_str_mv": ["d0029"]}`),
+			json.RawMessage(`{"id": "c"}`),
+		}
+		cited = []json.RawMessage{
+			json.RawMessage(`{"id": "b", "doi_str_mv": ["d0029"]}`),
+		}
+		direct = &Server{OciDatabase: oci}
+		table  = &Server{OciDatabase: oci, CountsDatabase: countsDB}
+	)
+	want, err := direct.sortScores(context.Background(), "citation_count", citing, cited)
+	if err != nil {
+		t.Fatalf("scores: %v", err)
+	}
+	got, err := table.sortScores(context.Background(), "citation_count", citing, cited)
+	if err != nil {
+		t.Fatalf("scores: %v", err)
+	}
+	if len(got) != 2 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// d0009 is cited three times, d0029 twice.
+	sortDocuments(citing, "citation_count", "", got)
+	if !bytes.Contains(citing[0], []byte(`"a"`)) || !bytes.Contains(citing[2], []byte(`"c"`)) {
+		t.Fatalf("unexpected order: %s", citing)
+	}
+}
@@ -0,0 +1,88 @@
+package ckit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// phaseSamples is the number of recent durations kept per phase, for
+// percentiles.
+const phaseSamples = 1024
+
+// PhaseStats reports the time spent in a phase of a request, e.g. "edges",
+// over all successful requests since server start; durations are in
+// seconds. The 95th percentile is taken over the most recent requests.
+type PhaseStats struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean"`
+	P95   float64 `json:"p95"`
+	Max   float64 `json:"max"`
+}
+
+// phaseMetrics aggregates phase durations; the zero value is ready to use.
+type phaseMetrics struct {
+	mu     sync.Mutex
+	phases map[string]*phaseHistory
+}
+
+// phaseHistory holds the totals and a ring of recent durations of a phase.
+type phaseHistory struct {
+	count   int64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+	next    int
+}
+
+// observe adds the phase durations of a single request.
+func (m *phaseMetrics) observe(durations []PhaseDuration) {
+	if len(durations) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.phases == nil {
+		m.phases = make(map[string]*phaseHistory)
+	}
+	for _, pd := range durations {
+		h, ok := m.phases[pd.Phase]
+		if !ok {
+			h = &phaseHistory{}
+			m.phases[pd.Phase] = h
+		}
+		h.count++
+		h.total += pd.Duration
+		if pd.Duration > h.max {
+			h.max = pd.Duration
+		}
+		if len(h.samples) < phaseSamples {
+			h.samples = append(h.samples, pd.Duration)
+		} else {
+			h.samples[h.next] = pd.Duration
+			h.next = (h.next + 1) % phaseSamples
+		}
+	}
+}
+
+// stats returns the statistics per phase, nil, if nothing was observed.
+func (m *phaseMetrics) stats() map[string]PhaseStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.phases) == 0 {
+		return nil
+	}
+	result := make(map[string]PhaseStats, len(m.phases))
+	for phase, h := range m.phases {
+		samples := make([]time.Duration, len(h.samples))
+		copy(samples, h.samples)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		result[phase] = PhaseStats{
+			Count: h.count,
+			Mean:  (h.total / time.Duration(h.count)).Seconds(),
+			P95:   samples[(len(samples)-1)*95/100].Seconds(),
+			Max:   h.max.Seconds(),
+		}
+	}
+	return result
+}
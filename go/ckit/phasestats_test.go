@@ -0,0 +1,77 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestPhaseMetrics(t *testing.T) {
+	var m phaseMetrics
+	if st := m.stats(); st != nil {
+		t.Fatalf("got %v, want nil", st)
+	}
+	for i := 1; i <= 2000; i++ {
+		m.observe([]PhaseDuration{
+			{Phase: phaseEdges, Duration: time.Duration(i) * time.Millisecond},
+			{Phase: phaseFetch, Duration: time.Second},
+		})
+	}
+	st := m.stats()
+	if len(st) != 2 || st[phaseEdges].Count != 2000 || st[phaseFetch].Mean != 1 {
+		t.Fatalf("got %+v, want two phases", st)
+	}
+	// The percentile covers the most recent 1024 durations, 977ms to 2s.
+	if p95 := st[phaseEdges].P95; p95 < 1.9 || p95 > 1.96 || st[phaseEdges].Max != 2 {
+		t.Fatalf("got %+v, want p95 of recent durations", st[phaseEdges])
+	}
+}
+
+func TestStopWatchTrackPhases(t *testing.T) {
+	var sw StopWatch
+	sw.SetEnabled(false)
+	sw.TrackPhases()
+	sw.Recordf("started")
+	sw.RecordPhasef(phaseFetch, "fetched part")
+	sw.RecordPhasef(phaseFetch, "fetched rest")
+	sw.RecordPhasef(phaseEncode, "encoded")
+	if len(sw.Entries()) != 0 {
+		t.Fatalf("disabled stopwatch must not record messages")
+	}
+	if pd := sw.PhaseDurations(); len(pd) != 2 || pd[0].Phase != phaseFetch || pd[1].Phase != phaseEncode {
+		t.Fatalf("got %+v, want fetch and encode", pd)
+	}
+}
+
+func TestServerPhaseStats(t *testing.T) {
+	srv := newTestServer(t)
+	mustRequest(t, srv, "/id/i0029")
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/stats", nil))
+	var data struct {
+		Phases map[string]PhaseStats `json:"phases"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &data); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, phase := range []string{phaseLookup, phaseEdges, phaseMap, phaseFetch, phaseEncode} {
+		if data.Phases[phase].Count != 1 {
+			t.Fatalf("got %+v, want one request in phase %s", data.Phases, phase)
+		}
+	}
+	// Adding the id map is a phase of its own.
+	if _, ok := data.Phases[phaseIDMap]; ok {
+		t.Fatalf("got phase %s, want none without map=1", phaseIDMap)
+	}
+	mustRequest(t, srv, "/id/i0029?map=1")
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/stats", nil))
+	if err := json.Unmarshal(rr.Body.Bytes(), &data); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if data.Phases[phaseIDMap].Count != 1 || data.Phases[phaseMap].Count != 2 {
+		t.Fatalf("got %+v, want one request in phase %s and two in %s", data.Phases, phaseIDMap, phaseMap)
+	}
+}
@@ -0,0 +1,158 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+// ProgressInterval is the minimum time between two progress events, so
+// cheap requests only yield a result event.
+var ProgressInterval = 250 * time.Millisecond
+
+// Progress is a progress event for a request, sent at the end of a
+// processing stage and periodically while fetching index data.
+type Progress struct {
+	Stage   string  `json:"stage"`             // estimate, edges, mapped, fetch
+	Citing  int     `json:"citing,omitempty"`  // number of outbound edges
+	Cited   int     `json:"cited,omitempty"`   // number of inbound edges
+	Matched int     `json:"matched,omitempty"` // number of documents in the index
+	Fetched int     `json:"fetched,omitempty"` // documents fetched so far
+	Elapsed float64 `json:"elapsed"`           // seconds since the request started
+}
+
+type progressKey struct{}
+
+// progressReporter forwards progress events to a function, throttled by
+// ProgressInterval; stage changes are always reported.
+type progressReporter struct {
+	mu      sync.Mutex
+	started time.Time
+	last    time.Time
+	stage   string
+	f       func(Progress)
+}
+
+// withProgress returns a context, which receives progress events.
+func withProgress(ctx context.Context, f func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progressReporter{started: time.Now(), f: f})
+}
+
+// progressFromContext returns the progress reporter of a context, or nil.
+func progressFromContext(ctx context.Context) *progressReporter {
+	p, _ := ctx.Value(progressKey{}).(*progressReporter)
+	return p
+}
+
+// report sends a progress event; a nil reporter does nothing.
+func (p *progressReporter) report(e Progress) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e.Stage == p.stage && time.Since(p.last) < ProgressInterval {
+		return
+	}
+	p.stage, p.last = e.Stage, time.Now()
+	e.Elapsed = time.Since(p.started).Seconds()
+	p.f(e)
+}
+
+// handleEvents serves a request for a local identifier as server-sent events
+// (text/event-stream): "progress" events while the response is assembled,
+// followed by a single "result" event with the response (same as /id/{id},
+// including request options) or an "error" event with status and message.
+func (s *Server) handleEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			httpErrLogf(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		var (
+			id     = mux.Vars(r)["id"]
+			events = make(chan Progress, 16)
+			done   = make(chan *httptest.ResponseRecorder)
+			ctx    = withProgress(r.Context(), func(p Progress) {
+				select {
+				case events <- p:
+				default: // drop events for slow clients
+				}
+			})
+		)
+		// Estimate the work from precomputed counts, if available.
+		if s.data(ctx).CountsDatabase != nil {
+			if doi, err := s.lookupDOI(ctx, id); err == nil {
+				if c, err := s.counts(ctx, doi); err == nil {
+					progressFromContext(ctx).report(Progress{Stage: "estimate", Citing: c.Citing, Cited: c.Cited})
+				}
+			}
+		}
+		link := "/id/" + url.PathEscape(id)
+		if r.URL.RawQuery != "" {
+			link += "?" + r.URL.RawQuery
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+		if err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+		go func() {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			done <- rr
+		}()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // nginx
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case p := <-events:
+				b, err := json.Marshal(p)
+				if err != nil {
+					continue
+				}
+				writeEvent(w, "progress", b)
+				flusher.Flush()
+			case rr := <-done:
+				// Events sent before completion come first.
+				for len(events) > 0 {
+					if b, err := json.Marshal(<-events); err == nil {
+						writeEvent(w, "progress", b)
+					}
+				}
+				body := bytes.TrimSpace(rr.Body.Bytes())
+				switch {
+				case rr.Code == http.StatusOK:
+					writeEvent(w, "result", body)
+				case len(body) == 0:
+					writeEvent(w, "error", []byte(fmt.Sprintf(`{"status": %d}`, rr.Code)))
+				default:
+					writeEvent(w, "error", body)
+				}
+				flusher.Flush()
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes a server-sent event, with one data field per line.
+func writeEvent(w http.ResponseWriter, event string, data []byte) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
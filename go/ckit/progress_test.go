@@ -0,0 +1,80 @@
+package ckit
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sse is a parsed server-sent event.
+type sse struct {
+	event string
+	data  string
+}
+
+func parseEvents(t *testing.T, body string) (events []sse) {
+	var (
+		sc  = bufio.NewScanner(strings.NewReader(body))
+		cur sse
+	)
+	sc.Buffer(make([]byte, 1<<20), 1<<24)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			events = append(events, cur)
+			cur = sse{}
+		case strings.HasPrefix(line, "event: "):
+			cur.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if cur.data != "" {
+				cur.data += "\n"
+			}
+			cur.data += strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line: %s", line)
+		}
+	}
+	return events
+}
+
+func TestServerEvents(t *testing.T) {
+	saved := ProgressInterval
+	defer func() { ProgressInterval = saved }()
+	// Only report stage changes.
+	ProgressInterval = time.Hour
+	srv := newTestServer(t)
+	var cases = []struct {
+		target  string
+		stages  []string
+		final   string
+		content string
+	}{
+		{"/id/i0029/events", []string{"edges", "mapped", "fetch"}, "result", `"doi":"d0029"`},
+		{"/id/i0029/events?format=xml", []string{"edges", "mapped", "fetch"}, "result", "<response>"},
+		{"/id/i0029/events?sort=xxx", nil, "error", `"status":400`},
+		{"/id/xxx/events", nil, "error", `"status":404`},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if got := rr.Header().Get("Content-Type"); got != "text/event-stream" {
+			t.Fatalf("%s: got %s, want text/event-stream", c.target, got)
+		}
+		events := parseEvents(t, rr.Body.String())
+		if len(events) != len(c.stages)+1 {
+			t.Fatalf("%s: got %d events, want %d: %v", c.target, len(events), len(c.stages)+1, events)
+		}
+		for i, stage := range c.stages {
+			if events[i].event != "progress" || !strings.Contains(events[i].data, `"stage":"`+stage+`"`) {
+				t.Fatalf("%s: got %v, want %s progress", c.target, events[i], stage)
+			}
+		}
+		last := events[len(events)-1]
+		if last.event != c.final || !strings.Contains(strings.ReplaceAll(last.data, " ", ""), c.content) {
+			t.Fatalf("%s: got %v, want %s with %s", c.target, last, c.final, c.content)
+		}
+	}
+}
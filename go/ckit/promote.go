@@ -0,0 +1,354 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+// sqliteHeader starts every sqlite3 database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Promotion switches a running server to a new snapshot of its datasets,
+// i.e. a directory with all database files, blue/green style. The server
+// opens its databases through a symlink to the active snapshot, e.g.
+// /data/current, as in "labed -i /data/current/i.db -o /data/current/o.db
+// ..."; the symlink is replaced atomically and the server reloads. The
+// previously active snapshot is kept as a second symlink with a .previous
+// suffix, so a rollback is just another switch.
+type Promotion struct {
+	Current string       // symlink to the active snapshot, e.g. /data/current
+	Admin   string       // admin base URL of the server, e.g. http://localhost:8001
+	Server  string       // API base URL, for warming the cache, e.g. http://localhost:8000
+	Client  *http.Client // uses http.DefaultClient, if nil
+	Flush   bool         // flush the cache on reload, as cached responses are stale
+	WarmIDs []string     // identifiers to request after the switch (optional)
+	Workers int          // number of parallel warming requests
+}
+
+// PromotionReport describes a promotion or rollback.
+type PromotionReport struct {
+	Previous   string        // snapshot active before
+	Current    string        // snapshot active now
+	Validation *Report       // checks of the new snapshot
+	Reload     *ReloadReport // as reported by the server
+	Warm       *WarmStats    // nil, if there was nothing to warm
+}
+
+// Promote validates the snapshot in dir against the active snapshot,
+// switches the server over to it and warms the cache. If the server fails
+// to reload, the symlinks are restored; the server keeps its datasets in
+// this case.
+func (p *Promotion) Promote(ctx context.Context, dir string) (*PromotionReport, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	active, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	if active == dir {
+		return nil, fmt.Errorf("snapshot already active: %s", dir)
+	}
+	report := &PromotionReport{Previous: active, Validation: &Report{}}
+	DiagnoseSnapshot(report.Validation, dir, active)
+	if report.Validation.Failed() {
+		return report, fmt.Errorf("snapshot failed validation: %s", dir)
+	}
+	return report, p.switchTo(ctx, report, dir)
+}
+
+// Rollback switches the server back to the previous snapshot; the current
+// one becomes the previous one, so a second rollback reverts the first.
+func (p *Promotion) Rollback(ctx context.Context) (*PromotionReport, error) {
+	previous, err := os.Readlink(p.previousLink())
+	if err != nil {
+		return nil, fmt.Errorf("no previous snapshot: %w", err)
+	}
+	active, err := p.active()
+	if err != nil {
+		return nil, err
+	}
+	report := &PromotionReport{Previous: active}
+	return report, p.switchTo(ctx, report, previous)
+}
+
+// active returns the directory the symlink points to, or an empty string, if
+// there is no symlink yet.
+func (p *Promotion) active() (string, error) {
+	target, err := os.Readlink(p.Current)
+	switch {
+	case os.IsNotExist(err):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("current snapshot must be a symlink: %w", err)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(p.Current), target)
+	}
+	return target, nil
+}
+
+// previousLink returns the path of the symlink to the previous snapshot.
+func (p *Promotion) previousLink() string {
+	return p.Current + ".previous"
+}
+
+// switchTo points the symlink to dir, reloads the server and warms the
+// cache.
+func (p *Promotion) switchTo(ctx context.Context, report *PromotionReport, dir string) (err error) {
+	if err := SwitchSymlink(p.Current, dir); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil || report.Reload != nil {
+			return
+		}
+		if report.Previous == "" {
+			os.Remove(p.Current)
+		} else if rerr := SwitchSymlink(p.Current, report.Previous); rerr != nil {
+			err = fmt.Errorf("%w, and could not restore %s: %v", err, p.Current, rerr)
+		}
+	}()
+	if report.Reload, err = p.reload(ctx); err != nil {
+		return err
+	}
+	report.Current = dir
+	if report.Previous != "" {
+		if err := SwitchSymlink(p.previousLink(), report.Previous); err != nil {
+			return err
+		}
+	}
+	if len(p.WarmIDs) == 0 || p.Server == "" {
+		return nil
+	}
+	w := &Warmer{Server: p.Server, Client: p.Client, Workers: p.Workers}
+	report.Warm, err = w.Run(ctx, strings.NewReader(strings.Join(p.WarmIDs, "\n")))
+	return err
+}
+
+// reload asks the server to reload its datasets.
+func (p *Promotion) reload(ctx context.Context) (*ReloadReport, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	link := strings.TrimRight(p.Admin, "/") + "/admin/reload"
+	if p.Flush {
+		link += "?flush=1"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reload: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	var report ReloadReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+	return &report, nil
+}
+
+// SwitchSymlink points a symlink to a target atomically, by renaming a new
+// symlink over the old one; readers see either the old or the new target.
+func SwitchSymlink(link, target string) error {
+	tmp := link + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// DiagnoseSnapshot checks the files of a new snapshot before it is
+// promoted: each file of the active snapshot (if any) needs to be present,
+// sqlite3 databases need to open and to contain at least the tables and
+// indexes of their active counterpart; map databases are validated and
+// queried, which also brings parts of the new files into the page cache.
+func DiagnoseSnapshot(r *Report, dir, active string) {
+	files, err := snapshotFiles(dir)
+	if err != nil {
+		r.Fail("snapshot", "pass the directory with the new databases", "%v", err)
+		return
+	}
+	if len(files) == 0 {
+		r.Fail("snapshot", "pass the directory with the new databases", "no files in %s", dir)
+		return
+	}
+	if active != "" {
+		previous, err := snapshotFiles(active)
+		if err != nil {
+			r.Fail("snapshot", "check the current symlink", "active snapshot: %v", err)
+			return
+		}
+		for _, name := range previous {
+			if !SliceContains(files, name) {
+				r.Fail(name, "copy the file into the new snapshot, the server opens it on reload",
+					"missing in %s", dir)
+			}
+		}
+	}
+	for _, name := range files {
+		var counterpart string
+		if active != "" {
+			counterpart = filepath.Join(active, name)
+		}
+		diagnoseSnapshotFile(r, name, filepath.Join(dir, name), counterpart)
+	}
+}
+
+// snapshotFiles returns the names of the regular files in a directory,
+// sorted; hidden files, like leftovers from a copy, are ignored.
+func snapshotFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// diagnoseSnapshotFile checks a single file of a new snapshot, comparing
+// sqlite3 databases to their active counterpart, if there is one.
+func diagnoseSnapshotFile(r *Report, name, path, counterpart string) {
+	fi, err := os.Stat(path)
+	switch {
+	case err != nil:
+		r.Fail(name, "check file permissions", "%v", err)
+		return
+	case fi.Size() == 0:
+		r.Fail(name, "the file is empty, copy or regenerate it", "empty file: %s", path)
+		return
+	}
+	if ok, err := isSqliteFile(path); err != nil {
+		r.Fail(name, "check file permissions", "%v", err)
+		return
+	} else if !ok {
+		r.OK(name, "found %s (%s)", path, tabutils.ByteSize(int(fi.Size())))
+		return
+	}
+	db, err := OpenDatabase(path)
+	if err != nil {
+		r.Fail(name, "regenerate the database", "%v", err)
+		return
+	}
+	defer db.Close()
+	objects, err := sqliteObjects(db)
+	if err != nil {
+		r.Fail(name, "the file may be truncated, copy or regenerate it", "schema: %v", err)
+		return
+	}
+	if counterpart != "" {
+		if ok, _ := isSqliteFile(counterpart); ok {
+			if missing, err := missingObjects(counterpart, objects); err != nil {
+				r.Warn(name, "", "active database: %v", err)
+			} else if len(missing) > 0 {
+				r.Fail(name, "create the same tables and indexes as in the active database",
+					"missing %s", strings.Join(missing, ", "))
+				return
+			}
+		}
+	}
+	if !SliceContains(objects, "table map") {
+		r.OK(name, "found %s (%s), %d tables and indexes", path, tabutils.ByteSize(int(fi.Size())), len(objects))
+		return
+	}
+	var indexes []string
+	for _, v := range objects {
+		if strings.HasPrefix(v, "index idx_") {
+			indexes = append(indexes, strings.TrimPrefix(v, "index "))
+		}
+	}
+	if err := ValidateMapDatabase(db, indexes, false); err != nil {
+		r.Fail(name, validationHint(path, err), "%v", err)
+		return
+	}
+	r.OK(name, "found %s (%s), schema and indexes %v", path, tabutils.ByteSize(int(fi.Size())), indexes)
+	diagnoseLookup(r, name, db)
+}
+
+// isSqliteFile returns true, if a file starts with the sqlite3 header.
+func isSqliteFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	b := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, b); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(b, sqliteHeader), nil
+}
+
+// sqliteObjects returns the tables and indexes of a database, like "table
+// map" or "index idx_k", sorted.
+func sqliteObjects(db *sqlx.DB) ([]string, error) {
+	var objects []string
+	err := db.Select(&objects, `
+		SELECT type || ' ' || name FROM sqlite_master
+		WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%'
+		ORDER BY type, name`)
+	return objects, err
+}
+
+// missingObjects returns the tables and indexes of the database at path,
+// which are not in objects.
+func missingObjects(path string, objects []string) (missing []string, err error) {
+	db, err := OpenDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	required, err := sqliteObjects(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range required {
+		if !SliceContains(objects, v) {
+			missing = append(missing, v)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,110 @@
+package ckit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// writeSnapshot creates a snapshot directory with a citation database and
+// an additional file.
+func writeSnapshot(t *testing.T, dir string) string {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	w, err := NewCociWriter(filepath.Join(dir, "o.db"), false)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	if err := w.ReadCSV(strings.NewReader("01-02,10.1/a,10.1/b\n")); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci.bloom"), []byte("x"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return dir
+}
+
+func TestPromotion(t *testing.T) {
+	var (
+		base    = t.TempDir()
+		blue    = writeSnapshot(t, filepath.Join(base, "blue"))
+		green   = writeSnapshot(t, filepath.Join(base, "green"))
+		broken  = writeSnapshot(t, filepath.Join(base, "broken"))
+		current = filepath.Join(base, "current")
+		reloads int32
+		status  int32 = 200
+	)
+	// Missing index in the broken snapshot.
+	db, err := sqlx.Open("sqlite3", filepath.Join(broken, "o.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := db.Exec("DROP INDEX idx_v"); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	db.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/admin/reload" || r.URL.Query().Get("flush") != "1" {
+			http.Error(w, "unexpected request", 400)
+			return
+		}
+		atomic.AddInt32(&reloads, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		w.Write([]byte(`{"changed": ["oci"]}`))
+	}))
+	defer ts.Close()
+	p := &Promotion{Current: current, Admin: ts.URL, Flush: true}
+	active := func() string {
+		target, _ := os.Readlink(current)
+		return target
+	}
+	ctx := context.Background()
+	if _, err := p.Promote(ctx, blue); err != nil || active() != blue {
+		t.Fatalf("got %v, %s, want blue active", err, active())
+	}
+	report, err := p.Promote(ctx, green)
+	if err != nil || active() != green || report.Previous != blue || len(report.Reload.Changed) != 1 {
+		t.Fatalf("got %v, %s, %+v, want green active", err, active(), report)
+	}
+	if previous, _ := os.Readlink(current + ".previous"); previous != blue {
+		t.Fatalf("got previous %s, want blue", previous)
+	}
+	if _, err := p.Promote(ctx, green); err == nil {
+		t.Fatalf("got nil, want error for active snapshot")
+	}
+	report, err = p.Promote(ctx, broken)
+	if err == nil || !report.Validation.Failed() || active() != green {
+		t.Fatalf("got %v, %s, want failed validation", err, active())
+	}
+	os.Remove(filepath.Join(blue, "oci.bloom"))
+	if report, err = p.Promote(ctx, blue); err == nil || !report.Validation.Failed() {
+		t.Fatalf("got %v, want failed validation for missing file", err)
+	}
+	os.WriteFile(filepath.Join(blue, "oci.bloom"), []byte("x"), 0644)
+	// The symlink is restored, if the server fails to reload.
+	atomic.StoreInt32(&status, 500)
+	if _, err := p.Promote(ctx, blue); err == nil || active() != green {
+		t.Fatalf("got %v, %s, want green active after failed reload", err, active())
+	}
+	atomic.StoreInt32(&status, 200)
+	if report, err := p.Rollback(ctx); err != nil || active() != blue || report.Previous != green {
+		t.Fatalf("got %v, %s, want blue active after rollback", err, active())
+	}
+	if _, err := p.Rollback(ctx); err != nil || active() != green {
+		t.Fatalf("got %v, %s, want green active after second rollback", err, active())
+	}
+	if n := atomic.LoadInt32(&reloads); n != 5 {
+		t.Fatalf("got %d reloads, want 5", n)
+	}
+}
@@ -0,0 +1,27 @@
+package ckit
+
+// Provenance tells where a document in a response came from: the backend,
+// which served the index data (e.g. "sqlite:index.db", "lru" for the memory
+// cache) and the citation databases, which contain the edge.
+type Provenance struct {
+	Blob  string   `json:"blob"`
+	Edges []string `json:"edges"`
+}
+
+// addProvenance records the provenance of a document.
+func (r *Response) addProvenance(id, blob string, edges []string) {
+	if r.Extra.Provenance == nil {
+		r.Extra.Provenance = make(map[string]Provenance)
+	}
+	r.Extra.Provenance[id] = Provenance{Blob: blob, Edges: edges}
+}
+
+// edgeSources returns the names of the citation databases, which contain an
+// edge between the requested document and a related DOI. With a single
+// citation database, this is the primary database.
+func (r *Response) edgeSources(doi string) []string {
+	if v, ok := r.Extra.Sources[doi]; ok {
+		return v
+	}
+	return []string{PrimaryOciSourceName}
+}
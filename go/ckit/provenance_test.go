@@ -0,0 +1,58 @@
+package ckit
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestProvenance(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv.Cache = c
+	for i := 0; i < 2; i++ {
+		resp := mustRequest(t, srv, "/id/i0029?provenance=1")
+		if resp.Extra.Cached {
+			t.Fatalf("got cached response, want fresh response")
+		}
+		if len(resp.Extra.Provenance) == 0 {
+			t.Fatalf("got no provenance")
+		}
+		want := Provenance{Blob: "sqlite:id_metadata.db", Edges: []string{PrimaryOciSourceName}}
+		for id, v := range resp.Extra.Provenance {
+			if !reflect.DeepEqual(v, want) {
+				t.Fatalf("%s: got %v, want %v", id, v, want)
+			}
+		}
+	}
+	// Responses with provenance are not cached.
+	if _, err := c.Get("i0029"); err != cache.ErrCacheMiss {
+		t.Fatalf("got %v, want cache miss", err)
+	}
+	if resp := mustRequest(t, srv, "/id/i0029"); resp.Extra.Provenance != nil {
+		t.Fatalf("got provenance %v, want none", resp.Extra.Provenance)
+	}
+}
+
+func TestFetchSource(t *testing.T) {
+	g := &FetchGroup{}
+	if err := g.FromFiles("testdata/id_metadata.db"); err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	f := NewLRUFetcher(&TransformFetcher{Fetcher: g}, 1<<20)
+	for _, want := range []string{"sqlite:id_metadata.db", "lru"} {
+		_, source, err := fetchSource(f, "i0029")
+		if err != nil {
+			t.Fatalf("fetch: %v", err)
+		}
+		if source != want {
+			t.Fatalf("got %s, want %s", source, want)
+		}
+	}
+}
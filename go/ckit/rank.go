@@ -0,0 +1,190 @@
+package ckit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// rankSchema is the schema of the auxiliary rank table; score is the
+// PageRank of a DOI in the citation graph, scores sum up to one.
+const rankSchema = `
+CREATE TABLE IF NOT EXISTS rank (
+	doi TEXT PRIMARY KEY,
+	score REAL NOT NULL
+) WITHOUT ROWID;`
+
+// PageRank configures the PageRank computation.
+type PageRank struct {
+	Damping    float64 // usually 0.85
+	Iterations int     // maximum number of iterations
+	Tolerance  float64 // stop, if the L1 change of scores falls below this value
+}
+
+// DefaultPageRank are the defaults for PageRank.
+var DefaultPageRank = PageRank{Damping: 0.85, Iterations: 50, Tolerance: 1e-9}
+
+// Compute runs PageRank over a graph of n nodes, with edges from src[i] to
+// dst[i] (citing to cited). The rank of dangling nodes (without outbound
+// edges) is distributed over all nodes. Returns the scores and the number of
+// iterations run.
+func (p PageRank) Compute(n int, src, dst []uint32) ([]float64, int) {
+	if n == 0 {
+		return nil, 0
+	}
+	var (
+		outdeg = make([]uint32, n)
+		rank   = make([]float64, n)
+		next   = make([]float64, n)
+		i      int
+	)
+	for _, u := range src {
+		outdeg[u]++
+	}
+	for j := range rank {
+		rank[j] = 1 / float64(n)
+	}
+	for i = 1; i <= p.Iterations; i++ {
+		var dangling float64
+		for j, r := range rank {
+			if outdeg[j] == 0 {
+				dangling += r
+			}
+		}
+		base := (1-p.Damping)/float64(n) + p.Damping*dangling/float64(n)
+		for j := range next {
+			next[j] = base
+		}
+		for k, u := range src {
+			next[dst[k]] += p.Damping * rank[u] / float64(outdeg[u])
+		}
+		var delta float64
+		for j := range rank {
+			delta += math.Abs(next[j] - rank[j])
+		}
+		rank, next = next, rank
+		if delta < p.Tolerance {
+			break
+		}
+	}
+	if i > p.Iterations {
+		i = p.Iterations
+	}
+	return rank, i
+}
+
+// BuildRankDatabase computes PageRank over all edges of a citation database
+// (as generated by makta) and stores the scores in a "rank" table in an
+// sqlite3 database at output. The graph is held in memory with 8 bytes per
+// edge plus the DOI, so this needs a machine with lots of RAM for the full
+// OCI dump.
+func BuildRankDatabase(ociPath, output string, p PageRank) error {
+	oci, err := sqlx.Open("sqlite3", "file:"+ociPath+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer oci.Close()
+	var (
+		started = time.Now()
+		ids     = make(map[string]uint32)
+		dois    []string
+		src     []uint32
+		dst     []uint32
+		id      = func(doi string) uint32 {
+			if v, ok := ids[doi]; ok {
+				return v
+			}
+			v := uint32(len(dois))
+			ids[doi] = v
+			dois = append(dois, doi)
+			return v
+		}
+	)
+	rows, err := oci.Query("SELECT k, v FROM map")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		src, dst = append(src, id(k)), append(dst, id(v))
+		if len(src)%100000000 == 0 {
+			log.Printf("[..] rank: read %d edges, %d nodes", len(src), len(dois))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	ids = nil // not needed anymore
+	log.Printf("[ok] rank: read %d edges, %d nodes (%s)", len(src), len(dois), time.Since(started))
+	t := time.Now()
+	rank, iterations := p.Compute(len(dois), src, dst)
+	log.Printf("[ok] rank: %d iterations (%s)", iterations, time.Since(t))
+	return writeRankDatabase(output, dois, rank)
+}
+
+// writeRankDatabase writes scores into a rank table, replacing previous data.
+func writeRankDatabase(output string, dois []string, rank []float64) error {
+	db, err := sqlx.Open("sqlite3", output)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	t := time.Now()
+	for _, q := range []string{"PRAGMA journal_mode = OFF", "PRAGMA synchronous = 0", rankSchema, "DELETE FROM rank"} {
+		if _, err := db.Exec(q); err != nil {
+			return err
+		}
+	}
+	const batchSize = 100000
+	for b := 0; b < len(dois); b += batchSize {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare("INSERT INTO rank (doi, score) VALUES (?, ?)")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for j := b; j < len(dois) && j < b+batchSize; j++ {
+			if _, err := stmt.Exec(dois[j], rank[j]); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		stmt.Close()
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	log.Printf("[ok] rank: wrote %d scores (%s)", len(dois), time.Since(t))
+	return nil
+}
+
+// rank returns the PageRank score for a DOI, or zero, if there is no rank
+// database or no score.
+func (s *Server) rank(ctx context.Context, doi string) (float64, error) {
+	db := s.data(ctx).RankDatabase
+	if db == nil {
+		return 0, nil
+	}
+	stmt, err := s.stmts.get(db, "SELECT score FROM rank WHERE doi = ?")
+	if err != nil {
+		return 0, fmt.Errorf("prepare: %w", err)
+	}
+	var score float64
+	err = stmt.GetContext(ctx, &score, doi)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return score, err
+}
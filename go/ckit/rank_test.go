@@ -0,0 +1,70 @@
+package ckit
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestPageRankCompute(t *testing.T) {
+	var cases = []struct {
+		about    string
+		n        int
+		src, dst []uint32
+		want     []float64
+	}{
+		{"empty", 0, nil, nil, nil},
+		{"cycle", 3, []uint32{0, 1, 2}, []uint32{1, 2, 0}, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		// Two dangling nodes citing nothing, one cited by both.
+		{"star", 3, []uint32{1, 2}, []uint32{0, 0}, nil},
+	}
+	for _, c := range cases {
+		rank, _ := DefaultPageRank.Compute(c.n, c.src, c.dst)
+		if len(rank) != c.n {
+			t.Fatalf("[%s] got %d scores, want %d", c.about, len(rank), c.n)
+		}
+		var sum float64
+		for _, v := range rank {
+			sum += v
+		}
+		if c.n > 0 && math.Abs(sum-1) > 1e-6 {
+			t.Fatalf("[%s] scores sum up to %v, want 1", c.about, sum)
+		}
+		for i, v := range c.want {
+			if math.Abs(rank[i]-v) > 1e-6 {
+				t.Fatalf("[%s] got %v, want %v", c.about, rank, c.want)
+			}
+		}
+		if c.about == "star" && (rank[0] <= rank[1] || rank[1] != rank[2]) {
+			t.Fatalf("[%s] cited node must rank highest: %v", c.about, rank)
+		}
+	}
+}
+
+func TestServerSortByRank(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "rank.db")
+	if err := BuildRankDatabase("testdata/doi_doi.db", output, DefaultPageRank); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	db, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var count int
+	if err := db.Get(&count, "SELECT count(*) FROM rank"); err != nil || count == 0 {
+		t.Fatalf("got %d, %v, want scores", count, err)
+	}
+	srv := newTestServer(t)
+	srv.RankDatabase = db
+	score, err := srv.rank(context.Background(), "d0029")
+	if err != nil || score == 0 {
+		t.Fatalf("got %v, %v, want score", score, err)
+	}
+	if score, err = srv.rank(context.Background(), "xxx"); err != nil || score != 0 {
+		t.Fatalf("got %v, %v, want zero for unknown DOI", score, err)
+	}
+	// Fixture documents have no DOI field, so only check that sorting works.
+	mustRequest(t, srv, "/id/i0029?sort=rank")
+}
@@ -0,0 +1,34 @@
+package ckit
+
+import "sort"
+
+// RawEdge is a citation as found in the citation databases, whether or not
+// the citing and cited DOI match local records.
+type RawEdge struct {
+	Citing string `json:"citing"`
+	Cited  string `json:"cited"`
+}
+
+// setRawEdges records the edges a response is built from, sorted by citing
+// and cited DOI; a self-citation, found as citing and cited edge, is listed
+// once.
+func (r *Response) setRawEdges(citing, cited []Map) {
+	seen := make(map[RawEdge]bool, len(citing)+len(cited))
+	for _, edges := range [][]Map{citing, cited} {
+		for _, m := range edges {
+			e := RawEdge{Citing: m.Key, Cited: m.Value}
+			if seen[e] {
+				continue
+			}
+			seen[e] = true
+			r.Extra.Edges = append(r.Extra.Edges, e)
+		}
+	}
+	sort.Slice(r.Extra.Edges, func(i, j int) bool {
+		a, b := r.Extra.Edges[i], r.Extra.Edges[j]
+		if a.Citing != b.Citing {
+			return a.Citing < b.Citing
+		}
+		return a.Cited < b.Cited
+	})
+}
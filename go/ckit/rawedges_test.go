@@ -0,0 +1,44 @@
+package ckit
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestRawEdges(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	// Edges include the unmatched d0156 and are listed once, even if
+	// duplicated in the citation database.
+	want := []RawEdge{
+		{"d0029", "d0009"},
+		{"d0029", "d0039"},
+		{"d0029", "d0065"},
+		{"d0069", "d0029"},
+		{"d0156", "d0029"},
+	}
+	resp := mustRequest(t, srv, "/id/i0029?edges=1")
+	if !reflect.DeepEqual(resp.Extra.Edges, want) {
+		t.Fatalf("got %v, want %v", resp.Extra.Edges, want)
+	}
+	if _, err := c.Get("i0029"); err != cache.ErrCacheMiss {
+		t.Fatalf("got %v, want response with edges not cached", err)
+	}
+	// Without the option, there are no edges, also not from the cache.
+	for i := 0; i < 2; i++ {
+		if resp := mustRequest(t, srv, "/id/i0029"); resp.Extra.Edges != nil {
+			t.Fatalf("got %v, want no edges", resp.Extra.Edges)
+		}
+	}
+	if resp := mustRequest(t, srv, "/id/i0029?edges=1"); !reflect.DeepEqual(resp.Extra.Edges, want) {
+		t.Fatalf("got %v, want %v from fresh response", resp.Extra.Edges, want)
+	}
+}
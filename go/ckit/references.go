@@ -0,0 +1,337 @@
+package ckit
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+const (
+	// DefaultHarvestRows is the number of records requested per page.
+	DefaultHarvestRows = 1000
+	// harvestRetries is the number of attempts per page.
+	harvestRetries = 3
+	// harvestLogInterval is the number of pages between progress logs.
+	harvestLogInterval = 100
+)
+
+// Relation types of DataCite related identifiers, which are citations: the
+// record cites the related identifier or is cited by it.
+var (
+	dataciteCites   = []string{"Cites", "References"}
+	dataciteCitedBy = []string{"IsCitedBy", "IsReferencedBy"}
+)
+
+// crossrefReferences contains the DOI and the references of a Crossref work.
+type crossrefReferences struct {
+	DOI       string `json:"DOI"`
+	Reference []struct {
+		DOI string `json:"DOI"`
+	} `json:"reference"`
+}
+
+// dataciteReferences contains the DOI and the related identifiers of a
+// DataCite record.
+type dataciteReferences struct {
+	Attributes struct {
+		DOI                string `json:"doi"`
+		RelatedIdentifiers []struct {
+			RelatedIdentifier     string `json:"relatedIdentifier"`
+			RelatedIdentifierType string `json:"relatedIdentifierType"`
+			RelationType          string `json:"relationType"`
+		} `json:"relatedIdentifiers"`
+	} `json:"attributes"`
+}
+
+// writeCrossrefWork writes the references of a work, which have a DOI.
+func (w *CociWriter) writeCrossrefWork(work *crossrefReferences) error {
+	for _, ref := range work.Reference {
+		if ref.DOI == "" {
+			continue
+		}
+		if err := w.WriteEdge(work.DOI, ref.DOI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDataCiteRecord writes the citations among the related identifiers of
+// a record, in either direction.
+func (w *CociWriter) writeDataCiteRecord(record *dataciteReferences) error {
+	doi := record.Attributes.DOI
+	for _, rel := range record.Attributes.RelatedIdentifiers {
+		if rel.RelatedIdentifierType != "DOI" {
+			continue
+		}
+		var err error
+		switch {
+		case SliceContains(dataciteCites, rel.RelationType):
+			err = w.WriteEdge(doi, rel.RelatedIdentifier)
+		case SliceContains(dataciteCitedBy, rel.RelationType):
+			err = w.WriteEdge(rel.RelatedIdentifier, doi)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCrossrefWorks writes the references of Crossref works, given as a
+// sequence of JSON values: objects with a list of "items" (as in the public
+// data files) or single works, e.g. one per line.
+func ReadCrossrefWorks(r io.Reader, w *CociWriter) error {
+	dec := json.NewDecoder(r)
+	for {
+		var v struct {
+			Items []crossrefReferences `json:"items"`
+			crossrefReferences
+		}
+		if err := dec.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for i := range v.Items {
+			if err := w.writeCrossrefWork(&v.Items[i]); err != nil {
+				return err
+			}
+		}
+		if err := w.writeCrossrefWork(&v.crossrefReferences); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadDataCiteRecords writes the citations of DataCite records, given as a
+// sequence of JSON values: API responses with a list of records under
+// "data" or single records, e.g. one per line (as in the public data file).
+func ReadDataCiteRecords(r io.Reader, w *CociWriter) error {
+	dec := json.NewDecoder(r)
+	for {
+		var v struct {
+			Data json.RawMessage `json:"data"`
+			dataciteReferences
+		}
+		if err := dec.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var records []dataciteReferences
+		if len(v.Data) > 0 && v.Data[0] == '[' {
+			if err := json.Unmarshal(v.Data, &records); err != nil {
+				return err
+			}
+		}
+		for i := range records {
+			if err := w.writeDataCiteRecord(&records[i]); err != nil {
+				return err
+			}
+		}
+		if err := w.writeDataCiteRecord(&v.dataciteReferences); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadReferenceFile writes the references from a file with Crossref works
+// or DataCite records (read with the given function): JSON, optionally
+// compressed, or a tar archive of such files, as the public data files.
+func ReadReferenceFile(r io.Reader, w *CociWriter, read func(io.Reader, *CociWriter) error) error {
+	dr, err := tabutils.DecompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	br := bufio.NewReaderSize(dr, 1<<16)
+	// A tar archive has "ustar" at offset 257 of the first header block.
+	if b, _ := br.Peek(262); len(b) < 262 || string(b[257:]) != "ustar" {
+		return read(br, w)
+	}
+	tr := tar.NewReader(br)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg || !isJSONFilename(h.Name) {
+			continue
+		}
+		rows := w.Rows
+		if err := readCompressed(tr, w, read); err != nil {
+			return fmt.Errorf("%s: %w", h.Name, err)
+		}
+		log.Printf("references: %s: %d edges", h.Name, w.Rows-rows)
+	}
+}
+
+// isJSONFilename returns true for JSON files, also compressed ones.
+func isJSONFilename(name string) bool {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	switch path.Ext(name) {
+	case ".json", ".jsonl", ".ndjson", ".ndj":
+		return true
+	}
+	return false
+}
+
+// readCompressed reads a possibly compressed member of an archive.
+func readCompressed(r io.Reader, w *CociWriter, read func(io.Reader, *CociWriter) error) error {
+	dr, err := tabutils.DecompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	return read(dr, w)
+}
+
+// HarvestOptions configure harvesting references from the Crossref or
+// DataCite REST API.
+type HarvestOptions struct {
+	Endpoint string       // defaults to DefaultCrossrefEndpoint or DefaultDataCiteEndpoint
+	Mailto   string       // contact email, for the Crossref polite pool
+	Client   *http.Client // uses a client with a 5s timeout, if nil
+	Rows     int          // records per page, DefaultHarvestRows if zero
+	// Filter restricts the records, e.g. "from-index-date:2023-01-01" for
+	// Crossref (filter parameter) or "updated:[2023-01-01 TO *]" for
+	// DataCite (query parameter).
+	Filter string
+}
+
+// rows returns the page size.
+func (o *HarvestOptions) rows() int {
+	if o.Rows > 0 {
+		return o.Rows
+	}
+	return DefaultHarvestRows
+}
+
+// getPage fetches a page of records, with retries.
+func (o *HarvestOptions) getPage(ctx context.Context, link string, v interface{}) (err error) {
+	for attempt := 1; attempt <= harvestRetries; attempt++ {
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, "GET", link, nil); err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", resolverUserAgent(o.Mailto))
+		if err = getJSON(o.Client, req, v); err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("harvest: page failed (attempt %d/%d): %v", attempt, harvestRetries, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	return err
+}
+
+// HarvestCrossref writes the references of all Crossref works with
+// references (and matching the filter), paging through the REST API with a
+// cursor.
+func HarvestCrossref(ctx context.Context, opts HarvestOptions, w *CociWriter) error {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultCrossrefEndpoint
+	}
+	filter := "has-references:true"
+	if opts.Filter != "" {
+		filter += "," + opts.Filter
+	}
+	vs := url.Values{}
+	vs.Set("filter", filter)
+	vs.Set("select", "DOI,reference")
+	vs.Set("rows", fmt.Sprintf("%d", opts.rows()))
+	if opts.Mailto != "" {
+		vs.Set("mailto", opts.Mailto)
+	}
+	var works int
+	for cursor, page := "*", 1; ; page++ {
+		vs.Set("cursor", cursor)
+		var payload struct {
+			Message struct {
+				NextCursor string               `json:"next-cursor"`
+				Items      []crossrefReferences `json:"items"`
+			} `json:"message"`
+		}
+		link := strings.TrimRight(endpoint, "/") + "/works?" + vs.Encode()
+		if err := opts.getPage(ctx, link, &payload); err != nil {
+			return fmt.Errorf("crossref: %w", err)
+		}
+		for i := range payload.Message.Items {
+			if err := w.writeCrossrefWork(&payload.Message.Items[i]); err != nil {
+				return err
+			}
+		}
+		works += len(payload.Message.Items)
+		if page%harvestLogInterval == 0 {
+			log.Printf("crossref: %d works, %d edges", works, w.Rows)
+		}
+		if len(payload.Message.Items) == 0 || payload.Message.NextCursor == "" {
+			log.Printf("[ok] crossref: %d works, %d edges", works, w.Rows)
+			return nil
+		}
+		cursor = payload.Message.NextCursor
+	}
+}
+
+// HarvestDataCite writes the citations of all DataCite records with related
+// DOI (and matching the filter), paging through the REST API with a cursor.
+func HarvestDataCite(ctx context.Context, opts HarvestOptions, w *CociWriter) error {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultDataCiteEndpoint
+	}
+	query := "relatedIdentifiers.relatedIdentifierType:DOI"
+	if opts.Filter != "" {
+		query += " AND " + opts.Filter
+	}
+	vs := url.Values{}
+	vs.Set("query", query)
+	vs.Set("fields[dois]", "doi,relatedIdentifiers")
+	vs.Set("page[size]", fmt.Sprintf("%d", opts.rows()))
+	vs.Set("page[cursor]", "1")
+	var (
+		link    = strings.TrimRight(endpoint, "/") + "/dois?" + vs.Encode()
+		records int
+	)
+	for page := 1; link != ""; page++ {
+		var payload struct {
+			Data  []dataciteReferences `json:"data"`
+			Links struct {
+				Next string `json:"next"`
+			} `json:"links"`
+		}
+		if err := opts.getPage(ctx, link, &payload); err != nil {
+			return fmt.Errorf("datacite: %w", err)
+		}
+		for i := range payload.Data {
+			if err := w.writeDataCiteRecord(&payload.Data[i]); err != nil {
+				return err
+			}
+		}
+		records += len(payload.Data)
+		if page%harvestLogInterval == 0 {
+			log.Printf("datacite: %d records, %d edges", records, w.Rows)
+		}
+		link = payload.Links.Next
+		if len(payload.Data) == 0 {
+			link = ""
+		}
+	}
+	log.Printf("[ok] datacite: %d records, %d edges", records, w.Rows)
+	return nil
+}
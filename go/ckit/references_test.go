@@ -0,0 +1,152 @@
+package ckit
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/klauspost/compress/gzip"
+)
+
+// mustEdges returns the edges of a closed citation database, sorted.
+func mustEdges(t *testing.T, w *CociWriter, filename string) string {
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	db := sqlx.MustOpen("sqlite3", filename)
+	defer db.Close()
+	var edges []string
+	if err := db.Select(&edges, "SELECT k || ' ' || v FROM map ORDER BY k, v"); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	return strings.Join(edges, ",")
+}
+
+// mustGzip compresses a string.
+func mustGzip(s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, s)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestReadReferenceFile(t *testing.T) {
+	const (
+		crossrefFile = `{"items": [
+			{"DOI": "10.1/A", "reference": [{"key": "1", "DOI": "10.1/b"}, {"key": "2", "unstructured": "x"}]},
+			{"DOI": "10.1/c"}
+		]}`
+		crossrefLines = `{"DOI": "10.1/d", "reference": [{"DOI": "10.1/a"}]}
+{"DOI": "10.1/e", "reference": [{"DOI": "10.1/a"}, {"DOI": "10.1/b"}]}
+`
+		dataciteLines = `{"id": "10.5/x", "attributes": {"doi": "10.5/x", "relatedIdentifiers": [
+	{"relatedIdentifier": "10.1/a", "relatedIdentifierType": "DOI", "relationType": "References"},
+	{"relatedIdentifier": "10.1/b", "relatedIdentifierType": "DOI", "relationType": "IsCitedBy"},
+	{"relatedIdentifier": "10.1/c", "relatedIdentifierType": "DOI", "relationType": "IsPartOf"},
+	{"relatedIdentifier": "https://example.com", "relatedIdentifierType": "URL", "relationType": "Cites"}]}}
+`
+	)
+	// A tar archive of compressed and uncompressed JSON files.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, b := range map[string][]byte{
+		"0.json.gz": mustGzip(crossrefFile),
+		"1.jsonl":   []byte(crossrefLines),
+		"README":    []byte("not json"),
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg})
+		tw.Write(b)
+	}
+	tw.Close()
+	var cases = []struct {
+		name string
+		data []byte
+		read func(io.Reader, *CociWriter) error
+		want string
+	}{
+		{"crossref file", []byte(crossrefFile), ReadCrossrefWorks, "10.1/a 10.1/b"},
+		{"crossref tar", mustGzip(buf.String()), ReadCrossrefWorks,
+			"10.1/a 10.1/b,10.1/d 10.1/a,10.1/e 10.1/a,10.1/e 10.1/b"},
+		{"datacite", []byte(dataciteLines), ReadDataCiteRecords, "10.1/b 10.5/x,10.5/x 10.1/a"},
+	}
+	for _, c := range cases {
+		filename := filepath.Join(t.TempDir(), "refs.db")
+		w, err := NewCociWriter(filename, false)
+		if err != nil {
+			t.Fatalf("writer: %v", err)
+		}
+		if err := ReadReferenceFile(bytes.NewReader(c.data), w, c.read); err != nil {
+			w.Abort()
+			t.Fatalf("[%s] read: %v", c.name, err)
+		}
+		if got := mustEdges(t, w, filename); got != c.want {
+			t.Fatalf("[%s] got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestHarvest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/works" && q.Get("cursor") == "*":
+			if q.Get("filter") != "has-references:true,from-index-date:2023-01-01" || q.Get("mailto") != "me@example.com" {
+				http.Error(w, "unexpected query: "+r.URL.RawQuery, 400)
+				return
+			}
+			io.WriteString(w, `{"message": {"next-cursor": "c2", "items": [{"DOI": "10.1/a", "reference": [{"DOI": "10.1/b"}]}]}}`)
+		case r.URL.Path == "/works" && q.Get("cursor") == "c2":
+			io.WriteString(w, `{"message": {"next-cursor": "c3", "items": []}}`)
+		case r.URL.Path == "/dois" && q.Get("page[cursor]") == "1":
+			io.WriteString(w, `{"data": [{"attributes": {"doi": "10.5/x", "relatedIdentifiers": [
+				{"relatedIdentifier": "10.1/a", "relatedIdentifierType": "DOI", "relationType": "Cites"}]}}],
+				"links": {"next": "http://`+r.Host+`/dois?page%5Bcursor%5D=2"}}`)
+		case r.URL.Path == "/dois" && q.Get("page[cursor]") == "2":
+			io.WriteString(w, `{"data": [{"attributes": {"doi": "10.5/y", "relatedIdentifiers": [
+				{"relatedIdentifier": "10.5/x", "relatedIdentifierType": "DOI", "relationType": "IsReferencedBy"}]}}],
+				"links": {}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	var cases = []struct {
+		name    string
+		harvest func(context.Context, HarvestOptions, *CociWriter) error
+		want    string
+	}{
+		{"crossref", HarvestCrossref, "10.1/a 10.1/b"},
+		{"datacite", HarvestDataCite, "10.5/x 10.1/a,10.5/x 10.5/y"},
+	}
+	for _, c := range cases {
+		filename := filepath.Join(t.TempDir(), "refs.db")
+		w, err := NewCociWriter(filename, false)
+		if err != nil {
+			t.Fatalf("writer: %v", err)
+		}
+		opts := HarvestOptions{
+			Endpoint: ts.URL,
+			Mailto:   "me@example.com",
+			Client:   ts.Client(),
+			Filter:   "from-index-date:2023-01-01",
+		}
+		if c.name == "datacite" {
+			opts.Filter = ""
+		}
+		if err := c.harvest(context.Background(), opts, w); err != nil {
+			w.Abort()
+			t.Fatalf("[%s] harvest: %v", c.name, err)
+		}
+		if got := mustEdges(t, w, filename); got != c.want {
+			t.Fatalf("[%s] got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
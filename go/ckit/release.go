@@ -0,0 +1,271 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+const (
+	// DefaultReleaseCheckInterval is the time a release check is reused.
+	DefaultReleaseCheckInterval = 24 * time.Hour
+	// releaseRetryInterval is the time after which a failed check is
+	// repeated.
+	releaseRetryInterval = 5 * time.Minute
+)
+
+// snapshotSchema records the release a citation database was built from.
+const snapshotSchema = `CREATE TABLE IF NOT EXISTS snapshot (
+	source TEXT NOT NULL,
+	article INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	published TEXT NOT NULL,
+	doi TEXT NOT NULL,
+	created TEXT NOT NULL
+)`
+
+// Snapshot identifies a release of a citation dump. OpenCitations publishes
+// each release of a dump as a new version of a figshare article.
+type Snapshot struct {
+	Source    string `db:"source" json:"source"`
+	Article   int64  `db:"article" json:"article"`
+	Version   int    `db:"version" json:"version"`
+	Published string `db:"published" json:"published,omitempty"`
+	DOI       string `db:"doi" json:"doi,omitempty"`
+	Created   string `db:"created" json:"created,omitempty"` // when the database was built
+}
+
+// SnapshotOf returns the snapshot of a figshare article.
+func SnapshotOf(a *FigshareArticle) *Snapshot {
+	return &Snapshot{
+		Source:    "figshare",
+		Article:   a.ID,
+		Version:   a.Version,
+		Published: a.Published,
+		DOI:       a.DOI,
+	}
+}
+
+// String returns a short description, e.g. for logs.
+func (s *Snapshot) String() string {
+	if s.Published == "" {
+		return fmt.Sprintf("%s article %d, version %d", s.Source, s.Article, s.Version)
+	}
+	return fmt.Sprintf("%s article %d, version %d, published %s", s.Source, s.Article, s.Version, s.Published)
+}
+
+// NewerThan returns true, if the snapshot is a later version of the same
+// article than the other.
+func (s *Snapshot) NewerThan(other *Snapshot) bool {
+	if s == nil || other == nil {
+		return false
+	}
+	return s.Source == other.Source && s.Article == other.Article && s.Version > other.Version
+}
+
+// WriteSnapshot records the release a citation database was built from,
+// replacing any previously recorded release.
+func WriteSnapshot(db *sqlx.DB, s *Snapshot) error {
+	if s.Created == "" {
+		s.Created = time.Now().UTC().Format(time.RFC3339)
+	}
+	for _, q := range []string{snapshotSchema, "DELETE FROM snapshot"} {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+	}
+	_, err := db.NamedExec(`INSERT INTO snapshot (source, article, version, published, doi, created)
+		VALUES (:source, :article, :version, :published, :doi, :created)`, s)
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	return nil
+}
+
+// ReadSnapshot returns the release a citation database was built from, or
+// nil, if none is recorded, e.g. for databases built with makta.
+func ReadSnapshot(db *sqlx.DB) (*Snapshot, error) {
+	q := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'snapshot'`
+	if db.DriverName() == "postgres" {
+		q = `SELECT COUNT(*) FROM information_schema.tables WHERE table_name = 'snapshot'`
+	}
+	var n int
+	if err := db.Get(&n, q); err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	var s Snapshot
+	if err := db.Get(&s, "SELECT * FROM snapshot LIMIT 1"); err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	return &s, nil
+}
+
+// ReleaseStatus compares the installed release of the citation data with the
+// latest published release.
+type ReleaseStatus struct {
+	Installed       *Snapshot `json:"installed,omitempty"`
+	Latest          *Snapshot `json:"latest,omitempty"`
+	UpdateAvailable bool      `json:"update_available"`
+	Checked         string    `json:"checked,omitempty"`
+	Err             string    `json:"err,omitempty"`
+}
+
+// ReleaseChecker looks up the latest release of a citation dump on figshare,
+// at most once per interval, as the releases are months apart.
+type ReleaseChecker struct {
+	// Client for figshare requests, defaults to a client with a 5s timeout.
+	Client *http.Client
+	// Endpoint of the figshare API, DefaultFigshareEndpoint if empty.
+	Endpoint string
+	// Article to check, if the installed snapshot does not name one;
+	// DefaultCociArticle if zero.
+	Article int64
+	// Interval between checks, DefaultReleaseCheckInterval if zero.
+	Interval time.Duration
+
+	mu      sync.Mutex
+	article int64
+	latest  *Snapshot
+	err     error
+	checked time.Time
+}
+
+// Check compares the installed snapshot (which may be nil) with the latest
+// release.
+func (c *ReleaseChecker) Check(ctx context.Context, installed *Snapshot) ReleaseStatus {
+	article := c.Article
+	if installed != nil && installed.Article != 0 {
+		article = installed.Article
+	}
+	if article == 0 {
+		article = DefaultCociArticle
+	}
+	latest, checked, err := c.latestRelease(ctx, article)
+	status := ReleaseStatus{
+		Installed:       installed,
+		Latest:          latest,
+		UpdateAvailable: latest.NewerThan(installed),
+	}
+	if !checked.IsZero() {
+		status.Checked = checked.UTC().Format(time.RFC3339)
+	}
+	if err != nil {
+		status.Err = err.Error()
+	}
+	return status
+}
+
+// latestRelease returns the latest release of an article, checked at most
+// once per interval.
+func (c *ReleaseChecker) latestRelease(ctx context.Context, article int64) (*Snapshot, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	interval := c.Interval
+	if interval == 0 {
+		interval = DefaultReleaseCheckInterval
+	}
+	if c.err != nil && interval > releaseRetryInterval {
+		interval = releaseRetryInterval
+	}
+	if c.article == article && !c.checked.IsZero() && time.Since(c.checked) < interval {
+		return c.latest, c.checked, c.err
+	}
+	a, err := FetchFigshareArticle(ctx, c.Client, c.Endpoint, article)
+	c.article, c.checked, c.err = article, time.Now(), err
+	if err != nil {
+		log.Printf("release check: %v", err)
+		c.latest = nil
+	} else {
+		c.latest = SnapshotOf(a)
+	}
+	return c.latest, c.checked, c.err
+}
+
+// BuildInfo is the response of the version endpoint.
+type BuildInfo struct {
+	Version   string        `json:"version,omitempty"`
+	Buildtime string        `json:"buildtime,omitempty"`
+	Citations ReleaseStatus `json:"citations"`
+}
+
+// installedSnapshot returns the release, the citation database was built
+// from, if recorded.
+func (s *Server) installedSnapshot(ctx context.Context) (*Snapshot, error) {
+	var (
+		d  = s.data(ctx)
+		db = d.OciDatabase
+	)
+	if len(d.OciShards) > 0 {
+		db = d.OciShards[0]
+	}
+	if db == nil || d.isDegraded(ComponentCitations) {
+		return nil, nil
+	}
+	return ReadSnapshot(db)
+}
+
+// handleVersion reports the server version, the release of the citation
+// data and, with a ReleaseChecker, whether a newer release is available.
+func (s *Server) handleVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		info := BuildInfo{Version: s.Version, Buildtime: s.Buildtime}
+		installed, err := s.installedSnapshot(r.Context())
+		switch {
+		case err != nil:
+			info.Citations.Err = err.Error()
+		case s.ReleaseChecker != nil:
+			info.Citations = s.ReleaseChecker.Check(r.Context(), installed)
+		default:
+			info.Citations.Installed = installed
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			log.Printf("version: %v", err)
+		}
+	}
+}
+
+// DiagnoseRelease reports the release a citation database was built from
+// and, with a checker, whether a newer release is available.
+func DiagnoseRelease(r *Report, name, path string, c *ReleaseChecker) {
+	db, err := OpenDatabase(path)
+	if err != nil {
+		return // reported by DiagnoseMapDatabase
+	}
+	defer db.Close()
+	installed, err := ReadSnapshot(db)
+	switch {
+	case err != nil:
+		r.Warn(name, "", "%v", err)
+		return
+	case installed == nil:
+		r.Warn(name, "build the database with labed fetch-oci to record the release",
+			"release unknown")
+	default:
+		r.OK(name, "built from %s", installed)
+	}
+	if c == nil {
+		return
+	}
+	status := c.Check(context.Background(), installed)
+	switch {
+	case status.Err != "":
+		r.Warn(name, "check network access to figshare", "release check: %s", status.Err)
+	case status.UpdateAvailable:
+		r.Warn(name, "update with labed fetch-oci",
+			"newer release available: version %d, published %s", status.Latest.Version, status.Latest.Published)
+	case installed != nil:
+		r.OK(name, "latest release installed")
+	default:
+		r.OK(name, "latest release is %s", status.Latest)
+	}
+}
@@ -0,0 +1,130 @@
+package ckit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+)
+
+// figshareTestServer serves an article with the given version and counts
+// requests.
+func figshareTestServer(t *testing.T, version int, requests *int32) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		json.NewEncoder(w).Encode(FigshareArticle{
+			ID:        DefaultCociArticle,
+			Version:   version,
+			Published: "2023-01-12T00:00:00Z",
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSnapshot(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "oci.db"))
+	defer db.Close()
+	s, err := ReadSnapshot(db)
+	if err != nil || s != nil {
+		t.Fatalf("got %v, %v, want no snapshot", s, err)
+	}
+	for _, version := range []int{19, 20} {
+		if err := WriteSnapshot(db, &Snapshot{Source: "figshare", Article: 1, Version: version}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if s, err = ReadSnapshot(db); err != nil || s == nil || s.Version != 20 || s.Created == "" {
+		t.Fatalf("got %+v, %v, want version 20", s, err)
+	}
+	var cases = []struct {
+		other  *Snapshot
+		result bool
+	}{
+		{nil, false},
+		{&Snapshot{Source: "figshare", Article: 1, Version: 19}, true},
+		{&Snapshot{Source: "figshare", Article: 1, Version: 20}, false},
+		{&Snapshot{Source: "figshare", Article: 2, Version: 1}, false},
+	}
+	for _, c := range cases {
+		if got := s.NewerThan(c.other); got != c.result {
+			t.Fatalf("[%v] got %v, want %v", c.other, got, c.result)
+		}
+	}
+}
+
+func TestReleaseChecker(t *testing.T) {
+	var requests int32
+	ts := figshareTestServer(t, 20, &requests)
+	c := &ReleaseChecker{Client: ts.Client(), Endpoint: ts.URL}
+	installed := &Snapshot{Source: "figshare", Article: DefaultCociArticle, Version: 19}
+	for i := 0; i < 3; i++ {
+		status := c.Check(context.Background(), installed)
+		if !status.UpdateAvailable || status.Latest.Version != 20 || status.Err != "" || status.Checked == "" {
+			t.Fatalf("got %+v, want update available", status)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("got %d requests, want 1", requests)
+	}
+	if status := c.Check(context.Background(), nil); status.UpdateAvailable || status.Latest == nil {
+		t.Fatalf("got %+v, want latest release without update", status)
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	var requests int32
+	ts := figshareTestServer(t, 20, &requests)
+	srv := newTestServer(t)
+	srv.Version = "v1.0.0"
+	srv.OciDatabase = sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "oci.db"))
+	defer srv.OciDatabase.Close()
+	if err := WriteSnapshot(srv.OciDatabase, &Snapshot{Source: "figshare", Article: DefaultCociArticle, Version: 19}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	get := func() BuildInfo {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/version", nil))
+		var info BuildInfo
+		if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return info
+	}
+	if info := get(); info.Version != "v1.0.0" || info.Citations.Installed == nil || info.Citations.Latest != nil {
+		t.Fatalf("got %+v, want installed release only", info)
+	}
+	srv.ReleaseChecker = &ReleaseChecker{Client: ts.Client(), Endpoint: ts.URL}
+	if info := get(); !info.Citations.UpdateAvailable {
+		t.Fatalf("got %+v, want update available", info)
+	}
+}
+
+func TestDiagnoseRelease(t *testing.T) {
+	var requests int32
+	ts := figshareTestServer(t, 20, &requests)
+	filename := filepath.Join(t.TempDir(), "oci.db")
+	w, err := NewCociWriter(filename, false)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	w.Snapshot = &Snapshot{Source: "figshare", Article: DefaultCociArticle, Version: 19}
+	if err := w.ReadCSV(strings.NewReader("01-02,10.1/a,10.1/b\n")); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var report Report
+	DiagnoseRelease(&report, "oci release", filename, &ReleaseChecker{Client: ts.Client(), Endpoint: ts.URL})
+	if len(report.Checks) != 2 || report.Checks[0].Status != StatusOK || report.Checks[1].Status != StatusWarn ||
+		!strings.Contains(report.Checks[1].Message, "version 20") {
+		t.Fatalf("got %+v, want installed release and newer release warning", report.Checks)
+	}
+}
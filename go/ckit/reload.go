@@ -0,0 +1,368 @@
+package ckit
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/bloom"
+)
+
+// Datasets are the databases and index data of a server, which can be
+// replaced at runtime, e.g. after a data update. Namespaces are matched by
+// name; new namespaces require a restart.
+type Datasets struct {
+	IdentifierDatabase     *sqlx.DB
+	OciDatabase            *sqlx.DB
+	OciShards              []*sqlx.DB
+	AdditionalOciDatabases []OciSource
+	Namespaces             []Namespace
+	IndexData              Fetcher
+	CountsDatabase         *sqlx.DB
+	RankDatabase           *sqlx.DB
+	HoldingsDatabase       *sqlx.DB
+	MatchDatabase          *sqlx.DB
+	EdgeFilter             *bloom.Filter
+	Degraded               []Degradation
+}
+
+// Fingerprint identifies the version of a database file by path, size and
+// modification time.
+type Fingerprint struct {
+	Name        string `json:"name"`
+	Path        string `json:"path,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// ReloadReport describes a reload, with the fingerprints of the datasets
+// before and after.
+type ReloadReport struct {
+	Old     []Fingerprint `json:"old"`
+	New     []Fingerprint `json:"new"`
+	Changed []string      `json:"changed"`
+	Flushed bool          `json:"flushed"`
+	Took    float64       `json:"took"` // seconds
+}
+
+// datasets returns the current datasets.
+func (s *Server) datasets() *Datasets {
+	return &Datasets{
+		IdentifierDatabase:     s.IdentifierDatabase,
+		OciDatabase:            s.OciDatabase,
+		OciShards:              s.OciShards,
+		AdditionalOciDatabases: s.AdditionalOciDatabases,
+		Namespaces:             s.Namespaces,
+		IndexData:              s.IndexData,
+		CountsDatabase:         s.CountsDatabase,
+		RankDatabase:           s.RankDatabase,
+		HoldingsDatabase:       s.HoldingsDatabase,
+		MatchDatabase:          s.MatchDatabase,
+		EdgeFilter:             s.EdgeFilter,
+		Degraded:               s.Degraded,
+	}
+}
+
+// datasetsRef counts the users of datasets, which are closed once they are
+// retired and the last user is done.
+type datasetsRef struct {
+	datasets *Datasets
+	refs     atomic.Int64
+	retired  atomic.Bool
+	once     sync.Once
+	close    func()
+}
+
+// release marks a user done.
+func (r *datasetsRef) release() {
+	if r.refs.Add(-1) == 0 && r.retired.Load() {
+		r.once.Do(r.close)
+	}
+}
+
+// retire closes the datasets with f, now or after the last user is done.
+func (r *datasetsRef) retire(f func()) {
+	r.close = f
+	r.retired.Store(true)
+	if r.refs.Load() == 0 {
+		r.once.Do(r.close)
+	}
+}
+
+// acquireDatasets returns the current datasets and a function to call, when
+// done with them. Until the first reload, the datasets are the ones set on
+// the server.
+func (s *Server) acquireDatasets() (*Datasets, func()) {
+	for {
+		cur := s.current.Load()
+		ref := cur
+		if ref == nil {
+			ref = &s.initial
+		}
+		ref.refs.Add(1)
+		if s.current.Load() != cur {
+			// Replaced in the meantime, try again.
+			ref.release()
+			continue
+		}
+		if cur == nil {
+			return s.datasets(), ref.release
+		}
+		return cur.datasets, ref.release
+	}
+}
+
+type datasetsKey struct{}
+
+// withDatasets attaches datasets to a context, e.g. for a request.
+func withDatasets(ctx context.Context, d *Datasets) context.Context {
+	return context.WithValue(ctx, datasetsKey{}, d)
+}
+
+// data returns the datasets attached to the context, or the current ones,
+// e.g. outside of requests.
+func (s *Server) data(ctx context.Context) *Datasets {
+	if d, ok := ctx.Value(datasetsKey{}).(*Datasets); ok {
+		return d
+	}
+	if cur := s.current.Load(); cur != nil {
+		return cur.datasets
+	}
+	return s.datasets()
+}
+
+// withCurrentDatasets keeps the current datasets for the duration of a
+// request, which is not served by ServeHTTP, e.g. on the admin router.
+func (s *Server) withCurrentDatasets(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(datasetsKey{}).(*Datasets); ok {
+			next(w, r)
+			return
+		}
+		d, release := s.acquireDatasets()
+		defer release()
+		next(w, r.WithContext(withDatasets(r.Context(), d)))
+	}
+}
+
+// ReloadDatasets opens the datasets anew with the Reload function and
+// replaces the current ones, once they are reachable. Requests running
+// during the reload finish with the old datasets, which are closed after the
+// last of them is done; new requests use the new datasets right away.
+// Optionally, the cache is flushed.
+func (s *Server) ReloadDatasets(flush bool) (*ReloadReport, error) {
+	if s.Reload == nil {
+		return nil, fmt.Errorf("reload not configured")
+	}
+	started := time.Now()
+	d, err := s.Reload()
+	if err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+	if err := d.Ping(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+	if d.CountsDatabase != nil {
+		if err := ValidateCountsDatabase(d.CountsDatabase, 1+len(d.AdditionalOciDatabases)); err != nil {
+			d.Close()
+			return nil, fmt.Errorf("reload: counts database: %w", err)
+		}
+	}
+	report := &ReloadReport{New: d.fingerprints()}
+	s.reloadMu.Lock()
+	var (
+		ref = s.current.Load()
+		old *Datasets
+	)
+	if ref == nil {
+		ref, old = &s.initial, s.datasets()
+	} else {
+		old = ref.datasets
+	}
+	report.Old = old.fingerprints()
+	s.current.Store(&datasetsRef{datasets: d})
+	if flush && s.Cache != nil {
+		if err := s.Cache.Flush(); err != nil {
+			log.Printf("reload: cache flush: %v", err)
+		} else {
+			report.Flushed = true
+			s.cacheMetrics.resetSize()
+		}
+	}
+	s.reloadMu.Unlock()
+	_, keep := d.named()
+	ref.retire(func() {
+		old.close(func(db *sqlx.DB) bool {
+			for _, v := range keep {
+				if v == db {
+					return false
+				}
+			}
+			s.stmts.forget(db)
+			s.edgeMeta.Delete(db)
+			s.examples.Delete(db)
+			return true
+		})
+	})
+	report.Changed = changedFingerprints(report.Old, report.New)
+	report.Took = time.Since(started).Seconds()
+	log.Printf("reloaded datasets in %0.3fs, changed: %v", report.Took, report.Changed)
+	s.notify(EventDatasetsReloaded, report)
+	if report.Flushed {
+		s.notify(EventCacheFlushed, map[string]string{"reason": "reload"})
+	}
+	return report, nil
+}
+
+// handleReload reloads the datasets, optionally flushing the cache (query
+// parameter "flush").
+func (s *Server) handleReload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var flush bool
+		switch r.URL.Query().Get("flush") {
+		case "1", "true":
+			flush = true
+		}
+		report, err := s.ReloadDatasets(flush)
+		if err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+// named returns all databases with a name.
+func (d *Datasets) named() (names []string, dbs []*sqlx.DB) {
+	add := func(name string, db *sqlx.DB) {
+		if db != nil {
+			names, dbs = append(names, name), append(dbs, db)
+		}
+	}
+	add("identifier", d.IdentifierDatabase)
+	add(PrimaryOciSourceName, d.OciDatabase)
+	for i, db := range d.OciShards {
+		add(fmt.Sprintf("%s/shard:%d", PrimaryOciSourceName, i), db)
+	}
+	for _, src := range d.AdditionalOciDatabases {
+		add(PrimaryOciSourceName+":"+src.Name, src.DB)
+	}
+	for _, ns := range d.Namespaces {
+		add("ns:"+ns.Name, ns.DB)
+	}
+	for i, db := range fetcherDatabases(d.IndexData) {
+		add(fmt.Sprintf("index:%d", i), db)
+	}
+	add("counts", d.CountsDatabase)
+	add("rank", d.RankDatabase)
+	add("holdings", d.HoldingsDatabase)
+	add("match", d.MatchDatabase)
+	return names, dbs
+}
+
+// fingerprints returns the fingerprints of all databases.
+func (d *Datasets) fingerprints() []Fingerprint {
+	names, dbs := d.named()
+	result := make([]Fingerprint, len(names))
+	for i, db := range dbs {
+		result[i] = databaseFingerprint(names[i], db)
+	}
+	return result
+}
+
+// Close closes all databases.
+func (d *Datasets) Close() {
+	d.close(nil)
+}
+
+// close closes all databases, for which f returns true, or all, if f is
+// nil.
+func (d *Datasets) close(f func(db *sqlx.DB) bool) {
+	_, dbs := d.named()
+	for _, db := range dbs {
+		if f != nil && !f(db) {
+			continue
+		}
+		if err := db.Close(); err != nil {
+			log.Printf("close: %v", err)
+		}
+	}
+}
+
+// fetcherDatabases returns the sqlite3 databases behind a fetcher.
+func fetcherDatabases(f Fetcher) []*sqlx.DB {
+	switch v := f.(type) {
+	case *SqliteFetcher:
+		return []*sqlx.DB{v.DB}
+	case *FetchGroup:
+		var dbs []*sqlx.DB
+		for _, b := range v.Backends {
+			dbs = append(dbs, fetcherDatabases(b)...)
+		}
+		return dbs
+	case *LRUFetcher:
+		return fetcherDatabases(v.Fetcher)
+	case *TransformFetcher:
+		return fetcherDatabases(v.Fetcher)
+	default:
+		return nil
+	}
+}
+
+// databaseFingerprint fingerprints an sqlite3 database file; for other
+// databases, only the driver is reported.
+func databaseFingerprint(name string, db *sqlx.DB) Fingerprint {
+	fp := Fingerprint{Name: name, Fingerprint: db.DriverName()}
+	if !strings.HasPrefix(db.DriverName(), "sqlite3") {
+		return fp
+	}
+	var rows []struct {
+		Seq  int    `db:"seq"`
+		Name string `db:"name"`
+		File string `db:"file"`
+	}
+	if err := db.Select(&rows, "PRAGMA database_list"); err != nil || len(rows) == 0 {
+		return fp
+	}
+	fp.Path = rows[0].File
+	fi, err := os.Stat(fp.Path)
+	if err != nil {
+		return fp
+	}
+	fp.Size, fp.Modified = fi.Size(), fi.ModTime().Format(time.RFC3339)
+	h := sha1.Sum([]byte(fmt.Sprintf("%s:%d:%d", fp.Path, fi.Size(), fi.ModTime().UnixNano())))
+	fp.Fingerprint = fmt.Sprintf("%x", h[:8])
+	return fp
+}
+
+// changedFingerprints returns the names of datasets, which differ.
+func changedFingerprints(old, new []Fingerprint) []string {
+	var (
+		before  = make(map[string]string)
+		changed = []string{}
+	)
+	for _, fp := range old {
+		before[fp.Name] = fp.Fingerprint
+	}
+	for _, fp := range new {
+		if v, ok := before[fp.Name]; !ok || v != fp.Fingerprint {
+			changed = append(changed, fp.Name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,120 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestServerReload(t *testing.T) {
+	// Start with a copy of the citation database, reload the original.
+	b, err := os.ReadFile("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "doi_doi.db"), b, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	c, err := cache.New(filepath.Join(dir, "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	if srv.OciDatabase, err = OpenDatabase(filepath.Join(dir, "doi_doi.db")); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	srv.Cache = c
+	srv.Router, srv.AdminRouter = mux.NewRouter(), mux.NewRouter()
+	var fail bool
+	srv.Reload = func() (*Datasets, error) {
+		if fail {
+			return nil, errors.New("cannot open")
+		}
+		oci, err := OpenDatabase("testdata/doi_doi.db")
+		if err != nil {
+			return nil, err
+		}
+		d := srv.datasets()
+		d.OciDatabase = oci
+		return d, nil
+	}
+	srv.Routes()
+	mustRequest(t, srv, "/id/i0029")
+	old := srv.OciDatabase
+	rr := httptest.NewRecorder()
+	srv.AdminRouter.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/reload?flush=1", nil))
+	if rr.Code != 200 {
+		t.Fatalf("got %d, want 200: %s", rr.Code, rr.Body.String())
+	}
+	var report ReloadReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(report.Changed) != 1 || report.Changed[0] != "oci" || !report.Flushed || len(report.Old) != len(report.New) {
+		t.Fatalf("got %+v, want changed oci database and flushed cache", report)
+	}
+	for _, fp := range report.New {
+		if fp.Path == "" || fp.Size == 0 || len(fp.Fingerprint) != 16 {
+			t.Fatalf("got %+v, want file fingerprint", fp)
+		}
+	}
+	if err := old.Ping(); err == nil {
+		t.Fatalf("old database still open")
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+	if rr.Code != 200 || rr.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("got %d, %s, want 200 from reloaded databases", rr.Code, rr.Header().Get("X-Cache"))
+	}
+	// A failed reload keeps the current datasets.
+	fail = true
+	current := srv.data(context.Background()).OciDatabase
+	rr = httptest.NewRecorder()
+	srv.AdminRouter.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/reload", nil))
+	if rr.Code != 500 || srv.data(context.Background()).OciDatabase != current {
+		t.Fatalf("got %d, want 500 and unchanged datasets", rr.Code)
+	}
+	mustRequest(t, srv, "/id/i0029")
+}
+
+func TestServerReloadDuringRequest(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Reload = func() (*Datasets, error) {
+		oci, err := OpenDatabase("testdata/doi_doi.db")
+		if err != nil {
+			return nil, err
+		}
+		d := srv.datasets()
+		d.OciDatabase = oci
+		return d, nil
+	}
+	// A running request keeps its datasets, while a reload does not wait
+	// for it to finish.
+	d, release := srv.acquireDatasets()
+	if _, err := srv.ReloadDatasets(false); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if srv.data(context.Background()).OciDatabase == d.OciDatabase {
+		t.Fatalf("got old citation database, want reloaded one")
+	}
+	if err := d.OciDatabase.Ping(); err != nil {
+		t.Fatalf("old database closed during request: %v", err)
+	}
+	mustRequest(t, srv, "/id/i0029")
+	release()
+	if err := d.OciDatabase.Ping(); err == nil {
+		t.Fatalf("old database still open after the last request")
+	}
+	if err := d.IdentifierDatabase.Ping(); err != nil {
+		t.Fatalf("shared database closed: %v", err)
+	}
+}
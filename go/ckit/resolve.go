@@ -0,0 +1,185 @@
+package ckit
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// ErrDOINotFound is returned by a DOIResolver, if a DOI is unknown to the
+// external service.
+var ErrDOINotFound = errors.New("doi not found")
+
+// DOIResolver looks up metadata for a DOI, which is not in the index, from an
+// external service. The document uses the field names of the index data
+// (title, author, publishDate, ...) and contains the DOI as "doi_str_mv",
+// like the stub for unmatched documents.
+type DOIResolver interface {
+	Resolve(ctx context.Context, doi string) (json.RawMessage, error)
+}
+
+// CachingResolver keeps results of another resolver in memory, including
+// DOI not found, as we see the same unmatched DOI over and over. The cache is
+// bounded by the number of entries; other errors are not cached. Thread-safe.
+type CachingResolver struct {
+	Resolver   DOIResolver
+	MaxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type resolverEntry struct {
+	doi string
+	b   json.RawMessage // nil, if not found
+}
+
+// NewCachingResolver wraps a resolver with an in-memory cache of at most
+// maxEntries results.
+func NewCachingResolver(r DOIResolver, maxEntries int) *CachingResolver {
+	return &CachingResolver{
+		Resolver:   r,
+		MaxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Resolve returns a cached result or asks the wrapped resolver.
+func (r *CachingResolver) Resolve(ctx context.Context, doi string) (json.RawMessage, error) {
+	r.mu.Lock()
+	if e, ok := r.items[doi]; ok {
+		r.ll.MoveToFront(e)
+		b := e.Value.(*resolverEntry).b
+		r.mu.Unlock()
+		if b == nil {
+			return nil, ErrDOINotFound
+		}
+		return b, nil
+	}
+	r.mu.Unlock()
+	b, err := r.Resolver.Resolve(ctx, doi)
+	switch {
+	case errors.Is(err, ErrDOINotFound):
+		r.add(doi, nil)
+		return nil, err
+	case err != nil:
+		return nil, err
+	}
+	r.add(doi, b)
+	return b, nil
+}
+
+// add caches a result, evicting least recently used entries as needed.
+func (r *CachingResolver) add(doi string, b json.RawMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.items[doi]; ok || r.MaxEntries < 1 {
+		return
+	}
+	r.items[doi] = r.ll.PushFront(&resolverEntry{doi: doi, b: b})
+	for r.ll.Len() > r.MaxEntries {
+		entry := r.ll.Remove(r.ll.Back()).(*resolverEntry)
+		delete(r.items, entry.doi)
+	}
+}
+
+// Len returns the number of cached results.
+func (r *CachingResolver) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ll.Len()
+}
+
+// rateLimiter spaces out calls by a minimum interval; the zero value does
+// not limit.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the next call is allowed or the context is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	if delay == 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resolveUnmatched replaces stubs of unmatched documents with metadata from
+// the resolver, in place, for at most MaxResolve documents and within
+// ResolveTimeout. Documents, which cannot be resolved in time, keep their
+// stub. Returns the number of resolved documents.
+func (s *Server) resolveUnmatched(ctx context.Context, docs ...[]json.RawMessage) int {
+	if s.Resolver == nil {
+		return 0
+	}
+	rctx, cancel := withTimeout(ctx, s.ResolveTimeout)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		resolved int
+		sem      = make(chan struct{}, 8)
+		budget   = s.MaxResolve
+	)
+	for _, d := range docs {
+		for i := range d {
+			if s.MaxResolve > 0 {
+				if budget == 0 {
+					break
+				}
+				budget--
+			}
+			var v docSnippet
+			if err := json.Unmarshal(d[i], &v); err != nil || len(v.DOI) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(dst *json.RawMessage, doi string) {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+				case <-rctx.Done():
+					return
+				}
+				defer func() { <-sem }()
+				b, err := s.Resolver.Resolve(rctx, doi)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				*dst = b
+				resolved++
+				mu.Unlock()
+			}(&d[i], v.DOI[0])
+		}
+	}
+	wg.Wait()
+	return resolved
+}
@@ -0,0 +1,97 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// testResolver resolves DOI starting with "d" and counts calls.
+type testResolver struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (r *testResolver) Resolve(ctx context.Context, doi string) (json.RawMessage, error) {
+	r.mu.Lock()
+	r.calls++
+	r.mu.Unlock()
+	if doi[0] != 'd' {
+		return nil, ErrDOINotFound
+	}
+	return json.RawMessage(fmt.Sprintf(`{"doi_str_mv": %q, "title": "T", "resolved_by": "test"}`, doi)), nil
+}
+
+func TestCachingResolver(t *testing.T) {
+	var (
+		tr  = &testResolver{}
+		r   = NewCachingResolver(tr, 2)
+		ctx = context.Background()
+	)
+	for i := 0; i < 3; i++ {
+		if _, err := r.Resolve(ctx, "d1"); err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		if _, err := r.Resolve(ctx, "x1"); !errors.Is(err, ErrDOINotFound) {
+			t.Fatalf("got %v, want ErrDOINotFound", err)
+		}
+	}
+	if tr.calls != 2 {
+		t.Fatalf("got %d calls, want 2", tr.calls)
+	}
+	r.Resolve(ctx, "d2")
+	if r.Len() != 2 {
+		t.Fatalf("got %d entries, want 2", r.Len())
+	}
+	r.Resolve(ctx, "d1") // evicted
+	if tr.calls != 4 {
+		t.Fatalf("got %d calls, want 4", tr.calls)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	var (
+		l       = rateLimiter{interval: 20 * time.Millisecond}
+		started = time.Now()
+	)
+	for i := 0; i < 3; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Fatalf("got %s, want at least 40ms", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); err == nil {
+		t.Fatalf("want error for cancelled context")
+	}
+}
+
+func TestServerResolveUnmatched(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Resolver = &testResolver{}
+	// d0029 is cited by d0156, which is not in the index.
+	resp := mustRequest(t, srv, "/id/i0029")
+	if resp.Extra.ResolvedCount != 1 || len(resp.Unmatched.Cited) != 1 {
+		t.Fatalf("got %d resolved, %d unmatched, want 1, 1", resp.Extra.ResolvedCount, len(resp.Unmatched.Cited))
+	}
+	var doc resolvedDocument
+	if err := json.Unmarshal(resp.Unmatched.Cited[0], &doc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if doc.DOI != "d0156" || doc.Title != "T" {
+		t.Fatalf("got %+v", doc)
+	}
+	srv.MaxResolve, srv.Resolver = 0, nil
+	resp = mustRequest(t, srv, "/id/i0029")
+	if resp.Extra.ResolvedCount != 0 {
+		t.Fatalf("got %d resolved, want 0", resp.Extra.ResolvedCount)
+	}
+}
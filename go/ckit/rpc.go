@@ -0,0 +1,334 @@
+package ckit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/labepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RPCService implements the gRPC service defined in labepb on top of a
+// Server. Lookups go through the HTTP handler in-process, so caching, request
+// options and logging are the same for both APIs.
+type RPCService struct {
+	labepb.UnimplementedLabeServer
+	Server *Server
+	// Workers is the number of parallel lookups in a batch.
+	Workers int
+	// MaxBatchSize limits the number of identifiers per batch, zero means
+	// no limit.
+	MaxBatchSize int
+	// MaxGraphNodes limits the number of records visited by a graph
+	// request, zero means the default of 1000.
+	MaxGraphNodes int
+}
+
+// Lookup returns the fused response for a local identifier or a DOI.
+func (rs *RPCService) Lookup(ctx context.Context, req *labepb.LookupRequest) (*labepb.Response, error) {
+	if err := rs.checkPeer(ctx); err != nil {
+		return nil, err
+	}
+	id := req.GetId()
+	if doi := req.GetDoi(); doi != "" {
+		var err error
+		if id, err = rs.Server.lookupID(ctx, doi); err != nil {
+			return nil, rpcError(err, "id lookup for %s", doi)
+		}
+	}
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id or doi required")
+	}
+	return rs.lookup(ctx, id, req.GetOptions())
+}
+
+// BatchLookup streams responses for a number of identifiers, in request order.
+func (rs *RPCService) BatchLookup(req *labepb.BatchLookupRequest, stream labepb.Labe_BatchLookupServer) error {
+	var (
+		ids     = req.GetIds()
+		workers = rs.Workers
+	)
+	if err := rs.checkPeer(stream.Context()); err != nil {
+		return err
+	}
+	if rs.MaxBatchSize > 0 && len(ids) > rs.MaxBatchSize {
+		return status.Errorf(codes.InvalidArgument, "batch size %d exceeds limit of %d", len(ids), rs.MaxBatchSize)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		ctx     = stream.Context()
+		sem     = make(chan struct{}, workers)
+		results = make([]chan *labepb.LookupResult, len(ids))
+	)
+	for i, id := range ids {
+		results[i] = make(chan *labepb.LookupResult, 1)
+		go func(id string, out chan<- *labepb.LookupResult) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result := &labepb.LookupResult{Id: id}
+			resp, err := rs.lookup(ctx, id, req.GetOptions())
+			if err != nil {
+				st := status.Convert(err)
+				result.Code, result.Error = int32(st.Code()), st.Message()
+			}
+			result.Response = resp
+			out <- result
+		}(id, results[i])
+	}
+	for _, ch := range results {
+		select {
+		case result := <-ch:
+			if err := stream.Send(result); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	return nil
+}
+
+// Counts returns the number of citing and cited edges for a local identifier.
+func (rs *RPCService) Counts(ctx context.Context, req *labepb.CountsRequest) (*labepb.CountsResponse, error) {
+	if err := rs.checkPeer(ctx); err != nil {
+		return nil, err
+	}
+	d, release := rs.Server.acquireDatasets()
+	defer release()
+	ctx = withDatasets(ctx, d)
+	doi, err := rs.Server.lookupDOI(ctx, req.GetId())
+	if err != nil {
+		return nil, rpcError(err, "doi lookup for %s", req.GetId())
+	}
+	c, err := rs.Server.counts(ctx, doi)
+	if err != nil {
+		return nil, rpcError(err, "counts for %s", doi)
+	}
+	return &labepb.CountsResponse{
+		Id:     req.GetId(),
+		Doi:    doi,
+		Citing: int64(c.Citing),
+		Cited:  int64(c.Cited),
+	}, nil
+}
+
+// Graph streams citation edges between matched documents around a record,
+// following matched documents breadth first. Each edge is sent once.
+func (rs *RPCService) Graph(req *labepb.GraphRequest, stream labepb.Labe_GraphServer) error {
+	var (
+		ctx      = stream.Context()
+		depth    = int(req.GetDepth())
+		maxNodes = rs.MaxGraphNodes
+	)
+	if maxNodes < 1 {
+		maxNodes = 1000
+	}
+	if n := int(req.GetMaxNodes()); n > 0 && n < maxNodes {
+		maxNodes = n
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	if err := rs.checkPeer(ctx); err != nil {
+		return err
+	}
+	d, release := rs.Server.acquireDatasets()
+	defer release()
+	ctx = withDatasets(ctx, d)
+	if _, err := rs.Server.lookupDOI(ctx, req.GetId()); err != nil {
+		return rpcError(err, "doi lookup for %s", req.GetId())
+	}
+	var (
+		frontier = []string{req.GetId()}
+		visited  = map[string]bool{req.GetId(): true}
+		seen     = make(map[[2]string]bool)
+	)
+	for level := 1; level <= depth && len(frontier) > 0; level++ {
+		var next []string
+		for _, id := range frontier {
+			e, err := rs.Server.Enrich(ctx, id)
+			if err != nil {
+				return rpcError(err, "edges for %s", id)
+			}
+			var edges [][2]string
+			for _, v := range e.CitesIDs {
+				edges = append(edges, [2]string{id, v})
+			}
+			for _, v := range e.CitedByIDs {
+				edges = append(edges, [2]string{v, id})
+			}
+			for _, edge := range edges {
+				if !seen[edge] {
+					seen[edge] = true
+					err := stream.Send(&labepb.Edge{CitingId: edge[0], CitedId: edge[1], Depth: int32(level)})
+					if err != nil {
+						return err
+					}
+				}
+				for _, v := range edge {
+					if !visited[v] && len(visited) < maxNodes {
+						visited[v] = true
+						next = append(next, v)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return nil
+}
+
+// lookup runs a request for a local identifier through the HTTP handler and
+// converts the response.
+func (rs *RPCService) lookup(ctx context.Context, id string, opts *labepb.Options) (*labepb.Response, error) {
+	link := "/id/" + url.PathEscape(id)
+	if v := rpcOptionValues(opts); len(v) > 0 {
+		link += "?" + v.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+	}
+	// Tenants are identified by the API key in the call metadata.
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(TenantKeyHeader); len(v) > 0 {
+			req.Header.Set(TenantKeyHeader, v[0])
+		}
+	}
+	rr := httptest.NewRecorder()
+	rs.Server.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		return nil, status.Errorf(rpcCode(rr.Code), "%s: %s", id, strings.TrimSpace(rr.Body.String()))
+	}
+	var resp Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		return nil, status.Errorf(codes.Internal, "decode: %v", err)
+	}
+	extra, err := json.Marshal(resp.Extra)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "encode: %v", err)
+	}
+	return &labepb.Response{
+		Id:              resp.ID,
+		Doi:             resp.DOI,
+		Citing:          rawBytes(resp.Citing),
+		Cited:           rawBytes(resp.Cited),
+		UnmatchedCiting: rawBytes(resp.Unmatched.Citing),
+		UnmatchedCited:  rawBytes(resp.Unmatched.Cited),
+		Extra:           extra,
+	}, nil
+}
+
+// rawBytes converts documents for a protobuf message.
+func rawBytes(docs []json.RawMessage) [][]byte {
+	result := make([][]byte, len(docs))
+	for i, doc := range docs {
+		result[i] = doc
+	}
+	return result
+}
+
+// rpcOptionValues returns options as URL query parameters.
+func rpcOptionValues(o *labepb.Options) url.Values {
+	v := url.Values{}
+	if o == nil {
+		return v
+	}
+	if o.Institution != "" {
+		v.Set("i", o.Institution)
+	}
+	if o.Sort != "" {
+		v.Set("sort", o.Sort)
+	}
+	if o.Order != "" {
+		v.Set("order", o.Order)
+	}
+	if o.From > 0 {
+		v.Set("from", strconv.Itoa(int(o.From)))
+	}
+	if o.Until > 0 {
+		v.Set("until", strconv.Itoa(int(o.Until)))
+	}
+	if len(o.Sources) > 0 {
+		v.Set("source", strings.Join(o.Sources, ","))
+	}
+	return v
+}
+
+// rpcCode maps an HTTP status code to a gRPC status code.
+func rpcCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// checkPeer checks the address of the caller against the allowed networks
+// of the server.
+func (rs *RPCService) checkPeer(ctx context.Context) error {
+	acl := rs.Server.AllowedNetworks
+	if acl == nil {
+		return nil
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.PermissionDenied, "client not allowed")
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || !containsIP(acl.Allow, ip) {
+		return status.Errorf(codes.PermissionDenied, "client not allowed: %s", p.Addr)
+	}
+	return nil
+}
+
+// rpcError turns a database error into a gRPC status error.
+func rpcError(err error, format string, args ...interface{}) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		code = codes.NotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		code = codes.Internal
+	}
+	return status.Errorf(code, format+": %v", append(args, err)...)
+}
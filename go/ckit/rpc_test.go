@@ -0,0 +1,164 @@
+package ckit
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/slub/labe/go/ckit/labepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestRPCClient serves an RPCService over an in-memory connection.
+func newTestRPCClient(t *testing.T) labepb.LabeClient {
+	var (
+		lis = bufconn.Listen(1 << 20)
+		gs  = grpc.NewServer()
+	)
+	labepb.RegisterLabeServer(gs, &RPCService{Server: newTestServer(t), Workers: 4, MaxBatchSize: 10})
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return labepb.NewLabeClient(conn)
+}
+
+func TestRPCLookup(t *testing.T) {
+	var (
+		client = newTestRPCClient(t)
+		ctx    = context.Background()
+	)
+	resp, err := client.Lookup(ctx, &labepb.LookupRequest{Key: &labepb.LookupRequest_Id{Id: "i0029"}})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if resp.Doi != "d0029" || len(resp.Citing) == 0 || len(resp.Extra) == 0 {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+	byDOI, err := client.Lookup(ctx, &labepb.LookupRequest{Key: &labepb.LookupRequest_Doi{Doi: "d0029"}})
+	if err != nil {
+		t.Fatalf("lookup doi: %v", err)
+	}
+	if byDOI.Id != "i0029" || len(byDOI.Citing) != len(resp.Citing) {
+		t.Fatalf("got %v, want same response as for i0029", byDOI)
+	}
+	var cases = []struct {
+		req  *labepb.LookupRequest
+		code codes.Code
+	}{
+		{&labepb.LookupRequest{}, codes.InvalidArgument},
+		{&labepb.LookupRequest{Key: &labepb.LookupRequest_Id{Id: "xxx"}}, codes.NotFound},
+		{&labepb.LookupRequest{Key: &labepb.LookupRequest_Doi{Doi: "xxx"}}, codes.NotFound},
+		{&labepb.LookupRequest{
+			Key:     &labepb.LookupRequest_Id{Id: "i0029"},
+			Options: &labepb.Options{Sort: "xxx"},
+		}, codes.InvalidArgument},
+	}
+	for _, c := range cases {
+		_, err := client.Lookup(ctx, c.req)
+		if got := status.Code(err); got != c.code {
+			t.Fatalf("%v: got %v, want %v", c.req, got, c.code)
+		}
+	}
+}
+
+func TestRPCBatchLookup(t *testing.T) {
+	client := newTestRPCClient(t)
+	ids := []string{"i0029", "xxx", "i0030", "i0029"}
+	stream, err := client.BatchLookup(context.Background(), &labepb.BatchLookupRequest{Ids: ids})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	var results []*labepb.LookupResult
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		results = append(results, r)
+	}
+	if len(results) != len(ids) {
+		t.Fatalf("got %d results, want %d", len(results), len(ids))
+	}
+	for i, r := range results {
+		if r.Id != ids[i] {
+			t.Fatalf("got %s at %d, want %s", r.Id, i, ids[i])
+		}
+	}
+	if results[0].Response == nil || codes.Code(results[1].Code) != codes.NotFound {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	stream, err = client.BatchLookup(context.Background(), &labepb.BatchLookupRequest{Ids: make([]string, 11)})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument for batch over limit", err)
+	}
+}
+
+func TestRPCCountsAndGraph(t *testing.T) {
+	var (
+		client = newTestRPCClient(t)
+		ctx    = context.Background()
+	)
+	c, err := client.Counts(ctx, &labepb.CountsRequest{Id: "i0029"})
+	if err != nil {
+		t.Fatalf("counts: %v", err)
+	}
+	if c.Doi != "d0029" || c.Citing == 0 || c.Cited == 0 {
+		t.Fatalf("unexpected counts: %v", c)
+	}
+	stream, err := client.Graph(ctx, &labepb.GraphRequest{Id: "i0029", Depth: 2})
+	if err != nil {
+		t.Fatalf("graph: %v", err)
+	}
+	var (
+		seen       = make(map[[2]string]bool)
+		maxDepth   int32
+		hasCitedBy bool
+	)
+	for {
+		e, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		key := [2]string{e.CitingId, e.CitedId}
+		if seen[key] {
+			t.Fatalf("duplicate edge: %v", e)
+		}
+		seen[key] = true
+		if e.CitedId == "i0029" && e.CitingId == "i0069" {
+			hasCitedBy = true
+		}
+		if e.Depth > maxDepth {
+			maxDepth = e.Depth
+		}
+	}
+	if !hasCitedBy || len(seen) == 0 || maxDepth > 2 {
+		t.Fatalf("unexpected graph: %v (depth %d)", seen, maxDepth)
+	}
+	stream, err = client.Graph(ctx, &labepb.GraphRequest{Id: "xxx"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("got %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,131 @@
+package ckit
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// indexExamples is the number of example links on the index page.
+	indexExamples = 7
+	// exampleCandidates is the number of identifiers sampled per example,
+	// to find identifiers with citations.
+	exampleCandidates = 4
+)
+
+// SampleKeys returns up to n random keys from a map database, e.g. local
+// identifiers for benchmarks. For sqlite3 tables with a rowid, random rowids
+// are looked up, which is fast on large tables; otherwise the whole table is
+// shuffled, which may take a while. Keys may repeat, if a key appears in more
+// than one row.
+func SampleKeys(db *sqlx.DB, n int) ([]string, error) {
+	return sampleKeys(db, n, rand.Int63n)
+}
+
+// SampleKeysSeed is like SampleKeys, but the sample only depends on the seed
+// (and the database), e.g. for reproducible load profiles. This does not
+// apply to tables without rowid, which are shuffled by the database.
+func SampleKeysSeed(db *sqlx.DB, n int, seed int64) ([]string, error) {
+	return sampleKeys(db, n, rand.New(rand.NewSource(seed)).Int63n)
+}
+
+// sampleKeys samples keys with a given random number function.
+func sampleKeys(db *sqlx.DB, n int, int63n func(int64) int64) ([]string, error) {
+	var maxRowid int64
+	if err := db.Get(&maxRowid, "SELECT coalesce(max(rowid), 0) FROM map"); err != nil || maxRowid == 0 {
+		var keys []string
+		err := db.Select(&keys, db.Rebind("SELECT k FROM map ORDER BY random() LIMIT ?"), n)
+		return keys, err
+	}
+	var (
+		keys    []string
+		attempt int
+	)
+	stmt, err := db.Preparex("SELECT k FROM map WHERE rowid = ?")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	// Rowids may have gaps, e.g. after deletions; give up eventually.
+	for len(keys) < n && attempt < 10*n {
+		attempt++
+		var k []string
+		if err := stmt.Select(&k, int63n(maxRowid)+1); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+	}
+	return keys, nil
+}
+
+// exampleIdentifiers returns up to n random local identifiers from the
+// identifier database, e.g. for links on the index page; identifiers with
+// citations come first, others are only included, if there are not enough
+// of them. Errors are logged and end the search early.
+func (s *Server) exampleIdentifiers(ctx context.Context, n int) []string {
+	db := s.data(ctx).IdentifierDatabase
+	if db == nil {
+		return nil
+	}
+	keys, err := SampleKeys(db, exampleCandidates*n)
+	if err != nil {
+		log.Printf("examples: %v", err)
+		return nil
+	}
+	var (
+		seen    = make(map[string]bool)
+		cited   []string
+		uncited []string
+	)
+	for _, k := range keys {
+		if len(cited) == n {
+			break
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		e, err := s.exists(ctx, k)
+		if err != nil {
+			log.Printf("examples: %v", err)
+			break
+		}
+		if e.HasEdges() {
+			cited = append(cited, k)
+		} else {
+			uncited = append(uncited, k)
+		}
+	}
+	result := append(cited, uncited...)
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// exampleSet are the example identifiers of an identifier database.
+type exampleSet struct {
+	once sync.Once
+	ids  []string
+}
+
+// cachedExamples returns example identifiers for the index page. They are
+// sampled once per identifier database, i.e. again after a reload, not on
+// every request.
+func (s *Server) cachedExamples(ctx context.Context) []string {
+	db := s.data(ctx).IdentifierDatabase
+	if db == nil {
+		return nil
+	}
+	v, _ := s.examples.LoadOrStore(db, &exampleSet{})
+	es := v.(*exampleSet)
+	es.once.Do(func() {
+		// A canceled request must not leave the index without examples.
+		es.ids = s.exampleIdentifiers(context.WithoutCancel(ctx), indexExamples)
+	})
+	return es.ids
+}
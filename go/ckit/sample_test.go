@@ -0,0 +1,130 @@
+package ckit
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestSampleKeys(t *testing.T) {
+	db, err := OpenDatabase("testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	keys, err := SampleKeys(db, 10)
+	if err != nil {
+		t.Fatalf("sample: %v", err)
+	}
+	if len(keys) != 10 {
+		t.Fatalf("got %d keys, want 10", len(keys))
+	}
+	for _, k := range keys {
+		if !strings.HasPrefix(k, "i") {
+			t.Fatalf("unexpected key: %s", k)
+		}
+	}
+	// Tables without rowid are shuffled instead.
+	cdb, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "clustered.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer cdb.Close()
+	for _, q := range []string{
+		"CREATE TABLE map (k TEXT, v TEXT, PRIMARY KEY (k, v)) WITHOUT ROWID",
+		"INSERT INTO map VALUES ('a', '1'), ('b', '2'), ('c', '3')",
+	} {
+		if _, err := cdb.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	if keys, err = SampleKeys(cdb, 2); err != nil || len(keys) != 2 {
+		t.Fatalf("got %v, %v, want two keys", keys, err)
+	}
+}
+
+func TestSampleKeysSeed(t *testing.T) {
+	db, err := OpenDatabase("testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	defer db.Close()
+	a, err := SampleKeysSeed(db, 20, 7)
+	if err != nil {
+		t.Fatalf("sample: %v", err)
+	}
+	b, _ := SampleKeysSeed(db, 20, 7)
+	if len(a) != 20 || !reflect.DeepEqual(a, b) {
+		t.Fatalf("got %v and %v, want the same 20 keys", a, b)
+	}
+}
+
+func TestExampleIdentifiers(t *testing.T) {
+	var (
+		srv = newTestServer(t)
+		ctx = context.Background()
+	)
+	ids := srv.exampleIdentifiers(ctx, 5)
+	if len(ids) != 5 {
+		t.Fatalf("got %v, want 5 examples", ids)
+	}
+	// Identifiers with citations come first.
+	var uncited bool
+	for _, id := range ids {
+		e, err := srv.exists(ctx, id)
+		if err != nil {
+			t.Fatalf("exists: %v", err)
+		}
+		if e.HasEdges() && uncited {
+			t.Fatalf("got %v, want identifiers with citations first", ids)
+		}
+		uncited = uncited || !e.HasEdges()
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if n := strings.Count(rr.Body.String(), "/id/i0"); n != indexExamples {
+		t.Fatalf("got %d example links, want %d", n, indexExamples)
+	}
+}
+
+func TestCachedExamples(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Reload = func() (*Datasets, error) {
+		db, err := OpenDatabase("testdata/id_doi.db")
+		if err != nil {
+			return nil, err
+		}
+		d := srv.datasets()
+		d.IdentifierDatabase = db
+		return d, nil
+	}
+	index := func() string {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		return rr.Body.String()
+	}
+	// Examples are sampled once, not on every request.
+	first := index()
+	if got := index(); got != first {
+		t.Fatalf("got other examples on second request, want the same")
+	}
+	old := srv.data(context.Background()).IdentifierDatabase
+	if _, ok := srv.examples.Load(old); !ok {
+		t.Fatalf("want examples kept for identifier database")
+	}
+	// A reload samples new examples from the new database.
+	if _, err := srv.ReloadDatasets(false); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if _, ok := srv.examples.Load(old); ok {
+		t.Fatalf("want examples of old identifier database removed")
+	}
+	if n := strings.Count(index(), "/id/i0"); n != indexExamples {
+		t.Fatalf("got %d example links after reload, want %d", n, indexExamples)
+	}
+}
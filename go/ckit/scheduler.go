@@ -0,0 +1,257 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+// ErrSkipJob ends a job run early, without an error, e.g. if there is no
+// newer release of a dataset.
+var ErrSkipJob = errors.New("nothing to do")
+
+// Job outcomes, as reported in JobStatus.
+const (
+	JobOK      = "ok"
+	JobSkipped = "skipped"
+	JobFailed  = "failed"
+)
+
+// Step is a single step of a job, e.g. downloading or swapping a dataset.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Job runs its steps in order, on a schedule; a failing step ends the run.
+type Job struct {
+	Name string
+	// Schedule of the job; with a zero schedule, the job only runs when
+	// triggered.
+	Schedule Schedule
+	Steps    []Step
+	// Timeout limits a single run, zero means no limit.
+	Timeout time.Duration
+}
+
+// StepStatus is the outcome of a step of the last run of a job.
+type StepStatus struct {
+	Name string  `json:"name"`
+	Took float64 `json:"took"` // seconds
+	Err  string  `json:"err,omitempty"`
+}
+
+// JobStatus describes the schedule and the last run of a job.
+type JobStatus struct {
+	Name         string       `json:"name"`
+	Schedule     string       `json:"schedule"`
+	Next         string       `json:"next,omitempty"`
+	Running      bool         `json:"running"`
+	Runs         int          `json:"runs"`
+	LastStarted  string       `json:"last_started,omitempty"`
+	LastFinished string       `json:"last_finished,omitempty"`
+	LastOutcome  string       `json:"last_outcome,omitempty"`
+	LastErr      string       `json:"last_err,omitempty"`
+	Steps        []StepStatus `json:"steps,omitempty"`
+}
+
+// Scheduler runs jobs on their schedules or when triggered; a job never runs
+// concurrently with itself.
+type Scheduler struct {
+	jobs    []*Job
+	trigger map[string]chan struct{}
+
+	mu     sync.Mutex
+	status map[string]*JobStatus
+}
+
+// NewScheduler creates a scheduler; job names must be unique.
+func NewScheduler(jobs ...*Job) (*Scheduler, error) {
+	s := &Scheduler{
+		jobs:    jobs,
+		trigger: make(map[string]chan struct{}),
+		status:  make(map[string]*JobStatus),
+	}
+	for _, job := range jobs {
+		if job.Name == "" {
+			return nil, fmt.Errorf("scheduler: job without name")
+		}
+		if _, ok := s.trigger[job.Name]; ok {
+			return nil, fmt.Errorf("scheduler: duplicate job: %s", job.Name)
+		}
+		if len(job.Steps) == 0 {
+			return nil, fmt.Errorf("scheduler: job without steps: %s", job.Name)
+		}
+		s.trigger[job.Name] = make(chan struct{}, 1)
+		s.status[job.Name] = &JobStatus{Name: job.Name, Schedule: job.Schedule.String()}
+		if next := job.Schedule.Next(time.Now()); !next.IsZero() {
+			s.status[job.Name].Next = next.Format(time.RFC3339)
+		}
+	}
+	return s, nil
+}
+
+// Run runs the jobs until the context is canceled.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+// loop runs a job on its schedule or when triggered.
+func (s *Scheduler) loop(ctx context.Context, job *Job) {
+	for {
+		var (
+			next  = job.Schedule.Next(time.Now())
+			timer *time.Timer
+			fire  <-chan time.Time
+		)
+		s.update(job.Name, func(st *JobStatus) {
+			st.Next = ""
+			if !next.IsZero() {
+				st.Next = next.Format(time.RFC3339)
+			}
+		})
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-fire:
+		case <-s.trigger[job.Name]:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		s.runJob(ctx, job)
+	}
+}
+
+// update changes the status of a job.
+func (s *Scheduler) update(name string, f func(*JobStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.status[name])
+}
+
+// runJob runs the steps of a job and records the outcome.
+func (s *Scheduler) runJob(ctx context.Context, job *Job) {
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+	started := time.Now()
+	s.update(job.Name, func(st *JobStatus) {
+		st.Running, st.Runs = true, st.Runs+1
+		st.LastStarted, st.LastFinished, st.LastErr, st.Steps = started.Format(time.RFC3339), "", "", nil
+	})
+	log.Printf("job %s: started", job.Name)
+	outcome := JobOK
+	for _, step := range job.Steps {
+		t := time.Now()
+		err := step.Run(ctx)
+		status := StepStatus{Name: step.Name, Took: time.Since(t).Seconds()}
+		switch {
+		case errors.Is(err, ErrSkipJob):
+			outcome = JobSkipped
+			log.Printf("job %s: %s: %v, skipping remaining steps", job.Name, step.Name, err)
+		case err != nil:
+			outcome, status.Err = JobFailed, err.Error()
+			log.Printf("job %s: %s failed: %v", job.Name, step.Name, err)
+		default:
+			log.Printf("job %s: %s done (%s)", job.Name, step.Name, time.Since(t).Round(time.Millisecond))
+		}
+		s.update(job.Name, func(st *JobStatus) {
+			st.Steps = append(st.Steps, status)
+			if status.Err != "" {
+				st.LastErr = fmt.Sprintf("%s: %s", step.Name, status.Err)
+			}
+		})
+		if err != nil {
+			break
+		}
+	}
+	s.update(job.Name, func(st *JobStatus) {
+		st.Running, st.LastOutcome = false, outcome
+		st.LastFinished = time.Now().Format(time.RFC3339)
+	})
+	log.Printf("job %s: %s (%s)", job.Name, outcome, time.Since(started).Round(time.Second))
+}
+
+// Trigger runs a job as soon as possible, unless it is running already.
+func (s *Scheduler) Trigger(name string) error {
+	ch, ok := s.trigger[name]
+	if !ok {
+		return fmt.Errorf("job not found: %s", name)
+	}
+	s.mu.Lock()
+	running := s.status[name].Running
+	s.mu.Unlock()
+	if running {
+		return fmt.Errorf("job running: %s", name)
+	}
+	select {
+	case ch <- struct{}{}:
+		return nil
+	default:
+		return fmt.Errorf("job already triggered: %s", name)
+	}
+}
+
+// Status returns the status of all jobs, sorted by name.
+func (s *Scheduler) Status() (result []JobStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, st := range s.status {
+		v := *st
+		v.Steps = append([]StepStatus(nil), st.Steps...)
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// handleJobs reports the status of all scheduled jobs.
+func (s *Server) handleJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Scheduler.Status()); err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+		}
+	}
+}
+
+// handleJobTrigger runs a scheduled job now.
+func (s *Server) handleJobTrigger() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if _, ok := s.Scheduler.trigger[name]; !ok {
+			httpErrLogf(w, http.StatusNotFound, "job not found: %s", name)
+			return
+		}
+		if err := s.Scheduler.Trigger(name); err != nil {
+			httpErrLog(w, http.StatusConflict, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
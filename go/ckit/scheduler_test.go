@@ -0,0 +1,183 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+// never is a schedule, which does not fire, so jobs only run when triggered.
+const never = "0 0 31 4 *"
+
+// waitForRun waits until a job has finished a number of runs.
+func waitForRun(t *testing.T, s *Scheduler, name string, runs int) JobStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, st := range s.Status() {
+			if st.Name == name && st.Runs >= runs && !st.Running {
+				return st
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish run %d", name, runs)
+	return JobStatus{}
+}
+
+func TestScheduler(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		staged  = filepath.Join(dir, "o.db.new")
+		target  = filepath.Join(dir, "o.db")
+		config  = filepath.Join(dir, "jobs.json")
+		counter int
+	)
+	w, err := NewCociWriter(staged, false)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	if err := w.ReadCSV(strings.NewReader("01-02,10.1/a,10.1/b\n")); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(config, []byte(fmt.Sprintf(`{"jobs": [
+		{"name": "oci", "schedule": %q, "steps": [
+			{"action": "verify", "path": %q},
+			{"action": "swap", "from": %q, "to": %q, "keep": true},
+			{"action": "exec", "command": ["true"]}]},
+		{"name": "broken", "schedule": "@daily", "timeout": "1m", "steps": [
+			{"action": "exec", "command": ["false"]},
+			{"action": "exec", "command": ["true"]}]}
+	]}`, never, staged, staged, target)), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s, err := LoadScheduler(config, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	skip, err := NewScheduler(&Job{Name: "skip", Steps: []Step{
+		{Name: "check", Run: func(ctx context.Context) error { return ErrSkipJob }},
+		{Name: "count", Run: func(ctx context.Context) error { counter++; return nil }},
+	}})
+	if err != nil {
+		t.Fatalf("scheduler: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	go skip.Run(ctx)
+	if st := s.Status(); len(st) != 2 || st[0].Name != "broken" || st[0].Next == "" || st[1].Runs != 0 {
+		t.Fatalf("got %+v, want two jobs, not run", st)
+	}
+	for _, name := range []string{"oci", "broken"} {
+		if err := s.Trigger(name); err != nil {
+			t.Fatalf("trigger: %v", err)
+		}
+	}
+	if st := waitForRun(t, s, "oci", 1); st.LastOutcome != JobOK || len(st.Steps) != 3 || st.LastErr != "" {
+		t.Fatalf("got %+v, want ok", st)
+	}
+	if b, err := os.ReadFile(target + ".old"); err != nil || string(b) != "old" {
+		t.Fatalf("got %q, %v, want replaced file kept", b, err)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatalf("got %v, want staged file moved", err)
+	}
+	if st := waitForRun(t, s, "broken", 1); st.LastOutcome != JobFailed || len(st.Steps) != 1 ||
+		!strings.HasPrefix(st.LastErr, "exec false") {
+		t.Fatalf("got %+v, want failed at first step", st)
+	}
+	// Without the staged file, verify fails.
+	s.Trigger("oci")
+	if st := waitForRun(t, s, "oci", 2); st.LastOutcome != JobFailed || len(st.Steps) != 1 {
+		t.Fatalf("got %+v, want failed verification", st)
+	}
+	skip.Trigger("skip")
+	if st := waitForRun(t, skip, "skip", 1); st.LastOutcome != JobSkipped || counter != 0 {
+		t.Fatalf("got %+v, %d, want skipped", st, counter)
+	}
+	if err := s.Trigger("unknown"); err == nil {
+		t.Fatalf("got nil, want error for unknown job")
+	}
+}
+
+func TestLoadSchedulerErrors(t *testing.T) {
+	var cases = []string{
+		`{"jobs": [{"name": "a", "schedule": "x", "steps": [{"action": "exec", "command": ["true"]}]}]}`,
+		`{"jobs": [{"name": "a", "schedule": "@daily", "steps": []}]}`,
+		`{"jobs": [{"name": "a", "schedule": "@daily", "steps": [{"action": "unknown"}]}]}`,
+		`{"jobs": [{"name": "a", "schedule": "@daily", "steps": [{"action": "reload"}]}]}`,
+		`{"jobs": [{"name": "a", "schedule": "@daily", "steps": [{"action": "swap", "from": "x"}]}]}`,
+		`{"jobs": [{"name": "a", "schedule": "@daily", "timeout": "x", "steps": [{"action": "exec", "command": ["true"]}]}]}`,
+		`{"jobs": [{"name": "a", "schedule": "@daily", "steps": [{"action": "exec", "command": ["true"]}]},
+			{"name": "a", "schedule": "@daily", "steps": [{"action": "exec", "command": ["true"]}]}]}`,
+	}
+	for _, c := range cases {
+		filename := filepath.Join(t.TempDir(), "jobs.json")
+		if err := os.WriteFile(filename, []byte(c), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := LoadScheduler(filename, nil); err == nil {
+			t.Fatalf("[%s] got nil, want error", c)
+		}
+	}
+}
+
+func TestHandleJobs(t *testing.T) {
+	done := make(chan struct{})
+	s, err := NewScheduler(&Job{Name: "wait", Steps: []Step{
+		{Name: "wait", Run: func(ctx context.Context) error { <-done; return nil }},
+	}})
+	if err != nil {
+		t.Fatalf("scheduler: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	srv := newTestServer(t)
+	srv.Scheduler = s
+	srv.AdminRouter = mux.NewRouter()
+	srv.Routes()
+	post := func(target string) int {
+		rr := httptest.NewRecorder()
+		srv.AdminRouter.ServeHTTP(rr, httptest.NewRequest("POST", target, nil))
+		return rr.Code
+	}
+	if code := post("/admin/jobs/unknown"); code != 404 {
+		t.Fatalf("got %d, want 404", code)
+	}
+	if code := post("/admin/jobs/wait"); code != 202 {
+		t.Fatalf("got %d, want 202", code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.Status()[0].Running && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := post("/admin/jobs/wait"); code != 409 {
+		t.Fatalf("got %d, want 409 for running job", code)
+	}
+	close(done)
+	waitForRun(t, s, "wait", 1)
+	rr := httptest.NewRecorder()
+	srv.AdminRouter.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/jobs", nil))
+	var status []JobStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(status) != 1 || status[0].Runs != 1 || status[0].LastOutcome != JobOK {
+		t.Fatalf("got %+v, want one successful run", status)
+	}
+}
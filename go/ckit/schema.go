@@ -0,0 +1,192 @@
+package ckit
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// Response schema versions. Version 1 is the default and is kept stable for
+// existing consumers; version 2 is selected with the "v" query parameter or
+// with an Accept header of mediaTypeV2.
+const (
+	SchemaV1 = 1
+	SchemaV2 = 2
+)
+
+// mediaTypeV2 selects the version 2 schema via content negotiation.
+const mediaTypeV2 = "application/vnd.labe.v2+json"
+
+// negotiateVersion returns the response schema version for a request: an
+// explicit "v" parameter wins, otherwise version 2 is chosen, if the Accept
+// header asks for it.
+func negotiateVersion(r *http.Request) (int, error) {
+	if v := r.URL.Query().Get("v"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < SchemaV1 || version > SchemaV2 {
+			return 0, fmt.Errorf("invalid schema version: %s", v)
+		}
+		return version, nil
+	}
+	if strings.Contains(r.Header.Get("Accept"), mediaTypeV2) {
+		return SchemaV2, nil
+	}
+	return SchemaV1, nil
+}
+
+// ResponseV2 is the version 2 response schema: matched (in the index) and
+// unmatched (DOI only or resolved externally) documents are grouped by
+// direction, counts sit next to the documents they count, all fields are
+// always present and documents are in a stable order, unless sorted
+// explicitly.
+type ResponseV2 struct {
+	ID     string      `json:"id"`
+	DOI    string      `json:"doi"`
+	Citing DocumentSet `json:"citing"`
+	Cited  DocumentSet `json:"cited"`
+	Extra  ExtraV2     `json:"extra"`
+}
+
+// DocumentSet contains the citing or cited documents of a response.
+type DocumentSet struct {
+	Matched        []json.RawMessage `json:"matched"`
+	Unmatched      []json.RawMessage `json:"unmatched"`
+	MatchedCount   int               `json:"matched_count"`
+	UnmatchedCount int               `json:"unmatched_count"`
+	// TotalMatchedCount is the number of matched documents before
+	// truncation, only set if the response has been truncated.
+	TotalMatchedCount int `json:"total_matched_count,omitempty"`
+	// Edges contains edge attributes, keyed by related DOI, if any.
+	Edges map[string]EdgeMeta `json:"edges,omitempty"`
+	// Map lists local identifier and DOI of the matched documents, in the
+	// same order, if requested with map=1.
+	Map []IDMapping `json:"map,omitempty"`
+}
+
+// ExtraV2 contains information about the response.
+type ExtraV2 struct {
+	Version            int       `json:"version"`
+	Cached             bool      `json:"cached"`
+	Took               float64   `json:"took"` // seconds
+	Truncated          bool      `json:"truncated"`
+	ResolvedCount      int       `json:"resolved_count"`
+	MetadataMatched    int       `json:"metadata_matched_count"`
+	MutualCount        int       `json:"mutual_count"`
+	DuplicateEdgeCount int       `json:"duplicate_edge_count"`
+	Filters            FiltersV2 `json:"filters"`
+	// Sources maps related DOI to the names of the citation databases an
+	// edge was found in, if more than one is configured.
+	Sources    map[string][]string   `json:"sources,omitempty"`
+	Trace      []TraceEntry          `json:"trace,omitempty"`
+	Provenance map[string]Provenance `json:"provenance,omitempty"`
+	Edges      []RawEdge             `json:"edges,omitempty"`
+	Errors     []string              `json:"errors,omitempty"`
+	Degraded   []string              `json:"degraded,omitempty"`
+}
+
+// FiltersV2 lists the request options, which have been applied to the
+// documents; empty, if none.
+type FiltersV2 struct {
+	Institution string   `json:"institution,omitempty"`
+	From        int      `json:"from,omitempty"`
+	Until       int      `json:"until,omitempty"`
+	Sources     []string `json:"sources,omitempty"`
+	ISSN        []string `json:"issn,omitempty"`
+}
+
+// NewResponseV2 converts a response into the version 2 schema; unless sorted
+// (sorted is true), matched documents are ordered by id and unmatched
+// documents by DOI.
+func NewResponseV2(r *Response, sorted bool) *ResponseV2 {
+	v2 := &ResponseV2{
+		ID:  r.ID,
+		DOI: r.DOI,
+		Citing: newDocumentSet(r.Citing, r.Unmatched.Citing, r.Extra.TotalCitingCount,
+			r.Extra.Truncated, r.Extra.CitingEdges, sorted),
+		Cited: newDocumentSet(r.Cited, r.Unmatched.Cited, r.Extra.TotalCitedCount,
+			r.Extra.Truncated, r.Extra.CitedEdges, sorted),
+		Extra: ExtraV2{
+			Version:            SchemaV2,
+			Cached:             r.Extra.Cached,
+			Took:               r.Extra.Took,
+			Truncated:          r.Extra.Truncated,
+			ResolvedCount:      r.Extra.ResolvedCount,
+			MetadataMatched:    r.Extra.MetadataMatchedCount,
+			MutualCount:        r.Extra.MutualCount,
+			DuplicateEdgeCount: r.Extra.DuplicateEdgeCount,
+			Filters: FiltersV2{
+				Institution: r.Extra.Institution,
+				From:        r.Extra.From,
+				Until:       r.Extra.Until,
+				Sources:     r.Extra.SourceFilter,
+				ISSN:        r.Extra.ISSNFilter,
+			},
+			Sources:    r.Extra.Sources,
+			Trace:      r.Extra.Trace,
+			Provenance: r.Extra.Provenance,
+			Edges:      r.Extra.Edges,
+			Errors:     r.Extra.Errors,
+			Degraded:   r.Extra.Degraded,
+		},
+	}
+	if r.Map != nil {
+		v2.Citing.Map, v2.Cited.Map = r.Map.Citing, r.Map.Cited
+		if !sorted {
+			v2.Citing.Map = sortedMappings(r.Map.Citing)
+			v2.Cited.Map = sortedMappings(r.Map.Cited)
+		}
+	}
+	return v2
+}
+
+// newDocumentSet groups documents; slices are copied, so the order of the
+// original response is not changed.
+func newDocumentSet(matched, unmatched []json.RawMessage, total int, truncated bool,
+	edges map[string]EdgeMeta, sorted bool) DocumentSet {
+	ds := DocumentSet{
+		Matched:        append([]json.RawMessage{}, matched...),
+		Unmatched:      append([]json.RawMessage{}, unmatched...),
+		MatchedCount:   len(matched),
+		UnmatchedCount: len(unmatched),
+		Edges:          edges,
+	}
+	if truncated {
+		ds.TotalMatchedCount = total
+	}
+	if !sorted {
+		sortDocumentsBy(ds.Matched, func(s *docSnippet) string { return s.ID })
+	}
+	sortDocumentsBy(ds.Unmatched, func(s *docSnippet) string { return s.DOI.first() })
+	return ds
+}
+
+// sortDocumentsBy sorts documents by a key, with the raw document as tie
+// breaker, so the order is the same for every request.
+func sortDocumentsBy(docs []json.RawMessage, key func(*docSnippet) string) {
+	type entry struct {
+		key string
+		doc json.RawMessage
+	}
+	entries := make([]entry, len(docs))
+	for i, doc := range docs {
+		var s docSnippet
+		entries[i].doc = doc
+		if err := json.Unmarshal(doc, &s); err == nil {
+			entries[i].key = key(&s)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		return bytes.Compare(entries[i].doc, entries[j].doc) < 0
+	})
+	for i := range entries {
+		docs[i] = entries[i].doc
+	}
+}
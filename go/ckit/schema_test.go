@@ -0,0 +1,99 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	var cases = []struct {
+		target  string
+		accept  string
+		version int
+		err     bool
+	}{
+		{"/id/1", "", SchemaV1, false},
+		{"/id/1?v=1", mediaTypeV2, SchemaV1, false},
+		{"/id/1?v=2", "", SchemaV2, false},
+		{"/id/1", mediaTypeV2 + ", application/json", SchemaV2, false},
+		{"/id/1?v=3", "", 0, true},
+		{"/id/1?v=x", "", 0, true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.target, nil)
+		r.Header.Set("Accept", c.accept)
+		version, err := negotiateVersion(r)
+		if (err != nil) != c.err || version != c.version {
+			t.Fatalf("[%s] got %v, %v, want %v, err %v", c.target, version, err, c.version, c.err)
+		}
+	}
+}
+
+func TestNewResponseV2(t *testing.T) {
+	var resp Response
+	if err := json.Unmarshal([]byte(`{
+	  "id": "1", "doi": "10.1/1",
+	  "citing": [{"id": "b"}, {"id": "a"}],
+	  "unmatched": {"citing": [{"doi_str_mv": "10.1/z"}, {"doi_str_mv": "10.1/y"}]},
+	  "extra": {"institution": "DE-14", "took": 0.5}
+	}`), &resp); err != nil {
+		t.Fatalf("could not unmarshal test response: %v", err)
+	}
+	var cases = []struct {
+		sorted bool
+		want   []string
+	}{
+		{false, []string{`{"id": "a"}`, `{"id": "b"}`}},
+		{true, []string{`{"id": "b"}`, `{"id": "a"}`}},
+	}
+	for _, c := range cases {
+		v := NewResponseV2(&resp, c.sorted)
+		var got []string
+		for _, doc := range v.Citing.Matched {
+			got = append(got, string(doc))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("[sorted=%v] got %v, want %v", c.sorted, got, c.want)
+		}
+		if string(v.Citing.Unmatched[0]) != `{"doi_str_mv": "10.1/y"}` {
+			t.Fatalf("got %s, want unmatched ordered by doi", v.Citing.Unmatched[0])
+		}
+		if v.Citing.MatchedCount != 2 || v.Citing.UnmatchedCount != 2 || v.Cited.Matched == nil ||
+			v.Extra.Version != SchemaV2 || v.Extra.Filters.Institution != "DE-14" {
+			t.Fatalf("got %+v", v)
+		}
+	}
+	// The original response keeps its order.
+	if string(resp.Citing[0]) != `{"id": "b"}` {
+		t.Fatalf("response modified: %s", resp.Citing[0])
+	}
+}
+
+func TestServerSchemaV2(t *testing.T) {
+	srv := newTestServer(t)
+	for _, target := range []string{"/id/i0029?v=2", "/id/i0029?v=2&sort=year"} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != 200 {
+			t.Fatalf("[%s] got %d, want 200", target, rr.Code)
+		}
+		var v ResponseV2
+		if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+			t.Fatalf("[%s] decode: %v", target, err)
+		}
+		// d0029 cites d0009, d0039, d0065 and is cited by d0069 and d0156
+		// (unmatched); fixture documents appear four times each.
+		if v.Extra.Version != SchemaV2 || v.Citing.MatchedCount != 12 || v.Cited.MatchedCount != 4 ||
+			v.Cited.UnmatchedCount != 1 || len(v.Citing.Unmatched) != 0 {
+			t.Fatalf("[%s] got %+v", target, v)
+		}
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029?v=9", nil))
+	if rr.Code != 400 {
+		t.Fatalf("got %d, want 400", rr.Code)
+	}
+}
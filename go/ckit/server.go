@@ -9,20 +9,25 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/icholy/replace"
 	"github.com/jmoiron/sqlx"
-	"github.com/klauspost/compress/zstd"
 	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/bloom"
 	"github.com/slub/labe/go/ckit/cache"
 	"github.com/slub/labe/go/ckit/set"
-	"github.com/slub/labe/go/ckit/tabutils"
 	"github.com/thoas/stats"
 	"golang.org/x/text/transform"
 )
@@ -58,7 +63,8 @@ type Snippet struct {
 // hover at around 10% (of 16GB) RAM.
 type Server struct {
 	// IdentifierDatabase maps local ids to DOI. The expected schema is
-	// documented here: https://github.com/miku/labe/tree/main/go/ckit#makta
+	// documented here: https://github.com/miku/labe/tree/main/go/ckit#makta;
+	// this can be an sqlite3 or a PostgreSQL database.
 	//
 	// 0-025152688     10.1007/978-3-476-03951-4
 	// 0-025351737     10.13109/9783666551536
@@ -68,7 +74,8 @@ type Server struct {
 	IdentifierDatabase *sqlx.DB
 	// OciDatabase contains DOI to DOI mappings representing a citation
 	// relationship. The expected schema is documented here:
-	// https://github.com/miku/labe/tree/main/go/ckit#makta
+	// https://github.com/miku/labe/tree/main/go/ckit#makta; this can be an
+	// sqlite3 or a PostgreSQL database.
 	//
 	// 10.1002/9781119393351.ch1       10.1109/icelmach.2012.6350005
 	// 10.1002/9781119393351.ch1       10.1115/detc2011-48151
@@ -76,6 +83,19 @@ type Server struct {
 	// 10.1002/9781119393351.ch1       10.1109/cdc.2013.6760196
 	// ...
 	OciDatabase *sqlx.DB
+	// OciShards optionally replace OciDatabase with the citation data split
+	// across multiple databases, see BuildOciShards and OpenOciShards.
+	// Outbound edges are looked up in a single shard, inbound edges in all
+	// shards in parallel.
+	OciShards []*sqlx.DB
+	// AdditionalOciDatabases are optional, supplementary citation databases
+	// (e.g. a local institutional citation set), with the same schema as
+	// OciDatabase. Edges from all citation databases are merged at query
+	// time and tagged with the name of their source.
+	AdditionalOciDatabases []OciSource
+	// Namespaces are optional, alternate identifier namespaces (e.g. PubMed
+	// ids), each served under "/{name}/{id}" and resolved via DOI.
+	Namespaces []Namespace
 	// IndexData allows to fetch a metadata blob for an identifier. This is
 	// an interface that in the past has been implemented by types wrapping
 	// microblob, SOLR and sqlite3, as well as a FetchGroup, that allows to
@@ -90,22 +110,229 @@ type Server struct {
 	IndexData Fetcher
 	// Router to register routes on.
 	Router *mux.Router
+	// AdminRouter, if set, gets the operational endpoints (cache info and
+	// purge, stats, pprof) instead of Router, e.g. to serve them on a
+	// separate, local address.
+	AdminRouter *mux.Router
 	// StopWatchEnabled enabled the stopwatch, a builtin, simplistic request tracer.
 	StopWatchEnabled bool
+	// StopWatchFormat is the format of stopwatch log output, "table"
+	// (default) or "json", one record per request with a span per phase.
+	StopWatchFormat string
 	// Cache for expensive items.
 	Cache *cache.Cache
 	// CacheTriggerDuration determines which items to cache.
 	CacheTriggerDuration time.Duration
+	// CacheAdmission, if set, additionally weighs computation time, size
+	// and request frequency of responses above the trigger duration.
+	CacheAdmission *CacheAdmission
+	// CacheVariantISILs are institutions, whose filtered responses are
+	// cached separately (key is id and ISIL), to save decoding and
+	// filtering the unfiltered cached response on each request.
+	CacheVariantISILs []string
+	// CacheSnapshotDir is the directory for cache snapshots, see
+	// SnapshotCache; defaults to the temporary directory.
+	CacheSnapshotDir string
 	// Stats, like request counts and status codes.
 	Stats *stats.Stats
+	// LookupTimeout limits queries against the identifier database, zero
+	// means no limit.
+	LookupTimeout time.Duration
+	// EdgesTimeout limits the citing and cited queries against the OCI
+	// database, zero means no limit.
+	EdgesTimeout time.Duration
+	// FetchTimeout limits the time spent fetching blobs from the index data
+	// store for a single request, zero means no limit. Fetcher does not
+	// take a context, so the timeout is only checked between blob fetches
+	// and a single slow fetch may exceed it.
+	FetchTimeout time.Duration
+	// RequestTimeout is an overall deadline for each request, independent
+	// of the client; when exceeded, queries and fetches are canceled and
+	// the request fails with a timeout error. Zero means no limit.
+	RequestTimeout time.Duration
+
+	// MaxDocuments limits the number of citing and cited documents (each)
+	// in a response, zero means no limit. Documents are truncated after
+	// filtering and sorting; truncated responses are not cached.
+	MaxDocuments int
+	// MaxEdges limits the number of citing and cited edges (together) a
+	// single request may expand, zero means no limit; requests for documents
+	// with more edges fail with status 413. With a counts database, the
+	// limit is checked before any edges are queried.
+	MaxEdges int
+	// StreamThreshold, if positive, is the number of matched documents
+	// above which a response is written while the documents are fetched,
+	// instead of being assembled in memory first; only responses without
+	// post-processing (filters, sorting, other formats) are streamed.
+	StreamThreshold int
+	// UnmatchedDOIField is the name of the DOI field of unmatched documents
+	// in responses, DefaultDOIField ("doi_str_mv") if empty, or
+	// SpindelDOIField ("doi") with Spindel. Documents are
+	// kept with the default field internally (including the cache) and
+	// renamed, when a response is written.
+	UnmatchedDOIField string
+	// Spindel is a compatibility mode for existing clients of spindel, the
+	// prototype of this server: it adds spindel's routes, "/q/{id}" like
+	// "/id/{id}" and the admin endpoint "/cache/size" with the number of
+	// cached responses, and uses spindel's field names in responses.
+	Spindel bool
+	// Limiter optionally caps the number of concurrently assembled
+	// responses (cache hits are not limited); requests beyond the limit and
+	// queue fail fast with status 503.
+	Limiter *ConcurrencyLimiter
+	// CountsDatabase optionally contains precomputed citing and cited counts
+	// per DOI, as generated by BuildCountsDatabase. Used for the counts
+	// endpoint and for early size estimation.
+	CountsDatabase *sqlx.DB
+	// RankDatabase optionally contains PageRank scores per DOI, as generated
+	// by BuildRankDatabase, for sorting by importance.
+	RankDatabase *sqlx.DB
+	// HoldingsDatabase optionally contains holdings (ISSN or local
+	// identifiers) per institution, as generated by BuildHoldingsDatabase;
+	// documents listed there count as held by the institution, in addition
+	// to the "institution" field of the index data.
+	HoldingsDatabase *sqlx.DB
+	// Resolver optionally looks up metadata for unmatched DOI from external
+	// services (e.g. Crossref), for at most MaxResolve documents per request
+	// (zero means no limit) and within ResolveTimeout (zero means no limit).
+	// Documents not resolved keep the bare DOI.
+	Resolver       DOIResolver
+	MaxResolve     int
+	ResolveTimeout time.Duration
+	// MatchDatabase optionally contains normalized titles, years and
+	// authors of index documents without a DOI, as generated by
+	// BuildMatchDatabase. Unmatched documents with metadata from the
+	// Resolver are matched against it, as many documents are held locally
+	// under records lacking a DOI.
+	MatchDatabase *sqlx.DB
+
+	// FieldFilter optionally removes fields from all documents in
+	// responses, after request options have been applied.
+	FieldFilter *FieldFilter
+	// AllowedNetworks optionally restricts access to clients from a list of
+	// networks, e.g. a campus network. AdminAllowedNetworks restricts the
+	// operational endpoints, in addition, if they are served on Router.
+	AllowedNetworks      *NetworkACL
+	AdminAllowedNetworks *NetworkACL
+	// Version and Buildtime of the server, reported by /version.
+	Version   string
+	Buildtime string
+	// Webhooks are optionally notified of reloads, cache flushes and
+	// readiness changes (see WatchReadiness).
+	Webhooks *Webhooks
+	// Scheduler optionally runs data update jobs (download, build, verify,
+	// swap, reload), with their status under /admin/jobs.
+	Scheduler *Scheduler
+	// ReleaseChecker optionally looks up the latest release of the citation
+	// dump, to report available updates via /version.
+	ReleaseChecker *ReleaseChecker
+	// AuditLog optionally records each query, e.g. for usage reporting.
+	AuditLog *AuditLog
+	// Tenants optionally identifies clients by API key or hostname, to
+	// apply a default institution, field policy and rate limit per tenant.
+	Tenants *Tenants
+	// EdgeFilter optionally contains all DOI found in the citation
+	// databases; if a DOI is not in the filter, edge queries are skipped.
+	EdgeFilter *bloom.Filter
+	// CacheControl maps endpoints to Cache-Control directives for
+	// successful responses, e.g. "id" to "public, max-age=3600", see
+	// CacheControlKeys; an Expires header is derived from max-age.
+	CacheControl map[string]string
+	// SlowRequestThreshold, if positive, logs a JSON record (id, isil,
+	// took, edge and blob counts, cache outcome) for each request taking
+	// longer than this duration.
+	SlowRequestThreshold time.Duration
+	// Degraded lists the components, which are unavailable, e.g. a citation
+	// database, which could not be opened; the server then serves responses
+	// without citations or with document stubs, see ComponentCitations and
+	// ComponentIndexData.
+	Degraded []Degradation
+
+	// stmts keeps prepared statements for hot queries.
+	stmts stmtCache
+	// edgeMeta caches edge queries per citation database, depending on the
+	// edge attributes available.
+	edgeMeta sync.Map
+	// examples keeps the example identifiers for the index page per
+	// identifier database, as sampling them takes a number of queries.
+	examples sync.Map
+	// Reload optionally opens the datasets anew, for reloading them at
+	// runtime via the admin endpoint "/admin/reload" (only available on
+	// AdminRouter) or ReloadDatasets.
+	Reload func() (*Datasets, error)
+
+	// current are the datasets since the last reload, initial counts the
+	// users of the datasets set on the server, before the first reload.
+	current atomic.Pointer[datasetsRef]
+	initial datasetsRef
+	// reloadMu serializes reloads.
+	reloadMu sync.Mutex
+	// cacheMetrics counts cache reads and writes.
+	cacheMetrics cacheMetrics
+	// phaseMetrics aggregates the time spent per request phase.
+	phaseMetrics phaseMetrics
+	// cacheCodec contains the compression options for cache values.
+	codecOnce  sync.Once
+	cacheCodec cacheCodec
+}
+
+// OciSource is a named citation database. Shards, if set, contain the edges
+// split across databases by the hash of the citing DOI (see ShardIndex) and
+// are used instead of DB.
+type OciSource struct {
+	Name   string
+	DB     *sqlx.DB
+	Shards []*sqlx.DB
 }
 
+// PrimaryOciSourceName is the source name used for edges from OciDatabase.
+const PrimaryOciSourceName = "oci"
+
 // Map is a generic lookup table. We use it together with sqlite3. This
 // corresponds to the format generated by the makta command line tool:
 // https://github.com/miku/labe/tree/main/go/ckit#makta.
 type Map struct {
 	Key   string `db:"k"`
 	Value string `db:"v"`
+	// EdgeMeta is only set for edges from citation databases with edge
+	// attributes.
+	EdgeMeta
+}
+
+// TimeoutError is returned, if a processing stage exceeded its configured
+// timeout. Partial contains diagnostics about the work done so far.
+type TimeoutError struct {
+	Stage   string `json:"stage"`
+	Timeout string `json:"timeout"`
+	Partial string `json:"partial,omitempty"`
+	// Request is set, if the overall request deadline has been exceeded
+	// (during Stage), rather than the timeout of the stage.
+	Request bool `json:"request,omitempty"`
+}
+
+// Error returns the error message.
+func (e *TimeoutError) Error() string {
+	if e.Request {
+		return fmt.Sprintf("%s: request deadline of %s exceeded (%s)", e.Stage, e.Timeout, e.Partial)
+	}
+	if e.Partial == "" {
+		return fmt.Sprintf("%s: timeout after %s", e.Stage, e.Timeout)
+	}
+	return fmt.Sprintf("%s: timeout after %s (%s)", e.Stage, e.Timeout, e.Partial)
+}
+
+// EdgeLimitError is returned with status 413, if a document has more edges
+// than a single request may expand.
+type EdgeLimitError struct {
+	Citing int `json:"citing"`
+	Cited  int `json:"cited"`
+	Limit  int `json:"limit"`
+}
+
+// Error returns the error message.
+func (e *EdgeLimitError) Error() string {
+	return fmt.Sprintf("edge limit exceeded: %d citing and %d cited edges, limit is %d",
+		e.Citing, e.Cited, e.Limit)
 }
 
 // ErrorMessage from failed requests.
@@ -126,6 +353,9 @@ type Response struct {
 		Citing []json.RawMessage `json:"citing,omitempty"`
 		Cited  []json.RawMessage `json:"cited,omitempty"`
 	} `json:"unmatched,omitempty"`
+	// Map lists local identifier and DOI of the citing and cited
+	// documents, if requested with map=1.
+	Map   *IDMap `json:"map,omitempty"`
 	Extra struct {
 		UnmatchedCitingCount int     `json:"unmatched_citing_count"`
 		UnmatchedCitedCount  int     `json:"unmatched_cited_count"`
@@ -136,48 +366,204 @@ type Response struct {
 		// Institution is set optionally (e.g. to "DE-14"), if the response has
 		// been tailored towards the holdings of a given institution.
 		Institution string `json:"institution,omitempty"`
+		// DuplicateEdgeCount is the number of duplicate edges found (and
+		// ignored) in the citation databases.
+		DuplicateEdgeCount int `json:"duplicate_edge_count,omitempty"`
+		// MutualCount is the number of DOI, which both cite and are cited
+		// by the requested document (including the document itself, for
+		// self-citations); these are listed as citing and cited.
+		MutualCount int `json:"mutual_count,omitempty"`
+		// ResolvedCount is the number of unmatched documents with metadata
+		// from an external service (e.g. Crossref).
+		ResolvedCount int `json:"resolved_count,omitempty"`
+		// MetadataMatchedCount is the number of local records, which have
+		// been matched to unmatched DOI by title, year and authors.
+		MetadataMatchedCount int `json:"metadata_matched_count,omitempty"`
+		// From and Until are set, if the response has been limited to
+		// documents published within a range of years (inclusive).
+		From  int `json:"from,omitempty"`
+		Until int `json:"until,omitempty"`
+		// SourceFilter is set, if the response has been limited to documents
+		// from a set of sources (catalogs).
+		SourceFilter []string `json:"source_filter,omitempty"`
+		// ISSNFilter is set, if the response has been limited to documents
+		// with any of these ISSN.
+		ISSNFilter []string `json:"issn_filter,omitempty"`
+		// Sources maps each related DOI to the names of the citation
+		// databases the edge was found in; only set, if more than one
+		// citation database is configured.
+		Sources map[string][]string `json:"sources,omitempty"`
+		// CitingEdges and CitedEdges contain edge attributes (e.g. OCI
+		// identifier, creation date), keyed by related DOI; only set, if
+		// the citation database contains edge attributes.
+		CitingEdges map[string]EdgeMeta `json:"citing_edges,omitempty"`
+		CitedEdges  map[string]EdgeMeta `json:"cited_edges,omitempty"`
+		// Truncated is set, if the number of citing or cited documents
+		// exceeded the configured maximum; in that case only the first
+		// documents (after filtering and sorting) are included and the
+		// total number of citing and cited documents is reported as well.
+		Truncated        bool `json:"truncated,omitempty"`
+		TotalCitingCount int  `json:"total_citing_count,omitempty"`
+		TotalCitedCount  int  `json:"total_cited_count,omitempty"`
+		// Trace contains the timings of the request phases, if requested
+		// with debug=1; encoding the response is not included.
+		Trace []TraceEntry `json:"trace,omitempty"`
+		// Provenance maps the local identifiers of citing and cited
+		// documents to the backend, which served the document, and the
+		// citation databases of the edge, if requested with provenance=1.
+		Provenance map[string]Provenance `json:"provenance,omitempty"`
+		// Edges lists the citing and cited DOI of all edges found in the
+		// citation databases, including edges to unmatched DOI, if
+		// requested with edges=1.
+		Edges []RawEdge `json:"edges,omitempty"`
+		// Errors lists problems with individual documents (e.g. invalid
+		// index data), which did not prevent the response.
+		Errors []string `json:"errors,omitempty"`
+		// Degraded lists the unavailable components (see
+		// ComponentCitations and ComponentIndexData), if the server runs
+		// with reduced functionality; such responses are not cached.
+		Degraded []string `json:"degraded,omitempty"`
 	} `json:"extra,omitempty"`
 }
 
 // applyInstitutionFilter rearranges cited and citing documents in-place based
 // on holdings of an institution (as found in the index data), identified by
-// its ISIL (ISO 15511). This method will panic, if the index metadata is not
-// valid JSON. In order for this to work, we expect an "institution" field in
-// the metadata.
-func (r *Response) applyInstitutionFilter(institution string) {
-	var (
-		citing []json.RawMessage
-		cited  []json.RawMessage
-		v      *Snippet
-	)
-	for _, b := range r.Citing {
-		v = snippetPool.Get().(*Snippet)
-		if err := json.Unmarshal(b, v); err != nil {
-			panic(fmt.Sprintf("internal data broken: %v", err))
+// its ISIL (ISO 15511). In order for this to work, we expect an "institution"
+// field in the metadata or the document in the holdings of the institution.
+// Documents, which are not valid JSON, are moved to the unmatched documents
+// and reported in Extra.Errors.
+func (r *Response) applyInstitutionFilter(institution string, holdings holdingSet) {
+	split := func(docs []json.RawMessage, unmatched *[]json.RawMessage, name string) (result []json.RawMessage) {
+		for i, b := range docs {
+			v := snippetPool.Get().(*Snippet)
+			v.Institutions = v.Institutions[:0] // fields missing in b are left as is
+			err := json.Unmarshal(b, v)
+			switch {
+			case err != nil:
+				r.reportInvalid(name, i, err)
+				*unmatched = append(*unmatched, b)
+			case SliceContains(v.Institutions, institution) || holdings.contains(b):
+				result = append(result, b)
+			default:
+				*unmatched = append(*unmatched, b)
+			}
+			snippetPool.Put(v)
 		}
-		if SliceContains(v.Institutions, institution) {
-			citing = append(citing, b)
-		} else {
-			r.Unmatched.Citing = append(r.Unmatched.Citing, b)
+		return result
+	}
+	r.Citing = split(r.Citing, &r.Unmatched.Citing, "citing")
+	r.Cited = split(r.Cited, &r.Unmatched.Cited, "cited")
+	r.updateCounts()
+	r.Extra.Institution = institution
+}
+
+// reportInvalid logs a document, which is not valid JSON, and reports it in
+// Extra.Errors.
+func (r *Response) reportInvalid(name string, i int, err error) {
+	msg := fmt.Sprintf("%s %d: invalid index data: %v", name, i, err)
+	log.Printf("%s: %s", r.ID, msg)
+	r.Extra.Errors = append(r.Extra.Errors, msg)
+}
+
+// applyYearFilter removes citing and cited documents, which have not been
+// published between from and until (inclusive); a zero value means no lower or
+// upper bound, respectively. Documents without a publication year are removed
+// as well. Unmatched documents carry no metadata and are kept. Documents,
+// which are not valid JSON, are removed and reported in Extra.Errors.
+func (r *Response) applyYearFilter(from, until int) {
+	keep := func(docs []json.RawMessage, name string) (result []json.RawMessage) {
+		for i, b := range docs {
+			var v docSnippet
+			if err := json.Unmarshal(b, &v); err != nil {
+				r.reportInvalid(name, i, err)
+				continue
+			}
+			year := v.year()
+			if year == 0 || (from > 0 && year < from) || (until > 0 && year > until) {
+				continue
+			}
+			result = append(result, b)
 		}
-		snippetPool.Put(v)
+		return result
 	}
-	for _, b := range r.Cited {
-		v = snippetPool.Get().(*Snippet)
-		if err := json.Unmarshal(b, v); err != nil {
-			panic(fmt.Sprintf("internal data broken: %v", err))
+	r.Citing = keep(r.Citing, "citing")
+	r.Cited = keep(r.Cited, "cited")
+	r.updateCounts()
+	r.Extra.From = from
+	r.Extra.Until = until
+}
+
+// applySourceFilter removes citing and cited documents, which do not belong to
+// any of the given sources, identified by source id or local identifier
+// prefix. Unmatched documents are not in the index and are kept. Documents,
+// which are not valid JSON, are removed and reported in Extra.Errors.
+func (r *Response) applySourceFilter(sources []string) {
+	keep := func(docs []json.RawMessage, name string) (result []json.RawMessage) {
+		for i, b := range docs {
+			var v docSnippet
+			if err := json.Unmarshal(b, &v); err != nil {
+				r.reportInvalid(name, i, err)
+				continue
+			}
+			if v.hasSource(sources) {
+				result = append(result, b)
+			}
 		}
-		if SliceContains(v.Institutions, institution) {
-			cited = append(cited, b)
-		} else {
-			r.Unmatched.Cited = append(r.Unmatched.Cited, b)
+		return result
+	}
+	r.Citing = keep(r.Citing, "citing")
+	r.Cited = keep(r.Cited, "cited")
+	r.updateCounts()
+	r.Extra.SourceFilter = sources
+}
+
+// applyISSNFilter removes citing and cited documents, which do not have any
+// of the given ISSN (normalized, e.g. 1234-567X) in their "issn" field.
+// Unmatched documents carry no metadata and are kept. Documents, which are
+// not valid JSON, are removed and reported in Extra.Errors.
+func (r *Response) applyISSNFilter(issn []string) {
+	keep := func(docs []json.RawMessage, name string) (result []json.RawMessage) {
+		for i, b := range docs {
+			var v docSnippet
+			if err := json.Unmarshal(b, &v); err != nil {
+				r.reportInvalid(name, i, err)
+				continue
+			}
+			for _, w := range v.ISSN {
+				if SliceContains(issn, normalizeHoldingID(w)) {
+					result = append(result, b)
+					break
+				}
+			}
 		}
-		snippetPool.Put(v)
+		return result
 	}
-	r.Citing = citing
-	r.Cited = cited
+	r.Citing = keep(r.Citing, "citing")
+	r.Cited = keep(r.Cited, "cited")
 	r.updateCounts()
-	r.Extra.Institution = institution
+	r.Extra.ISSNFilter = issn
+}
+
+// setEdgeMeta collects edge attributes, if there are any.
+func (r *Response) setEdgeMeta(citing, cited []Map) {
+	for _, m := range citing {
+		if m.EdgeMeta.IsZero() {
+			continue
+		}
+		if r.Extra.CitingEdges == nil {
+			r.Extra.CitingEdges = make(map[string]EdgeMeta)
+		}
+		r.Extra.CitingEdges[m.Value] = m.EdgeMeta
+	}
+	for _, m := range cited {
+		if m.EdgeMeta.IsZero() {
+			continue
+		}
+		if r.Extra.CitedEdges == nil {
+			r.Extra.CitedEdges = make(map[string]EdgeMeta)
+		}
+		r.Extra.CitedEdges[m.Key] = m.EdgeMeta
+	}
 }
 
 // updateCounts updates extra fields containing counts. Best called after the
@@ -189,22 +575,129 @@ func (r *Response) updateCounts() {
 	r.Extra.UnmatchedCitedCount = len(r.Unmatched.Cited)
 }
 
+// exceeds returns true, if there are more than n citing or cited documents;
+// n of zero means no limit.
+func (r *Response) exceeds(n int) bool {
+	return n > 0 && (len(r.Citing) > n || len(r.Cited) > n)
+}
+
+// truncate limits the citing and cited documents to the first n each and
+// records the totals, if the response exceeds n; it returns true, if the
+// response has been truncated.
+func (r *Response) truncate(n int) bool {
+	if !r.exceeds(n) {
+		return false
+	}
+	r.Extra.Truncated = true
+	r.Extra.TotalCitingCount = len(r.Citing)
+	r.Extra.TotalCitedCount = len(r.Cited)
+	if len(r.Citing) > n {
+		r.Citing = r.Citing[:n]
+	}
+	if len(r.Cited) > n {
+		r.Cited = r.Cited[:n]
+	}
+	r.updateCounts()
+	return true
+}
+
 // Routes sets up routes.
 func (s *Server) Routes() {
 	s.Router.HandleFunc("/", s.handleIndex()).Methods("GET")
-	s.Router.HandleFunc("/cache", s.handleCacheInfo()).Methods("GET")
-	s.Router.HandleFunc("/cache", s.handleCachePurge()).Methods("DELETE")
-	s.Router.HandleFunc("/doi/{doi:.*}", s.handleDOI()).Methods("GET")
-	s.Router.HandleFunc("/id/{id}", s.handleLocalIdentifier()).Methods("GET")
-	s.Router.HandleFunc("/stats", s.handleStats()).Methods("GET")
+	s.Router.HandleFunc("/doi/{doi:.*}", s.withCacheControl("doi", s.handleDOI())).Methods("GET")
+	s.Router.HandleFunc("/dois", s.handleBatchDOI()).Methods("POST")
+	s.Router.HandleFunc("/id/{id}", s.withCacheControl("id", s.handleLocalIdentifier())).Methods("GET")
+	s.Router.HandleFunc("/id/{id}", s.handleHead()).Methods("HEAD")
+	s.Router.HandleFunc("/id/{id}/counts", s.withCacheControl("counts", s.handleCounts())).Methods("GET")
+	s.Router.HandleFunc("/id/{id}/events", s.handleEvents()).Methods("GET")
+	s.Router.HandleFunc("/id/{id}/exists", s.withCacheControl("exists", s.handleExists())).Methods("GET")
+	s.Router.HandleFunc("/id/{id}/network", s.withCacheControl("network", s.handleNetwork())).Methods("GET")
+	s.Router.HandleFunc("/lookup/doi/{doi:.*}", s.withCacheControl("lookup", s.handleLookupDOI())).Methods("GET")
+	s.Router.HandleFunc("/lookup/id/{id}", s.withCacheControl("lookup", s.handleLookupID())).Methods("GET")
+	s.Router.HandleFunc("/map/{kind:doi|id}", s.handleMap()).Methods("POST")
+	s.Router.HandleFunc("/oci/{oci}", s.withCacheControl("oci", s.handleOCI())).Methods("GET")
+	s.Router.HandleFunc("/readyz", s.handleReadyz()).Methods("GET")
+	s.Router.HandleFunc("/top", s.withCacheControl("top", s.handleTop())).Methods("GET")
+	s.Router.HandleFunc("/view/{id}", s.withCacheControl("view", s.handleView())).Methods("GET")
+	s.Router.HandleFunc("/viz/{id}", s.withCacheControl("view", s.handleViz())).Methods("GET")
+	s.Router.HandleFunc("/index/v1/citations/{doi:.*}",
+		s.withCacheControl("citations", s.handleOpenCitations(false))).Methods("GET")
+	s.Router.HandleFunc("/index/v1/references/{doi:.*}",
+		s.withCacheControl("references", s.handleOpenCitations(true))).Methods("GET")
+	if s.Spindel {
+		s.Router.HandleFunc("/q/{id}", s.withCacheControl("id", s.handleLocalIdentifier())).Methods("GET")
+	}
+	for _, ns := range s.Namespaces {
+		s.Router.HandleFunc("/"+ns.Name+"/{id:.*}", s.withCacheControl("ns", s.handleNamespace(ns))).Methods("GET")
+	}
+	s.adminRoutes()
+}
+
+// adminRoutes sets up operational endpoints, on the admin router, if there
+// is one. Profiling is only available on a separate admin router.
+func (s *Server) adminRoutes() {
+	r := s.AdminRouter
+	if r == nil {
+		r = s.Router
+	}
+	acl := s.AdminAllowedNetworks
+	r.HandleFunc("/cache", withNetworkACL(acl, s.handleCacheInfo())).Methods("GET")
+	r.HandleFunc("/cache", withNetworkACL(acl, s.handleCachePurge())).Methods("DELETE")
+	r.HandleFunc("/cache/report", withNetworkACL(acl, s.handleCacheReport())).Methods("GET")
+	r.HandleFunc("/cache/snapshot", withNetworkACL(acl, s.handleCacheSnapshot())).Methods("POST")
+	if s.Spindel {
+		r.HandleFunc("/cache/size", withNetworkACL(acl, s.handleCacheSize())).Methods("GET")
+	}
+	r.HandleFunc("/stats", withNetworkACL(acl, s.handleStats())).Methods("GET")
+	r.HandleFunc("/version", withNetworkACL(acl, s.withCurrentDatasets(s.handleVersion()))).Methods("GET")
+	if s.Scheduler != nil {
+		r.HandleFunc("/admin/jobs", withNetworkACL(acl, s.handleJobs())).Methods("GET")
+	}
+	if s.AdminRouter == nil {
+		return
+	}
+	if s.Reload != nil {
+		r.HandleFunc("/admin/reload", withNetworkACL(acl, s.handleReload())).Methods("POST")
+	}
+	if s.Scheduler != nil {
+		r.HandleFunc("/admin/jobs/{name}", withNetworkACL(acl, s.handleJobTrigger())).Methods("POST")
+	}
+	r.HandleFunc("/debug/pprof/", withNetworkACL(acl, pprof.Index))
+	r.HandleFunc("/debug/pprof/cmdline", withNetworkACL(acl, pprof.Cmdline))
+	r.HandleFunc("/debug/pprof/profile", withNetworkACL(acl, pprof.Profile))
+	r.HandleFunc("/debug/pprof/symbol", withNetworkACL(acl, pprof.Symbol))
+	r.HandleFunc("/debug/pprof/trace", withNetworkACL(acl, pprof.Trace))
+	r.PathPrefix("/debug/pprof/").HandlerFunc(withNetworkACL(acl, pprof.Index))
 }
 
-// ServeHTTP turns the server into an HTTP handler.
+// ServeHTTP turns the server into an HTTP handler. The request deadline, if
+// any, is attached to the request context here.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.AllowedNetworks.Allowed(r) {
+		httpErrLog(w, http.StatusForbidden, fmt.Errorf("client not allowed: %s", r.RemoteAddr))
+		return
+	}
+	// Requests use the same datasets from start to end, even if they are
+	// reloaded in the meantime.
+	d, release := s.acquireDatasets()
+	defer release()
+	r = r.WithContext(withDatasets(r.Context(), d))
+	if s.RequestTimeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), s.RequestTimeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	if s.Tenants != nil {
+		var ok bool
+		if r, ok = s.withTenant(w, r); !ok {
+			return
+		}
+	}
 	s.Router.ServeHTTP(w, r)
 }
 
-// handleIndex handles the root route.
+// handleIndex handles the root route, with links to a random sample of
+// local identifiers, so the examples work on every deployment.
 func (s *Server) handleIndex() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		docs := `
@@ -220,31 +713,58 @@ Pid: {{ .PID }} | https://github.com/slub/labe
 
 Available endpoints:
 
-    /              GET
-    /cache         DELETE
-    /cache         GET
-    /doi/{doi}     GET
-    /id/{id}       GET
-    /stats         GET
+    /                   GET
+    /admin/jobs         GET (admin, status of scheduled update jobs, if configured)
+    /admin/jobs/{name}  POST (admin, separate listener only, run a scheduled job now)
+    /admin/reload       POST (admin, separate listener only, reopen databases, flush=1 empties the cache)
+    /cache              DELETE (admin)
+    /cache              GET (admin)
+    /cache/report       GET (admin, largest and latest entries, size by key prefix, n=20)
+    /cache/snapshot     POST (admin, write a copy of the cache, e.g. for new replicas)
+    /doi/{doi}          GET
+    /dois               POST (list of DOI to fused responses, counts=1 for counts only)
+    /id/{id}            GET, HEAD (status only, without fetching documents)
+    /id/{id}/counts     GET
+    /id/{id}/events     GET (server-sent progress events and result)
+    /id/{id}/exists     GET (cheap check for DOI and citation data)
+    /id/{id}/network    GET (citation network, including citations among neighbors)
+    /index/v1/citations/{doi}
+                        GET (OpenCitations COCI API format)
+    /index/v1/references/{doi}
+                        GET (OpenCitations COCI API format)
+    /lookup/doi/{doi}   GET (local identifier for a DOI, no citation data)
+    /lookup/id/{id}     GET (DOI for a local identifier, no citation data)
+    /map/doi            POST (list of DOI to local identifiers)
+    /map/id             POST (list of local identifiers to DOI)
+    /oci/{oci}          GET (citing and cited DOI of an OpenCitations identifier, requires indexed oci column)
+    /readyz             GET (readiness and degraded components, strict=1 fails if degraded)
+    /stats              GET (admin)
+    /top                GET (most cited documents, requires counts database)
+    /version            GET (admin, build and citation dump release, whether an update is available)
+    /view/{id}          GET (HTML page for a local identifier, for checking data)
+    /viz/{id}           GET (interactive citation graph of a local identifier)
+    /{ns}/{id}          GET (alternate namespaces, e.g. /pmid/{pmid}, if configured)
 
-Examples:
+Admin endpoints are served on a separate address, if configured.
 
-  http://{{ .Hostport }}/id/ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTA3My9wbmFzLjg1LjguMjQ0NA
-  http://{{ .Hostport }}/id/ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTAwMS9qYW1hLjI4Mi4xNi4xNTE5
-  http://{{ .Hostport }}/id/ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTAwNi9qbXJlLjE5OTkuMTcxNQ
-  http://{{ .Hostport }}/id/ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTE3Ny8xMDQ5NzMyMzA1Mjc2Njg3
-  http://{{ .Hostport }}/id/ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTIxMC9qYy4yMDExLTAzODU
-  http://{{ .Hostport }}/id/ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMTIxNC9hb3MvMTE3NjM0Nzk2Mw
-  http://{{ .Hostport }}/id/ai-49-aHR0cDovL2R4LmRvaS5vcmcvMTAuMjMwNy8yMDk1NTIx
+{{ if .Examples }}Examples (random sample):
 
+{{ range .Examples }}  http://{{ $.Hostport }}/id/{{ . }}
+{{ end }}{{ end }}
 `
+		var examples []string
+		for _, id := range s.cachedExamples(r.Context()) {
+			examples = append(examples, url.PathEscape(id))
+		}
 		t := template.Must(template.New("index").Parse(docs))
 		err := t.Execute(w, struct {
 			PID      int
 			Hostport string
+			Examples []string
 		}{
 			PID:      os.Getpid(),
 			Hostport: r.Host,
+			Examples: examples,
 		})
 		if err != nil {
 			httpErrLog(w, http.StatusInternalServerError, err)
@@ -263,9 +783,15 @@ func (s *Server) handleCacheInfo() http.HandlerFunc {
 			httpErrLog(w, http.StatusInternalServerError, err)
 			return
 		}
+		st, err := s.CacheStats()
+		if err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
 		err = json.NewEncoder(w).Encode(map[string]interface{}{
 			"count": count,
 			"path":  s.Cache.Path,
+			"stats": st,
 		})
 		if err != nil {
 			httpErrLog(w, http.StatusInternalServerError, err)
@@ -274,6 +800,27 @@ func (s *Server) handleCacheInfo() http.HandlerFunc {
 	}
 }
 
+// handleCacheSize returns the number of cached responses, like spindel.
+func (s *Server) handleCacheSize() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			count int
+			err   error
+		)
+		if s.Cache != nil {
+			if count, err = s.Cache.ItemCount(); err != nil {
+				httpErrLog(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]int{"count": count}); err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
 // handleCachePurge empties the cache.
 func (s *Server) handleCachePurge() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -286,6 +833,8 @@ func (s *Server) handleCachePurge() http.HandlerFunc {
 		} else {
 			log.Println("flushed cached")
 		}
+		s.cacheMetrics.resetSize()
+		s.notify(EventCacheFlushed, map[string]string{"reason": "purge"})
 	}
 }
 
@@ -300,7 +849,26 @@ func (s *Server) handleStats() http.HandlerFunc {
 	s.Stats.MetricsTimers = make(map[string]time.Time)
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(s.Stats.Data()); err != nil {
+		var data = struct {
+			*stats.Data
+			Limiter *LimiterStats         `json:"limiter,omitempty"`
+			Cache   *CacheStats           `json:"cache,omitempty"`
+			Phases  map[string]PhaseStats `json:"phases,omitempty"`
+		}{
+			Data:   s.Stats.Data(),
+			Phases: s.phaseMetrics.stats(),
+		}
+		if s.Limiter != nil {
+			ls := s.Limiter.Stats()
+			data.Limiter = &ls
+		}
+		cs, err := s.CacheStats()
+		if err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+		data.Cache = cs
+		if err := json.NewEncoder(w).Encode(data); err != nil {
 			httpErrLog(w, http.StatusInternalServerError, err)
 			return
 		}
@@ -309,57 +877,149 @@ func (s *Server) handleStats() http.HandlerFunc {
 
 // handleDOI currently only redirects to the local id handler.
 func (s *Server) handleDOI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.redirectDOI(w, r, mux.Vars(r)["doi"])
+	}
+}
+
+// redirectDOI redirects to the local identifier of a DOI.
+func (s *Server) redirectDOI(w http.ResponseWriter, r *http.Request, doi string) {
+	var (
+		ctx      = r.Context()
+		response = &Response{
+			DOI: doi,
+		}
+	)
+	id, err := s.lookupID(ctx, response.DOI)
+	response.ID = id
+	if err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(ctx, "lookup",
+				s.LookupTimeout, fmt.Sprintf("id lookup for %s", response.DOI)))
+		case err == context.Canceled:
+			log.Printf("handle doi: %v", err)
+		case err == sql.ErrNoRows:
+			http.Error(w, `{"msg": "no id found", "status": 404}`, http.StatusNotFound)
+		default:
+			httpErrLogf(w, http.StatusInternalServerError, "select id: %w", err)
+		}
+	} else {
+		loc := fmt.Sprintf("/id/%s", response.ID)
+		w.Header().Set("Content-Type", "text/plain") // disable http snippet
+		http.Redirect(w, r, loc, http.StatusTemporaryRedirect)
+	}
+}
+
+// handleCounts returns the number of citing and cited edges for a local
+// identifier, without fetching any documents.
+func (s *Server) handleCounts() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
-			ctx      = r.Context()
-			vars     = mux.Vars(r)
-			response = &Response{
-				DOI: vars["doi"],
-			}
+			ctx = r.Context()
+			id  = mux.Vars(r)["id"]
 		)
-		err := s.IdentifierDatabase.GetContext(ctx, &response.ID, "SELECT k FROM map WHERE v = ?", response.DOI)
+		doi, err := s.lookupDOI(ctx, id)
 		if err != nil {
-			switch {
-			case err == context.Canceled:
-				log.Printf("handle doi: %v", err)
-			default:
-				http.Error(w, `{"msg": "no id found", "status": 404}`, http.StatusNotFound)
-			}
-		} else {
-			loc := fmt.Sprintf("/id/%s", response.ID)
-			w.Header().Set("Content-Type", "text/plain") // disable http snippet
-			http.Redirect(w, r, loc, http.StatusTemporaryRedirect)
+			s.writeLookupError(w, r, id, err)
+			return
+		}
+		c, err := s.counts(ctx, doi)
+		if err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "counts: %w", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(struct {
+			ID string `json:"id"`
+			*Counts
+		}{
+			ID:     id,
+			Counts: c,
+		})
+		if err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
 		}
 	}
 }
 
 // serveFromCache tries to serve a response from cache. If this method returns
-// nil, the response has been successfully served from the cache.
-func (s *Server) serveFromCache(w http.ResponseWriter, r *http.Request) error {
+// nil, the response has been successfully served from the cache. For
+// institutions in CacheVariantISILs, the filtered variant is served, if
+// cached, otherwise it is derived from the unfiltered response and cached.
+// Values, which need no post-processing, are sent compressed, if the client
+// accepts zstd.
+func (s *Server) serveFromCache(w http.ResponseWriter, r *http.Request, opts *requestOptions, sw *StopWatch, rec *AuditRecord) error {
 	var (
-		t    = time.Now()
-		vars = mux.Vars(r)
-		id   = vars["id"]
-		isil = r.URL.Query().Get("i")
+		t          = time.Now()
+		vars       = mux.Vars(r)
+		id         = vars["id"]
+		variantKey = s.cacheVariantKey(r.Context(), id, opts, rec)
+		variant    bool
+		b          []byte
+		err        error
 	)
-	b, err := s.Cache.Get(id)
-	if err != nil {
-		return err
+	if variantKey != "" {
+		b, err = s.Cache.Get(variantKey)
+		switch {
+		case err == nil:
+			variant = true
+			s.cacheMetrics.variantHits.Add(1)
+		case err != cache.ErrCacheMiss:
+			return err
+		}
+	}
+	if !variant {
+		if b, err = s.Cache.Get(id); err != nil {
+			return err
+		}
+	}
+	w.Header().Set("X-Cache", "HIT")
+	raw := !opts.Map && (variant || (opts.isZero() && s.rawCacheable(r.Context(), opts, rec)))
+	if raw && acceptsEncoding(r, "zstd") && isPlainZstd(b) {
+		// Send the compressed value as is; "took" is the time it took
+		// originally.
+		w.Header().Set("Content-Encoding", "zstd")
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if _, err := w.Write(b); err != nil {
+			return fmt.Errorf("cache copy: %w", err)
+		}
+		return nil
 	}
-	zr, err := zstd.NewReader(bytes.NewReader(b))
+	zr, err := s.newCacheReader(bytes.NewReader(b))
 	if err != nil {
 		return fmt.Errorf("cache decompress: %w", err)
 	}
 	took := fmt.Sprintf(`"took":%f`, time.Since(t).Seconds())
 	replacer := transform.NewReader(zr, replace.RegexpString(regexp.MustCompile(`"took":[0-9.]+`), took))
 	switch {
-	case isil != "":
+	case !raw:
 		var resp Response
 		if err := json.NewDecoder(replacer).Decode(&resp); err != nil {
 			return fmt.Errorf("cache json decode: %w", err)
 		}
-		resp.applyInstitutionFilter(isil)
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
+		sw.RecordPhasef(phaseCache, "decoded cached value")
+		if !variant {
+			if err := s.postprocess(r.Context(), &resp, opts); err != nil {
+				return err
+			}
+			if err := s.cacheVariant(variantKey, &resp); err != nil {
+				return err
+			}
+		}
+		if opts.Map {
+			if err := s.addIDMap(r.Context(), &resp); err != nil {
+				return err
+			}
+			sw.RecordPhasef(phaseIDMap, "added id map")
+		}
+		resp.applyFieldFilter(s.fieldFilter(r.Context()))
+		rec.setCounts(&resp)
+		if opts.Debug {
+			sw.RecordPhasef(phasePostprocess, "applied request options")
+			resp.Extra.Trace = sw.Trace()
+		}
+		if err := encodeResponse(w, &resp, opts, s.unmatchedDOIField()); err != nil {
 			return fmt.Errorf("encode: %w", err)
 		}
 	default:
@@ -371,10 +1031,17 @@ func (s *Server) serveFromCache(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-// cacheResponse prepares and caches a response. If the cache is read-only no
-// error is returned (but the value is not cached). Other caching errors are
-// returned.
+// cacheResponse prepares and caches a response. If the cache is read-only or
+// the response is not admitted, no error is returned (but the value is not
+// cached). Other caching errors are returned.
 func (s *Server) cacheResponse(response *Response) error {
+	return s.cacheResponseKey(response.ID, response, true)
+}
+
+// cacheResponseKey caches a response under a given key, see cacheResponse.
+// With admission, the response is only cached, if the admission policy (if
+// any) agrees; otherwise the cached flag is reset.
+func (s *Server) cacheResponseKey(key string, response *Response, admission bool) error {
 	response.Extra.Cached = true
 	var (
 		t   = time.Now()
@@ -382,24 +1049,29 @@ func (s *Server) cacheResponse(response *Response) error {
 	)
 	buf.Reset()
 	defer bufPool.Put(buf)
-	zw, err := zstd.NewWriter(buf)
+	zw, err := s.newCacheWriter(buf)
 	if err != nil {
 		return fmt.Errorf("cache compress: %w", err)
 	}
 	// We cache the unfiltered response (otherwise the cache would
-	// waste disk space).
-	if err := json.NewEncoder(zw).Encode(response); err != nil {
+	// waste disk space), except for the variants of CacheVariantISILs.
+	cw := &countingWriter{w: zw}
+	if err := json.NewEncoder(cw).Encode(response); err != nil {
 		return fmt.Errorf("cache json encode: %w", err)
 	}
 	if err := zw.Close(); err != nil {
 		return fmt.Errorf("cache close: %w", err)
 	}
-	if err := s.Cache.Set(response.ID, buf.Bytes()); err != nil {
+	if admission && !s.admitCache(key, buf.Len(), response.Extra.Took) {
+		response.Extra.Cached = false
+		return nil
+	}
+	if err := s.setCache(key, buf.Bytes(), cw.n); err != nil {
 		if err == cache.ErrReadOnly {
 			return nil
 		} else {
 			// TODO: we would not need to fail, if cache fails; but do for now
-			return fmt.Errorf("failed to cache value for %s: %v", response.ID, err)
+			return fmt.Errorf("failed to cache value for %s: %v", key, err)
 		}
 	}
 	s.Stats.MeasureSinceWithLabels("cached", t, nil)
@@ -417,77 +1089,166 @@ func (s *Server) handleLocalIdentifier() http.HandlerFunc {
 		// (5) include unmatched ids
 		// (6) assemble result
 		// (7) cache, if request was expensive
-		// (8) optional: apply institution filter
+		// (8) optional: apply institution filter and sorting
 		// (9) send response
 		var (
-			ctx          = r.Context()
-			started      = time.Now()
-			vars         = mux.Vars(r)
-			ids          []Map
-			outbound     = set.New()
-			inbound      = set.New()
-			matched      []string
-			unmatchedSet = set.New()
-			response     = &Response{
+			ctx      = r.Context()
+			started  = time.Now()
+			vars     = mux.Vars(r)
+			ids      []Map
+			outbound set.Set[string]
+			inbound  set.Set[string]
+			response = &Response{
 				ID: vars["id"],
 			}
-			sw StopWatch
-			// Experimental, hacky support for limiting results to the documents of
-			// a particular institution, given as it appears in the "institution"
-			// field of the index data, e.g. "DE-14".
-			isil = r.URL.Query().Get("i")
+			sw       StopWatch
+			progress = progressFromContext(ctx)
+			audit    *AuditRecord
+			data     = s.data(ctx)
 		)
-		sw.SetEnabled(s.StopWatchEnabled)
-		sw.Recordf("[%s] started query: %s", isil, response.ID)
-		// Ganz sicher application/json.
-		w.Header().Add("Content-Type", "application/json")
-		// (0) Check cache first.
+		if s.AuditLog != nil {
+			lw := &loggingResponseWriter{ResponseWriter: w}
+			w = lw
+			audit = &AuditRecord{Time: started, Client: remoteHost(r), ID: response.ID, Cache: "off"}
+			if t := tenantFromContext(ctx); t != nil {
+				audit.Tenant = t.Name
+			}
+			defer func() {
+				audit.Status, audit.Took = lw.status, time.Since(started).Seconds()
+				if audit.Status == 0 {
+					audit.Status = http.StatusOK
+				}
+				if audit.Cache != "hit" && audit.Status == http.StatusOK {
+					audit.setCounts(response)
+				}
+				s.AuditLog.Record(audit)
+			}()
+		}
+		// Options for filtering and sorting, e.g. experimental, hacky support
+		// for limiting results to the documents of a particular institution,
+		// given as it appears in the "institution" field of the index data,
+		// e.g. "DE-14".
+		opts, err := parseRequestOptions(r)
+		if err != nil {
+			httpErrLog(w, http.StatusBadRequest, err)
+			return
+		}
+		sw.SetEnabled(s.StopWatchEnabled || opts.Debug)
+		sw.TrackPhases()
+		sw.Recordf("[%s] started query: %s", opts.Institution, response.ID)
+		slow := &slowRequest{ID: response.ID, Institution: opts.Institution, Cache: "off"}
+		defer s.logSlowRequest(slow, started)
+		if audit != nil {
+			audit.Institution = opts.Institution
+			defer func() { audit.Cache = slow.Cache }()
+		}
+		// Ganz sicher application/json, unless XML has been requested.
+		w.Header().Set("Content-Type", opts.contentType())
+		w.Header().Add("Vary", "Accept")
 		if s.Cache != nil {
-			err := s.serveFromCache(w, r)
+			// Cached values may be sent zstd compressed.
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		if s.CacheAdmission != nil {
+			s.CacheAdmission.Record(response.ID)
+		}
+		// (0) Check cache first.
+		// Provenance and raw edges are only known for fresh responses.
+		if s.Cache != nil && !opts.bypassCache() {
+			err := s.serveFromCache(w, r, opts, &sw, audit)
+			s.cacheMetrics.recordRead(err)
 			switch {
 			case err == cache.ErrCacheMiss:
-				break
+				w.Header().Set("X-Cache", "MISS")
+				slow.Cache = "miss"
+				sw.RecordPhasef(phaseCache, "cache miss")
 			case err != nil:
 				httpErrLog(w, http.StatusInternalServerError, err)
 				return
 			default:
+				slow.Cache = "hit"
 				s.Stats.MeasureSinceWithLabels("cache_hit", started, nil)
-				sw.Record("sent cached value")
-				sw.LogTable()
+				sw.RecordPhasef(phaseEncode, "sent cached value")
+				s.finishStopWatch(&sw, response.ID)
 				return
 			}
 		}
-		// (1) Get the DOI for the local id; or get out.
+		response.Extra.Degraded = data.degradedComponents()
+		// (0a) Wait for a slot, if the number of concurrent requests is
+		// limited; fail fast, if the server is saturated.
 		t := time.Now()
-		err := s.IdentifierDatabase.GetContext(ctx, &response.DOI, "SELECT v FROM map WHERE k = ?", response.ID)
+		release, err := s.Limiter.Acquire(ctx)
 		if err != nil {
+			var oe *OverloadError
 			switch {
-			case err == sql.ErrNoRows:
-				log.Printf("doi lookup (%s): %v", response.ID, err)
-				httpErrLogf(w, http.StatusNotFound, "doi lookup (%s): %w", response.ID, err)
-			case err == context.Canceled:
-				log.Printf("doi lookup (%s): %v", response.ID, err)
+			case errors.As(err, &oe):
+				w.Header().Set("Retry-After", "1")
+				httpErrLog(w, http.StatusServiceUnavailable, err)
+			case errors.Is(err, context.DeadlineExceeded):
+				httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(ctx, "queue",
+					s.Limiter.QueueTimeout, "waiting for a slot"))
 			default:
-				httpErrLogf(w, http.StatusInternalServerError, "select id: %w", err)
+				log.Println(err)
 			}
 			return
 		}
-		s.Stats.MeasureSinceWithLabels("sql_query", t, nil)
-		sw.Recordf("found doi: %s", response.DOI)
-		// (2) Get outbound and inbound edges.
-		citing, cited, err := s.edges(ctx, response.DOI)
+		defer release()
+		if s.Limiter != nil {
+			s.Stats.MeasureSinceWithLabels("limiter_wait", t, nil)
+			sw.RecordPhasef(phaseQueue, "acquired slot")
+		}
+		// (1) Get the DOI for the local id; or get out.
+		t = time.Now()
+		doi, err := s.lookupDOI(ctx, response.ID)
 		if err != nil {
+			s.writeLookupError(w, r, response.ID, err)
+			return
+		}
+		response.DOI = doi
+		s.Stats.MeasureSinceWithLabels("sql_query", t, nil)
+		sw.RecordPhasef(phaseLookup, "found doi: %s", response.DOI)
+		// (1a) Optional: Estimate the response size from precomputed counts
+		// and enforce the edge limit before querying edges.
+		if data.CountsDatabase != nil {
+			c, err := s.counts(ctx, response.DOI)
 			switch {
-			case err == context.Canceled:
-				log.Println(err)
+			case err != nil:
+				log.Printf("counts (%s): %v", response.DOI, err)
+			case s.MaxEdges > 0 && c.Total() > s.MaxEdges:
+				httpErrLog(w, http.StatusRequestEntityTooLarge,
+					&EdgeLimitError{Citing: c.Citing, Cited: c.Cited, Limit: s.MaxEdges})
+				return
 			default:
-				httpErrLogf(w, http.StatusInternalServerError, "edges: %w", err)
+				response.Citing = make([]json.RawMessage, 0, c.Citing)
+				response.Cited = make([]json.RawMessage, 0, c.Cited)
+				sw.RecordPhasef(phaseCounts, "estimated %d outbound and %d inbound edges", c.Citing, c.Cited)
 			}
+		}
+		// (2) Get outbound and inbound edges.
+		ectx, cancel := withTimeout(ctx, s.EdgesTimeout)
+		defer cancel()
+		citing, cited, sources, duplicates, err := s.edgesCounted(ectx, response.DOI)
+		if err != nil {
+			s.writeEdgesError(w, r, response.DOI, len(citing), err)
+			return
+		}
+		sw.RecordPhasef(phaseEdges, "found %d outbound and %d inbound edges", len(citing), len(cited))
+		slow.Citing, slow.Cited = len(citing), len(cited)
+		if s.MaxEdges > 0 && len(citing)+len(cited) > s.MaxEdges {
+			httpErrLog(w, http.StatusRequestEntityTooLarge,
+				&EdgeLimitError{Citing: len(citing), Cited: len(cited), Limit: s.MaxEdges})
 			return
 		}
-		sw.Recordf("found %d outbound and %d inbound edges", len(citing), len(cited))
+		progress.report(Progress{Stage: "edges", Citing: len(citing), Cited: len(cited)})
+		response.Extra.Sources = sources
+		response.Extra.DuplicateEdgeCount = duplicates
+		response.setEdgeMeta(citing, cited)
+		if opts.Edges {
+			response.setRawEdges(citing, cited)
+		}
 		// (3) We want to collect the unique set of DOI to get the complete
 		// indexed documents.
+		outbound, inbound = set.WithCapacity[string](len(citing)), set.WithCapacity[string](len(cited))
 		for _, v := range citing {
 			outbound.Add(v.Value)
 		}
@@ -495,14 +1256,27 @@ func (s *Server) handleLocalIdentifier() http.HandlerFunc {
 			inbound.Add(v.Key)
 		}
 		ds := outbound.Union(inbound)
+		if ds.IsEmpty() && data.isDegraded(ComponentCitations) {
+			// Without citation data, the document is all we know.
+			response.Extra.Took = time.Since(started).Seconds()
+			if err := encodeResponse(w, response, opts, s.unmatchedDOIField()); err != nil {
+				httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+			}
+			return
+		}
 		if ds.IsEmpty() {
 			log.Printf("no citations found: %s", response.ID)
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 		// (4) Map relevant DOI back to local identifiers.
-		if ids, err = s.mapToLocal(ctx, ds.Slice()); err != nil {
+		mctx, cancel := withTimeout(ctx, s.LookupTimeout)
+		defer cancel()
+		if ids, err = s.mapToLocal(mctx, ds.Slice()); err != nil {
 			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(ctx, "lookup",
+					s.LookupTimeout, fmt.Sprintf("mapping %d dois back to ids", ds.Len())))
 			case err == context.Canceled:
 				log.Println(err)
 			default:
@@ -510,27 +1284,64 @@ func (s *Server) handleLocalIdentifier() http.HandlerFunc {
 			}
 			return
 		}
-		sw.Recordf("mapped %d dois back to ids", ds.Len())
-		// (5) Here, we can find unmatched items, via DOI.
+		sw.RecordPhasef(phaseMap, "mapped %d dois back to ids", ds.Len())
+		progress.report(Progress{Stage: "mapped", Citing: len(citing), Cited: len(cited), Matched: len(ids)})
+		// (5) Here, we can find unmatched items, via DOI; sorted, so
+		// responses do not depend on map order.
+		matched := set.WithCapacity[string](len(ids))
 		for _, v := range ids {
-			matched = append(matched, v.Value)
+			matched.Add(v.Value)
 		}
-		unmatchedSet = ds.Difference(set.FromSlice(matched))
-		for k := range unmatchedSet {
+		for _, k := range set.Sorted(ds.Difference(matched)) {
 			// We shortcut and do not use a proper JSON marshaller to save a
 			// bit of time. TODO: may switch to proper JSON encoding, if other
 			// parts are more optimized.
-			b := []byte(fmt.Sprintf(`{"doi_str_mv": %q}`, k))
-			switch {
-			case outbound.Contains(k):
+			b := []byte(fmt.Sprintf(`{"%s": %q}`, DefaultDOIField, k))
+			// A DOI may cite and be cited by the target (or be the target
+			// itself, for self-citations); it is then listed in both.
+			if outbound.Contains(k) {
 				response.Unmatched.Citing = append(response.Unmatched.Citing, b)
-			case inbound.Contains(k):
+			}
+			if inbound.Contains(k) {
 				response.Unmatched.Cited = append(response.Unmatched.Cited, b)
-			default:
-				panic("cosmic rays detected (in-flight change of inbound or outbound values)")
 			}
 		}
-		sw.Record("recorded unmatched ids")
+		response.Extra.MutualCount = outbound.IntersectionLen(inbound)
+		sw.RecordPhasef(phaseUnmatched, "recorded unmatched ids")
+		if s.Resolver != nil {
+			response.Extra.ResolvedCount = s.resolveUnmatched(ctx, response.Unmatched.Citing, response.Unmatched.Cited)
+			sw.RecordPhasef(phaseResolve, "resolved %d unmatched dois", response.Extra.ResolvedCount)
+		}
+		// (5b) Optional: Match unmatched documents by title, year and
+		// authors to local records without a DOI; these are fetched like
+		// records matched by DOI.
+		if data.MatchDatabase != nil {
+			matches, err := s.matchUnmatched(ctx, response, ids)
+			if err != nil {
+				log.Printf("match (%s): %v", response.ID, err)
+			}
+			ids = append(ids, matches...)
+			response.Extra.MetadataMatchedCount = len(matches)
+			sw.RecordPhasef(phaseMatch, "matched %d unmatched dois by metadata", len(matches))
+		}
+		// Documents are listed by DOI and local identifier, so responses do
+		// not depend on database or batch order; sort options apply later,
+		// keeping this order for ties.
+		sortMaps(ids)
+		// (5a) Optional: Stream large responses, to bound memory usage.
+		if s.StreamThreshold > 0 && len(ids) > s.StreamThreshold && opts.streamable() {
+			sw.Recordf("streaming %d documents", len(ids))
+			blobs, err := s.streamResponse(ctx, w, response, ids, outbound, inbound, started, progress)
+			slow.Blobs = blobs
+			if err != nil {
+				log.Printf("stream (%s): %v", response.ID, err)
+				return
+			}
+			s.Stats.MeasureSinceWithLabels("streamed", started, nil)
+			sw.RecordPhasef(phaseStream, "sent response")
+			s.finishStopWatch(&sw, response.ID)
+			return
+		}
 		// (6) At this point, we need to assemble the result. For each
 		// identifier we want the full metadata. We currently use an local
 		// sqlite copy of the index data as this seems to be the fastest
@@ -538,60 +1349,165 @@ func (s *Server) handleLocalIdentifier() http.HandlerFunc {
 		//
 		// This is agnostic to the index data content, it can contain
 		// the full metadata record, or just a few fields.
-		for _, v := range ids {
-			t := time.Now()
-			b, err := s.IndexData.Fetch(v.Key)
-			if errors.Is(err, ErrBlobNotFound) {
+		fctx, cancel := withTimeout(ctx, s.FetchTimeout)
+		defer cancel()
+		var incomplete bool // documents left out, as all backends failed
+		for i, v := range ids {
+			if err := fctx.Err(); err != nil {
+				switch {
+				case errors.Is(err, context.DeadlineExceeded):
+					httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(ctx, "fetch",
+						s.FetchTimeout, fmt.Sprintf("fetched %d of %d blobs", i, len(ids))))
+				default:
+					log.Println(err)
+				}
+				return
+			}
+			// Documents citing and cited by the target go into both lists,
+			// but are fetched once.
+			var dsts []*[]json.RawMessage
+			if outbound.Contains(v.Value) {
+				dsts = append(dsts, &response.Citing)
+			}
+			if inbound.Contains(v.Value) {
+				dsts = append(dsts, &response.Cited)
+			}
+			if len(dsts) == 0 {
+				log.Printf("%s: mapped doi not in edges, skipping: %s", response.ID, v.Value)
 				continue
 			}
-			if err != nil {
+			var (
+				t      = time.Now()
+				b      []byte
+				source string
+			)
+			switch {
+			case data.isDegraded(ComponentIndexData):
+				b = documentStub(v.Key, v.Value)
+			case opts.Provenance:
+				b, source, err = fetchSource(data.IndexData, v.Key)
+			default:
+				b, err = data.IndexData.Fetch(v.Key)
+			}
+			switch {
+			case errors.Is(err, ErrBlobNotFound):
+				continue
+			case errors.Is(err, ErrBackendsFailed):
+				// The document is left out and reported, but the response
+				// is not cached, like a streamed response.
+				msg := fmt.Sprintf("index data fetch: %s: %v", v.Key, err)
+				log.Printf("%s: %s", response.ID, msg)
+				response.Extra.Errors = append(response.Extra.Errors, msg)
+				incomplete = true
+				continue
+			case err != nil:
 				httpErrLogf(w, http.StatusInternalServerError, "index data fetch: %w", err)
 				return
 			}
 			s.Stats.MeasureSinceWithLabels("index_data_fetch", t, nil)
-			switch {
-			case outbound.Contains(v.Value):
-				response.Citing = append(response.Citing, b)
-			case inbound.Contains(v.Value):
-				response.Cited = append(response.Cited, b)
+			for _, dst := range dsts {
+				*dst = append(*dst, b)
 			}
+			if opts.Provenance {
+				response.addProvenance(v.Key, source, response.edgeSources(v.Value))
+			}
+			slow.Blobs++
+			progress.report(Progress{Stage: "fetch", Matched: len(ids), Fetched: slow.Blobs})
 		}
-		sw.Recordf("fetched %d blob from index data store", len(ids))
+		sw.RecordPhasef(phaseFetch, "fetched %d blob from index data store", len(ids))
 		// Finalize response.
 		response.updateCounts()
 		response.Extra.Took = time.Since(started).Seconds()
-		// (7) Cache expensive results.
-		if s.Cache != nil && time.Since(started) > s.CacheTriggerDuration {
+		// (7) Cache expensive results; responses exceeding the document
+		// limit are not cached, as they are only sent truncated, and neither
+		// are responses missing documents due to failed backends.
+		if s.Cache != nil && !opts.bypassCache() && len(response.Extra.Degraded) == 0 && !incomplete &&
+			!response.exceeds(s.MaxDocuments) && time.Since(started) > s.CacheTriggerDuration {
 			if err := s.cacheResponse(response); err != nil {
 				httpErrLog(w, http.StatusInternalServerError, err)
 				return
 			}
-			sw.Record("cached value")
+			sw.RecordPhasef(phaseStore, "cached value")
+		}
+		// (8) Optional: Apply institution filter and sorting; cache the
+		// filtered variant, if the unfiltered response was cached.
+		if !opts.isZero() {
+			if err := s.postprocess(ctx, response, opts); err != nil {
+				httpErrLog(w, http.StatusInternalServerError, err)
+				return
+			}
+			sw.RecordPhasef(phasePostprocess, "applied request options")
+			if response.Extra.Cached {
+				if err := s.cacheVariant(s.cacheVariantKey(ctx, response.ID, opts, audit), response); err != nil {
+					httpErrLog(w, http.StatusInternalServerError, err)
+					return
+				}
+			}
+		}
+		// (8a) Guardrail: Send at most MaxDocuments citing and cited
+		// documents, after filtering and sorting.
+		if response.truncate(s.MaxDocuments) {
+			sw.RecordPhasef(phasePostprocess, "truncated response to %d documents per list", s.MaxDocuments)
+		}
+		if opts.Map {
+			if err := s.addIDMap(ctx, response); err != nil {
+				httpErrLog(w, http.StatusInternalServerError, err)
+				return
+			}
+			sw.RecordPhasef(phaseIDMap, "added id map")
 		}
-		// (8) Optional: Apply institution filter.
-		if isil != "" {
-			response.applyInstitutionFilter(isil)
-			sw.Record("applied institution filter")
+		// (9) Send response, without any internal fields.
+		response.applyFieldFilter(s.fieldFilter(ctx))
+		if opts.Debug {
+			response.Extra.Trace = sw.Trace()
 		}
-		// (9) Send response.
-		if err := json.NewEncoder(w).Encode(response); err != nil {
+		if err := encodeResponse(w, response, opts, s.unmatchedDOIField()); err != nil {
 			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
 			return
 		}
-		sw.Record("sent response")
+		sw.RecordPhasef(phaseEncode, "sent response")
+		s.finishStopWatch(&sw, response.ID)
+	}
+}
+
+// finishStopWatch adds the phase timings of a request to the phase
+// statistics and logs the timings, if the stopwatch is enabled, as a table
+// or as JSON.
+func (s *Server) finishStopWatch(sw *StopWatch, id string) {
+	s.phaseMetrics.observe(sw.PhaseDurations())
+	if !s.StopWatchEnabled {
+		return
+	}
+	if s.StopWatchFormat == "json" {
+		sw.LogJSON(id)
+	} else {
 		sw.LogTable()
 	}
 }
 
 // Ping returns an error, if any of the datastores is not available.
 func (s *Server) Ping() error {
-	if err := s.IdentifierDatabase.Ping(); err != nil {
+	return s.data(context.Background()).Ping()
+}
+
+// Ping returns an error, if any of the datastores is not available.
+func (d *Datasets) Ping() error {
+	if err := d.IdentifierDatabase.Ping(); err != nil {
 		return err
 	}
-	if err := s.OciDatabase.Ping(); err != nil {
-		return err
+	for _, src := range d.ociSources() {
+		for _, db := range src.databases() {
+			if err := db.Ping(); err != nil {
+				return fmt.Errorf("%s: %w", src.Name, err)
+			}
+		}
+	}
+	for _, ns := range d.Namespaces {
+		if err := ns.DB.Ping(); err != nil {
+			return fmt.Errorf("namespace %s: %w", ns.Name, err)
+		}
 	}
-	if pinger, ok := s.IndexData.(Pinger); ok {
+	if pinger, ok := d.IndexData.(Pinger); ok {
 		if err := pinger.Ping(); err != nil {
 			return fmt.Errorf("could not reach index data service: %w", err)
 		}
@@ -601,16 +1517,34 @@ func (s *Server) Ping() error {
 	return nil
 }
 
-// OpenDatabase first ensures a file does actually exists, then create as
-// read-only connection.
+// OpenDatabase opens a map database. If the argument is a PostgreSQL DSN
+// (starting with postgres:// or postgresql://), a PostgreSQL connection is
+// returned; the database needs to contain a "map" table with the same schema
+// as generated by makta. Otherwise, the argument is taken as a filename;
+// OpenDatabase first ensures the file does actually exists, then creates a
+// read-only sqlite3 connection.
 func OpenDatabase(filename string) (*sqlx.DB, error) {
+	return OpenDatabaseOptions(filename, SqliteOptions{})
+}
+
+// OpenDatabaseOptions works like OpenDatabase, but applies tuning options to
+// sqlite3 connections.
+func OpenDatabaseOptions(filename string, opts SqliteOptions) (*sqlx.DB, error) {
 	if len(filename) == 0 {
 		return nil, fmt.Errorf("empty file")
 	}
+	if IsPostgresDSN(filename) {
+		return sqlx.Open("postgres", filename)
+	}
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		return nil, fmt.Errorf("file not found: %s", filename)
 	}
-	return sqlx.Open("sqlite3", tabutils.WithReadOnly(filename))
+	return openSqlite(filename, opts)
+}
+
+// IsPostgresDSN returns true, if a string looks like a PostgreSQL connection URL.
+func IsPostgresDSN(s string) bool {
+	return strings.HasPrefix(s, "postgres://") || strings.HasPrefix(s, "postgresql://")
 }
 
 // SliceContains returns true, if a string slice contains a given value.
@@ -623,18 +1557,195 @@ func SliceContains(ss []string, v string) bool {
 	return false
 }
 
-// edges returns citing (outbound) and cited (inbound) edges for a given DOI.
-func (s *Server) edges(ctx context.Context, doi string) (citing, cited []Map, err error) {
+// timeoutError describes a timeout during a stage with timeout d. If the
+// request context is past its deadline, the request deadline has been
+// exceeded, not the (possibly longer or unset) timeout of the stage.
+func (s *Server) timeoutError(ctx context.Context, stage string, d time.Duration, partial string) *TimeoutError {
+	if s.RequestTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Stage: stage, Timeout: s.RequestTimeout.String(), Partial: partial, Request: true}
+	}
+	return &TimeoutError{Stage: stage, Timeout: d.String(), Partial: partial}
+}
+
+// withTimeout returns a context with a timeout, if d is positive; otherwise
+// just a cancelable context.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// lookupID returns the local identifier for a DOI.
+func (s *Server) lookupID(ctx context.Context, doi string) (id string, err error) {
+	stmt, err := s.stmts.get(s.data(ctx).IdentifierDatabase, queryKeyByValue)
+	if err != nil {
+		return "", fmt.Errorf("prepare: %w", err)
+	}
+	ctx, cancel := withTimeout(ctx, s.LookupTimeout)
+	defer cancel()
+	err = stmt.GetContext(ctx, &id, doi)
+	return id, err
+}
+
+// lookupDOI returns the DOI for a local identifier.
+func (s *Server) lookupDOI(ctx context.Context, id string) (doi string, err error) {
+	stmt, err := s.stmts.get(s.data(ctx).IdentifierDatabase, queryValueByKey)
+	if err != nil {
+		return "", fmt.Errorf("prepare: %w", err)
+	}
+	ctx, cancel := withTimeout(ctx, s.LookupTimeout)
+	defer cancel()
+	err = stmt.GetContext(ctx, &doi, id)
+	return doi, err
+}
+
+// writeLookupError responds with a suitable error for a failed DOI lookup.
+func (s *Server) writeLookupError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		log.Printf("doi lookup (%s): %v", id, err)
+		httpErrLogf(w, http.StatusNotFound, "doi lookup (%s): %w", id, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(r.Context(), "lookup",
+			s.LookupTimeout, fmt.Sprintf("doi lookup for %s", id)))
+	case err == context.Canceled:
+		log.Printf("doi lookup (%s): %v", id, err)
+	default:
+		httpErrLogf(w, http.StatusInternalServerError, "select id: %w", err)
+	}
+}
+
+// writeEdgesError writes an appropriate error response for a failed edges
+// query; numCiting is the number of outbound edges found so far.
+func (s *Server) writeEdgesError(w http.ResponseWriter, r *http.Request, doi string, numCiting int, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(r.Context(), "edges",
+			s.EdgesTimeout, fmt.Sprintf("found %d outbound edges for %s", numCiting, doi)))
+	case err == context.Canceled:
+		log.Println(err)
+	default:
+		httpErrLogf(w, http.StatusInternalServerError, "edges: %w", err)
+	}
+}
+
+// ociSources returns all configured citation databases, primary first.
+func (d *Datasets) ociSources() []OciSource {
+	sources := []OciSource{{Name: PrimaryOciSourceName, DB: d.OciDatabase, Shards: d.OciShards}}
+	return append(sources, d.AdditionalOciDatabases...)
+}
+
+// edges returns citing (outbound) and cited (inbound) edges for a given DOI,
+// without duplicates. If more than one citation database is configured, edges
+// are merged and sources maps each related DOI to the names of the databases
+// it was found in; otherwise sources is nil.
+func (s *Server) edges(ctx context.Context, doi string) (citing, cited []Map, sources map[string][]string, err error) {
+	citing, cited, sources, _, err = s.edgesCounted(ctx, doi)
+	return citing, cited, sources, err
+}
+
+// edgesCounted is like edges, but also returns the number of duplicate edges
+// found in the citation databases (the same citing and cited DOI more than
+// once in a database); edges found in more than one database are not counted
+// as duplicates.
+func (s *Server) edgesCounted(ctx context.Context, doi string) (citing, cited []Map, sources map[string][]string, duplicates int, err error) {
+	d := s.data(ctx)
+	if d.hasNoEdges(doi) {
+		return nil, nil, nil, 0, nil
+	}
+	if len(d.AdditionalOciDatabases) == 0 {
+		var n, m int
+		citing, cited, err = s.edgesFrom(ctx, d.ociSources()[0], doi)
+		citing, n = dedupEdges(citing)
+		cited, m = dedupEdges(cited)
+		return citing, cited, nil, n + m, err
+	}
+	var (
+		// Edges are deduplicated per direction, as a self-citation is both
+		// a citing and a cited edge.
+		seenCiting = make(map[[2]string]bool)
+		seenCited  = make(map[[2]string]bool)
+		add        = func(m Map, related, source string, edges *[]Map, seen map[[2]string]bool) {
+			if !SliceContains(sources[related], source) {
+				sources[related] = append(sources[related], source)
+			}
+			key := [2]string{m.Key, m.Value}
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+			*edges = append(*edges, m)
+		}
+	)
+	sources = make(map[string][]string)
+	for _, src := range d.ociSources() {
+		a, b, err := s.edgesFrom(ctx, src, doi)
+		if err != nil {
+			return citing, cited, nil, duplicates, fmt.Errorf("%s: %w", src.Name, err)
+		}
+		a, n := dedupEdges(a)
+		b, m := dedupEdges(b)
+		duplicates += n + m
+		for _, m := range a {
+			add(m, m.Value, src.Name, &citing, seenCiting)
+		}
+		for _, m := range b {
+			add(m, m.Key, src.Name, &cited, seenCited)
+		}
+	}
+	return citing, cited, sources, duplicates, nil
+}
+
+// dedupEdges removes duplicate edges in place, keeping the first occurrence
+// (with its edge attributes), and returns the number of removed edges.
+func dedupEdges(edges []Map) ([]Map, int) {
+	var (
+		seen   = make(map[[2]string]bool, len(edges))
+		result = edges[:0]
+	)
+	for _, m := range edges {
+		key := [2]string{m.Key, m.Value}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, m)
+	}
+	return result, len(edges) - len(result)
+}
+
+// edgesFrom returns citing (outbound) and cited (inbound) edges for a given
+// DOI from a single citation database.
+func (s *Server) edgesFrom(ctx context.Context, src OciSource, doi string) (citing, cited []Map, err error) {
+	db := src.shardFor(doi)
+	q, err := s.edgeQueriesFor(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	citingStmt, err := s.stmts.get(db, q.byKey)
+	if err != nil {
+		return nil, nil, err
+	}
 	t := time.Now()
-	if err := s.OciDatabase.SelectContext(
-		ctx, &citing, "SELECT * FROM map WHERE k = ?", doi); err != nil {
+	if err := citingStmt.SelectContext(ctx, &citing, doi); err != nil {
 		return nil, nil, err
 	}
 	s.Stats.MeasureSinceWithLabels("sql_query", t, nil)
+	if len(src.Shards) > 0 {
+		if cited, err = s.citedFromShards(ctx, src.Shards, doi); err != nil {
+			return citing, nil, err
+		}
+		return citing, cited, nil
+	}
+	citedStmt, err := s.stmts.get(db, q.byValue)
+	if err != nil {
+		return citing, nil, err
+	}
 	t = time.Now()
-	if err := s.OciDatabase.SelectContext(
-		ctx, &cited, "SELECT * FROM map WHERE v = ?", doi); err != nil {
-		return nil, nil, err
+	if err := citedStmt.SelectContext(ctx, &cited, doi); err != nil {
+		// Return the citing edges found so far, for diagnostics.
+		return citing, nil, err
 	}
 	s.Stats.MeasureSinceWithLabels("sql_query", t, nil)
 	return citing, cited, nil
@@ -643,6 +1754,12 @@ func (s *Server) edges(ctx context.Context, doi string) (citing, cited []Map, er
 // mapToLocal takes a list of DOI and returns a slice of Maps containing the
 // local id (key) and DOI (value).
 func (s *Server) mapToLocal(ctx context.Context, dois []string) (ids []Map, err error) {
+	return s.mapIn(ctx, "v", dois)
+}
+
+// mapIn returns the rows of the identifier database, where column (k or v)
+// is one of values, queried in batches.
+func (s *Server) mapIn(ctx context.Context, column string, values []string) (ids []Map, err error) {
 	// sqlite has a limit on the variable count, which at most is 999; it may
 	// lead to "too many SQL variables", SQLITE_LIMIT_VARIABLE_NUMBER (default:
 	// 999; https://www.daemon-systems.org/man/sqlite3_bind_blob.3.html).
@@ -651,18 +1768,19 @@ func (s *Server) mapToLocal(ctx context.Context, dois []string) (ids []Map, err
 		t     time.Time
 		query string
 		args  []interface{}
+		db    = s.data(ctx).IdentifierDatabase
 	)
-	for _, batch := range batchedStrings(dois, size) {
+	for _, batch := range batchedStrings(values, size) {
 		t = time.Now()
-		query, args, err = sqlx.In("SELECT * FROM map WHERE v IN (?)", batch)
+		query, args, err = sqlx.In("SELECT * FROM map WHERE "+column+" IN (?)", batch)
 		if err != nil {
-			return nil, fmt.Errorf("query (%d): %v", len(dois), err)
+			return nil, fmt.Errorf("query (%d): %v", len(values), err)
 		}
-		query = s.IdentifierDatabase.Rebind(query)
+		query = db.Rebind(query)
 		var result []Map // TODO: select into a portion of the final slice directly
-		err = s.IdentifierDatabase.SelectContext(ctx, &result, query, args...)
+		err = db.SelectContext(ctx, &result, query, args...)
 		if err != nil {
-			return nil, fmt.Errorf("select (%d): %v", len(dois), err)
+			return nil, fmt.Errorf("select (%d): %w", len(values), err)
 		}
 		s.Stats.MeasureSinceWithLabels("sql_query", t, nil)
 		ids = append(ids, result...)
@@ -670,6 +1788,16 @@ func (s *Server) mapToLocal(ctx context.Context, dois []string) (ids []Map, err
 	return ids, nil
 }
 
+// sortMaps sorts maps by value, then by key.
+func sortMaps(ms []Map) {
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Value != ms[j].Value {
+			return ms[i].Value < ms[j].Value
+		}
+		return ms[i].Key < ms[j].Key
+	})
+}
+
 // batchedStrings turns one string slice into one or more smaller strings
 // slices, each with size of at most n.
 func batchedStrings(ss []string, n int) (result [][]string) {
@@ -683,7 +1811,6 @@ func batchedStrings(ss []string, n int) (result [][]string) {
 			b, e = e, e+n
 		}
 	}
-	return
 }
 
 // httpErrLogf is a log formatting helper.
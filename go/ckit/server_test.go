@@ -1,14 +1,23 @@
 package ckit
 
 import (
+	"bytes"
+	"context"
 	"log"
 	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
 	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+	"github.com/thoas/stats"
 )
 
 func TestBatchedStrings(t *testing.T) {
@@ -119,7 +128,7 @@ func TestApplyInstitutionFilter(t *testing.T) {
 		if err := json.Unmarshal(c.expected, &expected); err != nil {
 			t.Fatalf("could not unmarshal test response: %v", err)
 		}
-		resp.applyInstitutionFilter(c.institution)
+		resp.applyInstitutionFilter(c.institution, nil)
 		if string(mustMarshal(resp)) != string(mustMarshal(expected)) {
 			log.Printf(string(mustMarshal(resp)))
 			log.Printf(string(mustMarshal(expected)))
@@ -128,7 +137,410 @@ func TestApplyInstitutionFilter(t *testing.T) {
 	}
 }
 
+func TestApplyInstitutionFilterInvalidData(t *testing.T) {
+	resp := &Response{
+		ID: "1",
+		Citing: []json.RawMessage{
+			json.RawMessage(`{"institution": ["a"]}`),
+			json.RawMessage(`{"institution": ["a"`),
+		},
+		Cited: []json.RawMessage{json.RawMessage(`not json`)},
+	}
+	resp.applyInstitutionFilter("a", nil)
+	if len(resp.Citing) != 1 || len(resp.Unmatched.Citing) != 1 || len(resp.Unmatched.Cited) != 1 {
+		t.Fatalf("got %d/%d/%d, want 1/1/1", len(resp.Citing), len(resp.Unmatched.Citing),
+			len(resp.Unmatched.Cited))
+	}
+	if len(resp.Extra.Errors) != 2 {
+		t.Fatalf("got %v, want two errors", resp.Extra.Errors)
+	}
+}
+
+func TestApplyYearFilter(t *testing.T) {
+	var cases = []struct {
+		desc        string
+		from, until int
+		resp        []byte
+		citing      int
+		cited       int
+	}{
+		{"empty", 2015, 2020, []byte("{}"), 0, 0},
+		{
+			desc: "range",
+			from: 2015, until: 2020,
+			resp: []byte(`{
+			  "citing": [{"publishDate": ["2014"]}, {"publishDate": ["2015"]}, {}],
+			  "cited": [{"publishDate": "2020"}, {"publishDateSort": "2021"}]
+			}`),
+			citing: 1,
+			cited:  1,
+		},
+		{
+			desc: "open upper bound",
+			from: 2015,
+			resp: []byte(`{
+			  "citing": [{"publishDate": ["2014"]}, {"publishDate": ["2015"]}],
+			  "cited": [{"publishDate": "2020"}, {"publishDateSort": "2021"}]
+			}`),
+			citing: 1,
+			cited:  2,
+		},
+	}
+	for _, c := range cases {
+		var resp Response
+		if err := json.Unmarshal(c.resp, &resp); err != nil {
+			t.Fatalf("could not unmarshal test response: %v", err)
+		}
+		resp.applyYearFilter(c.from, c.until)
+		if resp.Extra.CitingCount != c.citing || resp.Extra.CitedCount != c.cited {
+			t.Fatalf("[%s] got %d/%d, want %d/%d", c.desc,
+				resp.Extra.CitingCount, resp.Extra.CitedCount, c.citing, c.cited)
+		}
+	}
+}
+
+func TestApplyYearFilterInvalidData(t *testing.T) {
+	resp := &Response{
+		ID: "1",
+		Citing: []json.RawMessage{
+			json.RawMessage(`{"publishDate": ["2015"]}`),
+			json.RawMessage(`{"publishDate": ["2015"`),
+		},
+		Cited: []json.RawMessage{json.RawMessage(`not json`)},
+	}
+	resp.applyYearFilter(2015, 2020)
+	if len(resp.Citing) != 1 || len(resp.Cited) != 0 {
+		t.Fatalf("got %d/%d, want 1/0", len(resp.Citing), len(resp.Cited))
+	}
+	if len(resp.Extra.Errors) != 2 {
+		t.Fatalf("got %v, want two errors", resp.Extra.Errors)
+	}
+}
+
+func TestApplySourceFilter(t *testing.T) {
+	var resp Response
+	if err := json.Unmarshal([]byte(`{
+	  "citing": [{"id": "ai-49-abc"}, {"id": "0-123", "source_id": "0"}, {"id": "68-1"}],
+	  "cited": [{"id": "ai-490-abc"}, {"id": "x", "source_id": ["0"]}]
+	}`), &resp); err != nil {
+		t.Fatalf("could not unmarshal test response: %v", err)
+	}
+	resp.applySourceFilter([]string{"ai-49", "0"})
+	if resp.Extra.CitingCount != 2 || resp.Extra.CitedCount != 1 {
+		t.Fatalf("got %d/%d, want 2/1", resp.Extra.CitingCount, resp.Extra.CitedCount)
+	}
+}
+
+func TestApplyISSNFilter(t *testing.T) {
+	var resp Response
+	if err := json.Unmarshal([]byte(`{
+	  "citing": [{"id": "1", "issn": "1234-5678"}, {"id": "2", "issn": ["0000-0000", "8765432x"]}, {"id": "3"}],
+	  "cited": [{"id": "4", "issn": "1111-1111"}],
+	  "unmatched": {"cited": [{"doi_str_mv": "10.1/x"}]}
+	}`), &resp); err != nil {
+		t.Fatalf("could not unmarshal test response: %v", err)
+	}
+	resp.applyISSNFilter([]string{"1234-5678", "8765-432X"})
+	if resp.Extra.CitingCount != 2 || resp.Extra.CitedCount != 0 || resp.Extra.UnmatchedCitedCount != 1 {
+		t.Fatalf("got %d/%d/%d, want 2/0/1", resp.Extra.CitingCount, resp.Extra.CitedCount,
+			resp.Extra.UnmatchedCitedCount)
+	}
+	var (
+		srv = newTestServer(t)
+		rr  = httptest.NewRecorder()
+	)
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029?issn=1234", nil))
+	if rr.Code != 400 {
+		t.Fatalf("got %d, want 400 for invalid issn", rr.Code)
+	}
+	// Fixture documents have no ISSN, so only unmatched documents remain.
+	if resp := mustRequest(t, srv, "/id/i0029?issn=1234-5678"); len(resp.Citing)+len(resp.Cited) != 0 {
+		t.Fatalf("got %d documents, want none", len(resp.Citing)+len(resp.Cited))
+	}
+}
+
+func TestDedupEdges(t *testing.T) {
+	edges := []Map{{Key: "a", Value: "b"}, {Key: "a", Value: "c"}, {Key: "a", Value: "b"}, {Key: "b", Value: "a"}}
+	result, n := dedupEdges(edges)
+	if n != 1 || len(result) != 3 || result[2].Value != "a" {
+		t.Fatalf("got %v, %d", result, n)
+	}
+	if result, n = dedupEdges(nil); n != 0 || len(result) != 0 {
+		t.Fatalf("got %v, %d, want nothing", result, n)
+	}
+	srv := newTestServer(t)
+	// Each edge of d0029 is in the fixture four times, three citing and two
+	// cited edges.
+	if resp := mustRequest(t, srv, "/id/i0029"); resp.Extra.DuplicateEdgeCount != 15 {
+		t.Fatalf("got %d, want 15", resp.Extra.DuplicateEdgeCount)
+	}
+}
+
+func TestServerMaxEdges(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "counts.db")
+	if err := BuildCountsDatabase(output, "testdata/doi_doi.db"); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	countsDB, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer countsDB.Close()
+	srv := newTestServer(t)
+	// d0029 has three citing and two cited (distinct) edges.
+	var cases = []struct {
+		maxEdges int
+		counts   bool
+		status   int
+	}{
+		{0, false, 200},
+		{5, false, 200},
+		{4, false, 413},
+		{5, true, 200},
+		{4, true, 413},
+	}
+	for _, c := range cases {
+		srv.MaxEdges, srv.CountsDatabase = c.maxEdges, nil
+		if c.counts {
+			srv.CountsDatabase = countsDB
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+		if rr.Code != c.status {
+			t.Fatalf("[%d, %v] got %d, want %d", c.maxEdges, c.counts, rr.Code, c.status)
+		}
+		if c.status == 413 && !bytes.Contains(rr.Body.Bytes(), []byte(`"limit":4`)) {
+			t.Fatalf("[%d, %v] got %s, want limit in error", c.maxEdges, c.counts, rr.Body.String())
+		}
+	}
+}
+
+func TestServerRequestTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	srv.RequestTimeout = time.Nanosecond
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+	if rr.Code != 504 || !bytes.Contains(rr.Body.Bytes(), []byte(`"request":true`)) {
+		t.Fatalf("got %d, %s, want 504 with request deadline", rr.Code, rr.Body.String())
+	}
+	srv.RequestTimeout = time.Minute
+	mustRequest(t, srv, "/id/i0029")
+}
+
+func TestServerMutualCitations(t *testing.T) {
+	srv := newTestServer(t)
+	// d0029 also cites d0069 (matched) and d0156 (unmatched), which both cite
+	// d0029, and cites itself.
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "local.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, q := range []string{
+		"CREATE TABLE map (k TEXT, v TEXT, PRIMARY KEY (k, v)) WITHOUT ROWID",
+		"INSERT INTO map VALUES ('d0029', 'd0069'), ('d0029', 'd0156'), ('d0029', 'd0029')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	srv.AdditionalOciDatabases = []OciSource{{Name: "local", DB: db}}
+	resp := mustRequest(t, srv, "/id/i0029")
+	// Fixture documents appear four times each: citing d0009, d0039, d0065,
+	// d0069 and d0029, cited by d0069 and d0029.
+	if len(resp.Citing) != 20 || len(resp.Cited) != 8 {
+		t.Fatalf("got %d/%d, want 20/8", len(resp.Citing), len(resp.Cited))
+	}
+	if len(resp.Unmatched.Citing) != 1 || len(resp.Unmatched.Cited) != 1 {
+		t.Fatalf("got %d/%d unmatched, want 1/1", len(resp.Unmatched.Citing), len(resp.Unmatched.Cited))
+	}
+	if resp.Extra.MutualCount != 3 {
+		t.Fatalf("got %d, want 3", resp.Extra.MutualCount)
+	}
+}
+
+func TestApplySourceFilterInvalidData(t *testing.T) {
+	resp := &Response{
+		ID: "1",
+		Citing: []json.RawMessage{
+			json.RawMessage(`{"source_id": "49"}`),
+			json.RawMessage(`{"source_id": "49"`),
+		},
+		Cited: []json.RawMessage{json.RawMessage(`not json`)},
+	}
+	resp.applySourceFilter([]string{"49"})
+	if len(resp.Citing) != 1 || len(resp.Cited) != 0 {
+		t.Fatalf("got %d/%d, want 1/0", len(resp.Citing), len(resp.Cited))
+	}
+	if len(resp.Extra.Errors) != 2 {
+		t.Fatalf("got %v, want two errors", resp.Extra.Errors)
+	}
+}
+
+func TestApplyISSNFilterInvalidData(t *testing.T) {
+	resp := &Response{
+		ID: "1",
+		Citing: []json.RawMessage{
+			json.RawMessage(`{"issn": "1234-5678"}`),
+			json.RawMessage(`{"issn": "1234-5678"`),
+		},
+		Cited: []json.RawMessage{json.RawMessage(`not json`)},
+	}
+	resp.applyISSNFilter([]string{"1234-5678"})
+	if len(resp.Citing) != 1 || len(resp.Cited) != 0 {
+		t.Fatalf("got %d/%d, want 1/0", len(resp.Citing), len(resp.Cited))
+	}
+	if len(resp.Extra.Errors) != 2 {
+		t.Fatalf("got %v, want two errors", resp.Extra.Errors)
+	}
+}
+
 func TestServerBasic(t *testing.T) {
+	srv := newTestServer(t)
+	resp := mustRequest(t, srv, "/id/i0029")
+	// d0029 cites d0009, d0039, d0065 and d0029 is cited by d0069 (matched)
+	// and d0156 (unmatched).
+	if resp.DOI != "d0029" {
+		t.Fatalf("got %v, want d0029", resp.DOI)
+	}
+	if resp.Extra.CitingCount == 0 || resp.Extra.CitedCount == 0 {
+		t.Fatalf("got %d citing, %d cited, want both non-zero",
+			resp.Extra.CitingCount, resp.Extra.CitedCount)
+	}
+	if resp.Extra.UnmatchedCitedCount != 1 {
+		t.Fatalf("got %d unmatched cited, want 1", resp.Extra.UnmatchedCitedCount)
+	}
+	if resp.Extra.Truncated {
+		t.Fatalf("response should not be truncated")
+	}
+}
+
+func TestServerMaxDocuments(t *testing.T) {
+	srv := newTestServer(t)
+	srv.MaxDocuments = 2
+	resp := mustRequest(t, srv, "/id/i0029")
+	if resp.Extra.CitingCount != 2 || resp.Extra.CitedCount > 2 {
+		t.Fatalf("got %d citing, %d cited, want 2, at most 2",
+			resp.Extra.CitingCount, resp.Extra.CitedCount)
+	}
+	if !resp.Extra.Truncated || resp.Extra.TotalCitingCount <= 2 {
+		t.Fatalf("got truncated=%v, total=%d, want true, more than 2",
+			resp.Extra.Truncated, resp.Extra.TotalCitingCount)
+	}
+}
+
+func TestServerMaxDocumentsAfterFilter(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	srv.MaxDocuments = 2
+	// Only documents citing d0065 are held by DE-3; they must not be cut
+	// off by truncating before filtering.
+	resp := mustRequest(t, srv, "/id/i0029?i=DE-3")
+	if resp.Extra.CitingCount == 0 {
+		t.Fatalf("got no citing documents, want some")
+	}
+	for _, doc := range resp.Citing {
+		if !bytes.Contains(doc, []byte("DE-3")) {
+			t.Fatalf("got document of other institution: %s", doc)
+		}
+	}
+	// Truncated responses are not cached.
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+		if got := rr.Header().Get("X-Cache"); got != "MISS" {
+			t.Fatalf("[%d] got X-Cache %q, want MISS", i, got)
+		}
+	}
+}
+
+func TestServerSpindel(t *testing.T) {
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	srv.Router, srv.Spindel = mux.NewRouter(), true
+	srv.Routes()
+	var (
+		got  = mustRequest(t, srv, "/q/i0029")
+		want = mustRequest(t, srv, "/id/i0029")
+	)
+	if got.DOI != want.DOI || len(got.Citing) != len(want.Citing) || len(got.Cited) != len(want.Cited) {
+		t.Fatalf("got %s, %d citing, %d cited, want %s, %d, %d", got.DOI,
+			len(got.Citing), len(got.Cited), want.DOI, len(want.Citing), len(want.Cited))
+	}
+	// Responses use spindel's field names, fresh and from the cache.
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", "/q/i0029", nil))
+		var doc struct {
+			Fields    map[string]json.RawMessage
+			Extra     map[string]json.RawMessage `json:"extra"`
+			Unmatched struct {
+				Cited []map[string]json.RawMessage `json:"cited"`
+			} `json:"unmatched"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &doc.Fields); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, k := range []string{"id", "doi", "citing", "cited", "extra"} {
+			if _, ok := doc.Fields[k]; !ok {
+				t.Fatalf("[%d] got %s, want field %s", i, rr.Body.String(), k)
+			}
+		}
+		for _, k := range []string{"took", "citing_count", "cited_count"} {
+			if _, ok := doc.Extra[k]; !ok {
+				t.Fatalf("[%d] got %s, want extra field %s", i, rr.Body.String(), k)
+			}
+		}
+		if len(doc.Unmatched.Cited) == 0 {
+			t.Fatalf("[%d] got no unmatched documents, want some", i)
+		}
+		for _, v := range doc.Unmatched.Cited {
+			if _, ok := v[SpindelDOIField]; !ok || v[DefaultDOIField] != nil {
+				t.Fatalf("[%d] got unmatched document %v, want field %s only", i, v, SpindelDOIField)
+			}
+		}
+	}
+	n, err := c.ItemCount()
+	if err != nil || n == 0 {
+		t.Fatalf("got %d, %v, want cached responses", n, err)
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/cache/size", nil))
+	var size struct {
+		Count int `json:"count"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &size); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rr.Code != 200 || size.Count != n {
+		t.Fatalf("got %d, %+v, want 200 and count %d", rr.Code, size, n)
+	}
+	// Without the flag, there are no spindel routes.
+	srv = newTestServer(t)
+	for _, target := range []string{"/q/i0029", "/cache/size"} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != 404 {
+			t.Fatalf("%s: got %d, want 404", target, rr.Code)
+		}
+	}
+}
+
+// newTestServer returns a server over the test databases, with routes set up.
+func newTestServer(t *testing.T) *Server {
 	a, err := OpenDatabase("testdata/id_doi.db")
 	if err != nil {
 		t.Fatalf("test data: %v", err)
@@ -146,10 +558,28 @@ func TestServerBasic(t *testing.T) {
 		OciDatabase:        b,
 		IndexData:          g,
 		Router:             mux.NewRouter(),
+		Stats:              newTestStats(),
 	}
-	rr := httptest.NewRecorder()
-	t.Logf("setup %v [%v]", srv, rr)
-	// TODO: execute handlers
+	srv.Routes()
+	return srv
+}
+
+// mustRequest performs a GET request against the server and decodes the
+// response, which must have status 200.
+func mustRequest(t *testing.T, srv *Server, target string) *Response {
+	var (
+		rr   = httptest.NewRecorder()
+		req  = httptest.NewRequest("GET", target, nil)
+		resp Response
+	)
+	srv.ServeHTTP(rr, req)
+	if rr.Code != 200 {
+		t.Fatalf("%s: got status %d, want 200: %s", target, rr.Code, rr.Body.String())
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: decode: %v", target, err)
+	}
+	return &resp
 }
 
 func mustMarshal(v interface{}) []byte {
@@ -159,3 +589,137 @@ func mustMarshal(v interface{}) []byte {
 	}
 	return b
 }
+
+func TestEdgesMultipleSources(t *testing.T) {
+	a, err := OpenDatabase("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	b, err := OpenDatabase("testdata/doi_doi.db")
+	if err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	srv := &Server{
+		OciDatabase:            a,
+		AdditionalOciDatabases: []OciSource{{Name: "local", DB: b}},
+		Stats:                  newTestStats(),
+	}
+	citing, cited, sources, err := srv.edges(context.Background(), "d0098")
+	if err != nil {
+		t.Fatalf("edges: %v", err)
+	}
+	// Identical edges from both sources are only reported once.
+	if len(citing) != 2 || len(cited) != 0 {
+		t.Fatalf("got %d citing, %d cited, want 2, 0", len(citing), len(cited))
+	}
+	want := []string{PrimaryOciSourceName, "local"}
+	if !reflect.DeepEqual(sources["d0194"], want) {
+		t.Fatalf("got %v, want %v", sources["d0194"], want)
+	}
+}
+
+// newTestStats returns stats ready for measurements, which the stats handler
+// would otherwise set up.
+func newTestStats() *stats.Stats {
+	st := stats.New()
+	st.MetricsCounts = make(map[string]int)
+	st.MetricsTimers = make(map[string]time.Time)
+	return st
+}
+
+func TestServerDebugTrace(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv.Cache = c
+	if resp := mustRequest(t, srv, "/id/i0029"); len(resp.Extra.Trace) > 0 {
+		t.Fatalf("unexpected trace without debug")
+	}
+	// The first request was cached, so this is served from the cache.
+	resp := mustRequest(t, srv, "/id/i0029?debug=1")
+	if len(resp.Extra.Trace) < 2 {
+		t.Fatalf("got %v, want trace", resp.Extra.Trace)
+	}
+	if resp = mustRequest(t, srv, "/id/i0030?debug=1"); len(resp.Extra.Trace) < 4 {
+		t.Fatalf("got %v, want trace", resp.Extra.Trace)
+	}
+	if resp = mustRequest(t, srv, "/id/i0030"); len(resp.Extra.Trace) > 0 {
+		t.Fatalf("trace must not be cached")
+	}
+}
+
+func TestServerAdminRouter(t *testing.T) {
+	srv := newTestServer(t)
+	srv.Router, srv.AdminRouter = mux.NewRouter(), mux.NewRouter()
+	srv.Routes()
+	var cases = []struct {
+		router *mux.Router
+		target string
+		status int
+	}{
+		{srv.Router, "/id/i0029", 200},
+		{srv.Router, "/stats", 404},
+		{srv.Router, "/debug/pprof/", 404},
+		{srv.AdminRouter, "/stats", 200},
+		{srv.AdminRouter, "/debug/pprof/", 200},
+		{srv.AdminRouter, "/id/i0029", 404},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		c.router.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != c.status {
+			t.Fatalf("%s: got %d, want %d", c.target, rr.Code, c.status)
+		}
+	}
+}
+
+func TestServerDeterministicOrder(t *testing.T) {
+	srv := newTestServer(t)
+	// Without indexes, rows come back in insertion order, here descending.
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "id.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var rows []Map
+	if err := srv.IdentifierDatabase.Select(&rows, "SELECT k, v FROM map ORDER BY v DESC"); err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE map (k TEXT, v TEXT)"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, row := range rows {
+		if _, err := db.Exec("INSERT INTO map VALUES (?, ?)", row.Key, row.Value); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	srv.IdentifierDatabase = db
+	first := mustRequest(t, srv, "/id/i0029")
+	// Fixture documents carry their number in field "a", like their DOI.
+	numbers := func(docs []json.RawMessage) (result []int) {
+		for _, doc := range docs {
+			var v struct {
+				A string `json:"a"`
+			}
+			if err := json.Unmarshal(doc, &v); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			n, _ := strconv.Atoi(v.A)
+			result = append(result, n)
+		}
+		return result
+	}
+	if got := numbers(first.Citing); !sort.IntsAreSorted(got) || len(got) == 0 {
+		t.Fatalf("got %v, want documents ordered by DOI", got)
+	}
+	for i := 0; i < 5; i++ {
+		resp := mustRequest(t, srv, "/id/i0029")
+		if !reflect.DeepEqual(resp.Citing, first.Citing) || !reflect.DeepEqual(resp.Cited, first.Cited) ||
+			!reflect.DeepEqual(resp.Unmatched, first.Unmatched) {
+			t.Fatalf("got different order in request %d", i+2)
+		}
+	}
+}
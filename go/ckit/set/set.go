@@ -1,22 +1,29 @@
 package set
 
 import (
-	"sort"
+	"cmp"
+	"slices"
 	"strings"
 )
 
-// Set implements basic string set operations, not thread-safe.
-type Set map[string]struct{}
+// Set implements basic set operations, not thread-safe. Iteration over a set
+// follows map order, which is random; use Sorted or SortedFunc, where the
+// order matters, e.g. in responses.
+type Set[T comparable] map[T]struct{}
 
 // New creates a new set.
-func New() Set {
-	var s = make(Set)
-	return s
+func New[T comparable]() Set[T] {
+	return make(Set[T])
+}
+
+// WithCapacity creates a new set with room for n elements.
+func WithCapacity[T comparable](n int) Set[T] {
+	return make(Set[T], n)
 }
 
 // FromSlice initializes a set from a slice.
-func FromSlice(vs []string) Set {
-	s := New()
+func FromSlice[T comparable](vs []T) Set[T] {
+	s := WithCapacity[T](len(vs))
 	for _, v := range vs {
 		s.Add(v)
 	}
@@ -24,47 +31,57 @@ func FromSlice(vs []string) Set {
 }
 
 // Clear removes all elements.
-func (s Set) Clear() {
-	for k := range s {
-		delete(s, k)
-	}
+func (s Set[T]) Clear() {
+	clear(s)
 }
 
 // Add adds an element.
-func (s Set) Add(v string) Set {
+func (s Set[T]) Add(v T) Set[T] {
 	s[v] = struct{}{}
 	return s
 }
 
+// Remove removes an element, if it exists.
+func (s Set[T]) Remove(v T) Set[T] {
+	delete(s, v)
+	return s
+}
+
 // Len returns number of elements in set.
-func (s Set) Len() int {
+func (s Set[T]) Len() int {
 	return len(s)
 }
 
 // IsEmpty returns if set has zero elements.
-func (s Set) IsEmpty() bool {
+func (s Set[T]) IsEmpty() bool {
 	return s.Len() == 0
 }
 
 // Equals returns true, if sets contain the same elements.
-func (s Set) Equals(t Set) bool {
+func (s Set[T]) Equals(t Set[T]) bool {
+	if s.Len() != t.Len() {
+		return false
+	}
 	for k := range s {
 		if !t.Contains(k) {
 			return false
 		}
 	}
-	return s.Len() == t.Len()
+	return true
 }
 
 // Contains returns membership status.
-func (s Set) Contains(v string) bool {
-	_, ok := (s)[v]
+func (s Set[T]) Contains(v T) bool {
+	_, ok := s[v]
 	return ok
 }
 
 // Intersection returns a new set containing all elements found in both sets.
-func (s Set) Intersection(t Set) Set {
-	u := New()
+func (s Set[T]) Intersection(t Set[T]) Set[T] {
+	if s.Len() > t.Len() {
+		s, t = t, s
+	}
+	u := New[T]()
 	for k := range s {
 		if t.Contains(k) {
 			u.Add(k)
@@ -73,9 +90,23 @@ func (s Set) Intersection(t Set) Set {
 	return u
 }
 
+// IntersectionLen returns the number of elements found in both sets, without
+// creating the intersection.
+func (s Set[T]) IntersectionLen(t Set[T]) (n int) {
+	if s.Len() > t.Len() {
+		s, t = t, s
+	}
+	for k := range s {
+		if t.Contains(k) {
+			n++
+		}
+	}
+	return n
+}
+
 // Union returns the union of two sets.
-func (s Set) Union(t Set) Set {
-	u := New()
+func (s Set[T]) Union(t Set[T]) Set[T] {
+	u := WithCapacity[T](max(s.Len(), t.Len()))
 	for k := range s {
 		u.Add(k)
 	}
@@ -85,8 +116,10 @@ func (s Set) Union(t Set) Set {
 	return u
 }
 
-func (s Set) Difference(t Set) Set {
-	u := New()
+// Difference returns a new set containing all elements of s, which are not
+// in t.
+func (s Set[T]) Difference(t Set[T]) Set[T] {
+	u := New[T]()
 	for k := range s {
 		if !t.Contains(k) {
 			u.Add(k)
@@ -95,39 +128,25 @@ func (s Set) Difference(t Set) Set {
 	return u
 }
 
-// Slice returns all elements as a slice.
-func (s Set) Slice() (result []string) {
-	for k := range s {
-		result = append(result, k)
+// Slice returns all elements as a slice, in random order; nil, if the set is
+// empty.
+func (s Set[T]) Slice() []T {
+	if len(s) == 0 {
+		return nil
 	}
-	return
-}
-
-// Sorted returns all elements as a slice, sorted.
-func (s Set) Sorted() (result []string) {
+	result := make([]T, 0, len(s))
 	for k := range s {
 		result = append(result, k)
 	}
-	sort.Strings(result)
-	return
+	return result
 }
 
-// TopK returns at most k sorted elements.
-func (s Set) TopK(k int) Set {
-	var top []string
-	for i, v := range s.Sorted() {
-		if i < k {
-			top = append(top, v)
-		}
-	}
-	return FromSlice(top)
-}
-
-// Product returns a slice of pairs, representing the cartesian product of two sets.
-func (s Set) Product(t Set) (result [][]string) {
+// Product returns a slice of pairs, representing the cartesian product of two
+// sets, in random order.
+func (s Set[T]) Product(t Set[T]) (result [][]T) {
 	for k := range s {
 		for l := range t {
-			result = append(result, []string{k, l})
+			result = append(result, []T{k, l})
 		}
 	}
 	return
@@ -135,24 +154,45 @@ func (s Set) Product(t Set) (result [][]string) {
 
 // Jaccard returns the jaccard index of sets s and t, between 0 and 1, where 1
 // means equality.
-func (s Set) Jaccard(t Set) float64 {
+func (s Set[T]) Jaccard(t Set[T]) float64 {
 	if s.IsEmpty() && t.IsEmpty() {
 		return 1
 	}
-	if u := s.Union(t); u.IsEmpty() {
-		return 0
-	} else {
-		return float64(s.Intersection(t).Len()) / float64(u.Len())
+	n := s.IntersectionLen(t)
+	return float64(n) / float64(s.Len()+t.Len()-n)
+}
+
+// Sorted returns all elements as a slice, sorted.
+func Sorted[T cmp.Ordered](s Set[T]) []T {
+	result := s.Slice()
+	slices.Sort(result)
+	return result
+}
+
+// SortedFunc returns all elements as a slice, sorted by a comparison
+// function, as used by slices.SortFunc.
+func SortedFunc[T comparable](s Set[T], cmp func(a, b T) int) []T {
+	result := s.Slice()
+	slices.SortFunc(result, cmp)
+	return result
+}
+
+// TopK returns at most k elements, the smallest ones.
+func TopK[T cmp.Ordered](s Set[T], k int) Set[T] {
+	sorted := Sorted(s)
+	if len(sorted) > k {
+		sorted = sorted[:k]
 	}
+	return FromSlice(sorted)
 }
 
-// Join joins elements from a set with given separator.
-func (s Set) Join(sep string) string {
-	return strings.Join(s.Slice(), sep)
+// Join joins the sorted elements of a set with given separator.
+func Join(s Set[string], sep string) string {
+	return strings.Join(Sorted(s), sep)
 }
 
 // Max returns the size of the largest set.
-func Max(ss ...Set) (max int) {
+func Max[T comparable](ss ...Set[T]) (max int) {
 	for _, s := range ss {
 		if s.Len() > max {
 			max = s.Len()
@@ -162,7 +202,7 @@ func Max(ss ...Set) (max int) {
 }
 
 // Min returns the size of the smallest set.
-func Min(ss ...Set) (min int) {
+func Min[T comparable](ss ...Set[T]) (min int) {
 	min = 2 << 30
 	for _, s := range ss {
 		if s.Len() < min {
@@ -173,8 +213,8 @@ func Min(ss ...Set) (min int) {
 }
 
 // Filter returns a set containing all elements, which satisfy a given predicate.
-func Filter(s Set, f func(string) bool) Set {
-	t := New()
+func Filter[T comparable](s Set[T], f func(T) bool) Set[T] {
+	t := New[T]()
 	for v := range s {
 		if f(v) {
 			t.Add(v)
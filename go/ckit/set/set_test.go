@@ -1,6 +1,7 @@
 package set
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/matryer/is"
@@ -9,7 +10,7 @@ import (
 func TestSet(t *testing.T) {
 	is := is.New(t)
 
-	s := make(Set)
+	s := make(Set[string])
 	is.Equal(s.Len(), 0)
 	is.True(s.IsEmpty())
 
@@ -20,11 +21,12 @@ func TestSet(t *testing.T) {
 	is.True(!s.Contains("2"))
 	is.Equal(s.Slice(), []string{"1"})
 
-	r := make(Set)
+	r := make(Set[string])
 	r.Add("2")
 	is.True(s.Intersection(r).IsEmpty())
 	is.Equal(s.Union(r).Len(), 2)
-	is.Equal(s.Union(r).Sorted(), []string{"1", "2"})
+	is.Equal(Sorted(s.Union(r)), []string{"1", "2"})
+	is.Equal(Join(s.Union(r), ","), "1,2")
 
 	r.Add("3")
 	r.Add("4")
@@ -32,10 +34,12 @@ func TestSet(t *testing.T) {
 	r.Add("6")
 	r.Add("7")
 	r.Add("8")
-	top := make(Set)
+	top := make(Set[string])
 	top.Add("2")
 	top.Add("3")
-	is.Equal(r.TopK(2), top)
+	is.Equal(TopK(r, 2), top)
+	is.Equal(s.Union(r).IntersectionLen(top), 2)
+	is.Equal(s.Union(r).Intersection(top), top)
 
 	r.Clear()
 	is.Equal(r.Len(), 0)
@@ -43,12 +47,12 @@ func TestSet(t *testing.T) {
 
 func TestSetDifference(t *testing.T) {
 	is := is.New(t)
-	s := New()
+	s := New[string]()
 	s.Add("1")
 	s.Add("2")
 	s.Add("3")
 
-	r := New()
+	r := New[string]()
 	r.Add("2")
 	r.Add("3")
 
@@ -58,3 +62,66 @@ func TestSetDifference(t *testing.T) {
 	is.True(!u.Contains("2"))
 	is.True(!u.Contains("3"))
 }
+
+func TestSetInt(t *testing.T) {
+	is := is.New(t)
+	s := FromSlice([]int{3, 1, 2, 3})
+	is.Equal(s.Len(), 3)
+	is.Equal(Sorted(s), []int{1, 2, 3})
+	is.Equal(SortedFunc(s, func(a, b int) int { return b - a }), []int{3, 2, 1})
+	is.True(s.Equals(FromSlice([]int{1, 2, 3})))
+	is.True(!s.Equals(FromSlice([]int{1, 2, 4})))
+	is.Equal(s.Jaccard(FromSlice([]int{2, 3, 4})), 0.5)
+	is.Equal(Filter(s, func(v int) bool { return v > 1 }), FromSlice([]int{2, 3}))
+	is.Equal(s.Remove(1).Len(), 2)
+}
+
+// benchmarkSets returns two sets of n strings each, overlapping by half.
+func benchmarkSets(n int) (Set[string], Set[string]) {
+	s, t := WithCapacity[string](n), WithCapacity[string](n)
+	for i := 0; i < n; i++ {
+		s.Add(fmt.Sprintf("10.1000/%d", i))
+		t.Add(fmt.Sprintf("10.1000/%d", i+n/2))
+	}
+	return s, t
+}
+
+func BenchmarkUnion(b *testing.B) {
+	s, t := benchmarkSets(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Union(t)
+	}
+}
+
+func BenchmarkIntersection(b *testing.B) {
+	s, t := benchmarkSets(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Intersection(t)
+	}
+}
+
+func BenchmarkIntersectionLen(b *testing.B) {
+	s, t := benchmarkSets(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.IntersectionLen(t)
+	}
+}
+
+func BenchmarkDifference(b *testing.B) {
+	s, t := benchmarkSets(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Difference(t)
+	}
+}
+
+func BenchmarkSorted(b *testing.B) {
+	s, _ := benchmarkSets(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Sorted(s)
+	}
+}
@@ -0,0 +1,298 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/slub/labe/go/ckit/set"
+)
+
+// shardSchema records the position of a shard database, so shards can be
+// opened in any order.
+const shardSchema = `CREATE TABLE shard (i INTEGER NOT NULL, n INTEGER NOT NULL)`
+
+// ShardIndex returns the shard containing the outbound edges of a DOI, out
+// of n shards. We hash the whole DOI, as DOI prefixes are very unevenly
+// distributed (a few publishers account for a large part of all citations).
+func ShardIndex(doi string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(doi))
+	return int(h.Sum32() % uint32(n))
+}
+
+// databases returns the databases of a citation source, which are its
+// shards, if it is sharded.
+func (src OciSource) databases() []*sqlx.DB {
+	if len(src.Shards) > 0 {
+		return src.Shards
+	}
+	return []*sqlx.DB{src.DB}
+}
+
+// shardFor returns the database containing the outbound edges of a DOI.
+func (src OciSource) shardFor(doi string) *sqlx.DB {
+	if len(src.Shards) > 0 {
+		return src.Shards[ShardIndex(doi, len(src.Shards))]
+	}
+	return src.DB
+}
+
+// eachShard calls f for each database in parallel and returns the first
+// error; a single database is queried directly.
+func eachShard(dbs []*sqlx.DB, f func(i int, db *sqlx.DB) error) error {
+	if len(dbs) == 1 {
+		return f(0, dbs[0])
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(dbs))
+	)
+	for i, db := range dbs {
+		wg.Add(1)
+		go func(i int, db *sqlx.DB) {
+			defer wg.Done()
+			errs[i] = f(i, db)
+		}(i, db)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupByShard groups DOI by the shard containing their outbound edges.
+func (src OciSource) groupByShard(dois set.Set[string]) [][]string {
+	if len(src.Shards) == 0 {
+		return [][]string{set.Sorted(dois)}
+	}
+	groups := make([][]string, len(src.Shards))
+	for _, doi := range set.Sorted(dois) {
+		i := ShardIndex(doi, len(src.Shards))
+		groups[i] = append(groups[i], doi)
+	}
+	return groups
+}
+
+// OpenOciShards opens the shards of a citation database, as written by
+// BuildOciShards, in any order; all shards are required.
+func OpenOciShards(filenames []string, opts SqliteOptions) (shards []*sqlx.DB, err error) {
+	var dbs []*sqlx.DB
+	defer func() {
+		if err != nil {
+			for _, db := range dbs {
+				db.Close()
+			}
+		}
+	}()
+	shards = make([]*sqlx.DB, len(filenames))
+	for _, filename := range filenames {
+		db, err := OpenDatabaseOptions(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+		var pos struct {
+			I int `db:"i"`
+			N int `db:"n"`
+		}
+		if err := db.Get(&pos, "SELECT i, n FROM shard"); err != nil {
+			return nil, fmt.Errorf("not a shard: %s: %w", filename, err)
+		}
+		switch {
+		case pos.N != len(filenames):
+			return nil, fmt.Errorf("%s is one of %d shards, got %d", filename, pos.N, len(filenames))
+		case pos.I < 0 || pos.I >= pos.N:
+			return nil, fmt.Errorf("invalid shard number %d: %s", pos.I, filename)
+		case shards[pos.I] != nil:
+			return nil, fmt.Errorf("duplicate shard %d: %s", pos.I, filename)
+		}
+		shards[pos.I] = db
+	}
+	return shards, nil
+}
+
+// BuildOciShards splits a citation database (as generated by makta) into n
+// sqlite3 databases by the hash of the citing DOI (see ShardIndex), named
+// prefix-00.db, prefix-01.db and so on; the table and indexes of the map
+// table are kept. Returns the filenames of the shards. This is a single scan
+// over the citation database; the indexes are created afterwards.
+func BuildOciShards(ociPath, prefix string, n int) (_ []string, err error) {
+	if n < 2 {
+		return nil, fmt.Errorf("need at least two shards, got %d", n)
+	}
+	src, err := OpenDatabase(ociPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	schema, err := mapSchema(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ociPath, err)
+	}
+	rows, err := src.Queryx("SELECT * FROM map")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	keyIndex := -1
+	for i, c := range columns {
+		if c == "k" {
+			keyIndex = i
+		}
+	}
+	if keyIndex < 0 {
+		return nil, fmt.Errorf("map table has no column k")
+	}
+	var (
+		started   = time.Now()
+		width     = len(strconv.Itoa(n - 1))
+		filenames []string
+		dbs       = make([]*sqlx.DB, n)
+		txs       = make([]*sqlx.Tx, n)
+		stmts     = make([]*sqlx.Stmt, n)
+		insert    = fmt.Sprintf("INSERT INTO map (%s) VALUES (%s)",
+			strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	)
+	defer func() {
+		for i, db := range dbs {
+			if db == nil {
+				continue
+			}
+			if err != nil && txs[i] != nil {
+				txs[i].Rollback()
+			}
+			db.Close()
+			if err != nil {
+				os.Remove(filenames[i])
+			}
+		}
+	}()
+	for i := range dbs {
+		filename := fmt.Sprintf("%s-%0*d.db", prefix, width, i)
+		if _, err := os.Stat(filename); err == nil {
+			return nil, fmt.Errorf("shard exists: %s", filename)
+		}
+		filenames = append(filenames, filename)
+		if dbs[i], err = sqlx.Open("sqlite3", filename); err != nil {
+			return nil, err
+		}
+		dbs[i].SetMaxOpenConns(1)
+		for _, q := range []string{"PRAGMA journal_mode = OFF", "PRAGMA synchronous = 0", schema[0], shardSchema} {
+			if _, err := dbs[i].Exec(q); err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+		if _, err := dbs[i].Exec("INSERT INTO shard (i, n) VALUES (?, ?)", i, n); err != nil {
+			return nil, err
+		}
+		if txs[i], err = dbs[i].Beginx(); err != nil {
+			return nil, err
+		}
+		if stmts[i], err = txs[i].Preparex(insert); err != nil {
+			return nil, err
+		}
+	}
+	var count int64
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+		var k string
+		switch v := values[keyIndex].(type) {
+		case string:
+			k = v
+		case []byte:
+			k = string(v)
+		default:
+			return nil, fmt.Errorf("unexpected key type %T", v)
+		}
+		if _, err := stmts[ShardIndex(k, n)].Exec(values...); err != nil {
+			return nil, err
+		}
+		if count++; count%10000000 == 0 {
+			log.Printf("shard: %d edges (%s)", count, time.Since(started))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range dbs {
+		if err := txs[i].Commit(); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[ok] shard: split %d edges into %d shards (%s)", count, n, time.Since(started))
+	err = eachShard(dbs, func(i int, db *sqlx.DB) error {
+		for _, q := range schema[1:] {
+			if _, err := db.Exec(q); err != nil {
+				return fmt.Errorf("%s: %w", filenames[i], err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[ok] shard: created indexes (%s)", time.Since(started))
+	return filenames, nil
+}
+
+// mapSchema returns the statements creating the map table of an sqlite3
+// database, the table first, followed by its indexes.
+func mapSchema(db *sqlx.DB) ([]string, error) {
+	var schema []string
+	if err := db.Select(&schema, `SELECT sql FROM sqlite_master
+		WHERE tbl_name = 'map' AND sql IS NOT NULL ORDER BY type DESC`); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("no map table")
+	}
+	return schema, nil
+}
+
+// citedFromShards returns the inbound edges for a DOI from all shards,
+// queried in parallel, in shard order.
+func (s *Server) citedFromShards(ctx context.Context, dbs []*sqlx.DB, doi string) ([]Map, error) {
+	results := make([][]Map, len(dbs))
+	err := eachShard(dbs, func(i int, db *sqlx.DB) error {
+		q, err := s.edgeQueriesFor(db)
+		if err != nil {
+			return err
+		}
+		stmt, err := s.stmts.get(db, q.byValue)
+		if err != nil {
+			return err
+		}
+		t := time.Now()
+		if err := stmt.SelectContext(ctx, &results[i], doi); err != nil {
+			return err
+		}
+		s.Stats.MeasureSinceWithLabels("sql_query", t, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var cited []Map
+	for _, v := range results {
+		cited = append(cited, v...)
+	}
+	return cited, nil
+}
@@ -0,0 +1,77 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestShardIndex(t *testing.T) {
+	for _, doi := range []string{"d0029", "10.1007/978-3-476-03951-4"} {
+		i := ShardIndex(doi, 16)
+		if i < 0 || i >= 16 || ShardIndex(doi, 16) != i {
+			t.Fatalf("[%s] got shard %d", doi, i)
+		}
+	}
+}
+
+func TestServerOciShards(t *testing.T) {
+	filenames, err := BuildOciShards("testdata/doi_doi.db", filepath.Join(t.TempDir(), "o-shard"), 3)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(filenames) != 3 || filepath.Base(filenames[2]) != "o-shard-2.db" {
+		t.Fatalf("got %v, want 3 shards", filenames)
+	}
+	if _, err := OpenOciShards(filenames[1:], SqliteOptions{}); err == nil {
+		t.Fatalf("got nil, want error for missing shard")
+	}
+	// Shards can be given in any order.
+	shards, err := OpenOciShards([]string{filenames[2], filenames[0], filenames[1]}, SqliteOptions{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var (
+		plain   = newTestServer(t)
+		sharded = newTestServer(t)
+	)
+	sharded.OciDatabase, sharded.OciShards = nil, shards
+	if err := sharded.Ping(); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if err := sharded.Validate(false); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	for _, id := range []string{"i0000", "i0029", "i0066"} {
+		var (
+			want = mustRequest(t, plain, "/id/"+id)
+			got  = mustRequest(t, sharded, "/id/"+id)
+		)
+		if len(got.Citing) != len(want.Citing) || len(got.Cited) != len(want.Cited) {
+			t.Fatalf("[%s] got %d/%d, want %d/%d citing/cited", id,
+				len(got.Citing), len(got.Cited), len(want.Citing), len(want.Cited))
+		}
+		for _, suffix := range []string{"/counts", "/exists"} {
+			a, b := httptest.NewRecorder(), httptest.NewRecorder()
+			plain.ServeHTTP(a, httptest.NewRequest("GET", "/id/"+id+suffix, nil))
+			sharded.ServeHTTP(b, httptest.NewRequest("GET", "/id/"+id+suffix, nil))
+			if a.Code != 200 || b.Body.String() != a.Body.String() {
+				t.Fatalf("[%s%s] got %s, want %s", id, suffix, b.Body.String(), a.Body.String())
+			}
+		}
+		var networks [2]Network
+		for i, srv := range []*Server{plain, sharded} {
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/"+id+"/network", nil))
+			if err := json.Unmarshal(rr.Body.Bytes(), &networks[i]); err != nil {
+				t.Fatalf("[%s] network: %v", id, err)
+			}
+		}
+		if networks[1].Extra.EdgeCount != networks[0].Extra.EdgeCount ||
+			networks[1].Extra.NodeCount != networks[0].Extra.NodeCount {
+			t.Fatalf("[%s] got %+v, want %+v", id, networks[1].Extra, networks[0].Extra)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package ckit
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// slowRequest is the record logged for requests exceeding the slow request
+// threshold; fields are filled in as the request progresses.
+type slowRequest struct {
+	ID          string  `json:"id"`
+	Institution string  `json:"isil,omitempty"`
+	Took        float64 `json:"took"` // seconds
+	Citing      int     `json:"citing"`
+	Cited       int     `json:"cited"`
+	Blobs       int     `json:"blobs"`
+	Cache       string  `json:"cache"` // hit, miss or off
+}
+
+// logSlowRequest logs the record as JSON, if the request took longer than
+// the configured threshold.
+func (s *Server) logSlowRequest(rec *slowRequest, started time.Time) {
+	elapsed := time.Since(started)
+	if s.SlowRequestThreshold <= 0 || elapsed < s.SlowRequestThreshold {
+		return
+	}
+	rec.Took = elapsed.Seconds()
+	b, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("slow request: %v", err)
+		return
+	}
+	log.Printf("slow request: %s", b)
+}
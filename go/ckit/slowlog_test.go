@@ -0,0 +1,36 @@
+package ckit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	srv := newTestServer(t)
+	mustRequest(t, srv, "/id/i0029")
+	if buf.Len() > 0 {
+		t.Fatalf("unexpected log output without threshold: %s", buf.String())
+	}
+	srv.SlowRequestThreshold = time.Nanosecond
+	mustRequest(t, srv, "/id/i0029?i=DE-1")
+	line := buf.String()
+	i := strings.Index(line, "slow request: ")
+	if i < 0 {
+		t.Fatalf("missing slow request log: %s", line)
+	}
+	var rec slowRequest
+	if err := json.Unmarshal([]byte(line[i+len("slow request: "):]), &rec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.ID != "i0029" || rec.Institution != "DE-1" || rec.Citing == 0 || rec.Blobs == 0 || rec.Cache != "off" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+}
@@ -0,0 +1,69 @@
+package ckit
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// CacheSnapshot describes a snapshot of the cache.
+type CacheSnapshot struct {
+	Path string  `json:"path"`
+	Size int64   `json:"size"`
+	Took float64 `json:"took"` // seconds
+}
+
+// SnapshotCache writes a consistent copy of the cache into a directory,
+// named after the current time, e.g. labed-cache-20220301-120000.db. The
+// file appears only when complete, so it can be picked up by a copy job.
+func (s *Server) SnapshotCache(dir string) (*CacheSnapshot, error) {
+	if s.Cache == nil {
+		return nil, fmt.Errorf("cache not enabled")
+	}
+	var (
+		started = time.Now()
+		name    = fmt.Sprintf("labed-cache-%s.db", started.Format("20060102-150405"))
+		dst     = filepath.Join(dir, name)
+		tmp     = filepath.Join(dir, "."+name+".tmp")
+	)
+	if _, err := os.Stat(dst); err == nil {
+		return nil, fmt.Errorf("snapshot file exists: %s", dst)
+	}
+	if err := s.Cache.Snapshot(tmp); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheSnapshot{Path: dst, Size: fi.Size(), Took: time.Since(started).Seconds()}, nil
+}
+
+// handleCacheSnapshot writes a snapshot of the cache to CacheSnapshotDir.
+func (s *Server) handleCacheSnapshot() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dir := s.CacheSnapshotDir
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		snapshot, err := s.SnapshotCache(dir)
+		if err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestServerCacheSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	c, err := cache.New(filepath.Join(dir, "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv := newTestServer(t)
+	srv.Cache = c
+	srv.CacheSnapshotDir = dir
+	mustRequest(t, srv, "/id/i0029")
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("POST", "/cache/snapshot", nil))
+	if rr.Code != 200 {
+		t.Fatalf("got %d, want 200: %s", rr.Code, rr.Body.String())
+	}
+	var snapshot CacheSnapshot
+	if err := json.Unmarshal(rr.Body.Bytes(), &snapshot); err != nil || snapshot.Size == 0 {
+		t.Fatalf("got %+v, %v, want snapshot", snapshot, err)
+	}
+	// A server seeded with the snapshot has the cached response.
+	seeded, err := cache.New(snapshot.Path)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	defer seeded.Close()
+	srv = newTestServer(t)
+	srv.Cache = seeded
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029", nil))
+	if rr.Code != 200 || rr.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("got %d, %s, want cache hit", rr.Code, rr.Header().Get("X-Cache"))
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(matches) > 0 {
+		t.Fatalf("got %v, want no temporary files", matches)
+	}
+}
@@ -0,0 +1,134 @@
+package ckit
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/slub/labe/go/ckit/tabutils"
+)
+
+var (
+	validJournalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	validSynchronous  = []string{"OFF", "NORMAL", "FULL", "EXTRA", "0", "1", "2", "3"}
+
+	// sqliteDrivers keeps track of the drivers registered for a given set
+	// of options, since database/sql does not allow to register a driver
+	// name twice.
+	sqliteDrivers   = make(map[SqliteOptions]string)
+	sqliteDriversMu sync.Mutex
+)
+
+// SqliteOptions allows to tune sqlite3 connections. Zero values leave the
+// sqlite3 defaults untouched. The pragmas are applied to each new connection.
+// Databases are opened read-only and immutable by default, which guarantees
+// we never write to dataset files and enables sqlite's immutable fast path
+// (no locking); set Mutable, if files may change while being served.
+type SqliteOptions struct {
+	MmapSize     int64         // PRAGMA mmap_size, in bytes
+	CacheSize    int           // PRAGMA cache_size, pages or -KiB
+	BusyTimeout  time.Duration // PRAGMA busy_timeout
+	JournalMode  string        // PRAGMA journal_mode, e.g. WAL
+	Synchronous  string        // PRAGMA synchronous, e.g. NORMAL
+	MaxOpenConns int           // maximum number of open (read) connections
+	Mutable      bool          // open read-only, but not immutable
+}
+
+// IsZero returns true, if no option is set.
+func (o SqliteOptions) IsZero() bool {
+	return o == SqliteOptions{}
+}
+
+// Validate checks options for invalid values.
+func (o SqliteOptions) Validate() error {
+	if o.JournalMode != "" && !SliceContains(validJournalModes, strings.ToUpper(o.JournalMode)) {
+		return fmt.Errorf("invalid journal mode: %s %v", o.JournalMode, validJournalModes)
+	}
+	if o.Synchronous != "" && !SliceContains(validSynchronous, strings.ToUpper(o.Synchronous)) {
+		return fmt.Errorf("invalid synchronous setting: %s %v", o.Synchronous, validSynchronous)
+	}
+	if o.MmapSize < 0 || o.MaxOpenConns < 0 || o.BusyTimeout < 0 {
+		return fmt.Errorf("invalid negative sqlite option")
+	}
+	return nil
+}
+
+// Pragmas returns the PRAGMA statements corresponding to the options.
+func (o SqliteOptions) Pragmas() []string {
+	var pragmas []string
+	if o.MmapSize > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA mmap_size = %d", o.MmapSize))
+	}
+	if o.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = %d", o.CacheSize))
+	}
+	if o.BusyTimeout > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA busy_timeout = %d", o.BusyTimeout.Milliseconds()))
+	}
+	if o.JournalMode != "" {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA journal_mode = %s", strings.ToUpper(o.JournalMode)))
+	}
+	if o.Synchronous != "" {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA synchronous = %s", strings.ToUpper(o.Synchronous)))
+	}
+	return pragmas
+}
+
+// driverName returns the name of an sqlite3 driver, which applies the
+// pragmas on connect. The driver is registered on first use.
+func (o SqliteOptions) driverName() string {
+	pragmas := o.Pragmas()
+	if len(pragmas) == 0 {
+		return "sqlite3"
+	}
+	key := o
+	key.MaxOpenConns = 0 // not a connection setting
+	key.Mutable = false
+	sqliteDriversMu.Lock()
+	defer sqliteDriversMu.Unlock()
+	if name, ok := sqliteDrivers[key]; ok {
+		return name
+	}
+	name := fmt.Sprintf("sqlite3_ckit_%d", len(sqliteDrivers))
+	sql.Register(name, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, p := range pragmas {
+				if _, err := conn.Exec(p, nil); err != nil {
+					return fmt.Errorf("%s: %w", p, err)
+				}
+			}
+			return nil
+		},
+	})
+	sqlx.BindDriver(name, sqlx.QUESTION)
+	sqliteDrivers[key] = name
+	return name
+}
+
+// dsn returns the connection string for a file.
+func (o SqliteOptions) dsn(filename string) string {
+	if o.Mutable {
+		return tabutils.WithReadOnly(filename)
+	}
+	return tabutils.WithImmutable(filename)
+}
+
+// openSqlite opens an sqlite3 database read-only, with options applied.
+func openSqlite(filename string, opts SqliteOptions) (*sqlx.DB, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	db, err := sqlx.Open(opts.driverName(), opts.dsn(filename))
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+		db.SetMaxIdleConns(opts.MaxOpenConns)
+	}
+	return db, nil
+}
@@ -0,0 +1,22 @@
+package ckit
+
+import "testing"
+
+func TestOpenDatabaseOptions(t *testing.T) {
+	opts := SqliteOptions{MmapSize: 1 << 20, CacheSize: -2000, MaxOpenConns: 2}
+	db, err := OpenDatabaseOptions("testdata/id_doi.db", opts)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var mmapSize int64
+	if err := db.Get(&mmapSize, "PRAGMA mmap_size"); err != nil {
+		t.Fatalf("pragma: %v", err)
+	}
+	if mmapSize != opts.MmapSize {
+		t.Fatalf("got mmap_size %d, want %d", mmapSize, opts.MmapSize)
+	}
+	if _, err := OpenDatabaseOptions("testdata/id_doi.db", SqliteOptions{JournalMode: "x; DROP"}); err == nil {
+		t.Fatalf("expected error for invalid journal mode")
+	}
+}
@@ -0,0 +1,75 @@
+package ckit
+
+import (
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Hot queries, executed for each request.
+const (
+	queryValueByKey  = "SELECT v FROM map WHERE k = ?"
+	queryKeyByValue  = "SELECT k FROM map WHERE v = ?"
+	queryRowsByKey   = "SELECT k, v FROM map WHERE k = ?"
+	queryRowsByValue = "SELECT k, v FROM map WHERE v = ?"
+)
+
+// stmtCache prepares statements once per database and query and reuses them
+// afterwards, so we do not parse the same SQL on every request. The zero value
+// is ready to use. Thread-safe.
+type stmtCache struct {
+	mu sync.Mutex
+	m  map[stmtKey]*sqlx.Stmt
+}
+
+type stmtKey struct {
+	db    *sqlx.DB
+	query string
+}
+
+// get returns a prepared statement for a query, which will be rebound to the
+// bindvar type of the database.
+func (c *stmtCache) get(db *sqlx.DB, query string) (*sqlx.Stmt, error) {
+	key := stmtKey{db: db, query: query}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stmt, ok := c.m[key]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.Preparex(db.Rebind(query))
+	if err != nil {
+		return nil, err
+	}
+	if c.m == nil {
+		c.m = make(map[stmtKey]*sqlx.Stmt)
+	}
+	c.m[key] = stmt
+	return stmt, nil
+}
+
+// Close closes all prepared statements.
+func (c *stmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for k, stmt := range c.m {
+		if cerr := stmt.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(c.m, k)
+	}
+	return err
+}
+
+// forget closes and removes the statements prepared for a database, e.g.
+// before it is closed.
+func (c *stmtCache) forget(db *sqlx.DB) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, stmt := range c.m {
+		if k.db == db {
+			stmt.Close()
+			delete(c.m, k)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"sync"
 	"text/tabwriter"
 	"time"
+
+	"github.com/segmentio/encoding/json"
 )
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyz"
@@ -20,10 +22,31 @@ func randString(n int) string {
 	return string(b)
 }
 
-// Entry is a stopwatch entry.
+// Phases of a request, used to name stopwatch entries.
+const (
+	phaseCache       = "cache"
+	phaseQueue       = "queue"
+	phaseLookup      = "lookup"
+	phaseCounts      = "counts"
+	phaseEdges       = "edges"
+	phaseMap         = "map"
+	phaseUnmatched   = "unmatched"
+	phaseResolve     = "resolve"
+	phaseMatch       = "match"
+	phaseFetch       = "fetch"
+	phaseStream      = "stream"
+	phaseStore       = "store"
+	phasePostprocess = "postprocess"
+	phaseIDMap       = "idmap"
+	phaseEncode      = "encode"
+)
+
+// Entry is a stopwatch entry. The phase, if any, names the work done since
+// the previous entry, e.g. "edges".
 type Entry struct {
 	T       time.Time
 	Message string
+	Phase   string
 }
 
 // StopWatch allows to record events over time and render them in a pretty
@@ -46,6 +69,15 @@ type StopWatch struct {
 	id       string
 	entries  []*Entry
 	disabled bool
+	tracking bool
+	last     time.Time
+	phases   []PhaseDuration
+}
+
+// PhaseDuration is the total time spent in a phase.
+type PhaseDuration struct {
+	Phase    string
+	Duration time.Duration
 }
 
 // SetEnabled enables or disables the stopwatch. If disabled, any call will be
@@ -63,20 +95,66 @@ func (s *StopWatch) Record(msg string) {
 
 // Recordf records a message.
 func (s *StopWatch) Recordf(msg string, vs ...interface{}) {
-	if s.disabled {
+	s.RecordPhasef("", msg, vs...)
+}
+
+// RecordPhasef records a message at the end of a phase, so timings can be
+// aggregated by phase, while messages vary.
+func (s *StopWatch) RecordPhasef(phase, msg string, vs ...interface{}) {
+	if s.disabled && !s.tracking {
 		return
 	}
+	now := time.Now()
 	s.Lock()
 	defer s.Unlock()
+	if s.tracking {
+		s.addPhase(phase, now.Sub(s.last))
+		s.last = now
+	}
+	if s.disabled {
+		return
+	}
 	if s.id == "" {
 		s.id = randString(8)
 	}
 	s.entries = append(s.entries, &Entry{
-		T:       time.Now(),
+		T:       now,
 		Message: fmt.Sprintf(msg, vs...),
+		Phase:   phase,
 	})
 }
 
+// TrackPhases sums up the time spent per phase from now on, even if the
+// stopwatch is disabled; messages are not recorded in that case.
+func (s *StopWatch) TrackPhases() {
+	s.Lock()
+	defer s.Unlock()
+	s.tracking, s.last = true, time.Now()
+}
+
+// addPhase adds to the time spent in a phase; the time between entries
+// without a phase is not counted.
+func (s *StopWatch) addPhase(phase string, d time.Duration) {
+	if phase == "" {
+		return
+	}
+	for i := range s.phases {
+		if s.phases[i].Phase == phase {
+			s.phases[i].Duration += d
+			return
+		}
+	}
+	s.phases = append(s.phases, PhaseDuration{Phase: phase, Duration: d})
+}
+
+// PhaseDurations returns the time spent per phase, in order of first
+// occurrence, as tracked since TrackPhases.
+func (s *StopWatch) PhaseDurations() []PhaseDuration {
+	s.Lock()
+	defer s.Unlock()
+	return s.phases
+}
+
 // Reset resets the stopwatch.
 func (s *StopWatch) Reset() {
 	if s.disabled {
@@ -98,6 +176,121 @@ func (s *StopWatch) Entries() []*Entry {
 	return s.entries
 }
 
+// TraceEntry is a single recorded event, with durations in seconds.
+type TraceEntry struct {
+	Message string  `json:"msg"`
+	Phase   string  `json:"phase,omitempty"`
+	Took    float64 `json:"took"`    // since the previous event
+	Elapsed float64 `json:"elapsed"` // since the first event
+}
+
+// Trace returns the recorded events with durations, e.g. for inclusion in a
+// response.
+func (s *StopWatch) Trace() []TraceEntry {
+	s.Lock()
+	defer s.Unlock()
+	var trace []TraceEntry
+	for i, entry := range s.entries {
+		var te = TraceEntry{Message: entry.Message, Phase: entry.Phase}
+		if i > 0 {
+			te.Took = entry.T.Sub(s.entries[i-1].T).Seconds()
+			te.Elapsed = entry.T.Sub(s.entries[0].T).Seconds()
+		}
+		trace = append(trace, te)
+	}
+	return trace
+}
+
+// Span is the time between two entries, named after the phase of the later
+// entry; spans map to tracing spans, e.g. of OpenTelemetry.
+type Span struct {
+	Phase    string
+	Message  string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Spans returns one span per recorded entry, except the first, which marks
+// the start.
+func (s *StopWatch) Spans() []Span {
+	s.Lock()
+	defer s.Unlock()
+	var spans []Span
+	for i := 1; i < len(s.entries); i++ {
+		prev, entry := s.entries[i-1], s.entries[i]
+		spans = append(spans, Span{
+			Phase:    entry.Phase,
+			Message:  entry.Message,
+			Start:    prev.T,
+			Duration: entry.T.Sub(prev.T),
+		})
+	}
+	return spans
+}
+
+// spanRecord is a span in a JSON log record, with offset and duration in
+// seconds.
+type spanRecord struct {
+	Phase   string  `json:"phase,omitempty"`
+	Message string  `json:"msg"`
+	Start   float64 `json:"start"` // since the first entry
+	Took    float64 `json:"took"`
+}
+
+// timingsRecord is the JSON log record of a stopwatch.
+type timingsRecord struct {
+	StopWatch string       `json:"stopwatch"`
+	ID        string       `json:"id,omitempty"`
+	Started   string       `json:"started"`
+	Took      float64      `json:"took"`
+	Spans     []spanRecord `json:"spans"`
+}
+
+// JSON returns the spans as a single JSON object, e.g. for a log line; id
+// identifies the request, e.g. by the requested identifier.
+func (s *StopWatch) JSON(id string) ([]byte, error) {
+	spans := s.Spans()
+	if len(spans) == 0 {
+		return nil, nil
+	}
+	var (
+		started = spans[0].Start
+		rec     = timingsRecord{
+			StopWatch: s.id,
+			ID:        id,
+			Started:   started.Format(time.RFC3339Nano),
+			Spans:     make([]spanRecord, len(spans)),
+		}
+	)
+	for i, span := range spans {
+		rec.Spans[i] = spanRecord{
+			Phase:   span.Phase,
+			Message: span.Message,
+			Start:   span.Start.Sub(started).Seconds(),
+			Took:    span.Duration.Seconds(),
+		}
+	}
+	last := spans[len(spans)-1]
+	rec.Took = last.Start.Add(last.Duration).Sub(started).Seconds()
+	return json.Marshal(rec)
+}
+
+// LogJSON writes the timings as a JSON record using standard library log
+// facilities, one line per stopwatch, prefixed with "timings: ".
+func (s *StopWatch) LogJSON(id string) {
+	if s.disabled {
+		return
+	}
+	b, err := s.JSON(id)
+	if err != nil {
+		log.Printf("timings: %v", err)
+		return
+	}
+	if len(b) > 0 {
+		log.Printf("timings: %s", b)
+	}
+}
+
 // LogTable write a table using standard library log facilities.
 func (s *StopWatch) LogTable() {
 	if s.disabled {
@@ -1,6 +1,9 @@
 package ckit
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestRandString(t *testing.T) {
 	// Only test for correct length.
@@ -42,3 +45,52 @@ func TestStopWatch(t *testing.T) {
 		t.Fatalf("got %v, want ", len(entries))
 	}
 }
+
+func TestStopWatchTrace(t *testing.T) {
+	var sw StopWatch
+	sw.Record("a")
+	sw.Record("b")
+	trace := sw.Trace()
+	if len(trace) != 2 || trace[0].Message != "a" || trace[1].Message != "b" {
+		t.Fatalf("unexpected trace: %v", trace)
+	}
+	if trace[0].Took != 0 || trace[1].Elapsed < trace[0].Elapsed {
+		t.Fatalf("unexpected durations: %v", trace)
+	}
+	sw.SetEnabled(false)
+	sw.Reset()
+	sw.Record("c")
+	if len(sw.Trace()) != 2 {
+		t.Fatalf("disabled stopwatch must not record")
+	}
+}
+
+func TestStopWatchSpans(t *testing.T) {
+	var sw StopWatch
+	sw.Record("started")
+	sw.RecordPhasef(phaseLookup, "found doi: %s", "10.1/a")
+	sw.RecordPhasef(phaseEdges, "found %d edges", 2)
+	spans := sw.Spans()
+	if len(spans) != 2 || spans[0].Phase != phaseLookup || spans[1].Message != "found 2 edges" {
+		t.Fatalf("got %+v, want two spans", spans)
+	}
+	if !spans[1].Start.Equal(spans[0].Start.Add(spans[0].Duration)) {
+		t.Fatalf("got %+v, want adjacent spans", spans)
+	}
+	b, err := sw.JSON("i1")
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var rec timingsRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.ID != "i1" || rec.StopWatch == "" || len(rec.Spans) != 2 || rec.Spans[1].Phase != phaseEdges ||
+		rec.Took < rec.Spans[1].Start {
+		t.Fatalf("got %s, want record with two spans", b)
+	}
+	var empty StopWatch
+	if b, err := empty.JSON(""); err != nil || b != nil {
+		t.Fatalf("got %s, %v, want nothing for an empty stopwatch", b, err)
+	}
+}
@@ -0,0 +1,221 @@
+package ckit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+	"github.com/slub/labe/go/ckit/set"
+)
+
+// streamable returns true, if a response can be streamed: plain JSON in the
+// version 1 schema, without any post-processing.
+func (o *requestOptions) streamable() bool {
+	return o.isZero() && !o.Debug && !o.Map && !o.bypassCache() && o.Format == FormatJSON && o.Version == SchemaV1
+}
+
+// streamResponse writes a response to w while the blobs of the matched ids
+// are fetched, instead of keeping all documents in memory; only the
+// unmatched documents (which are small) are taken from the response. Citing
+// and cited documents are written in two passes over ids, so a document in
+// both lists is fetched twice. The counts (and any errors) are only known at
+// the end and follow the documents in "extra". As the status has been sent
+// already, a failed fetch ends the document list and is reported in
+// extra.errors. If a cache is configured, a compressed copy (without the
+// field filter applied) is kept and cached, if the request was expensive
+// and complete, i.e. not truncated.
+func (s *Server) streamResponse(ctx context.Context, w io.Writer, response *Response,
+	ids []Map, outbound, inbound set.Set[string], started time.Time, progress *progressReporter) (blobs int, err error) {
+	var (
+		bw   = bufio.NewWriterSize(w, 65536)
+		zbuf bytes.Buffer
+		zw   *zstd.Encoder
+		size int // uncompressed size of the cached copy
+		ff   = s.fieldFilter(ctx)
+		data = s.data(ctx)
+	)
+	if s.Cache != nil {
+		if zw, err = s.newCacheWriter(&zbuf); err != nil {
+			return 0, fmt.Errorf("cache compress: %w", err)
+		}
+		defer zw.Close()
+	}
+	// emit writes to the client and to the cached copy, which may differ.
+	emit := func(client, cached []byte) error {
+		if _, err := bw.Write(client); err != nil {
+			return err
+		}
+		if zw == nil {
+			return nil
+		}
+		n, err := zw.Write(cached)
+		size += n
+		return err
+	}
+	id, _ := json.Marshal(response.ID)
+	doi, _ := json.Marshal(response.DOI)
+	prefix := []byte(fmt.Sprintf(`{"id":%s,"doi":%s`, id, doi))
+	if err := emit(prefix, prefix); err != nil {
+		return 0, err
+	}
+	fctx, cancel := withTimeout(ctx, s.FetchTimeout)
+	defer cancel()
+	var (
+		failed   bool // fetching stopped early, do not cache
+		filtered bool // documents removed by the field filter, do not cache
+	)
+	for _, list := range []struct {
+		name  string
+		edges set.Set[string]
+		count *int
+		total *int
+	}{
+		{"citing", outbound, &response.Extra.CitingCount, &response.Extra.TotalCitingCount},
+		{"cited", inbound, &response.Extra.CitedCount, &response.Extra.TotalCitedCount},
+	} {
+		start := []byte(fmt.Sprintf(`,%q:[`, list.name))
+		if err := emit(start, start); err != nil {
+			return blobs, err
+		}
+		var written int // documents written to the cached copy
+		for _, v := range ids {
+			if !list.edges.Contains(v.Value) {
+				continue
+			}
+			*list.total++
+			if failed {
+				continue
+			}
+			if s.MaxDocuments > 0 && written >= s.MaxDocuments {
+				response.Extra.Truncated = true
+				continue
+			}
+			if err := fctx.Err(); err != nil {
+				if errors.Is(err, context.DeadlineExceeded) {
+					err = s.timeoutError(ctx, "fetch", s.FetchTimeout,
+						fmt.Sprintf("fetched %d of %d blobs", blobs, len(ids)))
+				}
+				response.Extra.Errors = append(response.Extra.Errors, err.Error())
+				failed = true
+				continue
+			}
+			var (
+				t   = time.Now()
+				b   []byte
+				err error
+			)
+			if data.isDegraded(ComponentIndexData) {
+				b = documentStub(v.Key, v.Value)
+			} else {
+				b, err = data.IndexData.Fetch(v.Key)
+			}
+			if errors.Is(err, ErrBlobNotFound) {
+				continue
+			}
+			if err != nil {
+				response.Extra.Errors = append(response.Extra.Errors,
+					fmt.Sprintf("index data fetch: %v", err))
+				failed = true
+				continue
+			}
+			s.Stats.MeasureSinceWithLabels("index_data_fetch", t, nil)
+			client := b
+			if ff != nil {
+				if client, err = ff.Transform(b); err != nil {
+					response.Extra.Errors = append(response.Extra.Errors,
+						fmt.Sprintf("%s %s: removed, cannot filter fields: %v", list.name, v.Key, err))
+					filtered = true
+					continue
+				}
+			}
+			if written > 0 {
+				if err := emit([]byte(","), []byte(",")); err != nil {
+					return blobs, err
+				}
+			}
+			if err := emit(client, b); err != nil {
+				return blobs, err
+			}
+			written++
+			*list.count++
+			blobs++
+			progress.report(Progress{Stage: "fetch", Matched: len(ids), Fetched: blobs})
+		}
+		if err := emit([]byte("]"), []byte("]")); err != nil {
+			return blobs, err
+		}
+	}
+	cached, err := json.Marshal(response.Unmatched)
+	if err != nil {
+		return blobs, err
+	}
+	if ff != nil {
+		var (
+			errs   []string
+			before = len(response.Extra.Errors)
+		)
+		response.Unmatched.Citing, errs = ff.filterDocuments(response.Unmatched.Citing, "unmatched citing")
+		response.Extra.Errors = append(response.Extra.Errors, errs...)
+		response.Unmatched.Cited, errs = ff.filterDocuments(response.Unmatched.Cited, "unmatched cited")
+		response.Extra.Errors = append(response.Extra.Errors, errs...)
+		filtered = filtered || len(response.Extra.Errors) > before
+	}
+	response.Unmatched.Citing = renameField(response.Unmatched.Citing, DefaultDOIField, s.unmatchedDOIField())
+	response.Unmatched.Cited = renameField(response.Unmatched.Cited, DefaultDOIField, s.unmatchedDOIField())
+	client, err := json.Marshal(response.Unmatched)
+	if err != nil {
+		return blobs, err
+	}
+	if err := emit(append([]byte(`,"unmatched":`), client...), append([]byte(`,"unmatched":`), cached...)); err != nil {
+		return blobs, err
+	}
+	response.Extra.UnmatchedCitingCount = len(response.Unmatched.Citing)
+	response.Extra.UnmatchedCitedCount = len(response.Unmatched.Cited)
+	if !response.Extra.Truncated {
+		// Totals are only reported for truncated responses.
+		response.Extra.TotalCitingCount = 0
+		response.Extra.TotalCitedCount = 0
+	}
+	response.Extra.Took = time.Since(started).Seconds()
+	// The extra section differs between response and cache (cached flag).
+	extra, err := json.Marshal(response.Extra)
+	if err != nil {
+		return blobs, err
+	}
+	if _, err := fmt.Fprintf(bw, `,"extra":%s}`+"\n", extra); err != nil {
+		return blobs, err
+	}
+	if err := bw.Flush(); err != nil {
+		return blobs, err
+	}
+	if zw == nil || failed || filtered || response.Extra.Truncated || len(response.Extra.Degraded) > 0 ||
+		time.Since(started) <= s.CacheTriggerDuration {
+		return blobs, nil
+	}
+	response.Extra.Cached = true
+	if extra, err = json.Marshal(response.Extra); err != nil {
+		return blobs, err
+	}
+	n, err := fmt.Fprintf(zw, `,"extra":%s}`+"\n", extra)
+	if err != nil {
+		return blobs, err
+	}
+	size += n
+	if err := zw.Close(); err != nil {
+		return blobs, fmt.Errorf("cache close: %w", err)
+	}
+	if !s.admitCache(response.ID, zbuf.Len(), response.Extra.Took) {
+		return blobs, nil
+	}
+	if err := s.setCache(response.ID, zbuf.Bytes(), size); err != nil && err != cache.ErrReadOnly {
+		return blobs, fmt.Errorf("failed to cache value for %s: %v", response.ID, err)
+	}
+	return blobs, nil
+}
@@ -0,0 +1,53 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestServerStreamResponse(t *testing.T) {
+	srv := newTestServer(t)
+	want := mustRequest(t, srv, "/id/i0029")
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv.Cache = c
+	srv.StreamThreshold = 1
+	for _, cached := range []bool{false, true} {
+		got := mustRequest(t, srv, "/id/i0029")
+		if got.Extra.Cached != cached {
+			t.Fatalf("got cached %v, want %v", got.Extra.Cached, cached)
+		}
+		if len(got.Citing) != len(want.Citing) || len(got.Cited) != len(want.Cited) ||
+			got.Extra.CitingCount != want.Extra.CitingCount ||
+			got.Extra.CitedCount != want.Extra.CitedCount ||
+			got.Extra.UnmatchedCitedCount != want.Extra.UnmatchedCitedCount {
+			t.Fatalf("got %d/%d docs (%+v), want %d/%d", len(got.Citing), len(got.Cited),
+				got.Extra, len(want.Citing), len(want.Cited))
+		}
+	}
+	// Other formats and filters are not streamed.
+	rr := httptest.NewRecorder()
+	srv.Cache = nil
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/id/i0029?v=2", nil))
+	var v2 ResponseV2
+	if err := json.Unmarshal(rr.Body.Bytes(), &v2); err != nil || v2.Citing.MatchedCount != len(want.Citing) {
+		t.Fatalf("got %d, %v, want %d matched", v2.Citing.MatchedCount, err, len(want.Citing))
+	}
+}
+
+func TestServerStreamResponseTruncated(t *testing.T) {
+	srv := newTestServer(t)
+	srv.StreamThreshold = 1
+	srv.MaxDocuments = 2
+	got := mustRequest(t, srv, "/id/i0029")
+	if len(got.Citing) != 2 || !got.Extra.Truncated || got.Extra.TotalCitingCount != 12 {
+		t.Fatalf("got %d docs, %+v", len(got.Citing), got.Extra)
+	}
+}
@@ -0,0 +1,74 @@
+package tabutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// Checkpoint records the progress of an import, so an interrupted import can
+// be resumed. Offset is the number of (decompressed) bytes of the input file
+// at FileIndex, that have been imported; all previous files have been
+// imported completely.
+type Checkpoint struct {
+	Filenames []string  `json:"filenames"`
+	FileIndex int       `json:"file_index"`
+	Offset    int64     `json:"offset"`
+	Rows      int64     `json:"rows"`
+	Done      bool      `json:"done"` // all input has been imported
+	Updated   time.Time `json:"updated"`
+}
+
+// CheckpointPath returns the path of the checkpoint file for a database.
+func CheckpointPath(database string) string {
+	return database + ".checkpoint"
+}
+
+// ReadCheckpoint reads a checkpoint from a file.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Matches returns an error, if the checkpoint has been recorded for
+// different input files.
+func (c *Checkpoint) Matches(filenames []string) error {
+	if !reflect.DeepEqual(c.Filenames, filenames) {
+		return fmt.Errorf("checkpoint is for input %v, got %v", c.Filenames, filenames)
+	}
+	return nil
+}
+
+// WriteFile atomically writes the checkpoint to a file.
+func (c *Checkpoint) WriteFile(path string) error {
+	c.Updated = time.Now()
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
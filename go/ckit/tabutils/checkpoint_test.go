@@ -0,0 +1,29 @@
+package tabutils
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	var (
+		path = CheckpointPath(filepath.Join(t.TempDir(), "data.db"))
+		c    = &Checkpoint{Filenames: []string{"a.tsv", "b.tsv"}, FileIndex: 1, Offset: 1024, Rows: 42}
+	)
+	if err := c.WriteFile(path); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	d, err := ReadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if d.FileIndex != 1 || d.Offset != 1024 || d.Rows != 42 || d.Done {
+		t.Fatalf("got %+v, want %+v", d, c)
+	}
+	if err := d.Matches([]string{"a.tsv", "b.tsv"}); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if err := d.Matches([]string{"a.tsv"}); err == nil {
+		t.Fatalf("expected error for different input")
+	}
+}
@@ -0,0 +1,50 @@
+package tabutils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// zstdReadCloser releases decoder resources on close.
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+// Close closes the decoder.
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+// DecompressReader returns a reader, that transparently decompresses gzip or
+// zstd compressed data, detected by magic bytes; other data is passed
+// through unchanged. Close does not close the underlying reader.
+func DecompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{zr}, nil
+	default:
+		return ioutil.NopCloser(br), nil
+	}
+}
@@ -0,0 +1,45 @@
+package tabutils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDecompressReader(t *testing.T) {
+	var (
+		data = []byte("10.1/a\t10.1/b\n")
+		gz   bytes.Buffer
+		zs   bytes.Buffer
+	)
+	gw := gzip.NewWriter(&gz)
+	gw.Write(data)
+	gw.Close()
+	zw, err := zstd.NewWriter(&zs)
+	if err != nil {
+		t.Fatalf("zstd: %v", err)
+	}
+	zw.Write(data)
+	zw.Close()
+	for _, input := range [][]byte{data, gz.Bytes(), zs.Bytes(), []byte("a"), nil} {
+		r, err := DecompressReader(bytes.NewReader(input))
+		if err != nil {
+			t.Fatalf("got %v", err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		r.Close()
+		want := data
+		if len(input) < 2 {
+			want = input
+		}
+		if !bytes.Equal(b, want) {
+			t.Fatalf("got %q, want %q", b, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package tabutils
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// Selector selects a value from a JSON document by a dotted path, e.g. "id"
+// or "meta.doi"; a single dot selects the whole document.
+type Selector struct {
+	path []string
+}
+
+// ParseSelector parses a selector, a leading dot is optional.
+func ParseSelector(s string) Selector {
+	s = strings.TrimPrefix(strings.TrimSpace(s), ".")
+	if s == "" {
+		return Selector{}
+	}
+	return Selector{path: strings.Split(s, ".")}
+}
+
+// IsWhole returns true, if the selector selects the whole document.
+func (s Selector) IsWhole() bool {
+	return len(s.path) == 0
+}
+
+// String returns the selector in dotted form.
+func (s Selector) String() string {
+	return "." + strings.Join(s.path, ".")
+}
+
+// Values returns the selected values as strings. Strings are returned as is,
+// other scalars in their JSON representation; arrays are expanded into
+// multiple values and objects are encoded as JSON. A missing field or null
+// results in no values.
+func (s Selector) Values(doc interface{}) ([]string, error) {
+	v := doc
+	for _, p := range s.path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		if v, ok = m[p]; !ok {
+			return nil, nil
+		}
+	}
+	switch w := v.(type) {
+	case []interface{}:
+		var result []string
+		for _, elem := range w {
+			if elem == nil {
+				continue
+			}
+			s, err := stringValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	case nil:
+		return nil, nil
+	default:
+		s, err := stringValue(w)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+// stringValue returns a string for a JSON value.
+func stringValue(v interface{}) (string, error) {
+	switch w := v.(type) {
+	case string:
+		return w, nil
+	case json.Number:
+		return w.String(), nil
+	case bool:
+		return strconv.FormatBool(w), nil
+	default:
+		b, err := json.Marshal(w)
+		return string(b), err
+	}
+}
+
+// TabField prepares a string to be used as a field in a TSV line imported by
+// sqlite3; fields containing separators or starting with a quote are quoted.
+func TabField(s string) string {
+	if !strings.ContainsAny(s, "\t\n\r") && !strings.HasPrefix(s, `"`) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// NDJSONRows converts a single JSON document into zero or more two-column
+// TSV rows, one for each combination of selected keys and values. Documents
+// without a key or value yield no rows.
+func NDJSONRows(line []byte, key, value Selector) ([]byte, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil, nil
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	keys, err := key.Values(doc)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	if value.IsWhole() {
+		values = []string{string(line)}
+	} else if values, err = value.Values(doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, k := range keys {
+		for _, v := range values {
+			buf.WriteString(TabField(k))
+			buf.WriteByte('\t')
+			buf.WriteString(TabField(v))
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,33 @@
+package tabutils
+
+import "testing"
+
+func TestNDJSONRows(t *testing.T) {
+	var cases = []struct {
+		line   string
+		key    string
+		value  string
+		result string
+	}{
+		{"", "id", ".", ""},
+		{`{"id": "1", "doi": "10.1/2"}`, "id", "doi", "1\t10.1/2\n"},
+		{`{"id": "1"}`, "id", "doi", ""},
+		{`{"id": "1"}`, ".id", ".", "1\t{\"id\": \"1\"}\n"},
+		{`{"id": 12345678901234567890, "a": {"b": true}}`, "id", "a.b", "12345678901234567890\ttrue\n"},
+		{`{"id": "1", "doi": ["a", "b", null]}`, "id", "doi", "1\ta\n1\tb\n"},
+		{`{"id": "1", "x": {"y": 1}}`, "id", "x", "1\t{\"y\":1}\n"},
+		{`{"id": "1", "x": "a\tb"}`, "id", "x", "1\t\"a\tb\"\n"},
+	}
+	for _, c := range cases {
+		b, err := NDJSONRows([]byte(c.line), ParseSelector(c.key), ParseSelector(c.value))
+		if err != nil {
+			t.Fatalf("[%s] got %v", c.line, err)
+		}
+		if string(b) != c.result {
+			t.Fatalf("[%s] got %q, want %q", c.line, string(b), c.result)
+		}
+	}
+	if _, err := NDJSONRows([]byte("{"), ParseSelector("id"), ParseSelector(".")); err == nil {
+		t.Fatalf("expected error for invalid JSON")
+	}
+}
@@ -0,0 +1,145 @@
+package tabutils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// linesPerBatch is the number of lines converted by a worker at once.
+const linesPerBatch = 10000
+
+// ConvertFunc converts a single input line into zero or more output rows,
+// each terminated by a newline.
+type ConvertFunc func(line []byte) ([]byte, error)
+
+// EmitFunc receives converted data in input order, together with the number
+// of output rows and the number of input bytes the data corresponds to.
+type EmitFunc func(b []byte, rows, size int64) error
+
+type lineBatch struct {
+	seq   int
+	first int64 // line number of the first line
+	lines [][]byte
+	size  int64
+}
+
+type convertedBatch struct {
+	seq  int
+	b    []byte
+	rows int64
+	size int64
+	err  error
+}
+
+// ConvertLines reads lines from a reader, converts them with a number of
+// workers in parallel and passes the results to emit, which is called from
+// the calling goroutine in input order. A missing newline at the end of the
+// input is added. The line numbers in errors are relative to the reader.
+func ConvertLines(r io.Reader, workers int, f ConvertFunc, emit EmitFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		batches = make(chan lineBatch)
+		results = make(chan convertedBatch)
+		done    = make(chan struct{})
+		readErr error
+		wg      sync.WaitGroup
+	)
+	defer close(done)
+	go func() {
+		defer close(batches)
+		var (
+			br    = bufio.NewReader(r)
+			batch = lineBatch{first: 1}
+			send  = func() bool {
+				select {
+				case batches <- batch:
+				case <-done:
+					return false
+				}
+				batch = lineBatch{seq: batch.seq + 1, first: batch.first + int64(len(batch.lines))}
+				return true
+			}
+		)
+		for {
+			line, err := br.ReadBytes('\n')
+			if len(line) > 0 {
+				batch.size += int64(len(line))
+				if line[len(line)-1] != '\n' {
+					line = append(line, '\n')
+				}
+				batch.lines = append(batch.lines, line)
+				if len(batch.lines) == linesPerBatch && !send() {
+					return
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+		}
+		if len(batch.lines) > 0 {
+			send()
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				var (
+					buf bytes.Buffer
+					res = convertedBatch{seq: batch.seq, size: batch.size}
+				)
+				for j, line := range batch.lines {
+					b, err := f(line)
+					if err != nil {
+						res.err = fmt.Errorf("line %d: %w", batch.first+int64(j), err)
+						break
+					}
+					buf.Write(b)
+				}
+				res.b = buf.Bytes()
+				res.rows = int64(bytes.Count(res.b, []byte{'\n'}))
+				select {
+				case results <- res:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var (
+		pending = make(map[int]convertedBatch)
+		next    int
+	)
+	for res := range results {
+		pending[res.seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if res.err != nil {
+				return res.err
+			}
+			if err := emit(res.b, res.rows, res.size); err != nil {
+				return err
+			}
+		}
+	}
+	return readErr
+}
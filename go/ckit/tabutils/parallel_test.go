@@ -0,0 +1,53 @@
+package tabutils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConvertLines(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 3*linesPerBatch+7; i++ {
+		fmt.Fprintf(&input, "%d\n", i)
+	}
+	s := strings.TrimSuffix(input.String(), "\n") // missing final newline
+	var (
+		out  bytes.Buffer
+		rows int64
+		size int64
+	)
+	double := func(line []byte) ([]byte, error) {
+		return append(line, line...), nil
+	}
+	err := ConvertLines(strings.NewReader(s), 4, double, func(b []byte, r, n int64) error {
+		out.Write(b)
+		rows += r
+		size += n
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	var want strings.Builder
+	for i := 0; i < 3*linesPerBatch+7; i++ {
+		fmt.Fprintf(&want, "%d\n%d\n", i, i)
+	}
+	if out.String() != want.String() {
+		t.Fatalf("output differs or is out of order")
+	}
+	if rows != 2*(3*linesPerBatch+7) || size != int64(len(s)) {
+		t.Fatalf("got %d rows, %d bytes", rows, size)
+	}
+	fail := func(line []byte) ([]byte, error) {
+		if string(line) == "12345\n" {
+			return nil, fmt.Errorf("broken")
+		}
+		return line, nil
+	}
+	err = ConvertLines(strings.NewReader(s), 4, fail, func(b []byte, r, n int64) error { return nil })
+	if err == nil || err.Error() != "line 12346: broken" {
+		t.Fatalf("got %v, want error at line 12346", err)
+	}
+}
@@ -0,0 +1,98 @@
+package tabutils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Progress keeps track of the number of bytes read and rows processed during
+// a long running import and can estimate the remaining time, if the total
+// input size is known. Thread-safe.
+type Progress struct {
+	Total   int64 // total number of input bytes, 0 if unknown
+	Started time.Time
+
+	bytes int64
+	rows  int64
+}
+
+// NewProgress starts tracking progress.
+func NewProgress(total int64) *Progress {
+	return &Progress{Total: total, Started: time.Now()}
+}
+
+// AddRows records processed rows.
+func (p *Progress) AddRows(n int64) {
+	atomic.AddInt64(&p.rows, n)
+}
+
+// Reader wraps a reader and records the number of bytes read.
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+// ETA returns the estimated remaining time or -1, if it cannot be estimated.
+func (p *Progress) ETA() time.Duration {
+	read := atomic.LoadInt64(&p.bytes)
+	if p.Total <= 0 || read <= 0 {
+		return -1
+	}
+	if read >= p.Total {
+		return 0
+	}
+	elapsed := time.Since(p.Started)
+	return time.Duration(float64(elapsed) * float64(p.Total-read) / float64(read))
+}
+
+// String returns a single line progress report.
+func (p *Progress) String() string {
+	var (
+		read    = atomic.LoadInt64(&p.bytes)
+		rows    = atomic.LoadInt64(&p.rows)
+		elapsed = time.Since(p.Started).Seconds()
+		parts   = []string{
+			fmt.Sprintf("%d rows", rows),
+			fmt.Sprintf("%d rows/s", int64(float64(rows)/elapsed)),
+		}
+	)
+	if p.Total > 0 {
+		parts = append(parts, fmt.Sprintf("read %s/%s (%0.1f%%)",
+			ByteSize(int(read)), ByteSize(int(p.Total)), 100*float64(read)/float64(p.Total)))
+	} else {
+		parts = append(parts, fmt.Sprintf("read %s", ByteSize(int(read))))
+	}
+	parts = append(parts, HumanSpeed(read, elapsed))
+	if eta := p.ETA(); eta >= 0 {
+		parts = append(parts, fmt.Sprintf("eta %s", eta.Round(time.Second)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// Report prints a progress line at the given interval, until done is closed.
+func (p *Progress) Report(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			Flushf("%s", p)
+		case <-done:
+			Flushf("%s", p)
+			return
+		}
+	}
+}
+
+type progressReader struct {
+	r io.Reader
+	p *Progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	atomic.AddInt64(&r.p.bytes, int64(n))
+	return n, err
+}
@@ -0,0 +1,31 @@
+package tabutils
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	p := NewProgress(100)
+	if eta := p.ETA(); eta != -1 {
+		t.Fatalf("got %v, want -1 before reading", eta)
+	}
+	p.Started = time.Now().Add(-10 * time.Second)
+	if _, err := io.CopyN(ioutil.Discard, p.Reader(strings.NewReader(strings.Repeat("x", 100))), 25); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	p.AddRows(5)
+	eta := p.ETA()
+	if eta < 29*time.Second || eta > 31*time.Second {
+		t.Fatalf("got %v, want about 30s", eta)
+	}
+	if s := p.String(); !strings.Contains(s, "5 rows") || !strings.Contains(s, "25.0%") {
+		t.Fatalf("unexpected report: %s", s)
+	}
+	if eta := NewProgress(0).ETA(); eta != -1 {
+		t.Fatalf("got %v, want -1 for unknown total", eta)
+	}
+}
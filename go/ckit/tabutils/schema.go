@@ -0,0 +1,63 @@
+package tabutils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Column is an additional column of the map table, besides k and v.
+type Column struct {
+	Name string
+	Type string
+}
+
+// ParseColumns parses a comma separated list of column names with an
+// optional sqlite3 type, e.g. "oci,creation,timespan:INTEGER"; the default
+// type is TEXT.
+func ParseColumns(s string) ([]Column, error) {
+	var columns []Column
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		c := Column{Name: f, Type: "TEXT"}
+		if i := strings.Index(f, ":"); i >= 0 {
+			c.Name, c.Type = f[:i], strings.ToUpper(f[i+1:])
+		}
+		if !identifierPattern.MatchString(c.Name) || c.Name == "k" || c.Name == "v" {
+			return nil, fmt.Errorf("invalid column name: %q", c.Name)
+		}
+		for _, d := range columns {
+			if d.Name == c.Name {
+				return nil, fmt.Errorf("duplicate column: %q", c.Name)
+			}
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// CreateTableSQL returns the statement to create the map table with a given
+// type for the value column and additional columns. If clustered is true,
+// the table is created as a WITHOUT ROWID table with (k, v) as primary key,
+// which stores rows in key order and makes a separate key index unnecessary.
+func CreateTableSQL(valueType string, columns []Column, clustered bool) string {
+	defs := []string{"k TEXT", "v " + valueType}
+	for _, c := range columns {
+		defs = append(defs, c.Name+" "+c.Type)
+	}
+	if clustered {
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS map (%s, PRIMARY KEY (k, v)) WITHOUT ROWID;",
+			strings.Join(defs, ", "))
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS map (%s);", strings.Join(defs, ", "))
+}
+
+// CreateIndexSQL returns the statement to create an index on a column of the
+// map table, named idx_{column}.
+func CreateIndexSQL(column string) string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s ON map(%s);", column, column)
+}
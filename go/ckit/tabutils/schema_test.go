@@ -0,0 +1,38 @@
+package tabutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	var cases = []struct {
+		s       string
+		columns []Column
+		err     bool
+	}{
+		{"", nil, false},
+		{"oci", []Column{{"oci", "TEXT"}}, false},
+		{"oci, timespan:integer", []Column{{"oci", "TEXT"}, {"timespan", "INTEGER"}}, false},
+		{"v", nil, true},
+		{"a,a", nil, true},
+		{"a b", nil, true},
+	}
+	for _, c := range cases {
+		columns, err := ParseColumns(c.s)
+		if (err != nil) != c.err {
+			t.Fatalf("[%s] got %v, want error=%v", c.s, err, c.err)
+		}
+		if !reflect.DeepEqual(columns, c.columns) {
+			t.Fatalf("[%s] got %v, want %v", c.s, columns, c.columns)
+		}
+	}
+	want := "CREATE TABLE IF NOT EXISTS map (k TEXT, v TEXT, oci TEXT);"
+	if got := CreateTableSQL("TEXT", []Column{{"oci", "TEXT"}}, false); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	want = "CREATE TABLE IF NOT EXISTS map (k TEXT, v TEXT, PRIMARY KEY (k, v)) WITHOUT ROWID;"
+	if got := CreateTableSQL("TEXT", nil, true); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
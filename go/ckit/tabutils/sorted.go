@@ -0,0 +1,51 @@
+package tabutils
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SortedFilter checks, that rows arrive sorted by key and drops duplicate
+// rows, so they can be inserted into a table with (k, v) as primary key. Only
+// keys need to be sorted; duplicates are detected per key. Not thread-safe.
+type SortedFilter struct {
+	lastKey []byte
+	seen    map[string]bool // rows seen for the current key
+	row     int64
+}
+
+// Filter returns the rows without duplicates, the number of remaining rows
+// and an error, if a key is smaller than the previous one.
+func (f *SortedFilter) Filter(b []byte) ([]byte, int64, error) {
+	var (
+		out  = b[:0:0]
+		rows int64
+	)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			i = len(b) - 1
+		}
+		row := b[:i+1]
+		b = b[i+1:]
+		f.row++
+		key := row
+		if j := bytes.IndexByte(row, '\t'); j >= 0 {
+			key = row[:j]
+		}
+		switch c := bytes.Compare(key, f.lastKey); {
+		case c < 0 && f.seen != nil:
+			return nil, 0, fmt.Errorf("input not sorted at row %d: %q after %q", f.row, key, f.lastKey)
+		case c > 0 || f.seen == nil:
+			f.lastKey = append(f.lastKey[:0], key...)
+			f.seen = make(map[string]bool)
+		}
+		if f.seen[string(row)] {
+			continue
+		}
+		f.seen[string(row)] = true
+		out = append(out, row...)
+		rows++
+	}
+	return out, rows, nil
+}
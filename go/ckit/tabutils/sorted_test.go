@@ -0,0 +1,25 @@
+package tabutils
+
+import "testing"
+
+func TestSortedFilter(t *testing.T) {
+	var f SortedFilter
+	b, n, err := f.Filter([]byte("a\t1\na\t2\na\t1\nb\t1\n"))
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if string(b) != "a\t1\na\t2\nb\t1\n" || n != 3 {
+		t.Fatalf("got %q, %d", b, n)
+	}
+	// Duplicates across calls are dropped as well.
+	b, n, err = f.Filter([]byte("b\t1\nc\t1\n"))
+	if err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if string(b) != "c\t1\n" || n != 1 {
+		t.Fatalf("got %q, %d", b, n)
+	}
+	if _, _, err := f.Filter([]byte("a\t1\n")); err == nil {
+		t.Fatalf("expected error for unsorted input")
+	}
+}
@@ -18,6 +18,13 @@ func WithReadOnly(path string) string {
 	return fmt.Sprintf("file:%s?mode=ro", path)
 }
 
+// WithImmutable opens a sqlite database in read-only mode and marks the file
+// as immutable, which disables locking and change detection. Only use this
+// for files that do not change while they are open.
+func WithImmutable(path string) string {
+	return fmt.Sprintf("file:%s?mode=ro&immutable=1", path)
+}
+
 // RunScript runs a script on an sqlite3 database.
 func RunScript(path, script, message string) error {
 	cmd := exec.Command("sqlite3", path)
@@ -83,8 +90,8 @@ func TempFileReader(r io.Reader) (string, error) {
 func Flushf(s string, vs ...interface{}) {
 	t := time.Now().Format("2006/01/02 15:04:05")
 	msg := fmt.Sprintf("\r"+t+" [io] "+s, vs...)
-	fmt.Printf("\r" + strings.Repeat(" ", len(msg)+1))
-	fmt.Printf(msg)
+	fmt.Print("\r" + strings.Repeat(" ", len(msg)+1))
+	fmt.Print(msg)
 }
 
 // HumanSpeed returns a human readable throughput number, e.g. 10MB/s.
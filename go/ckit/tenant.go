@@ -0,0 +1,256 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// TenantKeyHeader is the request header carrying a tenant API key.
+const TenantKeyHeader = "X-API-Key"
+
+var (
+	// ErrUnknownTenant is returned with status 401, if a request carries an
+	// unknown API key, or no tenant could be identified, but one is required.
+	ErrUnknownTenant = errors.New("unknown tenant")
+	// ErrTenantInstitution is returned with status 403, if a request asks
+	// for an institution other than the one configured for its tenant.
+	ErrTenantInstitution = errors.New("institution not allowed for tenant")
+)
+
+// Tenant is a client of a shared server, e.g. a member of a consortium,
+// identified by API key or hostname. A tenant has a default institution,
+// which is used for filtering, if a request does not ask for one, and may
+// have its own field policy and rate limit.
+type Tenant struct {
+	Name string `json:"name"`
+	// Keys are API keys, sent in the X-API-Key header.
+	Keys []string `json:"keys,omitempty"`
+	// Hosts are hostnames (without port) the tenant is served under.
+	Hosts []string `json:"hosts,omitempty"`
+	// ISIL is the default institution, e.g. "DE-14"; requests for other
+	// institutions fail, unless AllowOtherInstitutions is set.
+	ISIL                   string `json:"isil,omitempty"`
+	AllowOtherInstitutions bool   `json:"allow_other_institutions,omitempty"`
+	// AllowFields and DenyFields replace the server field filter for this
+	// tenant, if any is set.
+	AllowFields []string `json:"allow_fields,omitempty"`
+	DenyFields  []string `json:"deny_fields,omitempty"`
+	// Rate is the number of requests per second allowed, with bursts of up
+	// to Burst requests (at least one); zero means no limit.
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+
+	filter *FieldFilter
+	bucket tokenBucket
+}
+
+// RateLimitError is returned with status 429, if a tenant exceeded its rate
+// limit.
+type RateLimitError struct {
+	Tenant     string  `json:"tenant"`
+	Rate       float64 `json:"rate"`
+	RetryAfter string  `json:"retry_after"`
+}
+
+// Error returns the error message.
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %v requests per second exceeded for tenant %s", e.Rate, e.Tenant)
+}
+
+// Tenants maps API keys and hostnames to tenants.
+type Tenants struct {
+	// Require rejects requests, which cannot be attributed to a tenant;
+	// otherwise these are served without any tenant settings.
+	Require bool      `json:"require,omitempty"`
+	List    []*Tenant `json:"tenants"`
+
+	byKey  map[string]*Tenant
+	byHost map[string]*Tenant
+}
+
+// LoadTenants reads a tenant configuration from a JSON file, e.g.
+//
+//	{"require": true, "tenants": [{"name": "slub", "keys": ["..."], "isil": "DE-14"}]}
+func LoadTenants(filename string) (*Tenants, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var t Tenants
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("tenants: %w", err)
+	}
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// NewTenants creates a tenant configuration; keys and hostnames must be
+// unique across tenants.
+func NewTenants(require bool, list ...*Tenant) (*Tenants, error) {
+	t := &Tenants{Require: require, List: list}
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// init builds the lookup tables and validates the configuration.
+func (t *Tenants) init() error {
+	t.byKey = make(map[string]*Tenant)
+	t.byHost = make(map[string]*Tenant)
+	for _, v := range t.List {
+		if v.Name == "" {
+			return fmt.Errorf("tenants: tenant without name")
+		}
+		if v.Rate < 0 || v.Burst < 0 {
+			return fmt.Errorf("tenants: %s: invalid rate limit", v.Name)
+		}
+		for _, k := range v.Keys {
+			if _, ok := t.byKey[k]; ok || k == "" {
+				return fmt.Errorf("tenants: %s: empty or duplicate key", v.Name)
+			}
+			t.byKey[k] = v
+		}
+		for _, h := range v.Hosts {
+			h = strings.ToLower(h)
+			if _, ok := t.byHost[h]; ok || h == "" {
+				return fmt.Errorf("tenants: %s: empty or duplicate host: %s", v.Name, h)
+			}
+			t.byHost[h] = v
+		}
+		if len(v.AllowFields) > 0 || len(v.DenyFields) > 0 {
+			v.filter = &FieldFilter{Allow: v.AllowFields, Deny: v.DenyFields}
+		}
+		v.bucket.rate, v.bucket.burst = v.Rate, float64(v.Burst)
+		if v.bucket.burst < 1 {
+			v.bucket.burst = 1
+		}
+	}
+	return nil
+}
+
+// identify returns the tenant of a request, by API key first, then by
+// hostname; the tenant is nil, if there is none and none is required.
+func (t *Tenants) identify(r *http.Request) (*Tenant, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if key := r.Header.Get(TenantKeyHeader); key != "" {
+		if v, ok := t.byKey[key]; ok {
+			return v, nil
+		}
+		return nil, ErrUnknownTenant
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if v, ok := t.byHost[strings.ToLower(host)]; ok {
+		return v, nil
+	}
+	if t.Require {
+		return nil, ErrUnknownTenant
+	}
+	return nil, nil
+}
+
+// tenantKey is the context key for the tenant of a request.
+type tenantKey struct{}
+
+// tenantFromContext returns the tenant of a request, if any.
+func tenantFromContext(ctx context.Context) *Tenant {
+	v, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return v
+}
+
+// withTenant identifies the tenant of a request, enforces its rate limit
+// and institution and sets its default institution, as if the request
+// contained it. Returns false, if the request has been rejected. As the
+// tenant (and with it institution and fields) depends on the API key,
+// shared caches are told to keep responses apart by key.
+func (s *Server) withTenant(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	w.Header().Add("Vary", TenantKeyHeader)
+	tenant, err := s.Tenants.identify(r)
+	if err != nil {
+		httpErrLog(w, http.StatusUnauthorized, err)
+		return r, false
+	}
+	if tenant == nil {
+		return r, true
+	}
+	if wait := tenant.bucket.take(time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(wait.Seconds()))))
+		httpErrLog(w, http.StatusTooManyRequests, &RateLimitError{
+			Tenant:     tenant.Name,
+			Rate:       tenant.Rate,
+			RetryAfter: wait.Round(time.Millisecond).String(),
+		})
+		return r, false
+	}
+	if tenant.ISIL != "" {
+		q := r.URL.Query()
+		switch v := q.Get("i"); {
+		case v == "":
+			q.Set("i", tenant.ISIL)
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = q.Encode()
+		case v != tenant.ISIL && !tenant.AllowOtherInstitutions:
+			httpErrLog(w, http.StatusForbidden, fmt.Errorf("%w: %s", ErrTenantInstitution, v))
+			return r, false
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)), true
+}
+
+// fieldFilter returns the field filter for a request, the one of its tenant
+// or the server default.
+func (s *Server) fieldFilter(ctx context.Context) *FieldFilter {
+	if t := tenantFromContext(ctx); t != nil && t.filter != nil {
+		return t.filter
+	}
+	return s.FieldFilter
+}
+
+// tokenBucket is a simple token bucket rate limiter; a zero rate means no
+// limit.
+type tokenBucket struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token and returns zero, or the time to wait until the next
+// token is available.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.last.IsZero() {
+		b.tokens = b.burst
+	} else {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,99 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestServerTenants(t *testing.T) {
+	tenants, err := NewTenants(true,
+		&Tenant{Name: "a", Keys: []string{"ka"}, Hosts: []string{"a.example.com"}, ISIL: "DE-1"},
+		&Tenant{Name: "b", Keys: []string{"kb"}, ISIL: "DE-3", AllowOtherInstitutions: true, DenyFields: []string{"institution"}},
+		&Tenant{Name: "c", Keys: []string{"kc"}, Rate: 0.001},
+	)
+	if err != nil {
+		t.Fatalf("tenants: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.Tenants = tenants
+	var cases = []struct {
+		key    string
+		host   string
+		target string
+		status int
+		citing int
+	}{
+		{"ka", "", "/id/i0029", 200, 8},
+		{"", "a.example.com:8000", "/id/i0029", 200, 8},
+		{"ka", "", "/id/i0029?i=DE-1", 200, 8},
+		{"ka", "", "/id/i0029?i=DE-3", 403, 0},
+		{"kb", "", "/id/i0029", 200, 4},
+		{"kb", "", "/id/i0029?i=DE-1", 200, 8},
+		{"kc", "", "/id/i0029", 200, 12},
+		{"kc", "", "/id/i0029", 429, 0},
+		{"kx", "", "/id/i0029", 401, 0},
+		{"", "", "/id/i0029", 401, 0},
+	}
+	for i, c := range cases {
+		req := httptest.NewRequest("GET", c.target, nil)
+		if c.key != "" {
+			req.Header.Set(TenantKeyHeader, c.key)
+		}
+		if c.host != "" {
+			req.Host = c.host
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		if rr.Code != c.status {
+			t.Fatalf("[%d] got %d, want %d: %s", i, rr.Code, c.status, rr.Body.String())
+		}
+		if !SliceContains(rr.Header().Values("Vary"), TenantKeyHeader) {
+			t.Fatalf("[%d] got Vary %v, want %s", i, rr.Header().Values("Vary"), TenantKeyHeader)
+		}
+		if rr.Code != 200 {
+			continue
+		}
+		var resp Response
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("[%d] decode: %v", i, err)
+		}
+		if len(resp.Citing) != c.citing {
+			t.Fatalf("[%d] got %d citing, want %d", i, len(resp.Citing), c.citing)
+		}
+		if c.key == "kb" && strings.Contains(rr.Body.String(), `"institution":[`) {
+			t.Fatalf("[%d] got institution field, want it removed", i)
+		}
+	}
+	if _, err := NewTenants(false, &Tenant{Name: "a", Keys: []string{"k"}}, &Tenant{Name: "b", Keys: []string{"k"}}); err == nil {
+		t.Fatalf("got nil, want error for duplicate key")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	var (
+		b   = tokenBucket{rate: 2, burst: 2}
+		now = time.Now()
+	)
+	for i, c := range []struct {
+		after time.Duration
+		wait  time.Duration
+	}{
+		{0, 0},
+		{0, 0},
+		{0, 500 * time.Millisecond},
+		{250 * time.Millisecond, 250 * time.Millisecond},
+		{250 * time.Millisecond, 0},
+		{10 * time.Second, 0},
+		{0, 0},
+		{0, 500 * time.Millisecond},
+	} {
+		now = now.Add(c.after)
+		if got := b.take(now); got.Round(time.Millisecond) != c.wait {
+			t.Fatalf("[%d] got %v, want %v", i, got, c.wait)
+		}
+	}
+}
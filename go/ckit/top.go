@@ -0,0 +1,199 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// Limits for the top endpoint: the maximum number of documents per request
+// and the number of DOI examined, before giving up on restrictive filters.
+var (
+	MaxTopDocuments = 1000
+	MaxTopScan      = 100000
+)
+
+// TopDocument is a document from the index with its number of citations.
+type TopDocument struct {
+	ID    string          `json:"id"`
+	DOI   string          `json:"doi"`
+	Cited int             `json:"cited"`
+	Doc   json.RawMessage `json:"doc"`
+}
+
+// TopResponse lists the most cited documents in the index.
+type TopResponse struct {
+	Documents []TopDocument `json:"documents"`
+	Extra     struct {
+		N           int      `json:"n"`
+		Institution string   `json:"institution,omitempty"`
+		Sources     []string `json:"source_filter,omitempty"`
+		Year        int      `json:"year,omitempty"`
+		// Scanned is the number of DOI examined; if it reaches MaxTopScan,
+		// there may be fewer than n documents.
+		Scanned int     `json:"scanned"`
+		Took    float64 `json:"took"` // seconds
+	} `json:"extra"`
+}
+
+// topFilter are the filters for the top endpoint.
+type topFilter struct {
+	n           int
+	institution string
+	sources     []string
+	year        int
+}
+
+// parseTopFilter parses query parameters n, i, source and year.
+func parseTopFilter(r *http.Request) (*topFilter, error) {
+	var (
+		q = r.URL.Query()
+		f = &topFilter{n: 100, institution: q.Get("i")}
+	)
+	if v := q.Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxTopDocuments {
+			return nil, fmt.Errorf("n must be between 1 and %d, got %s", MaxTopDocuments, v)
+		}
+		f.n = n
+	}
+	if v := q.Get("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil || year < 1 {
+			return nil, fmt.Errorf("invalid year: %s", v)
+		}
+		f.year = year
+	}
+	for _, v := range strings.Split(q.Get("source"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			f.sources = append(f.sources, v)
+		}
+	}
+	return f, nil
+}
+
+// match returns true, if a document passes the filter.
+func (f *topFilter) match(doc []byte) bool {
+	if f.institution == "" && len(f.sources) == 0 && f.year == 0 {
+		return true
+	}
+	var v docSnippet
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return false
+	}
+	if f.institution != "" && !SliceContains(v.Institution, f.institution) {
+		return false
+	}
+	if len(f.sources) > 0 && !v.hasSource(f.sources) {
+		return false
+	}
+	return f.year == 0 || v.year() == f.year
+}
+
+// handleTop returns the most cited documents in the index, optionally
+// limited to an institution, a set of sources or a publication year; this
+// requires a counts database.
+func (s *Server) handleTop() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.data(r.Context()).CountsDatabase == nil {
+			httpErrLogf(w, http.StatusNotImplemented, "top documents require a counts database")
+			return
+		}
+		f, err := parseTopFilter(r)
+		if err != nil {
+			httpErrLog(w, http.StatusBadRequest, err)
+			return
+		}
+		resp, err := s.top(r.Context(), f)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			httpErrLog(w, http.StatusGatewayTimeout, s.timeoutError(r.Context(), "top",
+				s.LookupTimeout, fmt.Sprintf("found %d documents", len(resp.Documents))))
+			return
+		case err != nil:
+			httpErrLogf(w, http.StatusInternalServerError, "top: %w", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			httpErrLogf(w, http.StatusInternalServerError, "encode: %w", err)
+		}
+	}
+}
+
+// top walks the counts table from the most cited DOI downwards and collects
+// matching documents from the index.
+func (s *Server) top(ctx context.Context, f *topFilter) (*TopResponse, error) {
+	const pageSize = 1000
+	var (
+		started = time.Now()
+		resp    = &TopResponse{Documents: []TopDocument{}}
+		data    = s.data(ctx)
+		query   = data.CountsDatabase.Rebind(
+			"SELECT doi, citing, cited FROM counts WHERE cited > 0 ORDER BY cited DESC, doi LIMIT ? OFFSET ?")
+	)
+	resp.Extra.N, resp.Extra.Institution = f.n, f.institution
+	resp.Extra.Sources, resp.Extra.Year = f.sources, f.year
+	defer func() { resp.Extra.Took = time.Since(started).Seconds() }()
+	for offset := 0; offset < MaxTopScan; offset += pageSize {
+		var counts []Counts
+		if err := data.CountsDatabase.SelectContext(ctx, &counts, query, pageSize, offset); err != nil {
+			return resp, err
+		}
+		if len(counts) == 0 {
+			break
+		}
+		var (
+			dois  = make([]string, len(counts))
+			cited = make(map[string]int)
+		)
+		for i, c := range counts {
+			dois[i], cited[c.DOI] = c.DOI, c.Cited
+		}
+		mctx, cancel := withTimeout(ctx, s.LookupTimeout)
+		ids, err := s.mapToLocal(mctx, dois)
+		cancel()
+		if err != nil {
+			return resp, err
+		}
+		byDOI := make(map[string][]string)
+		for _, v := range ids {
+			if !SliceContains(byDOI[v.Value], v.Key) {
+				byDOI[v.Value] = append(byDOI[v.Value], v.Key)
+			}
+		}
+		for _, doi := range dois {
+			resp.Extra.Scanned++
+			sort.Strings(byDOI[doi])
+			for _, id := range byDOI[doi] {
+				b, err := data.IndexData.Fetch(id)
+				if errors.Is(err, ErrBlobNotFound) {
+					continue
+				}
+				if err != nil {
+					return resp, fmt.Errorf("index data fetch: %w", err)
+				}
+				if !f.match(b) {
+					continue
+				}
+				if ff := s.fieldFilter(ctx); ff != nil {
+					if b, err = ff.Transform(b); err != nil {
+						continue
+					}
+				}
+				resp.Documents = append(resp.Documents, TopDocument{ID: id, DOI: doi, Cited: cited[doi], Doc: b})
+				if len(resp.Documents) == f.n {
+					return resp, nil
+				}
+			}
+		}
+	}
+	return resp, nil
+}
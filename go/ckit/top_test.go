@@ -0,0 +1,69 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestServerTop(t *testing.T) {
+	srv := newTestServer(t)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("GET", "/top", nil))
+	if rr.Code != 501 {
+		t.Fatalf("got %d, want 501 without counts database", rr.Code)
+	}
+	output := filepath.Join(t.TempDir(), "counts.db")
+	if err := BuildCountsDatabase(output, "testdata/doi_doi.db"); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	db, err := OpenDatabase(output)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	srv.CountsDatabase = db
+	var cases = []struct {
+		target string
+		status int
+		count  int
+	}{
+		{"/top?n=5", 200, 5},
+		{"/top?n=5&i=DE-3", 200, 5},
+		{"/top?n=5&i=DE-XXX", 200, 0},
+		{"/top?n=5&year=2020", 200, 0},
+		{"/top?n=0", 400, 0},
+		{"/top?n=100000", 400, 0},
+		{"/top?year=x", 400, 0},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != c.status {
+			t.Fatalf("%s: got %d, want %d", c.target, rr.Code, c.status)
+		}
+		if c.status != 200 {
+			continue
+		}
+		var resp TopResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Documents) != c.count {
+			t.Fatalf("%s: got %d documents, want %d", c.target, len(resp.Documents), c.count)
+		}
+		for i, doc := range resp.Documents {
+			if doc.DOI == "d0156" {
+				t.Fatalf("%s: unmatched DOI in result", c.target)
+			}
+			if i > 0 && doc.Cited > resp.Documents[i-1].Cited {
+				t.Fatalf("%s: not sorted by citations: %v", c.target, resp.Documents)
+			}
+		}
+		if c.count == 0 && resp.Extra.Scanned == 0 {
+			t.Fatalf("%s: nothing scanned", c.target)
+		}
+	}
+}
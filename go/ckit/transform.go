@@ -0,0 +1,135 @@
+package ckit
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// BlobTransform changes an index data blob (a JSON document) before it is
+// used in a response, e.g. to strip internal fields, rename keys or inject
+// fields, so different deployments can serve different document shapes from
+// the same index data.
+type BlobTransform interface {
+	Transform(b []byte) ([]byte, error)
+}
+
+// BlobTransformFunc adapts a function to a BlobTransform, e.g. for computed
+// fields.
+type BlobTransformFunc func(b []byte) ([]byte, error)
+
+// Transform calls f.
+func (f BlobTransformFunc) Transform(b []byte) ([]byte, error) {
+	return f(b)
+}
+
+// TransformFetcher applies transforms, in order, to the blobs fetched from
+// another Fetcher. A blob, which cannot be transformed (e.g. invalid JSON),
+// is passed on unchanged and the error is logged. Wrap it with an
+// LRUFetcher, so cached blobs are transformed only once.
+type TransformFetcher struct {
+	Fetcher    Fetcher
+	Transforms []BlobTransform
+}
+
+// Fetch fetches and transforms a blob.
+func (f *TransformFetcher) Fetch(id string) ([]byte, error) {
+	b, _, err := f.FetchSource(id)
+	return b, err
+}
+
+// FetchSource is like Fetch, but also names the backend of the blob.
+func (f *TransformFetcher) FetchSource(id string) ([]byte, string, error) {
+	b, source, err := fetchSource(f.Fetcher, id)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, t := range f.Transforms {
+		v, err := t.Transform(b)
+		if err != nil {
+			log.Printf("transform (%s): %v", id, err)
+			return b, source, nil
+		}
+		b = v
+	}
+	return b, source, nil
+}
+
+// FieldTransform drops, renames and sets top level fields of a document, in
+// that order. Field order is not preserved.
+type FieldTransform struct {
+	Drop   []string
+	Rename map[string]string // old name to new name
+	Set    map[string]json.RawMessage
+}
+
+// Transform applies the changes to a JSON object.
+func (t *FieldTransform) Transform(b []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for _, k := range t.Drop {
+		delete(fields, k)
+	}
+	for k, name := range t.Rename {
+		if v, ok := fields[k]; ok {
+			delete(fields, k)
+			fields[name] = v
+		}
+	}
+	for k, v := range t.Set {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
+
+// ParseFieldTransform parses a transform given as "op:arguments", one of:
+//
+//	drop:field[,field...]             remove fields
+//	rename:old=new[,old=new...]       rename fields
+//	set:field=value                   set a field to a JSON value or string
+func ParseFieldTransform(s string) (*FieldTransform, error) {
+	op, args, ok := strings.Cut(s, ":")
+	if !ok || args == "" {
+		return nil, fmt.Errorf("transform must be given as op:arguments, got %s", s)
+	}
+	t := &FieldTransform{}
+	switch op {
+	case "drop":
+		for _, k := range strings.Split(args, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				t.Drop = append(t.Drop, k)
+			}
+		}
+	case "rename":
+		t.Rename = make(map[string]string)
+		for _, kv := range strings.Split(args, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+			if !ok || k == "" || v == "" {
+				return nil, fmt.Errorf("rename must be given as old=new, got %s", kv)
+			}
+			t.Rename[k] = v
+		}
+	case "set":
+		k, v, ok := strings.Cut(args, "=")
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return nil, fmt.Errorf("set must be given as field=value, got %s", args)
+		}
+		value := json.RawMessage(v)
+		if !json.Valid(value) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			value = b
+		}
+		t.Set = map[string]json.RawMessage{k: value}
+	default:
+		return nil, fmt.Errorf("unknown transform: %s", op)
+	}
+	return t, nil
+}
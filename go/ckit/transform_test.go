@@ -0,0 +1,72 @@
+package ckit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+)
+
+func TestParseFieldTransform(t *testing.T) {
+	var cases = []struct {
+		spec string
+		doc  string
+		want string
+		err  bool
+	}{
+		{"drop:a,c", `{"a":1,"b":2,"c":3}`, `{"b":2}`, false},
+		{"rename:a=x", `{"a":1,"b":2}`, `{"b":2,"x":1}`, false},
+		{"rename:z=x", `{"a":1}`, `{"a":1}`, false},
+		{"set:x=[1,2]", `{"a":1}`, `{"a":1,"x":[1,2]}`, false},
+		{"set:x=slub", `{"a":1}`, `{"a":1,"x":"slub"}`, false},
+		{"drop", "", "", true},
+		{"rename:a", "", "", true},
+		{"upper:a", "", "", true},
+	}
+	for _, c := range cases {
+		tr, err := ParseFieldTransform(c.spec)
+		if (err != nil) != c.err {
+			t.Fatalf("[%s] got %v, want error %v", c.spec, err, c.err)
+		}
+		if err != nil {
+			continue
+		}
+		b, err := tr.Transform([]byte(c.doc))
+		if err != nil {
+			t.Fatalf("[%s] transform: %v", c.spec, err)
+		}
+		if string(b) != c.want {
+			t.Fatalf("[%s] got %s, want %s", c.spec, b, c.want)
+		}
+	}
+}
+
+func TestTransformFetcher(t *testing.T) {
+	g := &FetchGroup{}
+	if err := g.FromFiles("testdata/id_metadata.db"); err != nil {
+		t.Fatalf("test data: %v", err)
+	}
+	tr, err := ParseFieldTransform("set:provider=slub")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	srv := newTestServer(t)
+	srv.IndexData = &TransformFetcher{Fetcher: g, Transforms: []BlobTransform{tr}}
+	resp := mustRequest(t, srv, "/id/i0029")
+	for _, b := range append(resp.Citing, resp.Cited...) {
+		var doc struct {
+			Provider string `json:"provider"`
+		}
+		if err := json.Unmarshal(b, &doc); err != nil || doc.Provider != "slub" {
+			t.Fatalf("got %s, want provider field", b)
+		}
+	}
+	// Blobs, which cannot be transformed, are passed on unchanged.
+	f := &TransformFetcher{Fetcher: g, Transforms: []BlobTransform{
+		BlobTransformFunc(func(b []byte) ([]byte, error) { return nil, errors.New("invalid") }),
+	}}
+	want, _ := g.Fetch("i0029")
+	if got, err := f.Fetch("i0029"); err != nil || string(got) != string(want) {
+		t.Fatalf("got %s, %v, want %s", got, err, want)
+	}
+}
@@ -0,0 +1,110 @@
+package ckit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Validator allows to check a backing store for structural problems.
+type Validator interface {
+	Validate(integrity bool) error
+}
+
+// ValidateMapDatabase checks, whether a database looks like a database
+// generated by makta: it needs to have a "map" table with "k" and "v" columns,
+// the given indexes (e.g. "idx_k", "idx_v") and at least one row; an index
+// "idx_k" is not required, if the table is clustered by k (as created by
+// makta -sorted). A truncated
+// file from a failed copy will typically fail one of these checks. If
+// integrity is true, a PRAGMA quick_check is run in addition, which can take
+// a long time on large databases. Index and integrity checks are only
+// performed for sqlite3 databases.
+func ValidateMapDatabase(db *sqlx.DB, indexes []string, integrity bool) error {
+	var v []Map
+	if err := db.Select(&v, "SELECT k, v FROM map LIMIT 1"); err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	if len(v) == 0 {
+		return fmt.Errorf("table map is empty")
+	}
+	if !strings.HasPrefix(db.DriverName(), "sqlite3") {
+		return nil
+	}
+	var names []string
+	if err := db.Select(&names,
+		"SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'map'"); err != nil {
+		return fmt.Errorf("indexes: %w", err)
+	}
+	var pk []string
+	if err := db.Select(&pk,
+		"SELECT name FROM pragma_table_info('map') WHERE pk = 1"); err != nil {
+		return fmt.Errorf("primary key: %w", err)
+	}
+	for _, index := range indexes {
+		if SliceContains(names, index) {
+			continue
+		}
+		if len(pk) == 1 && index == "idx_"+pk[0] {
+			continue
+		}
+		return fmt.Errorf("missing index: %s", index)
+	}
+	if !integrity {
+		return nil
+	}
+	var result []string
+	if err := db.Select(&result, "PRAGMA quick_check"); err != nil {
+		return fmt.Errorf("integrity: %w", err)
+	}
+	if len(result) != 1 || result[0] != "ok" {
+		return fmt.Errorf("integrity: %s", strings.Join(result, "; "))
+	}
+	return nil
+}
+
+// Validate checks all configured databases. Identifier and citation databases
+// need indexes on both columns, index data is checked, if it implements
+// Validator.
+func (s *Server) Validate(integrity bool) error {
+	var (
+		d  = s.data(context.Background())
+		kv = []string{"idx_k", "idx_v"}
+	)
+	if err := ValidateMapDatabase(d.IdentifierDatabase, kv, integrity); err != nil {
+		return fmt.Errorf("identifier database: %w", err)
+	}
+	if len(d.OciShards) == 0 && !d.isDegraded(ComponentCitations) {
+		if err := ValidateMapDatabase(d.OciDatabase, kv, integrity); err != nil {
+			return fmt.Errorf("oci database: %w", err)
+		}
+	}
+	for i, db := range d.OciShards {
+		if err := ValidateMapDatabase(db, kv, integrity); err != nil {
+			return fmt.Errorf("oci database shard %d: %w", i, err)
+		}
+	}
+	for _, src := range d.AdditionalOciDatabases {
+		if err := ValidateMapDatabase(src.DB, kv, integrity); err != nil {
+			return fmt.Errorf("oci database %s: %w", src.Name, err)
+		}
+	}
+	for _, ns := range d.Namespaces {
+		if err := ValidateMapDatabase(ns.DB, []string{"idx_k"}, integrity); err != nil {
+			return fmt.Errorf("namespace %s: %w", ns.Name, err)
+		}
+	}
+	if v, ok := d.IndexData.(Validator); ok {
+		if err := v.Validate(integrity); err != nil {
+			return fmt.Errorf("index data: %w", err)
+		}
+	}
+	if d.CountsDatabase != nil {
+		if err := ValidateCountsDatabase(d.CountsDatabase, len(d.ociSources())); err != nil {
+			return fmt.Errorf("counts database: %w", err)
+		}
+	}
+	return nil
+}
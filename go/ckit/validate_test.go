@@ -0,0 +1,62 @@
+package ckit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestValidateMapDatabase(t *testing.T) {
+	db, err := OpenDatabase("testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if err := ValidateMapDatabase(db, []string{"idx_k", "idx_v"}, true); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if err := ValidateMapDatabase(db, []string{"idx_x"}, false); err == nil {
+		t.Fatalf("expected error for missing index")
+	}
+	// A truncated file must not validate.
+	b, err := os.ReadFile("testdata/id_doi.db")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	truncated := filepath.Join(t.TempDir(), "truncated.db")
+	if err := os.WriteFile(truncated, b[:len(b)/2], 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	tdb, err := OpenDatabase(truncated)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer tdb.Close()
+	if err := ValidateMapDatabase(tdb, []string{"idx_k", "idx_v"}, true); err == nil {
+		t.Fatalf("expected error for truncated database")
+	}
+}
+
+func TestValidateMapDatabaseClustered(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "clustered.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for _, q := range []string{
+		"CREATE TABLE map (k TEXT, v TEXT, PRIMARY KEY (k, v)) WITHOUT ROWID",
+		"INSERT INTO map VALUES ('a', 'b')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	if err := ValidateMapDatabase(db, []string{"idx_k"}, false); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if err := ValidateMapDatabase(db, []string{"idx_k", "idx_v"}, false); err == nil {
+		t.Fatalf("expected error for missing index")
+	}
+}
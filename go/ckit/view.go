@@ -0,0 +1,203 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/segmentio/encoding/json"
+)
+
+// viewTemplate renders a fused response as a HTML page, for people checking
+// the data by hand.
+var viewTemplate = template.Must(template.New("view").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }} - labe</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 1em auto; padding: 0 1em; line-height: 1.4; }
+dt { font-weight: bold; float: left; clear: left; width: 8em; }
+dd { margin-left: 9em; }
+.error { color: #a00; }
+.muted { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<form method="get" action="">
+<label>Institution (ISIL) <input name="i" value="{{ .Institution }}" placeholder="e.g. DE-14"></label>
+<button type="submit">Filter</button>
+{{ if .Institution }}<a href="?">show all</a>{{ end }}
+</form>
+{{ if .Error }}<p class="error">{{ .Status }}: {{ .Error }}</p>{{ else }}
+<dl>
+<dt>ID</dt><dd>{{ .ID }}</dd>
+<dt>DOI</dt><dd><a href="https://doi.org/{{ .DOI }}">{{ .DOI }}</a></dd>
+{{ if .Year }}<dt>Year</dt><dd>{{ .Year }}</dd>{{ end }}
+<dt>Citing</dt><dd>{{ .CitingCount }} matched, {{ .UnmatchedCitingCount }} unmatched</dd>
+<dt>Cited</dt><dd>{{ .CitedCount }} matched, {{ .UnmatchedCitedCount }} unmatched</dd>
+<dt>Took</dt><dd>{{ printf "%0.3f" .Took }}s{{ if .Cached }} (cached){{ end }}</dd>
+</dl>
+<p><a href="{{ .JSON }}">JSON</a> | <a href="{{ .Viz }}">citation graph</a></p>
+{{ template "list" .Citing }}
+{{ template "list" .Cited }}
+{{ end }}
+</body>
+</html>
+{{ define "list" }}<h2>{{ .Name }} ({{ len .Matched }} + {{ len .Unmatched }} unmatched)</h2>
+{{ if .Matched }}<ol>{{ range .Matched }}
+<li><a href="{{ .Link }}">{{ .Title }}</a>{{ if .Year }} ({{ .Year }}){{ end }} <span class="muted">{{ .ID }}</span></li>{{ end }}
+</ol>{{ end }}
+{{ if .Unmatched }}<ol class="muted">{{ range .Unmatched }}
+<li><a href="https://doi.org/{{ .DOI }}">{{ .DOI }}</a></li>{{ end }}
+</ol>{{ end }}
+{{ end }}
+`))
+
+// viewDocument is a citing or cited document on the HTML page.
+type viewDocument struct {
+	ID    string
+	DOI   string
+	Title string
+	Year  int
+	Link  string
+}
+
+// viewList is a list of citing or cited documents on the HTML page.
+type viewList struct {
+	Name      string
+	Matched   []viewDocument
+	Unmatched []viewDocument
+}
+
+// viewPage contains the data for the HTML page of a local identifier.
+type viewPage struct {
+	ID          string
+	DOI         string
+	Title       string
+	Year        int
+	Institution string
+	JSON        string
+	Viz         string
+	Status      int
+	Error       string
+
+	CitingCount          int
+	CitedCount           int
+	UnmatchedCitingCount int
+	UnmatchedCitedCount  int
+	Cached               bool
+	Took                 float64
+
+	Citing viewList
+	Cited  viewList
+}
+
+// handleView renders the response for a local identifier as a HTML page,
+// with links to the pages of citing and cited documents and a form for the
+// institution filter. The response is assembled by the same handler as
+// "/id/{id}", with the same query parameters (except format and version).
+func (s *Server) handleView() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			id    = mux.Vars(r)["id"]
+			query = r.URL.Query()
+			page  = &viewPage{ID: id, Title: id, Institution: query.Get("i")}
+		)
+		query.Del("format")
+		query.Del("v")
+		link := "/id/" + url.PathEscape(id)
+		if len(query) > 0 {
+			link += "?" + query.Encode()
+		}
+		page.JSON = link
+		page.Viz = "/viz/" + url.PathEscape(id)
+		// The request has been checked (network, tenant) already, so it goes
+		// to the router directly.
+		req := r.Clone(r.Context())
+		req.URL = localIdentifierURL(id, query.Encode())
+		req.RequestURI = req.URL.RequestURI()
+		req.Header.Set("Accept", "application/json")
+		req.Header.Del("Accept-Encoding")
+		rr := httptest.NewRecorder()
+		s.Router.ServeHTTP(rr, req)
+		page.Status = rr.Code
+		if rr.Code == http.StatusOK {
+			s.fillViewPage(r.Context(), page, rr.Body.Bytes())
+		} else {
+			var msg struct {
+				Err interface{} `json:"err"`
+			}
+			page.Error = http.StatusText(rr.Code)
+			if err := json.Unmarshal(rr.Body.Bytes(), &msg); err == nil {
+				if v, ok := msg.Err.(string); ok && v != "" {
+					page.Error = v
+				}
+			}
+		}
+		var buf bytes.Buffer
+		if err := viewTemplate.Execute(&buf, page); err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(page.Status)
+		w.Write(buf.Bytes())
+	}
+}
+
+// fillViewPage adds the documents of a response to the page.
+func (s *Server) fillViewPage(ctx context.Context, page *viewPage, b []byte) {
+	var resp Response
+	if err := json.Unmarshal(b, &resp); err != nil {
+		page.Status, page.Error = http.StatusInternalServerError, err.Error()
+		return
+	}
+	page.DOI = resp.DOI
+	page.CitingCount, page.CitedCount = resp.Extra.CitingCount, resp.Extra.CitedCount
+	page.UnmatchedCitingCount = resp.Extra.UnmatchedCitingCount
+	page.UnmatchedCitedCount = resp.Extra.UnmatchedCitedCount
+	page.Cached, page.Took = resp.Extra.Cached, resp.Extra.Took
+	if blob, err := s.data(ctx).IndexData.Fetch(resp.ID); err == nil {
+		var snippet docSnippet
+		if json.Unmarshal(blob, &snippet) == nil && snippet.Title.first() != "" {
+			page.Title, page.Year = snippet.Title.first(), snippet.year()
+		}
+	}
+	var suffix string
+	if page.Institution != "" {
+		suffix = "?" + url.Values{"i": {page.Institution}}.Encode()
+	}
+	documents := func(docs []json.RawMessage) (result []viewDocument) {
+		for _, doc := range docs {
+			var snippet docSnippet
+			if err := json.Unmarshal(doc, &snippet); err != nil {
+				continue
+			}
+			v := viewDocument{ID: snippet.ID, Title: snippet.Title.first(), Year: snippet.year()}
+			if len(snippet.DOI) > 0 {
+				v.DOI = snippet.DOI[0]
+			}
+			if v.Title == "" {
+				v.Title = v.ID
+			}
+			if v.ID != "" {
+				v.Link = "/view/" + url.PathEscape(v.ID) + suffix
+			}
+			result = append(result, v)
+		}
+		return result
+	}
+	// Unmatched documents may use another DOI field in responses.
+	var (
+		unmatchedCiting = renameField(resp.Unmatched.Citing, s.unmatchedDOIField(), DefaultDOIField)
+		unmatchedCited  = renameField(resp.Unmatched.Cited, s.unmatchedDOIField(), DefaultDOIField)
+	)
+	page.Citing = viewList{Name: "Citing (references)", Matched: documents(resp.Citing), Unmatched: documents(unmatchedCiting)}
+	page.Cited = viewList{Name: "Cited (cited by)", Matched: documents(resp.Cited), Unmatched: documents(unmatchedCited)}
+}
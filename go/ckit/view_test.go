@@ -0,0 +1,36 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerView(t *testing.T) {
+	srv := newTestServer(t)
+	var cases = []struct {
+		target string
+		status int
+		want   []string
+	}{
+		{"/view/i0029", 200, []string{"<h1>i0029</h1>", "12 matched", "4 matched", `href="/id/i0029"`}},
+		{"/view/i0029?i=DE-1", 200, []string{"8 matched", `value="DE-1"`, `href="/id/i0029?i=DE-1"`}},
+		{"/view/i0029?format=xml", 200, []string{"12 matched"}},
+		{"/view/x", 404, []string{"404: Not Found"}},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != c.status {
+			t.Fatalf("[%s] got %d, want %d", c.target, rr.Code, c.status)
+		}
+		if v := rr.Header().Get("Content-Type"); !strings.HasPrefix(v, "text/html") {
+			t.Fatalf("[%s] got %s, want text/html", c.target, v)
+		}
+		for _, w := range c.want {
+			if !strings.Contains(rr.Body.String(), w) {
+				t.Fatalf("[%s] got %s, want %s", c.target, rr.Body.String(), w)
+			}
+		}
+	}
+}
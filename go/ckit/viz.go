@@ -0,0 +1,208 @@
+package ckit
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// vizMaxNodes is the default number of nodes drawn by the citation graph
+// viewer; the layout is quadratic in the number of nodes.
+const vizMaxNodes = 300
+
+// vizTemplate is a self-contained citation graph viewer, which fetches the
+// citation network of a local identifier and draws it with a simple force
+// layout; no external scripts are required.
+var vizTemplate = template.Must(template.New("viz").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .ID }} - labe</title>
+<style>
+html, body { margin: 0; height: 100%; font-family: sans-serif; }
+header { padding: 0.5em 1em; border-bottom: 1px solid #ddd; }
+#status { color: #666; margin-left: 1em; }
+svg { display: block; width: 100%; height: calc(100% - 3em); cursor: move; }
+line { stroke-opacity: 0.5; }
+line.citing { stroke: #1f77b4; }
+line.cited { stroke: #d62728; }
+line.neighbor { stroke: #aaa; }
+circle { stroke: #fff; stroke-width: 1.5px; cursor: pointer; fill: #999; }
+circle.matched { fill: #2ca02c; }
+circle.center { fill: #ff7f0e; }
+</style>
+</head>
+<body>
+<header>
+<a href="/view/{{ .ID }}">{{ .ID }}</a>
+<span id="status">loading citation network ...</span>
+</header>
+<svg id="graph"></svg>
+<script>
+"use strict";
+(function() {
+	var id = {{ .ID }}, maxNodes = {{ .MaxNodes }},
+		svg = document.getElementById("graph"),
+		status = document.getElementById("status"),
+		ns = "http://www.w3.org/2000/svg";
+	fetch("/id/" + encodeURIComponent(id) + "/network").then(function(r) {
+		if (!r.ok) {
+			throw new Error("network: HTTP " + r.status);
+		}
+		return r.json();
+	}).then(draw).catch(function(err) {
+		status.textContent = err.message;
+	});
+
+	function draw(network) {
+		var width = svg.clientWidth, height = svg.clientHeight,
+			nodes = network.nodes.slice(0, maxNodes), byDOI = {}, edges = [];
+		nodes.forEach(function(n, i) {
+			var a = 2 * Math.PI * i / nodes.length, r = i === 0 ? 0 : Math.min(width, height) / 3;
+			n.x = width / 2 + r * Math.cos(a);
+			n.y = height / 2 + r * Math.sin(a);
+			n.dx = n.dy = 0;
+			byDOI[n.doi] = n;
+		});
+		network.edges.forEach(function(e) {
+			if (byDOI[e.source] && byDOI[e.target] && e.source !== e.target) {
+				edges.push({source: byDOI[e.source], target: byDOI[e.target], type: e.type});
+			}
+		});
+		status.textContent = nodes.length + " of " + network.nodes.length + " nodes, " +
+			edges.length + " of " + network.edges.length + " edges (citing: blue, cited: red, among neighbors: grey)";
+		edges.forEach(function(e) {
+			e.el = document.createElementNS(ns, "line");
+			e.el.setAttribute("class", e.type);
+			svg.appendChild(e.el);
+		});
+		nodes.forEach(function(n, i) {
+			n.el = document.createElementNS(ns, "circle");
+			n.el.setAttribute("r", i === 0 ? 8 : 5);
+			n.el.setAttribute("class", i === 0 ? "center" : (n.ids && n.ids.length ? "matched" : ""));
+			var title = document.createElementNS(ns, "title");
+			title.textContent = (n.title || n.doi) + (n.year ? " (" + n.year + ")" : "") + "\n" + n.doi;
+			n.el.appendChild(title);
+			n.el.addEventListener("pointerdown", function(ev) { drag(ev, n); });
+			n.el.addEventListener("dblclick", function() {
+				if (n.ids && n.ids.length) {
+					window.location = "/viz/" + encodeURIComponent(n.ids[0]);
+				}
+			});
+			svg.appendChild(n.el);
+		});
+		var k = Math.sqrt(width * height / Math.max(nodes.length, 1)) / 2, temperature = width / 10, ticks = 0;
+
+		function tick() {
+			nodes.forEach(function(a) {
+				a.dx = (width / 2 - a.x) * 0.01;
+				a.dy = (height / 2 - a.y) * 0.01;
+				nodes.forEach(function(b) {
+					if (a === b) {
+						return;
+					}
+					var dx = a.x - b.x, dy = a.y - b.y, d = Math.max(Math.sqrt(dx * dx + dy * dy), 0.1), f = k * k / d;
+					a.dx += dx / d * f;
+					a.dy += dy / d * f;
+				});
+			});
+			edges.forEach(function(e) {
+				var dx = e.target.x - e.source.x, dy = e.target.y - e.source.y,
+					d = Math.max(Math.sqrt(dx * dx + dy * dy), 0.1), f = d * d / k;
+				e.source.dx += dx / d * f;
+				e.source.dy += dy / d * f;
+				e.target.dx -= dx / d * f;
+				e.target.dy -= dy / d * f;
+			});
+			nodes.forEach(function(n) {
+				if (n.fixed) {
+					return;
+				}
+				var d = Math.max(Math.sqrt(n.dx * n.dx + n.dy * n.dy), 0.1), m = Math.min(d, temperature);
+				n.x = Math.min(width - 10, Math.max(10, n.x + n.dx / d * m));
+				n.y = Math.min(height - 10, Math.max(10, n.y + n.dy / d * m));
+			});
+			temperature = Math.max(temperature * 0.97, 0.5);
+			render();
+			if (++ticks < 300) {
+				window.requestAnimationFrame(tick);
+			}
+		}
+
+		function render() {
+			edges.forEach(function(e) {
+				e.el.setAttribute("x1", e.source.x);
+				e.el.setAttribute("y1", e.source.y);
+				e.el.setAttribute("x2", e.target.x);
+				e.el.setAttribute("y2", e.target.y);
+			});
+			nodes.forEach(function(n) {
+				n.el.setAttribute("cx", n.x);
+				n.el.setAttribute("cy", n.y);
+			});
+		}
+
+		function drag(ev, n) {
+			var rect = svg.getBoundingClientRect();
+			n.fixed = true;
+			function move(ev) {
+				n.x = ev.clientX - rect.left;
+				n.y = ev.clientY - rect.top;
+				render();
+			}
+			function up() {
+				n.fixed = false;
+				window.removeEventListener("pointermove", move);
+				window.removeEventListener("pointerup", up);
+				if (ticks >= 300) {
+					ticks = 250;
+					temperature = width / 50;
+					window.requestAnimationFrame(tick);
+				}
+			}
+			window.addEventListener("pointermove", move);
+			window.addEventListener("pointerup", up);
+			ev.preventDefault();
+		}
+		tick();
+	}
+})();
+</script>
+</body>
+</html>
+`))
+
+// handleViz serves a citation graph viewer for a local identifier, which
+// draws the response of "/id/{id}/network" in the browser; at most "max"
+// nodes (default 300) are drawn. Double clicking a matched document shows
+// its graph.
+func (s *Server) handleViz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		maxNodes := vizMaxNodes
+		if v := r.URL.Query().Get("max"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				httpErrLogf(w, http.StatusBadRequest, "invalid max: %s", v)
+				return
+			}
+			maxNodes = n
+		}
+		var buf bytes.Buffer
+		err := vizTemplate.Execute(&buf, struct {
+			ID       string
+			MaxNodes int
+		}{
+			ID:       mux.Vars(r)["id"],
+			MaxNodes: maxNodes,
+		})
+		if err != nil {
+			httpErrLog(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,31 @@
+package ckit
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerViz(t *testing.T) {
+	srv := newTestServer(t)
+	var cases = []struct {
+		target string
+		status int
+		want   string
+	}{
+		{"/viz/i0029", 200, `var id = "i0029", maxNodes =  300 `},
+		{"/viz/i0029?max=50", 200, `maxNodes =  50 `},
+		{"/viz/i0029?max=0", 400, ""},
+		{"/viz/%3Cb%3E", 200, `var id = "\u003cb\u003e"`},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest("GET", c.target, nil))
+		if rr.Code != c.status {
+			t.Fatalf("[%s] got %d, want %d", c.target, rr.Code, c.status)
+		}
+		if !strings.Contains(rr.Body.String(), c.want) {
+			t.Fatalf("[%s] got %s, want %s", c.target, rr.Body.String(), c.want)
+		}
+	}
+}
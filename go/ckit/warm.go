@@ -0,0 +1,192 @@
+package ckit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Warmer requests identifiers from a running server, so expensive responses
+// end up in the cache, e.g. after a dataset swap. The server reports cache
+// hits and misses via the X-Cache header. If Handler is set, requests are
+// passed to the handler directly, without a server, e.g. for benchmarks.
+type Warmer struct {
+	Server  string       // base URL, e.g. http://localhost:8000
+	Client  *http.Client // uses http.DefaultClient, if nil
+	Handler http.Handler // optional, requests bypass the network
+	Workers int          // number of parallel requests
+	Rate    float64      // maximum requests per second, 0 means no limit
+}
+
+// WarmStats summarizes a warming run.
+type WarmStats struct {
+	Requests  int
+	Hits      int
+	Misses    int
+	NotFound  int
+	Errors    int
+	Elapsed   time.Duration
+	latencies []time.Duration
+}
+
+// Percentile returns the latency at percentile p (0-100).
+func (ws *WarmStats) Percentile(p float64) time.Duration {
+	if len(ws.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(ws.latencies)-1) * p / 100)
+	return ws.latencies[i]
+}
+
+// String returns a summary.
+func (ws *WarmStats) String() string {
+	var rps float64
+	if ws.Elapsed > 0 {
+		rps = float64(ws.Requests) / ws.Elapsed.Seconds()
+	}
+	return fmt.Sprintf("%d requests in %s (%0.1f/s), %d hit, %d miss, %d not found, %d errors; "+
+		"latency p50 %s, p95 %s, p99 %s, max %s",
+		ws.Requests, ws.Elapsed.Round(time.Millisecond), rps, ws.Hits, ws.Misses, ws.NotFound, ws.Errors,
+		ws.Percentile(50), ws.Percentile(95), ws.Percentile(99), ws.Percentile(100))
+}
+
+// warmResult is the outcome of a single request.
+type warmResult struct {
+	status  int
+	cache   string
+	elapsed time.Duration
+	err     error
+}
+
+// Run reads identifiers, one per line, from r and requests them from the
+// server; empty lines are skipped.
+func (w *Warmer) Run(ctx context.Context, r io.Reader) (*WarmStats, error) {
+	var (
+		client  = w.Client
+		workers = w.Workers
+		ids     = make(chan string)
+		results = make(chan warmResult)
+		stats   = &WarmStats{}
+		wg      sync.WaitGroup
+		done    = make(chan struct{})
+		started = time.Now()
+		tick    <-chan time.Time
+	)
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if w.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / w.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	go func() {
+		for res := range results {
+			stats.Requests++
+			switch {
+			case res.err != nil:
+				stats.Errors++
+				continue
+			case res.status == http.StatusNotFound:
+				stats.NotFound++
+			case res.status != http.StatusOK:
+				stats.Errors++
+			case res.cache == "HIT":
+				stats.Hits++
+			default:
+				stats.Misses++
+			}
+			stats.latencies = append(stats.latencies, res.elapsed)
+		}
+		close(done)
+	}()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				results <- w.request(ctx, client, id)
+			}
+		}()
+	}
+	var (
+		br  = bufio.NewScanner(r)
+		err error
+	)
+	br.Buffer(make([]byte, 64*1024), 1<<20)
+loop:
+	for br.Scan() {
+		id := strings.TrimSpace(br.Text())
+		if id == "" {
+			continue
+		}
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break loop
+			}
+		}
+		select {
+		case ids <- id:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(ids)
+	wg.Wait()
+	close(results)
+	<-done
+	if err = br.Err(); err == nil {
+		err = ctx.Err()
+	}
+	stats.Elapsed = time.Since(started)
+	sort.Slice(stats.latencies, func(i, j int) bool {
+		return stats.latencies[i] < stats.latencies[j]
+	})
+	return stats, err
+}
+
+// request fetches a single identifier and discards the body.
+func (w *Warmer) request(ctx context.Context, client *http.Client, id string) warmResult {
+	link := strings.TrimRight(w.Server, "/") + "/id/" + url.PathEscape(id)
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return warmResult{err: err}
+	}
+	started := time.Now()
+	if w.Handler != nil {
+		rr := httptest.NewRecorder()
+		w.Handler.ServeHTTP(rr, req)
+		return warmResult{
+			status:  rr.Code,
+			cache:   rr.Header().Get("X-Cache"),
+			elapsed: time.Since(started),
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return warmResult{err: err}
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return warmResult{err: err}
+	}
+	return warmResult{
+		status:  resp.StatusCode,
+		cache:   resp.Header.Get("X-Cache"),
+		elapsed: time.Since(started),
+	}
+}
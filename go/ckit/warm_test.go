@@ -0,0 +1,39 @@
+package ckit
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/slub/labe/go/ckit/cache"
+)
+
+func TestWarmer(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := cache.New(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("cache: %v", err)
+	}
+	defer c.Close()
+	srv.Cache = c
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	var (
+		ids = "i0029\ni0029\n\ni0030\nxxxx\n"
+		w   = &Warmer{Server: ts.URL, Workers: 1, Rate: 1000}
+	)
+	stats, err := w.Run(context.Background(), strings.NewReader(ids))
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	// With a zero trigger duration every response gets cached, so the
+	// repeated identifier must be a hit.
+	if stats.Requests != 4 || stats.Hits != 1 || stats.Misses != 2 || stats.NotFound != 1 {
+		t.Fatalf("got %s", stats)
+	}
+	if stats.Percentile(100) < stats.Percentile(50) {
+		t.Fatalf("latencies not sorted: %s", stats)
+	}
+}
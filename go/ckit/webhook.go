@@ -0,0 +1,209 @@
+package ckit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// Webhook event types.
+const (
+	// EventDatasetsReloaded is sent after the datasets have been replaced,
+	// with the reload report.
+	EventDatasetsReloaded = "datasets.reloaded"
+	// EventCacheFlushed is sent after the cache has been emptied.
+	EventCacheFlushed = "cache.flushed"
+	// EventReadinessChanged is sent, when the readiness (as reported by
+	// /readyz) changes, e.g. from "ok" to "degraded".
+	EventReadinessChanged = "readiness.changed"
+)
+
+const (
+	// WebhookSignatureHeader carries the HMAC-SHA256 signature of the
+	// request body, as "sha256=" followed by the hex digest.
+	WebhookSignatureHeader = "X-Labe-Signature"
+	// webhookQueueSize is the number of events waiting for delivery, newer
+	// events are dropped, if the queue is full.
+	webhookQueueSize = 64
+)
+
+// WebhookEvent is the JSON payload sent to webhooks.
+type WebhookEvent struct {
+	Type string      `json:"type"`
+	Time string      `json:"time"`
+	Host string      `json:"host,omitempty"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Webhooks delivers events as JSON POST requests to a list of URLs, in the
+// background and in order, retrying failed deliveries.
+type Webhooks struct {
+	URLs []string
+	// Secret, if set, is used to sign each request, see
+	// WebhookSignatureHeader.
+	Secret string
+	// Client for deliveries, defaults to a client with a 5s timeout.
+	Client *http.Client
+	// Retries is the number of additional attempts per URL.
+	Retries int
+
+	host  string
+	mu    sync.Mutex
+	queue chan WebhookEvent
+	done  chan struct{}
+}
+
+// NewWebhooks starts delivering events to a list of URLs; call Close to
+// deliver pending events and stop.
+func NewWebhooks(urls []string, secret string) *Webhooks {
+	w := &Webhooks{
+		URLs:    urls,
+		Secret:  secret,
+		Retries: 3,
+		queue:   make(chan WebhookEvent, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	w.host, _ = os.Hostname()
+	go w.run(w.queue)
+	return w
+}
+
+// Send queues an event for delivery, without blocking.
+func (w *Webhooks) Send(eventType string, data interface{}) {
+	e := WebhookEvent{
+		Type: eventType,
+		Time: time.Now().UTC().Format(time.RFC3339),
+		Host: w.host,
+		Data: data,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.queue == nil {
+		return
+	}
+	select {
+	case w.queue <- e:
+	default:
+		log.Printf("webhook: queue full, dropping %s event", eventType)
+	}
+}
+
+// Close delivers pending events and stops.
+func (w *Webhooks) Close() {
+	w.mu.Lock()
+	if w.queue != nil {
+		close(w.queue)
+		w.queue = nil
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+// run delivers queued events, until the queue is closed.
+func (w *Webhooks) run(queue <-chan WebhookEvent) {
+	defer close(w.done)
+	for e := range queue {
+		b, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("webhook: %v", err)
+			continue
+		}
+		for _, link := range w.URLs {
+			if err := w.deliver(link, b); err != nil {
+				log.Printf("webhook: %s event to %s: %v", e.Type, link, err)
+			}
+		}
+	}
+}
+
+// deliver posts a payload to a URL, with retries.
+func (w *Webhooks) deliver(link string, b []byte) (err error) {
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	for attempt := 0; attempt <= w.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<uint(attempt-1)) * time.Second)
+		}
+		var req *http.Request
+		if req, err = http.NewRequest("POST", link, bytes.NewReader(b)); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", resolverUserAgent(""))
+		if w.Secret != "" {
+			req.Header.Set(WebhookSignatureHeader, WebhookSignature(w.Secret, b))
+		}
+		var resp *http.Response
+		if resp, err = client.Do(req); err != nil {
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("%s", resp.Status)
+	}
+	return err
+}
+
+// WebhookSignature returns the signature of a payload, for verification by
+// receivers.
+func WebhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify sends an event to the webhooks, if configured.
+func (s *Server) notify(eventType string, data interface{}) {
+	if s.Webhooks != nil {
+		s.Webhooks.Send(eventType, data)
+	}
+}
+
+// WatchReadiness checks the readiness in an interval and notifies the
+// webhooks of changes, until the context is canceled.
+func (s *Server) WatchReadiness(ctx context.Context, interval time.Duration) {
+	check := func() Readiness {
+		d, release := s.acquireDatasets()
+		defer release()
+		readiness, _ := checkReadiness(d)
+		return readiness
+	}
+	var (
+		last   = check()
+		ticker = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := check()
+		if current.Status == last.Status {
+			continue
+		}
+		log.Printf("readiness changed from %s to %s", last.Status, current.Status)
+		s.notify(EventReadinessChanged, struct {
+			Previous string `json:"previous"`
+			Readiness
+		}{last.Status, current})
+		last = current
+	}
+}
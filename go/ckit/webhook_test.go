@@ -0,0 +1,122 @@
+package ckit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// webhookRecorder records events posted to it; the first request fails.
+type webhookRecorder struct {
+	mu       sync.Mutex
+	requests int
+	events   []WebhookEvent
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (rec *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests++
+	if rec.requests == 1 {
+		http.Error(w, "unavailable", 503)
+		return
+	}
+	b, _ := io.ReadAll(r.Body)
+	var e WebhookEvent
+	json.Unmarshal(b, &e)
+	rec.events = append(rec.events, e)
+	rec.bodies = append(rec.bodies, b)
+	rec.headers = append(rec.headers, r.Header)
+}
+
+// types returns the types of the recorded events.
+func (rec *webhookRecorder) types() (result []string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, e := range rec.events {
+		result = append(result, e.Type)
+	}
+	return result
+}
+
+func TestWebhooks(t *testing.T) {
+	rec := &webhookRecorder{}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+	wh := NewWebhooks([]string{ts.URL}, "s3cret")
+	wh.Retries = 1
+	wh.Send(EventCacheFlushed, map[string]string{"reason": "purge"})
+	wh.Send(EventDatasetsReloaded, nil)
+	wh.Close()
+	wh.Send(EventCacheFlushed, nil) // ignored after close
+	if got := rec.types(); len(got) != 2 || got[0] != EventCacheFlushed || got[1] != EventDatasetsReloaded {
+		t.Fatalf("got %v, want events in order, after a retry", got)
+	}
+	if got, want := rec.headers[0].Get(WebhookSignatureHeader), WebhookSignature("s3cret", rec.bodies[0]); got != want {
+		t.Fatalf("got signature %q, want %q", got, want)
+	}
+	if rec.events[0].Time == "" || rec.events[0].Data == nil {
+		t.Fatalf("got %+v, want time and data", rec.events[0])
+	}
+}
+
+func TestServerWebhooks(t *testing.T) {
+	rec := &webhookRecorder{requests: 1}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+	srv := newTestServer(t)
+	srv.Webhooks = NewWebhooks([]string{ts.URL}, "")
+	srv.Reload = func() (*Datasets, error) {
+		a, err := OpenDatabase("testdata/id_doi.db")
+		if err != nil {
+			return nil, err
+		}
+		b, err := OpenDatabase("testdata/doi_doi.db")
+		if err != nil {
+			return nil, err
+		}
+		return &Datasets{IdentifierDatabase: a, OciDatabase: b, IndexData: srv.IndexData}, nil
+	}
+	if _, err := srv.ReloadDatasets(false); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	// Readiness changes, when the citations become unavailable.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.WatchReadiness(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	d := *srv.data(ctx)
+	d.Degraded = []Degradation{{Component: ComponentCitations, Reason: "test"}}
+	srv.current.Store(&datasetsRef{datasets: &d})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.types()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	srv.Webhooks.Close()
+	got := rec.types()
+	if len(got) != 2 || got[0] != EventDatasetsReloaded || got[1] != EventReadinessChanged {
+		t.Fatalf("got %v, want reload and readiness events", got)
+	}
+	var data struct {
+		Previous string `json:"previous"`
+		Status   string `json:"status"`
+	}
+	b, _ := json.Marshal(rec.events[1].Data)
+	if err := json.Unmarshal(b, &data); err != nil || data.Previous != "ok" || data.Status != "degraded" {
+		t.Fatalf("got %s, %v, want change from ok to degraded", b, errors.Unwrap(err))
+	}
+}